@@ -0,0 +1,158 @@
+// Command libinfrared builds the search package as a C shared library, so
+// tools in other languages can build, load and query indexes in-process.
+//
+//	go build -buildmode=c-shared -o libinfrared.so ./cmd/libinfrared
+//
+// Every function returning char* returns a JSON document that the caller must
+// release with FreeString. Failures are reported as {"error": "..."}.
+//
+//	from ctypes import CDLL, c_char_p, c_int, c_void_p, string_at
+//	lib = CDLL("./libinfrared.so")
+//	lib.BuildIndex.restype = c_void_p
+//	lib.Search.restype = c_void_p
+//	ptr = lib.BuildIndex(b"./example/docs", b"")
+//	handle = json.loads(string_at(ptr))["handle"]; lib.FreeString(ptr)
+//	ptr = lib.Search(handle, b"moral law", 5)
+//	results = json.loads(string_at(ptr)); lib.FreeString(ptr)
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+
+	ir "github.com/Eratosthenes/infrared/search"
+)
+
+var (
+	mu      sync.Mutex
+	indexes = make(map[int]*ir.Index)
+	next    = 1
+)
+
+type result struct {
+	Name    string  `json:"name"`
+	Preview string  `json:"preview,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+func main() {}
+
+// BuildIndex indexes the documents in docsDir and, if indexPath is non-empty,
+// saves the index there (gzipped when it ends in .gz, zstd-compressed when
+// it ends in .zst). Returns {"handle": n}.
+//
+//export BuildIndex
+func BuildIndex(docsDir, indexPath *C.char) *C.char {
+	opts := ir.DocOpts{
+		Load: ir.LoadOpts{Path: C.GoString(docsDir), Content: true, LenPreview: 100},
+		Storage: ir.StorageOpts{
+			Path:       C.GoString(indexPath),
+			Compressed: strings.HasSuffix(C.GoString(indexPath), ".gz"),
+		},
+	}
+	if strings.HasSuffix(opts.Storage.Path, ".zst") {
+		opts.Storage.Codec = ir.Zstd
+	}
+	idx, err := ir.NewIndex(context.Background(), ir.DefaultLoader, opts)
+	if err != nil {
+		return errorJSON(err)
+	}
+	if opts.Storage.Path != "" {
+		if err := idx.Save(opts.Storage.Path); err != nil {
+			return errorJSON(err)
+		}
+	}
+	return toJSON(map[string]int{"handle": register(idx)})
+}
+
+// LoadIndex reads a saved index, loading previews from docsDir if it's
+// non-empty. Returns {"handle": n}.
+//
+//export LoadIndex
+func LoadIndex(indexPath, docsDir *C.char) *C.char {
+	file, err := os.Open(C.GoString(indexPath))
+	if err != nil {
+		return errorJSON(err)
+	}
+	defer file.Close()
+
+	opts := ir.DocOpts{Load: ir.LoadOpts{Path: C.GoString(docsDir), Content: true, LenPreview: 100}}
+	var loader ir.Loader
+	if opts.Load.Path != "" {
+		loader = ir.DefaultLoader
+	}
+	idx, err := ir.ReadIndex(context.Background(), file, loader, opts)
+	if err != nil {
+		return errorJSON(err)
+	}
+	return toJSON(map[string]int{"handle": register(idx)})
+}
+
+// Search runs query against the index and returns up to limit results as a
+// JSON array of {"name", "preview", "score"} objects.
+//
+//export Search
+func Search(handle C.int, query *C.char, limit C.int) *C.char {
+	mu.Lock()
+	idx, ok := indexes[int(handle)]
+	mu.Unlock()
+	if !ok {
+		return toJSON(map[string]string{"error": "invalid index handle"})
+	}
+
+	results, err := idx.Search(context.Background(), strings.Fields(C.GoString(query)), ir.SearchOpts{Limit: int(limit)})
+	if err != nil {
+		return errorJSON(err)
+	}
+	out := make([]result, len(results))
+	for i, r := range results {
+		out[i] = result{Name: r.Name, Preview: r.Preview, Score: r.Score}
+	}
+	return toJSON(out)
+}
+
+// FreeIndex releases an index handle.
+//
+//export FreeIndex
+func FreeIndex(handle C.int) {
+	mu.Lock()
+	delete(indexes, int(handle))
+	mu.Unlock()
+}
+
+// FreeString releases a string returned by this library.
+//
+//export FreeString
+func FreeString(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+func register(idx *ir.Index) int {
+	mu.Lock()
+	defer mu.Unlock()
+	h := next
+	next++
+	indexes[h] = idx
+	return h
+}
+
+func toJSON(v any) *C.char {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte(`{"error":"failed to encode result"}`)
+	}
+	return C.CString(string(data))
+}
+
+func errorJSON(err error) *C.char {
+	return toJSON(map[string]string{"error": err.Error()})
+}
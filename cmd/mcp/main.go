@@ -0,0 +1,79 @@
+// Command mcp serves a document directory as Model Context Protocol tools
+// over stdio, so LLM agents can search the corpus and fetch documents.
+//
+// Usage:
+//
+//	mcp [-index path] [-skip-unreadable] [-concurrency n] [-audit path] [docs dir]
+//
+// With -skip-unreadable, files that can't be read are logged and passed over
+// rather than stopping the build. -concurrency caps the goroutines scoring
+// each search, 1 scoring serially; by default large searches use every core.
+// -audit appends a JSON record of every search, with the names of the
+// documents returned, to the file at path, rotating it every 100 MB.
+//
+// Only JSON-RPC messages are written to stdout; diagnostics go to stderr.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Eratosthenes/infrared/mcp"
+	ir "github.com/Eratosthenes/infrared/search"
+)
+
+func main() {
+	indexPath := flag.String("index", "", "load a saved index instead of building one")
+	skipUnreadable := flag.Bool("skip-unreadable", false, "log and skip files that can't be read")
+	concurrency := flag.Int("concurrency", 0, "goroutines scoring each search (0 for up to GOMAXPROCS)")
+	auditPath := flag.String("audit", "", "append a record of every search to this file")
+	flag.Parse()
+
+	opts := ir.DocOpts{
+		Load:    ir.LoadOpts{Path: ".", Content: true},
+		Storage: ir.StorageOpts{Path: *indexPath},
+	}
+	if flag.NArg() > 0 {
+		opts.Load.Path = flag.Arg(0)
+	}
+	if *auditPath != "" {
+		audit, err := ir.OpenAuditLog(*auditPath, 100<<20, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer audit.Close()
+		opts.Audit = audit.Record
+	}
+	if *skipUnreadable {
+		opts.Load.Unreadable = ir.SkipUnreadable
+		opts.Load.Skip = func(path, reason string) {
+			log.Printf("skipped %s: %s", path, reason)
+		}
+	}
+
+	var index *ir.Index
+	if opts.Storage.Path != "" {
+		f, err := os.Open(opts.Storage.Path)
+		if err != nil {
+			log.Fatalf("failed to open index: %v", err)
+		}
+		index, err = ir.ReadIndex(context.Background(), f, ir.DefaultLoader, opts)
+		f.Close()
+		if err != nil {
+			log.Fatalf("failed to load index: %v", err)
+		}
+	} else {
+		var err error
+		if index, err = ir.NewIndex(context.Background(), ir.DefaultLoader, opts); err != nil {
+			log.Fatalf("failed to build index: %v", err)
+		}
+	}
+
+	server := mcp.NewServer(index)
+	server.Concurrency = *concurrency
+	if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,87 @@
+//go:build js && wasm
+
+// Command wasm exposes the search package to JavaScript, so a browser can run
+// exactly the same ranking as the server over a saved index file.
+//
+//	GOOS=js GOARCH=wasm go build -o infrared.wasm ./cmd/wasm
+//
+// It registers a global infrared object with two functions:
+//
+//	const handle = infrared.newIndexFromBytes(new Uint8Array(indexBytes))
+//	const results = JSON.parse(infrared.search(handle, "moral law", 5))
+//
+// Go can't throw into JavaScript, so on failure both return an Error object
+// instead; check results with instanceof Error.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"syscall/js"
+
+	ir "github.com/Eratosthenes/infrared/search"
+)
+
+type result struct {
+	Name    string  `json:"name"`
+	Preview string  `json:"preview,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+var indexes []*ir.Index
+
+func main() {
+	js.Global().Set("infrared", js.ValueOf(map[string]any{
+		"newIndexFromBytes": js.FuncOf(newIndexFromBytes),
+		"search":            js.FuncOf(search),
+	}))
+	select {}
+}
+
+// newIndexFromBytes(bytes: Uint8Array) -> handle: number
+func newIndexFromBytes(this js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		return jsError("newIndexFromBytes: expected a Uint8Array")
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+
+	idx, err := ir.ReadIndex(context.Background(), bytes.NewReader(data), nil, ir.DocOpts{})
+	if err != nil {
+		return jsError("newIndexFromBytes: " + err.Error())
+	}
+	indexes = append(indexes, idx)
+	return len(indexes) - 1
+}
+
+// search(handle: number, query: string, limit: number) -> JSON string
+func search(this js.Value, args []js.Value) any {
+	if len(args) < 3 {
+		return jsError("search: expected handle, query and limit")
+	}
+	h := args[0].Int()
+	if h < 0 || h >= len(indexes) {
+		return jsError("search: invalid index handle")
+	}
+
+	results, err := indexes[h].Search(context.Background(), strings.Fields(args[1].String()), ir.SearchOpts{Limit: args[2].Int()})
+	if err != nil {
+		return jsError("search: " + err.Error())
+	}
+	out := make([]result, len(results))
+	for i, r := range results {
+		out[i] = result{Name: r.Name, Preview: r.Preview, Score: r.Score}
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return jsError("search: " + err.Error())
+	}
+	return string(data)
+}
+
+// jsError returns a JavaScript Error with msg.
+func jsError(msg string) any {
+	return js.Global().Get("Error").New(msg)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -12,23 +13,29 @@ import (
 
 func main() {
 	opts := ir.DocOpts{
-		IndexPath:   "./example/index.gz",
-		LoadPath:    "./example/docs",
-		LoadContent: true,
-		Compressed:  true,
+		Load:    ir.LoadOpts{Path: "./example/docs", Content: true},
+		Storage: ir.StorageOpts{Path: "./example/index.gz", Compressed: true},
+		// report each build phase on stderr
+		Progress: func(p ir.Progress) {
+			if p.Finished {
+				fmt.Fprintf(os.Stderr, "%s: %d done in %v\n", p.Phase, p.Done, p.Elapsed.Round(time.Microsecond))
+			}
+		},
 	}
 
 	// build the index
-	start := time.Now()
-	index := ir.NewIndex(ir.DefaultLoader, opts)
-	elapsed := time.Since(start).Milliseconds()
-	fmt.Printf("Index built in %d milliseconds.\n", elapsed)
+	index, err := ir.NewIndex(context.Background(), ir.DefaultLoader, opts)
+	if err != nil {
+		log.Fatalf("failed to build index: %v", err)
+	}
+	stats := index.Stats()
+	fmt.Printf("Index built in %d milliseconds.\n", stats.BuildTime.Milliseconds())
 
 	// save the index and print its size
-	if err := index.Save(opts.IndexPath); err != nil {
+	if err := index.Save(opts.Storage.Path); err != nil {
 		log.Fatalf("failed to save index: %v", err)
 	}
-	info, err := os.Stat(opts.IndexPath)
+	info, err := os.Stat(opts.Storage.Path)
 	if err != nil {
 		log.Fatalf("failed to stat index file: %v", err)
 	}
@@ -37,14 +44,14 @@ func main() {
 	fmt.Printf("The index file is %.0f KB.\n\n", sizeKB)
 
 	// clean up the index file
-	if err := os.Remove(opts.IndexPath); err != nil {
+	if err := os.Remove(opts.Storage.Path); err != nil {
 		log.Fatalf("failed to remove index file: %v", err)
 	}
 
 	// print index metrics
-	fmt.Printf("Documents: %d\n", index.DocCount())
-	fmt.Printf("Indexed ngrams: %d\n", index.TermCount())
-	fmt.Printf("Total words in corpus: %d\n", index.TotalWords())
+	fmt.Printf("Documents: %d\n", stats.Documents)
+	fmt.Printf("Indexed ngrams: %d\n", stats.Terms)
+	fmt.Printf("Total words in corpus: %d\n", stats.TotalWords)
 	fmt.Println("-------------------------")
 
 	searchAndPrint := func(s string, index *ir.Index) {
@@ -55,7 +62,7 @@ func main() {
 
 		// time the search
 		start := time.Now()
-		results, err := index.Search(terms, ir.SearchOpts{Limit: 5})
+		results, err := index.Search(context.Background(), terms, ir.SearchOpts{Limit: 5})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,225 @@
+// Package mcp exposes a search index to LLM agents as Model Context Protocol
+// tools, using JSON-RPC 2.0 messages over stdio (one message per line).
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	ir "github.com/Eratosthenes/infrared/search"
+)
+
+// protocolVersion is the MCP revision this server implements.
+const protocolVersion = "2024-11-05"
+
+// defaultLimit is the number of search results returned when the caller doesn't ask for a limit.
+const defaultLimit = 10
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Server answers MCP requests against a single index.
+type Server struct {
+	// Concurrency is the number of goroutines scoring each search, as in
+	// ir.SearchOpts; 0 lets large searches use every core
+	Concurrency int
+
+	index *ir.Index
+	name  string
+}
+
+// NewServer returns a server exposing the search and fetch_document tools for idx.
+func NewServer(idx *ir.Index) *Server {
+	return &Server{index: idx, name: "infrared"}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type toolResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+var tools = []tool{
+	{
+		Name:        "search",
+		Description: "Search the document corpus. Returns matching document names with relevance scores in [0, 1] and previews.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "string", "description": "search terms"},
+				"limit": map[string]any{"type": "integer", "description": "maximum number of results", "minimum": 1},
+			},
+			"required": []string{"query"},
+		},
+	},
+	{
+		Name:        "fetch_document",
+		Description: "Fetch the full text of a document by the name returned from search.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name": map[string]any{"type": "string", "description": "document name"},
+			},
+			"required": []string{"name"},
+		},
+	},
+}
+
+// Serve reads requests from r and writes responses to w until r is exhausted.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if resp := s.handle([]byte(line)); resp != nil {
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// handle answers one message. Notifications (requests without an id) get no response.
+func (s *Server) handle(msg []byte) *response {
+	var req request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{codeParseError, err.Error()}}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return &response{JSONRPC: "2.0", ID: idOrNull(req.ID), Error: &rpcError{codeInvalidRequest, "invalid request"}}
+	}
+	if len(req.ID) == 0 {
+		return nil
+	}
+
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case "initialize":
+		resp.Result = map[string]any{
+			"protocolVersion": protocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": s.name, "version": "1.0.0"},
+		}
+	case "ping":
+		resp.Result = map[string]any{}
+	case "tools/list":
+		resp.Result = map[string]any{"tools": tools}
+	case "tools/call":
+		result, err := s.callTool(req.Params)
+		if err != nil {
+			resp.Error = err
+		} else {
+			resp.Result = result
+		}
+	default:
+		resp.Error = &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+	}
+	return resp
+}
+
+func (s *Server) callTool(params json.RawMessage) (*toolResult, *rpcError) {
+	var call struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			Query string `json:"query"`
+			Limit int    `json:"limit"`
+			Name  string `json:"name"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+
+	switch call.Name {
+	case "search":
+		limit := call.Arguments.Limit
+		if limit <= 0 {
+			limit = defaultLimit
+		}
+		results, err := s.index.Search(context.Background(), strings.Fields(call.Arguments.Query), ir.SearchOpts{Limit: limit, Concurrency: s.Concurrency})
+		if err != nil {
+			return errorResult(err.Error()), nil
+		}
+		if len(results) == 0 {
+			return textResult("No documents matched."), nil
+		}
+		var b strings.Builder
+		for _, r := range results {
+			fmt.Fprintf(&b, "%s (score %.3f)\n", r.Name, r.Score)
+			if r.Preview != "" {
+				fmt.Fprintf(&b, "  %s\n", strings.Join(strings.Fields(r.Preview), " "))
+			}
+		}
+		return textResult(b.String()), nil
+	case "fetch_document":
+		doc, ok := s.index.Document(call.Arguments.Name)
+		if !ok {
+			return errorResult("no document named " + call.Arguments.Name), nil
+		}
+		text := doc.Content
+		if text == "" {
+			text = doc.Preview
+		}
+		return textResult(text), nil
+	default:
+		return nil, &rpcError{codeInvalidParams, "unknown tool: " + call.Name}
+	}
+}
+
+func textResult(text string) *toolResult {
+	return &toolResult{Content: []content{{Type: "text", Text: text}}}
+}
+
+func errorResult(text string) *toolResult {
+	return &toolResult{Content: []content{{Type: "text", Text: text}}, IsError: true}
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
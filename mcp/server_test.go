@@ -0,0 +1,78 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	ir "github.com/Eratosthenes/infrared/search"
+)
+
+func TestServe(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pond.txt": {Data: []byte("the pond in winter")},
+		"city.txt": {Data: []byte("the city in summer")},
+	}
+	index, err := ir.NewIndex(context.Background(), ir.DefaultLoader, ir.DocOpts{Load: ir.LoadOpts{FS: fsys, Path: ".", Content: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"search","arguments":{"query":"winter"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"fetch_document","arguments":{"name":"city.txt"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"fetch_document","arguments":{"name":"missing.txt"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/list"}`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := NewServer(index).Serve(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	type reply struct {
+		ID     int
+		Result struct {
+			ProtocolVersion string
+			Tools           []tool
+			Content         []content
+			IsError         bool
+		}
+		Error *rpcError
+	}
+	var resps []reply
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r reply
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, r)
+	}
+	if len(resps) != 6 {
+		t.Fatalf("expected 6 responses (none for the notification), got %d", len(resps))
+	}
+	if resps[0].Result.ProtocolVersion != protocolVersion {
+		t.Errorf("unexpected initialize result %+v", resps[0].Result)
+	}
+	if len(resps[1].Result.Tools) != 2 {
+		t.Errorf("expected 2 tools, got %+v", resps[1].Result.Tools)
+	}
+	if text := resps[2].Result.Content[0].Text; !strings.HasPrefix(text, "pond.txt") {
+		t.Errorf("expected pond.txt first, got %q", text)
+	}
+	if text := resps[3].Result.Content[0].Text; text != "the city in summer" {
+		t.Errorf("unexpected document text %q", text)
+	}
+	if !resps[4].Result.IsError {
+		t.Error("expected a tool error for a missing document")
+	}
+	if resps[5].Error == nil || resps[5].Error.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", resps[5].Error)
+	}
+}
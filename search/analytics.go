@@ -0,0 +1,205 @@
+package search
+
+import (
+	"math"
+	"path"
+	"sort"
+	"time"
+)
+
+// GroupFunc assigns a document to a group such as its directory or a tag.
+// Documents mapped to "" are left out of the report.
+type GroupFunc func(doc Document) string
+
+// ByDir groups documents by the directory part of their name.
+func ByDir(doc Document) string {
+	return path.Dir(doc.Name)
+}
+
+// TermWeight is a term with a report-specific weight.
+type TermWeight struct {
+	Term   string  `json:"term"`
+	Weight float64 `json:"weight"`
+}
+
+// TopTerms returns, for every group, the k terms that most distinguish the
+// group from the whole corpus. A term's weight is its KL-divergence
+// contribution g*log(g/c), where g and c are its mean term frequency inside the
+// group and across all documents; terms that are not over-represented in a
+// group are never reported for it.
+func (idx *Index) TopTerms(group GroupFunc, k int) map[string][]TermWeight {
+	groupOf := make(map[string]string, len(idx.docs))
+	groupSize := make(map[string]int)
+	for name, doc := range idx.docs {
+		if g := group(doc); g != "" {
+			groupOf[name] = g
+			groupSize[g]++
+		}
+	}
+	n := float64(len(idx.docs))
+
+	weights := make(map[string][]TermWeight)
+	for term, tfreq := range idx.tmap {
+		corpus := 0.0
+		inGroup := make(map[string]float64)
+		idx.eachPosting(tfreq, func(name string, tf float64) {
+			corpus += tf
+			if g, ok := groupOf[name]; ok {
+				inGroup[g] += tf
+			}
+		})
+		c := corpus / n
+		for g, sum := range inGroup {
+			mean := sum / float64(groupSize[g])
+			if mean <= c {
+				continue
+			}
+			weights[g] = append(weights[g], TermWeight{Term: term, Weight: mean * math.Log(mean/c)})
+		}
+	}
+
+	for g, ws := range weights {
+		sortWeights(ws)
+		if len(ws) > k {
+			ws = ws[:k]
+		}
+		weights[g] = ws
+	}
+	return weights
+}
+
+// SignificantTerms returns the k terms most unusually frequent in the
+// documents of results, such as those of a search, compared to the whole
+// corpus, heaviest first, to suggest what to refine the search with. Field
+// terms like person:thoreau are included, and can be searched as filters.
+// A term's weight is (f-b)*f/b, where f and b are the fractions of the
+// results and of all documents it's in; terms no more frequent in the
+// results than in the corpus are never reported, nor, when there are
+// several results, terms in only one of them.
+func (idx *Index) SignificantTerms(results []SearchResult, k int) []TermWeight {
+	hits := make(map[string]bool, len(results))
+	for _, r := range results {
+		hits[r.Name] = true
+	}
+	if len(hits) == 0 || len(idx.docs) == 0 {
+		return nil
+	}
+	minHits := min(len(hits), 2)
+	n := float64(len(idx.docs))
+
+	var weights []TermWeight
+	for term, tfreq := range idx.tmap {
+		inHits, inCorpus := 0, 0
+		idx.eachPosting(tfreq, func(name string, _ float64) {
+			inCorpus++
+			if hits[name] {
+				inHits++
+			}
+		})
+		if inHits < minHits {
+			continue
+		}
+		f, b := float64(inHits)/float64(len(hits)), float64(inCorpus)/n
+		if f <= b {
+			continue
+		}
+		weights = append(weights, TermWeight{Term: term, Weight: (f - b) * f / b})
+	}
+	sortWeights(weights)
+	if len(weights) > k {
+		weights = weights[:k]
+	}
+	return weights
+}
+
+// BucketFunc truncates a time to the start of the bucket it falls in.
+type BucketFunc func(t time.Time) time.Time
+
+// ByYear buckets times by calendar year.
+func ByYear(t time.Time) time.Time {
+	return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+}
+
+// ByMonth buckets times by calendar month.
+func ByMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// ByDay buckets times by calendar day.
+func ByDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// TrendPoint reports how a term was used within one date bucket.
+type TrendPoint struct {
+	Bucket    time.Time `json:"bucket"`
+	Docs      int       `json:"docs"`      // documents dated within the bucket
+	Matches   int       `json:"matches"`   // of those, documents containing the term
+	Frequency float64   `json:"frequency"` // mean term frequency over all documents in the bucket
+}
+
+// TermTrend reports the frequency of term over time, bucketing documents by
+// their Date. Documents without a parseable date are skipped. Points are
+// returned in chronological order, including buckets where the term is absent.
+func (idx *Index) TermTrend(term string, bucket BucketFunc) []TrendPoint {
+	postings := idx.postings(idx.tmap[idx.normalizer(term)])
+	points := make(map[time.Time]*TrendPoint)
+	for name, doc := range idx.docs {
+		t, ok := parseDate(doc.Date)
+		if !ok {
+			continue
+		}
+		b := bucket(t)
+		p, ok := points[b]
+		if !ok {
+			p = &TrendPoint{Bucket: b}
+			points[b] = p
+		}
+		p.Docs++
+		if tf, ok := postings[name]; ok {
+			p.Matches++
+			p.Frequency += tf
+		}
+	}
+
+	trend := make([]TrendPoint, 0, len(points))
+	for _, p := range points {
+		p.Frequency /= float64(p.Docs)
+		trend = append(trend, *p)
+	}
+	sort.Slice(trend, func(i, j int) bool {
+		return trend[i].Bucket.Before(trend[j].Bucket)
+	})
+	return trend
+}
+
+// dateLayouts are the Document.Date formats understood by parseDate, starting
+// with the time.Time.String format used by NewDoc.
+var dateLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+}
+
+// parseDate parses a Document.Date in any of the known layouts.
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sortWeights orders weights from heaviest to lightest, breaking ties by term.
+func sortWeights(ws []TermWeight) {
+	sort.Slice(ws, func(i, j int) bool {
+		if ws[i].Weight != ws[j].Weight {
+			return ws[i].Weight > ws[j].Weight
+		}
+		return ws[i].Term < ws[j].Term
+	})
+}
@@ -0,0 +1,85 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memLoader returns a Loader serving fixed documents, filling in Length from the content.
+func memLoader(docs ...Document) Loader {
+	return func(ctx context.Context, opts LoadOpts) ([]Document, error) {
+		for i := range docs {
+			docs[i].Length = len(strings.Fields(docs[i].Content))
+		}
+		return docs, nil
+	}
+}
+
+func TestTopTermsAndTrend(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "2021/a.md", Date: "2021-03-01", Content: "garden tomatoes garden weather"},
+		Document{Name: "2021/b.md", Date: "2021-07-12", Content: "garden harvest weather"},
+		Document{Name: "2022/c.md", Date: "2022-02-03", Content: "office meetings weather"},
+		Document{Name: "2022/d.md", Date: "2022-05-09", Content: "office deadlines garden"},
+		Document{Name: "undated.md", Content: "weather"},
+	), DocOpts{})
+
+	top := index.TopTerms(ByDir, 10)
+	if !hasTerm(top["2021"], "garden") || hasTerm(top["2021"], "office") {
+		t.Errorf("expected garden but not office to distinguish 2021, got %+v", top["2021"])
+	}
+	if !hasTerm(top["2022"], "office") || hasTerm(top["2022"], "garden") {
+		t.Errorf("expected office but not garden to distinguish 2022, got %+v", top["2022"])
+	}
+
+	trend := index.TermTrend("Garden", ByYear)
+	if len(trend) != 2 {
+		t.Fatalf("expected 2 yearly buckets, got %+v", trend)
+	}
+	if !trend[0].Bucket.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)) || trend[0].Matches != 2 || trend[1].Matches != 1 {
+		t.Errorf("unexpected trend %+v", trend)
+	}
+	if trend[0].Frequency <= trend[1].Frequency {
+		t.Errorf("expected garden to decline from 2021 to 2022, got %+v", trend)
+	}
+}
+
+func hasTerm(ws []TermWeight, term string) bool {
+	for _, w := range ws {
+		if w.Term == term {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSignificantTerms(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "a.md", Content: "pond winter ice skating"},
+		Document{Name: "b.md", Content: "pond winter ice fishing"},
+		Document{Name: "c.md", Content: "pond summer swimming heat"},
+		Document{Name: "d.md", Content: "city winter traffic noise"},
+		Document{Name: "e.md", Content: "city summer traffic heat"},
+	), DocOpts{})
+	results, err := index.Search(context.Background(), []string{"ice"}, SearchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := index.SignificantTerms(results, 10)
+	if len(sig) == 0 || !hasTerm(sig, "ice") || !hasTerm(sig, "pond winter") {
+		t.Errorf("expected ice and pond winter to be significant, got %+v", sig)
+	}
+	if hasTerm(sig, "skating") || hasTerm(sig, "city") || hasTerm(sig, "summer") {
+		t.Errorf("expected no terms of one hit or of none, got %+v", sig)
+	}
+	for i := 1; i < len(sig); i++ {
+		if sig[i].Weight > sig[i-1].Weight {
+			t.Errorf("expected the heaviest first, got %+v", sig)
+		}
+	}
+	if got := index.SignificantTerms(nil, 10); got != nil {
+		t.Errorf("expected no terms without results, got %+v", got)
+	}
+}
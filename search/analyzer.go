@@ -0,0 +1,41 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Analyzers are the analyzers that DocOpts.FieldAnalyzers can name. An index
+// saves the names of its field analyzers rather than the functions, so an
+// application with analyzers of its own must add them here, under the same
+// names, before it builds or loads indexes that use them.
+var Analyzers = map[string]Normalizer{
+	"standard": DefaultNormalizer,
+	"keyword":  KeywordAnalyzer,
+}
+
+// KeywordAnalyzer keeps a value whole, only lowercasing it, so tags and
+// paths like "src/search.go" are matched exactly rather than word by word.
+func KeywordAnalyzer(s string) string {
+	return strings.ToLower(s)
+}
+
+// checkFieldAnalyzers reports an analyzer name that isn't in Analyzers.
+func checkFieldAnalyzers(names map[string]string) error {
+	for field, name := range names {
+		if _, ok := Analyzers[name]; !ok {
+			return fmt.Errorf("unknown analyzer %q for field %q", name, field)
+		}
+	}
+	return nil
+}
+
+// fieldValue analyzes a value of the given field for its field term, with
+// the field's analyzer, or the index normalizer if it has none.
+func (idx *Index) fieldValue(field, text string) string {
+	normalize := idx.normalizer
+	if name, ok := idx.fieldAnalyzers[field]; ok {
+		normalize = Analyzers[name]
+	}
+	return strings.Join(strings.Fields(normalize(text)), " ")
+}
@@ -0,0 +1,42 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzerParity(t *testing.T) {
+	content := "Città e LAWS, the Café's menu! Jean-Paul's libraries?"
+	docs := memLoader(
+		Document{Name: "a.md", Content: content},
+		Document{Name: "b.md", Content: "nothing to see here"},
+	)
+	for name, analyzer := range Analyzers {
+		for _, fold := range []bool{false, true} {
+			b := NewIndexBuilder().Source(docs, LoadOpts{}).Analyzer(analyzer)
+			if fold {
+				b.FoldPlurals()
+			}
+			index, err := b.Build(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, word := range index.Analyze(content) {
+				if _, ok := index.tmap[word]; !ok {
+					t.Errorf("%s, folding %v: analyzed word %q isn't indexed", name, fold, word)
+				}
+			}
+			// every word of the document, as written, finds it
+			for _, word := range strings.Fields(content) {
+				results, err := index.Search(context.Background(), []string{word}, SearchOpts{Limit: 5})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(results) != 1 || results[0].Name != "a.md" {
+					t.Errorf("%s, folding %v: expected %q to find a.md, got %+v", name, fold, word, results)
+				}
+			}
+		}
+	}
+}
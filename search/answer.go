@@ -0,0 +1,57 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Answerer extracts an answer to query from passage, the part of doc that
+// best matches it, so a question-answering frontend can be built on a
+// search: a cross-encoder might return the span of passage that answers the
+// query, an LLM a sentence summing it up. It returns "" if the passage
+// doesn't answer the query, and mustn't modify doc, which the index shares.
+// It's called once for each result a search returns, best first, so Limit
+// bounds the calls.
+type Answerer func(query, passage string, doc *Document) (string, error)
+
+// defaultPassageLength is the length of the passage handed to an Answerer,
+// in bytes, if SearchOpts.PassageLength isn't set: a paragraph or so.
+const defaultPassageLength = 600
+
+// answer sets the Answer of each result with opts.Answerer, from the
+// passage of its content matching the most query words, or its preview if
+// it has no content. Results with neither are left without one.
+func (idx *Index) answer(terms []string, results []SearchResult, opts SearchOpts) error {
+	query := strings.Join(terms, " ")
+	words := idx.queryWords(terms)
+	length := opts.PassageLength
+	if length <= 0 {
+		length = defaultPassageLength
+	}
+	for i := range results {
+		passage := passage(results[i].Content, idx.matches(results[i].Content, words), length)
+		if passage == "" {
+			passage = results[i].Preview
+		}
+		if passage == "" {
+			continue
+		}
+		answer, err := opts.Answerer(query, passage, results[i].Document)
+		if err != nil {
+			return fmt.Errorf("failed to extract an answer from %s: %w", results[i].Name, err)
+		}
+		results[i].Answer = answer
+	}
+	return nil
+}
+
+// passage returns the fragment of text of about length bytes with the most
+// distinct words of matches, as the best snippet, or the start of text if
+// nothing matches.
+func passage(text string, matches []Match, length int) string {
+	if s := snippets(text, matches, length, 1, false); len(s) > 0 {
+		return s[0].Text
+	}
+	start, end := window(text, Match{}, length)
+	return text[start:end]
+}
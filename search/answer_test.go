@@ -0,0 +1,57 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAnswerer(t *testing.T) {
+	filler := strings.Repeat("and so on ", 20)
+	index := mustIndex(t, memLoader(
+		Document{Name: "walden.md", Content: "The pond " + filler + "froze over in winter, the pond " + filler + "thawed."},
+		Document{Name: "city.md", Content: "the city streets in winter"},
+		Document{Name: "field.md", Content: "the open field"},
+	), DocOpts{})
+
+	var passages []string
+	answerer := func(query, passage string, doc *Document) (string, error) {
+		if query != "pond winter" {
+			t.Errorf("unexpected query %q", query)
+		}
+		passages = append(passages, passage)
+		if strings.Contains(passage, "froze") {
+			return doc.Name + ": it froze", nil
+		}
+		return "", nil
+	}
+	results, err := index.Search(context.Background(), []string{"pond", "winter"}, SearchOpts{Answerer: answerer, PassageLength: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || len(passages) != 2 {
+		t.Fatalf("expected 2 results and passages, got %+v and %q", results, passages)
+	}
+	for i, r := range results {
+		switch r.Name {
+		case "walden.md":
+			// the passage is the one matching both words
+			if p := passages[i]; !strings.Contains(p, "pond") || !strings.Contains(p, "winter") || len(p) > 60 {
+				t.Errorf("unexpected passage %q", p)
+			}
+			if r.Answer != "walden.md: it froze" {
+				t.Errorf("unexpected answer %q", r.Answer)
+			}
+		case "city.md":
+			if r.Answer != "" {
+				t.Errorf("unexpected answer %q", r.Answer)
+			}
+		}
+	}
+
+	failing := func(string, string, *Document) (string, error) { return "", errors.New("model unavailable") }
+	if _, err := index.Search(context.Background(), []string{"pond"}, SearchOpts{Answerer: failing}); err == nil || !strings.Contains(err.Error(), "model unavailable") {
+		t.Errorf("expected the answerer's error, got %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditFunc records a search of an index, as set with DocOpts.Audit. An
+// AuditLog's Record is one, appending to a file; AuditTo makes one writing
+// to any writer.
+type AuditFunc func(rec AuditRecord) error
+
+// AuditRecord is the audit trail's record of one search: what was asked,
+// by whom, and which documents were returned.
+type AuditRecord struct {
+	Time     time.Time     `json:"time"`
+	Query    []string      `json:"query"`
+	Options  AuditOpts     `json:"options"`
+	Results  []string      `json:"results"` // names of the documents returned, in order
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// AuditOpts are the SearchOpts of an audited search that shape its results.
+// Functions, like Rewriters and an Answerer, are only noted as being set.
+type AuditOpts struct {
+	Limit     int      `json:"limit,omitempty"`
+	Offset    int      `json:"offset,omitempty"`
+	MinScore  float64  `json:"min_score,omitempty"`
+	Ranking   string   `json:"ranking"`
+	Question  bool     `json:"question,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+	Principal string   `json:"principal,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Dirs      []string `json:"dirs,omitempty"`
+	Fields    []string `json:"fields,omitempty"`
+	Snippets  int      `json:"snippets,omitempty"`
+	Summarize bool     `json:"summarize,omitempty"`
+	Answer    bool     `json:"answer,omitempty"`
+	Rerank    bool     `json:"rerank,omitempty"`
+	Rewritten bool     `json:"rewritten,omitempty"`
+}
+
+// auditOpts returns the options of opts to record.
+func auditOpts(opts SearchOpts) AuditOpts {
+	ranking := "tfidf"
+	if opts.Ranking == RankBM25 {
+		ranking = "bm25"
+	}
+	return AuditOpts{
+		Limit:     opts.Limit,
+		Offset:    opts.Offset,
+		MinScore:  opts.MinScore,
+		Ranking:   ranking,
+		Question:  opts.Question,
+		Namespace: opts.Namespace,
+		Principal: opts.Principal,
+		Roles:     opts.Roles,
+		Dirs:      opts.Dirs,
+		Fields:    opts.Fields,
+		Snippets:  opts.SnippetCount,
+		Summarize: opts.Summarize || opts.Summarizer != nil,
+		Answer:    opts.Answerer != nil,
+		Rerank:    opts.Reranker != nil,
+		Rewritten: len(opts.Rewriters) > 0,
+	}
+}
+
+// audited records a search that started at start with the index's
+// AuditFunc, if it has one, and returns its results. A search that can't be
+// recorded fails, so that none goes unrecorded.
+func (idx Index) audited(start time.Time, terms []string, opts SearchOpts, results []SearchResult, err error) ([]SearchResult, error) {
+	if idx.audit == nil {
+		return results, err
+	}
+	rec := AuditRecord{
+		Time:     start,
+		Query:    terms,
+		Options:  auditOpts(opts),
+		Results:  make([]string, len(results)),
+		Duration: time.Since(start),
+	}
+	for i, r := range results {
+		rec.Results[i] = r.Name
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if auditErr := idx.audit(rec); auditErr != nil {
+		return nil, fmt.Errorf("failed to audit search: %w", auditErr)
+	}
+	return results, err
+}
+
+// AuditTo returns an AuditFunc writing each record to w as a line of JSON.
+// It's safe for concurrent use.
+func AuditTo(w io.Writer) AuditFunc {
+	var mu sync.Mutex
+	return func(rec AuditRecord) error {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+}
+
+// AuditLog is an append-only file of AuditRecords, a line of JSON each, for
+// compliance or for evaluating relevance offline. Once the file reaches its
+// size limit it's rotated: renamed with the time of rotation appended, as
+// in audit.log.20240501T100000.000000000, and a new file started. It's safe
+// for concurrent use.
+type AuditLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64 // 0 never rotates
+	keep     int   // rotated files kept, 0 for all
+	file     *os.File
+	size     int64
+	rotation time.Time // of the last rotation, so that no two share a name
+}
+
+// auditStamp is appended to the names of rotated audit logs; it sorts in
+// time order.
+const auditStamp = "20060102T150405.000000000"
+
+// OpenAuditLog opens the audit log at path for appending, creating it if it
+// doesn't exist. It's rotated once it has maxBytes or more, or never if
+// maxBytes is 0, keeping the newest keep rotated files, or all of them if
+// keep is 0.
+func OpenAuditLog(path string, maxBytes int64, keep int) (*AuditLog, error) {
+	l := &AuditLog{path: path, maxBytes: maxBytes, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *AuditLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Record appends rec to the log, rotating it first if it's full. Its
+// method value is the AuditFunc of DocOpts.Audit.
+func (l *AuditLog) Record(rec AuditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return os.ErrClosed
+	}
+	if l.maxBytes > 0 && l.size >= l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// rotate renames the full log, starts a new one, and removes the oldest
+// rotated logs beyond those kept.
+func (l *AuditLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	l.file = nil
+	now := time.Now().UTC()
+	if !now.After(l.rotation) {
+		now = l.rotation.Add(time.Nanosecond)
+	}
+	l.rotation = now
+	rotated := l.path + "." + now.Format(auditStamp)
+	if err := os.Rename(l.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+	if l.keep == 0 {
+		return nil
+	}
+	old := l.rotated()
+	for _, path := range old[:max(len(old)-l.keep, 0)] {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove rotated audit log: %w", err)
+		}
+	}
+	return nil
+}
+
+// rotated returns the paths of the rotated logs, oldest first.
+func (l *AuditLog) rotated() []string {
+	dir, base := filepath.Split(l.path)
+	entries, _ := os.ReadDir(filepath.Clean(dir + "."))
+	var paths []string
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), base+".")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(auditStamp, stamp); err == nil {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Close closes the log file, after which Record fails.
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
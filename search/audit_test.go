@@ -0,0 +1,102 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	var buf bytes.Buffer
+	docs := memLoader(
+		Document{Name: "walden.md", Content: "a winter at the pond"},
+		Document{Name: "city.md", Content: "the city in summer"},
+		Document{Name: "woods.md", Content: "a walk in the woods"},
+	)
+	index := mustIndex(t, docs, DocOpts{Audit: AuditTo(&buf)})
+	results, err := index.Search(context.Background(), []string{"pond"}, SearchOpts{Limit: 5, Principal: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index.Refine(context.Background(), results, []string{"winter"}, SearchOpts{Ranking: RankBM25}); err != nil {
+		t.Fatal(err)
+	}
+
+	var recs []AuditRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(recs))
+	}
+	if rec := recs[0]; rec.Query[0] != "pond" || len(rec.Results) != 1 || rec.Results[0] != "walden.md" ||
+		rec.Options.Limit != 5 || rec.Options.Principal != "alice" || rec.Time.IsZero() {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if rec := recs[1]; rec.Query[0] != "winter" || rec.Options.Ranking != "bm25" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	failing := mustIndex(t, docs, DocOpts{Audit: func(AuditRecord) error { return errors.New("disk full") }})
+	if _, err := failing.Search(context.Background(), []string{"pond"}, SearchOpts{}); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("expected a search that can't be audited to fail, got %v", err)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := OpenAuditLog(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := log.Record(AuditRecord{Query: []string{"pond"}, Results: []string{"walden.md"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Record(AuditRecord{}); err == nil {
+		t.Error("expected recording to a closed log to fail")
+	}
+
+	rotated := log.rotated()
+	if len(rotated) != 2 {
+		t.Errorf("expected 2 rotated logs to be kept, got %v", rotated)
+	}
+	for _, p := range append(rotated, path) {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) == 0 || !bytes.HasSuffix(data, []byte("\n")) {
+			t.Errorf("expected whole records in %s, got %q", p, data)
+		}
+	}
+
+	// reopening appends
+	reopened, err := OpenAuditLog(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(path)
+	if err := reopened.Record(AuditRecord{Query: []string{"city"}}); err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+	if after, _ := os.Stat(path); after.Size() <= before.Size() {
+		t.Error("expected the reopened log to be appended to")
+	}
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	"hash/maphash"
+	"math"
+)
+
+// bloomFalsePositiveRate is the target rate at which the term filter reports
+// an absent term as possibly present.
+const bloomFalsePositiveRate = 0.01
+
+// bloom is a Bloom filter over the terms of an index. It answers "definitely
+// not indexed" without touching the term map, which is most of the cost of
+// a query made of typos or words from another language. It isn't persisted;
+// it's rebuilt from the term map whenever an index is built or loaded.
+type bloom struct {
+	bits []uint64
+	k    uint64
+	seed maphash.Seed
+}
+
+// newBloom returns a filter containing every term of tmap.
+func newBloom(tmap map[string]TermFreq) *bloom {
+	n := max(len(tmap), 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2)))
+	b := &bloom{
+		bits: make([]uint64, (m+63)/64),
+		k:    uint64(max(1, math.Round(float64(m)/float64(n)*math.Ln2))),
+		seed: maphash.MakeSeed(),
+	}
+	for term := range tmap {
+		b.add(term)
+	}
+	return b
+}
+
+// hashes derives the probe sequence (h1 + i*h2) mod m of s from one 64-bit hash.
+func (b *bloom) hashes(s string) (h1, h2, m uint64) {
+	h := maphash.String(b.seed, s)
+	return h & 0xffffffff, h>>32 | 1, uint64(len(b.bits)) * 64
+}
+
+func (b *bloom) add(s string) {
+	h1, h2, m := b.hashes(s)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// mayContain reports whether s may be in the filter. A nil filter may contain anything.
+func (b *bloom) mayContain(s string) bool {
+	if b == nil {
+		return true
+	}
+	h1, h2, m := b.hashes(s)
+	for i := uint64(0); i < b.k; i++ {
+		pos := (h1 + i*h2) % m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
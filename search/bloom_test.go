@@ -0,0 +1,31 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloom(t *testing.T) {
+	tmap := make(map[string]TermFreq)
+	for i := 0; i < 10000; i++ {
+		tmap[fmt.Sprintf("term%d", i)] = TermFreq{}
+	}
+	b := newBloom(tmap)
+	for term := range tmap {
+		if !b.mayContain(term) {
+			t.Fatalf("false negative for %q", term)
+		}
+	}
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if b.mayContain(fmt.Sprintf("absent%d", i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / 10000; rate > 3*bloomFalsePositiveRate {
+		t.Errorf("false positive rate %.3f, want about %.2f", rate, bloomFalsePositiveRate)
+	}
+	if !(*bloom)(nil).mayContain("anything") {
+		t.Error("a nil filter should admit every term")
+	}
+}
@@ -0,0 +1,92 @@
+package search
+
+import "math"
+
+// Ranking is the function that scores documents against a query.
+type Ranking int
+
+const (
+	// RankTFIDF scores a document by the weighted geometric mean of the
+	// normalized tf-idf of the query terms, between 0 and 1.
+	RankTFIDF Ranking = iota
+	// RankBM25 scores a document by Okapi BM25: the sum over the query
+	// terms of their idf times their saturated, length-normalized term
+	// frequency. Scores are unbounded, so MinScore needs picking afresh.
+	RankBM25
+)
+
+// BM25 tunes RankBM25. Nil fields take the usual defaults; they're
+// pointers so that 0, which is meaningful for both, can be chosen.
+type BM25 struct {
+	// K1 is how quickly repeated occurrences of a term stop adding to the
+	// score (default 1.2); 0 ignores how often a term occurs
+	K1 *float64
+	// B is how strongly scores are normalized by document length, from 0
+	// (not at all) to 1 (fully) (default 0.75)
+	B *float64
+}
+
+// bm25 scores documents by BM25 for one query.
+type bm25 struct {
+	k1, b float64
+	avgdl float64   // mean document length in tokens
+	idfs  []float64 // of each query term
+}
+
+// bm25 returns the BM25 scorer of the search over queryTerms, or nil if it
+// doesn't rank by BM25.
+func (opts SearchOpts) bm25(idx *Index, queryTerms []queryTerm) *bm25 {
+	if opts.Ranking != RankBM25 {
+		return nil
+	}
+	s := &bm25{k1: 1.2, b: 0.75, avgdl: idx.avgTokens, idfs: make([]float64, len(queryTerms))}
+	if opts.BM25.K1 != nil {
+		s.k1 = *opts.BM25.K1
+	}
+	if opts.BM25.B != nil {
+		s.b = *opts.BM25.B
+	}
+	// a term repeated in the query, as a short query's n-grams repeat its
+	// words, counts once, at its highest boost; the rest get no idf
+	best := make(map[string]int, len(queryTerms))
+	for i, qt := range queryTerms {
+		if j, ok := best[qt.text]; !ok || qt.boost > queryTerms[j].boost {
+			best[qt.text] = i
+		}
+	}
+	n := float64(len(idx.docs))
+	for _, i := range best {
+		df := float64(len(queryTerms[i].tfs))
+		s.idfs[i] = math.Log(1 + (n-df+0.5)/(df+0.5))
+	}
+	return s
+}
+
+// score returns the BM25 score of the named document.
+func (s *bm25) score(idx *Index, queryTerms []queryTerm, name string) float64 {
+	dl := float64(idx.outliers.length(idx.docs[name]))
+	norm := s.k1 * (1 - s.b + s.b*dl/s.avgdl)
+	score := 0.0
+	for i, qt := range queryTerms {
+		tf, ok := qt.tfs[name]
+		if !ok {
+			continue
+		}
+		count := tf * dl
+		score += s.idfs[i] * qt.boost * count * (s.k1 + 1) / (count + norm)
+	}
+	return score
+}
+
+// meanTokens returns the mean length of the documents, in tokens, with
+// down-weighted outliers counted as MaxTokens long.
+func (idx *Index) meanTokens() float64 {
+	if len(idx.docs) == 0 {
+		return 0
+	}
+	total := 0
+	for _, doc := range idx.docs {
+		total += idx.outliers.length(doc)
+	}
+	return float64(total) / float64(len(idx.docs))
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBM25(t *testing.T) {
+	long := "the law " + strings.Repeat("and the state and the citizen ", 20)
+	index := mustIndex(t, memLoader(
+		Document{Name: "short.md", Content: "the law of the land"},
+		Document{Name: "long.md", Content: long},
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "woods.md", Content: "the woods in winter"},
+	), DocOpts{})
+
+	results, err := index.Search(context.Background(), []string{"law"}, SearchOpts{Limit: 5, Ranking: RankBM25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Name != "short.md" {
+		t.Fatalf("expected the short document first, got %+v", results)
+	}
+	// by hand: idf = ln(1 + (4-2+0.5)/(2+0.5)), one occurrence in 5 tokens
+	avgdl := float64(index.TotalWords()) / 4
+	want := math.Log(2) * 1 * 2.2 / (1 + 1.2*(0.25+0.75*5/avgdl))
+	if math.Abs(results[0].Score-want) > 1e-9 {
+		t.Errorf("expected a BM25 score of %v, got %v", want, results[0].Score)
+	}
+
+	// without length normalization, the long document's one occurrence scores the same
+	zero := 0.0
+	flat, _ := index.Search(context.Background(), []string{"law"}, SearchOpts{Limit: 5, Ranking: RankBM25, BM25: BM25{B: &zero}})
+	if len(flat) != 2 || flat[0].Score != flat[1].Score {
+		t.Errorf("expected equal scores without length normalization, got %+v", flat)
+	}
+	// without term frequency saturation, every matching document scores the idf
+	binary, _ := index.Search(context.Background(), []string{"state"}, SearchOpts{Limit: 5, Ranking: RankBM25, BM25: BM25{K1: &zero}})
+	if want := math.Log(1 + 3.5/1.5); len(binary) != 1 || math.Abs(binary[0].Score-want) > 1e-9 {
+		t.Errorf("expected a score of %v ignoring how often the term occurs, got %+v", want, binary)
+	}
+}
@@ -0,0 +1,202 @@
+package search
+
+import "strings"
+
+// BoolQuery is a boolean combination of query terms, which may be words,
+// quoted phrases or field terms like person:thoreau. A document matches it
+// if it has every term of one of Any and none of the terms of Not. With
+// only Not, every document without its terms matches, and an empty
+// BoolQuery matches none. Queries using AND or NOT parse into one, and a
+// rewriter, as in SearchOpts.Rewriters, may set one to search a query built
+// in code.
+type BoolQuery struct {
+	Any [][]string // alternatives, each of terms a document must all have
+	Not []string   // terms a document mustn't have
+}
+
+// boolean operators, recognized in queries only in upper case, so that the
+// words "and", "or" and "not" are still searched for
+const (
+	opAnd = "AND"
+	opOr  = "OR"
+	opNot = "NOT"
+)
+
+// hasOperators reports whether tokens use AND or NOT. OR alone is what a
+// query does anyway, so it needs no boolean query.
+func hasOperators(tokens []string) bool {
+	for _, tok := range tokens {
+		if tok == opAnd || tok == opNot {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBoolean parses tokens using AND, OR and NOT into q. AND binds more
+// tightly than OR, and terms without an operator between them are ORed, as
+// in a query without operators: "law freedom AND tax" is law OR (freedom
+// AND tax). NOT excludes the term after it from all results, whatever the
+// operators around it. The words of the terms that aren't excluded are
+// among q.Terms and rank the matching documents.
+func (idx *Index) parseBoolean(q *Query, tokens []string) {
+	m := &BoolQuery{}
+	and, not := false, false
+	for _, tok := range tokens {
+		switch tok {
+		case opAnd:
+			and = true
+			continue
+		case opOr:
+			and = false
+			continue
+		case opNot:
+			not = true
+			continue
+		}
+		term, words := idx.boolTerm(tok)
+		switch {
+		case term == "":
+		case not:
+			m.Not = append(m.Not, term)
+		case and && len(m.Any) > 0:
+			last := len(m.Any) - 1
+			m.Any[last] = append(m.Any[last], term)
+		default:
+			m.Any = append(m.Any, []string{term})
+		}
+		if !not {
+			q.Terms = append(q.Terms, words...)
+		}
+		and, not = false, false
+	}
+	q.Match = m
+}
+
+// boolTerm returns the term of a BoolQuery that tok stands for, analyzed
+// as the index analyzes documents, and its words to rank by, or "" if tok
+// has no words. A field term has no words to rank by. A stop word is left
+// out, and so, unless the index has positions to find it by, is a term
+// pruned as too common, whose documents the index no longer knows: it's
+// left out of AND and NOT alike rather than matching nothing.
+func (idx *Index) boolTerm(tok string) (string, []string) {
+	field, value, ok := strings.Cut(tok, ":")
+	if field = strings.ToLower(field); ok && idx.fields[field] {
+		if value = idx.fieldValue(field, value); value != "" {
+			return fieldTerm(field, value), nil
+		}
+		return "", nil
+	}
+	words := idx.Analyze(tok)
+	if len(words) == 1 && idx.stopWords[words[0]] {
+		return "", nil
+	}
+	term := strings.Join(words, " ")
+	if idx.positions == nil && idx.pruned[term] {
+		return "", nil
+	}
+	return term, strings.Fields(tok)
+}
+
+// boolKey returns the cache key of the filter of a BoolQuery.
+func boolKey(m *BoolQuery) string {
+	var b strings.Builder
+	b.WriteString("bool:")
+	for _, terms := range m.Any {
+		b.WriteString(strings.Join(terms, "\x00"))
+		b.WriteByte('\x01')
+	}
+	b.WriteByte('\x02')
+	b.WriteString(strings.Join(m.Not, "\x00"))
+	return b.String()
+}
+
+// boolDocs returns the names of the documents matching m.
+func (idx Index) boolDocs(m *BoolQuery) map[string]bool {
+	docs := make(map[string]bool)
+	if len(m.Any) == 0 && len(m.Not) > 0 {
+		for name := range idx.docs {
+			docs[name] = true
+		}
+	}
+	for _, terms := range m.Any {
+		matching := idx.termDocs(terms[0])
+		for _, term := range terms[1:] {
+			matching = intersect(matching, idx.termDocs(term))
+		}
+		for name := range matching {
+			docs[name] = true
+		}
+	}
+	for _, term := range m.Not {
+		for name := range idx.termDocs(term) {
+			delete(docs, name)
+		}
+	}
+	return docs
+}
+
+// termDocs returns the names of the documents with a term of a BoolQuery.
+// A phrase matches where its words are adjacent, with DocOpts.Positions,
+// or where it's indexed as an n-gram, or else wherever all its words are.
+// Words missing from the term map, as those pruned as too common, are
+// looked up in the positions if there are any. Otherwise the words of a
+// phrase that were pruned are skipped, as its stop words are, and other
+// missing words match nothing.
+func (idx Index) termDocs(term string) map[string]bool {
+	words := strings.Fields(term)
+	if isFieldTerm(term) || len(words) == 1 {
+		return idx.wordDocs(term)
+	}
+	if idx.positions != nil {
+		return idx.phraseDocs(words)
+	}
+	if idx.stopWords != nil {
+		idx.gapStopWords(words)
+	}
+	if tfreq, ok := idx.tmap[strings.Join(words, " ")]; ok {
+		return keys(idx.postings(tfreq))
+	}
+	var docs map[string]bool
+	for _, word := range words {
+		switch {
+		case word == gap, idx.pruned[word]:
+		case docs == nil:
+			docs = idx.wordDocs(word)
+		default:
+			docs = intersect(docs, idx.wordDocs(word))
+		}
+	}
+	return docs
+}
+
+// wordDocs returns the names of the documents with an indexed term.
+func (idx Index) wordDocs(term string) map[string]bool {
+	if tfreq, ok := idx.tmap[term]; ok {
+		return keys(idx.postings(tfreq))
+	}
+	docs := make(map[string]bool, len(idx.positions[term]))
+	for name := range idx.positions[term] {
+		docs[name] = true
+	}
+	return docs
+}
+
+// keys returns the document names of postings as a set.
+func keys(postings map[string]float64) map[string]bool {
+	docs := make(map[string]bool, len(postings))
+	for name := range postings {
+		docs[name] = true
+	}
+	return docs
+}
+
+// intersect returns the names in both a and b, reusing a.
+func intersect(a, b map[string]bool) map[string]bool {
+	for name := range a {
+		if !b[name] {
+			delete(a, name)
+		}
+	}
+	return a
+}
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestBooleanQuery(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "both.md", Content: "the law of freedom for all"},
+		Document{Name: "taxed.md", Content: "law and freedom and tax"},
+		Document{Name: "law.md", Content: "the law of the land"},
+		Document{Name: "sky.md", Content: "the starry sky above us"},
+		Document{Name: "walden.md", Content: "Henry Thoreau at the pond"},
+	)
+	index := mustIndex(t, docs, DocOpts{Entities: Gazetteer{"Henry Thoreau": "person"}})
+	for query, want := range map[string][]string{
+		"law AND freedom":                          {"both.md", "taxed.md"},
+		"law AND freedom NOT tax":                  {"both.md"},
+		"law NOT freedom":                          {"law.md"},
+		"sky OR law AND land":                      {"law.md", "sky.md"},
+		"land sky AND starry":                      {"law.md", "sky.md"},
+		"NOT law":                                  {"sky.md", "walden.md"},
+		`person:"henry thoreau" OR sky AND starry`: {"sky.md", "walden.md"},
+		`"law of the" AND land`:                    {"law.md"},
+		"law AND nothing":                          nil,
+		"AND":                                      nil,
+		"OR":                                       nil,
+		"NOT":                                      nil,
+		"AND NOT":                                  nil,
+	} {
+		if got := phraseResults(t, index, query); !slices.Equal(got, want) {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+
+	// lowercase operators are words
+	if got := phraseResults(t, index, "law and freedom"); len(got) != 3 {
+		t.Errorf("expected lowercase and to be a word, got %v", got)
+	}
+
+	// a structured query set by a rewriter
+	results, err := index.Search(context.Background(), nil, SearchOpts{Rewriters: []func(Query) Query{
+		func(q Query) Query {
+			q.Terms = []string{"law"}
+			q.Match = &BoolQuery{Any: [][]string{{"law"}}, Not: []string{"tax", "land"}}
+			return q
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "both.md" {
+		t.Errorf("expected both.md, got %+v", results)
+	}
+}
+
+func TestBooleanPrunedTerm(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "both.md", Content: "the law of freedom"},
+		Document{Name: "law.md", Content: "the law of the land"},
+		Document{Name: "sky.md", Content: "the starry sky"},
+	)
+	// "the" is in every document, and so pruned; without positions it's
+	// left out of the query, whether ANDed or NOTed
+	index := mustIndex(t, docs, DocOpts{})
+	if !index.pruned["the"] {
+		t.Fatal("expected the to be pruned")
+	}
+	for query, want := range map[string][]string{
+		"law AND the":      {"both.md", "law.md"},
+		"law NOT the":      {"both.md", "law.md"},
+		"law AND NOT the":  {"both.md", "law.md"},
+		`"law the" AND of`: {"both.md", "law.md"},
+		"NOT the":          nil,
+	} {
+		if got := phraseResults(t, index, query); !slices.Equal(got, want) {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+
+	// positions still know where it is
+	index = mustIndex(t, docs, DocOpts{Positions: true})
+	for query, want := range map[string][]string{
+		"law AND the": {"both.md", "law.md"},
+		"law NOT the": nil,
+	} {
+		if got := phraseResults(t, index, query); !slices.Equal(got, want) {
+			t.Errorf("positions, %q: expected %v, got %v", query, want, got)
+		}
+	}
+}
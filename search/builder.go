@@ -0,0 +1,244 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// IndexBuilder configures and builds an index in separate steps:
+//
+//	idx, err := search.NewIndexBuilder().
+//		Source(search.DefaultLoader, search.LoadOpts{Path: "./docs", Content: true}).
+//		Analyzer(search.DefaultNormalizer).
+//		Ngrams(1, 3).
+//		Workers(8).
+//		Build(ctx)
+//
+// Configuration errors are collected along the way and returned by Build.
+// The analyzer and n-gram range aren't saved with the index, so an index
+// built with non-default ones must be searched with an index configured the
+// same way.
+type IndexBuilder struct {
+	loader     Loader
+	opts       DocOpts
+	normalizer Normalizer
+	ngrams     ngramRange
+	workers    int
+	err        error
+}
+
+// NewIndexBuilder returns a builder with the same defaults as NewIndex.
+func NewIndexBuilder() *IndexBuilder {
+	return &IndexBuilder{normalizer: DefaultNormalizer, ngrams: defaultNGrams}
+}
+
+// Source sets the loader that provides the documents, and the options passed to it.
+func (b *IndexBuilder) Source(loader Loader, opts LoadOpts) *IndexBuilder {
+	b.loader, b.opts.Load = loader, opts
+	return b
+}
+
+// Storage sets how the built index is saved by Save.
+func (b *IndexBuilder) Storage(opts StorageOpts) *IndexBuilder {
+	b.opts.Storage = opts
+	return b
+}
+
+// Analyzer sets the normalizer that documents are passed through before
+// they're split into words.
+func (b *IndexBuilder) Analyzer(normalizer Normalizer) *IndexBuilder {
+	if normalizer == nil {
+		b.fail(fmt.Errorf("nil analyzer"))
+		return b
+	}
+	b.normalizer = normalizer
+	return b
+}
+
+// Ngrams sets the range of n-gram lengths that are indexed. The default is 1 to 3.
+func (b *IndexBuilder) Ngrams(min, max int) *IndexBuilder {
+	if min < 1 || max < min {
+		b.fail(fmt.Errorf("invalid n-gram range %d to %d", min, max))
+		return b
+	}
+	b.ngrams = ngramRange{min, max}
+	return b
+}
+
+// Workers sets the number of goroutines that tokenize documents. The
+// default is up to GOMAXPROCS, as for DocOpts.Workers.
+func (b *IndexBuilder) Workers(n int) *IndexBuilder {
+	if n < 1 {
+		b.fail(fmt.Errorf("invalid worker count %d", n))
+		return b
+	}
+	b.workers = n
+	return b
+}
+
+// Expansions sets the dictionary of equivalent phrases.
+func (b *IndexBuilder) Expansions(dict Expansions) *IndexBuilder {
+	b.opts.Expansions = dict
+	return b
+}
+
+// Entities sets the extractor whose entities are indexed as fields.
+func (b *IndexBuilder) Entities(extractor EntityExtractor) *IndexBuilder {
+	b.opts.Entities = extractor
+	return b
+}
+
+// CompactPostings stores postings as delta-encoded varints.
+func (b *IndexBuilder) CompactPostings() *IndexBuilder {
+	b.opts.CompactPostings = true
+	return b
+}
+
+// MemoryBudget spills the term map to segment files in dir whenever it
+// grows past bytes during the build. An empty dir means os.TempDir.
+func (b *IndexBuilder) MemoryBudget(bytes int64, dir string) *IndexBuilder {
+	b.opts.MemoryBudget, b.opts.SpillDir = bytes, dir
+	return b
+}
+
+// Stopwords drops the terms in more than ratio of the documents or, if
+// weight is positive, scales their weight in scores by it.
+func (b *IndexBuilder) Stopwords(ratio, weight float64) *IndexBuilder {
+	if ratio <= 0 || ratio > 1 || weight < 0 || weight > 1 {
+		b.fail(fmt.Errorf("invalid stopword ratio %g or weight %g", ratio, weight))
+		return b
+	}
+	b.opts.StopwordRatio, b.opts.StopwordWeight = ratio, weight
+	return b
+}
+
+// FoldPlurals indexes and searches plurals as their singular.
+func (b *IndexBuilder) FoldPlurals() *IndexBuilder {
+	b.opts.FoldPlurals = true
+	return b
+}
+
+// FoldDiacritics indexes and searches accented letters without their accents.
+func (b *IndexBuilder) FoldDiacritics() *IndexBuilder {
+	b.opts.FoldDiacritics = true
+	return b
+}
+
+// Report keeps a BuildReport of the build, saved next to the index by Save.
+func (b *IndexBuilder) Report() *IndexBuilder {
+	b.opts.Report = true
+	return b
+}
+
+// StopWords removes words from documents and queries, leaving gaps in n-grams.
+func (b *IndexBuilder) StopWords(words ...string) *IndexBuilder {
+	b.opts.StopWords = append(b.opts.StopWords, words...)
+	return b
+}
+
+// SentenceNGrams stops n-grams at sentence and paragraph boundaries.
+func (b *IndexBuilder) SentenceNGrams() *IndexBuilder {
+	b.opts.SentenceNGrams = true
+	return b
+}
+
+// FieldAnalyzer sets the analyzer, by its name in Analyzers, of an entity field.
+func (b *IndexBuilder) FieldAnalyzer(field, analyzer string) *IndexBuilder {
+	if _, ok := Analyzers[analyzer]; !ok {
+		b.fail(fmt.Errorf("unknown analyzer %q for field %q", analyzer, field))
+		return b
+	}
+	if b.opts.FieldAnalyzers == nil {
+		b.opts.FieldAnalyzers = make(map[string]string)
+	}
+	b.opts.FieldAnalyzers[field] = analyzer
+	return b
+}
+
+// Limits caps the work of each search of the index.
+func (b *IndexBuilder) Limits(limits Limits) *IndexBuilder {
+	b.opts.Limits = limits
+	return b
+}
+
+// Outliers sets how documents far longer than the rest are indexed.
+func (b *IndexBuilder) Outliers(outliers Outliers) *IndexBuilder {
+	b.opts.Outliers = outliers
+	return b
+}
+
+// Transform adds transforms applied to each document before it's indexed.
+func (b *IndexBuilder) Transform(transforms ...Transform) *IndexBuilder {
+	b.opts.Transform = append(b.opts.Transform, transforms...)
+	return b
+}
+
+// FilterCache keeps the documents of the size most recently used filters.
+func (b *IndexBuilder) FilterCache(size int) *IndexBuilder {
+	b.opts.FilterCache = size
+	return b
+}
+
+// WithholdText keeps the text of documents out of search results and
+// Document; see DocOpts.WithholdText.
+func (b *IndexBuilder) WithholdText() *IndexBuilder {
+	b.opts.WithholdText = true
+	return b
+}
+
+// Audit records every search of the index with fn; see DocOpts.Audit.
+func (b *IndexBuilder) Audit(fn AuditFunc) *IndexBuilder {
+	b.opts.Audit = fn
+	return b
+}
+
+// Positions keeps word positions, for exact phrase queries; see
+// DocOpts.Positions.
+func (b *IndexBuilder) Positions() *IndexBuilder {
+	b.opts.Positions = true
+	return b
+}
+
+// Progress sets a function that's called as each build phase starts, advances and finishes.
+func (b *IndexBuilder) Progress(fn ProgressFunc) *IndexBuilder {
+	b.opts.Progress = fn
+	return b
+}
+
+func (b *IndexBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Build loads the documents and builds the index. It returns early with
+// ctx's error if ctx is done before the index is built, and ErrEmptyCorpus
+// if the source has no documents.
+func (b *IndexBuilder) Build(ctx context.Context) (*Index, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.loader == nil {
+		return nil, fmt.Errorf("no document source")
+	}
+	start := time.Now()
+	idx := &Index{normalizer: b.normalizer, ngrams: b.ngrams, workers: b.workers}
+	if err := idx.configure(b.opts); err != nil {
+		return nil, err
+	}
+	if err := idx.populate(ctx, b.loader, b.opts); err != nil {
+		return nil, err
+	}
+	if len(idx.docs) == 0 {
+		return nil, ErrEmptyCorpus
+	}
+	if err := idx.build(ctx); err != nil {
+		return nil, err
+	}
+	idx.buildTime = time.Since(start)
+	if idx.report != nil {
+		idx.report.finish(idx)
+	}
+	return idx, nil
+}
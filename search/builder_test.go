@@ -0,0 +1,82 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIndexBuilder(t *testing.T) {
+	opts := DocOpts{Load: LoadOpts{Path: "../example/docs", Content: true}}
+	want := mustIndex(t, DefaultLoader, opts)
+
+	idx, err := NewIndexBuilder().Source(DefaultLoader, opts.Load).Workers(4).Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.TermCount() != want.TermCount() {
+		t.Errorf("parallel build: got %d terms, want %d", idx.TermCount(), want.TermCount())
+	}
+	results, _ := idx.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 1})
+	if len(results) != 1 || results[0].Name != "civil_disobedience.txt" {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	unigrams, err := NewIndexBuilder().Source(DefaultLoader, opts.Load).Ngrams(1, 1).Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for term := range unigrams.tmap {
+		if strings.Contains(term, " ") {
+			t.Fatalf("unexpected n-gram %q in a unigram index", term)
+		}
+	}
+
+	if _, err := NewIndexBuilder().Source(DefaultLoader, opts.Load).Ngrams(3, 2).Workers(0).Build(context.Background()); err == nil {
+		t.Error("expected an error for an invalid n-gram range")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewIndexBuilder().Source(DefaultLoader, opts.Load).Build(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBuildProgress(t *testing.T) {
+	var mu sync.Mutex
+	finished := make(map[Phase]Progress)
+	var order []Phase
+	_, err := NewIndexBuilder().
+		Source(DefaultLoader, LoadOpts{Path: "../example/docs", Content: true}).
+		Workers(2).
+		Progress(func(p Progress) {
+			mu.Lock()
+			defer mu.Unlock()
+			if p.Finished {
+				finished[p.Phase] = p
+				order = append(order, p.Phase)
+			}
+		}).
+		Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Phase{PhaseLoad, PhaseTokenize, PhasePostings, PhaseIDF}
+	if len(order) != len(want) {
+		t.Fatalf("got phases %v, want %v", order, want)
+	}
+	for i, phase := range want {
+		if order[i] != phase {
+			t.Fatalf("got phases %v, want %v", order, want)
+		}
+	}
+	if p := finished[PhaseTokenize]; p.Done != 4 || p.Total != 4 {
+		t.Errorf("tokenized %d of %d documents, want 4 of 4", p.Done, p.Total)
+	}
+	if p := finished[PhaseIDF]; p.Done == 0 || p.Done != p.Total {
+		t.Errorf("weighed %d of %d terms", p.Done, p.Total)
+	}
+}
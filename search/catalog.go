@@ -0,0 +1,240 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// aliasesFile is the file of a catalog directory mapping aliases to index names.
+const aliasesFile = "aliases.json"
+
+// Catalog hosts several named indexes, such as "blog", "docs" and "notes",
+// each served by its own IndexManager, along with aliases that point at
+// them. Repointing an alias is atomic: searches started before it finish on
+// the old index, and later ones use the new one, so a freshly built
+// "blog-2024-06-01" can be swapped in behind the alias "blog".
+//
+// Aliases point at indexes, not at other aliases, and an alias can't share a
+// name with an index.
+type Catalog struct {
+	mu      sync.RWMutex
+	indexes map[string]*IndexManager
+	aliases map[string]string
+}
+
+// NewCatalog returns an empty catalog.
+func NewCatalog() *Catalog {
+	return &Catalog{indexes: make(map[string]*IndexManager), aliases: make(map[string]string)}
+}
+
+// LoadCatalog loads every index saved in dir, named after its file without
+// extensions, and the aliases in dir/aliases.json, a JSON object mapping
+// alias to index name:
+//
+//	catalog/
+//	  aliases.json            {"blog": "blog-2024-06-01"}
+//	  blog-2024-06-01.pb.gz
+//	  notes.json
+//
+// Files ending in .pb or .pb.gz are read as protobuf, those ending in .gob
+// or .gob.gz as gob, those ending in .irm or .irm.gz as FormatMapped, and
+// others as JSON.
+// Indexes saved with their documents apart, at a DocsPath, are read
+// without them, and their results carry only document names. Other files
+// and subdirectories are ignored.
+func LoadCatalog(dir string) (*Catalog, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := NewCatalog()
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || file == aliasesFile {
+			continue
+		}
+		name, storage, ok := catalogEntry(file)
+		if !ok {
+			continue
+		}
+		idx, err := readIndexFile(filepath.Join(dir, file), storage)
+		if err != nil {
+			return nil, fmt.Errorf("index %q: %w", name, err)
+		}
+		if err := c.Add(name, idx); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, aliasesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", aliasesFile, err)
+	}
+	for alias, name := range aliases {
+		if err := c.Alias(alias, name); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// catalogEntry returns the index name and storage options of a file in a
+// catalog directory, and whether it's an index file at all.
+func catalogEntry(file string) (string, StorageOpts, bool) {
+	storage := StorageOpts{}
+	name := file
+	if trimmed, ok := strings.CutSuffix(name, ".gz"); ok {
+		name, storage.Compressed = trimmed, true
+	}
+	switch ext := filepath.Ext(name); ext {
+	case ".pb":
+		storage.Format = FormatProto
+		name = strings.TrimSuffix(name, ext)
+	case ".gob":
+		storage.Format = FormatGob
+		name = strings.TrimSuffix(name, ext)
+	case ".irm":
+		storage.Format = FormatMapped
+		name = strings.TrimSuffix(name, ext)
+	case ".json":
+		name = strings.TrimSuffix(name, ext)
+	default:
+		return "", storage, false
+	}
+	return name, storage, name != ""
+}
+
+func readIndexFile(path string, storage StorageOpts) (*Index, error) {
+	f, err := openIndexFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	storage.Path = path
+	return ReadIndex(context.Background(), f, nil, DocOpts{Storage: storage})
+}
+
+// Add adds an index under name, or swaps it in if the catalog already has
+// an index of that name, as IndexManager.Swap does.
+func (c *Catalog) Add(name string, idx *Index) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.aliases[name]; ok {
+		return fmt.Errorf("%q is an alias", name)
+	}
+	if m, ok := c.indexes[name]; ok {
+		m.Swap(idx)
+		return nil
+	}
+	c.indexes[name] = NewIndexManager(idx)
+	return nil
+}
+
+// Remove removes the index called name. An index that aliases point at
+// can't be removed until they've been repointed.
+func (c *Catalog) Remove(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.indexes[name]; !ok {
+		return fmt.Errorf("no index named %q", name)
+	}
+	for alias, target := range c.aliases {
+		if target == name {
+			return fmt.Errorf("index %q is still aliased as %q", name, alias)
+		}
+	}
+	delete(c.indexes, name)
+	return nil
+}
+
+// Alias points alias at the index called name, replacing whatever it
+// pointed at before.
+func (c *Catalog) Alias(alias, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.indexes[alias]; ok {
+		return fmt.Errorf("%q is an index", alias)
+	}
+	if _, ok := c.indexes[name]; !ok {
+		return fmt.Errorf("no index named %q", name)
+	}
+	c.aliases[alias] = name
+	return nil
+}
+
+// Unalias removes an alias. The index it pointed at stays.
+func (c *Catalog) Unalias(alias string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.aliases, alias)
+}
+
+// Resolve returns the name of the index that name refers to: the index an
+// alias points at, or name itself if it's an index.
+func (c *Catalog) Resolve(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.resolve(name)
+}
+
+func (c *Catalog) resolve(name string) (string, bool) {
+	if target, ok := c.aliases[name]; ok {
+		name = target
+	}
+	_, ok := c.indexes[name]
+	return name, ok
+}
+
+// Manager returns the manager serving the index that name, an index name or
+// alias, refers to.
+func (c *Catalog) Manager(name string) (*IndexManager, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	name, ok := c.resolve(name)
+	return c.indexes[name], ok
+}
+
+// Search searches the index that name, an index name or alias, refers to.
+func (c *Catalog) Search(ctx context.Context, name string, terms []string, opts SearchOpts) ([]SearchResult, error) {
+	m, ok := c.Manager(name)
+	if !ok {
+		return nil, fmt.Errorf("no index or alias named %q", name)
+	}
+	return m.Search(ctx, terms, opts)
+}
+
+// Names returns the names of the indexes in the catalog, sorted.
+func (c *Catalog) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.indexes))
+	for name := range c.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Aliases returns a copy of the catalog's aliases, mapping alias to index name.
+func (c *Catalog) Aliases() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	aliases := make(map[string]string, len(c.aliases))
+	for alias, name := range c.aliases {
+		aliases[alias] = name
+	}
+	return aliases
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	city := Document{Name: "city.md", Content: "the city streets"}
+	june := mustIndex(t, memLoader(city, Document{Name: "june.md", Content: "the pond in june"}), DocOpts{})
+	july := mustIndex(t, memLoader(city, Document{Name: "july.md", Content: "the pond in july"}), DocOpts{})
+
+	dir := t.TempDir()
+	if err := june.Save(filepath.Join(dir, "blog-06.json")); err != nil {
+		t.Fatal(err)
+	}
+	july.storage = StorageOpts{Format: FormatProto, Compressed: true}
+	if err := july.Save(filepath.Join(dir, "blog-07.pb.gz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "aliases.json"), []byte(`{"blog": "blog-06"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not an index"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := c.Names(); len(names) != 2 || names[0] != "blog-06" || names[1] != "blog-07" {
+		t.Fatalf("unexpected indexes %v", names)
+	}
+	search := func(name string) string {
+		results, err := c.Search(context.Background(), name, []string{"pond"}, SearchOpts{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("expected a result from %s, got %+v", name, results)
+		}
+		return results[0].Name
+	}
+	if got := search("blog"); got != "june.md" {
+		t.Errorf("blog: got %s, want june.md", got)
+	}
+
+	if err := c.Alias("blog", "blog-07"); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("blog"); got != "july.md" {
+		t.Errorf("repointed blog: got %s, want july.md", got)
+	}
+	if err := c.Remove("blog-07"); err == nil {
+		t.Error("removed an aliased index")
+	}
+	if err := c.Alias("blog-06", "blog-07"); err == nil {
+		t.Error("aliased an index name")
+	}
+	if err := c.Alias("notes", "missing"); err == nil {
+		t.Error("aliased a missing index")
+	}
+	if _, err := c.Search(context.Background(), "missing", []string{"pond"}, SearchOpts{Limit: 1}); err == nil {
+		t.Error("searched a missing index")
+	}
+}
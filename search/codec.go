@@ -0,0 +1,47 @@
+package search
+
+import (
+	"io"
+
+	"github.com/Eratosthenes/infrared/search/zstd"
+)
+
+// Codec is a compression format for saved indexes to use in place of gzip.
+// Zstd is one; another wraps a package that has its encoder and decoder:
+//
+//	import "github.com/pierrec/lz4/v4"
+//
+//	var LZ4 = &search.Codec{
+//		Name:  "lz4",
+//		Magic: []byte{0x04, 0x22, 0x4d, 0x18},
+//		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+//			return lz4.NewWriter(w), nil
+//		},
+//		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+//			return io.NopCloser(lz4.NewReader(r)), nil
+//		},
+//	}
+//
+// Set it with StorageOpts.Codec, for saving and loading alike.
+type Codec struct {
+	Name string
+	// Magic is the first bytes of everything the codec writes, by which a
+	// compressed index is told from an uncompressed one when loading
+	Magic     []byte
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// Zstd compresses indexes with zstd, a little faster than gzip at a similar
+// ratio, in files the zstd tools read. Indexes it compressed are detected
+// when loading, whatever the StorageOpts.Codec.
+var Zstd = &Codec{
+	Name:  "zstd",
+	Magic: zstd.Magic,
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w), nil
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		return zstd.NewReader(r), nil
+	},
+}
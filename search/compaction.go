@@ -0,0 +1,72 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"maps"
+)
+
+// Fragmentation describes how far an index that's been updated in place has
+// drifted from one built afresh from its documents. Updates don't leave
+// tombstones or dead postings behind, since each writes a new term map, but
+// terms the index had pruned as too common stay pruned however the corpus
+// changes, so the more documents have changed, the more a rebuild with
+// Optimize would find. Counts start over when the index is built or loaded.
+type Fragmentation struct {
+	Updates      int     `json:"updates"`       // AddDocuments and RemoveDocuments calls
+	ChangedDocs  int     `json:"changed_docs"`  // documents they added or removed
+	ChangedRatio float64 `json:"changed_ratio"` // ChangedDocs over the documents of the index
+}
+
+// Fragmentation returns how far the index has drifted through updates.
+func (idx *Index) Fragmentation() Fragmentation {
+	f := Fragmentation{Updates: idx.updates, ChangedDocs: idx.changedDocs}
+	if len(idx.docs) > 0 {
+		f.ChangedRatio = float64(idx.changedDocs) / float64(len(idx.docs))
+	}
+	return f
+}
+
+// Optimize returns an index rebuilt from the stored documents of idx, with
+// its configuration, as if it had been built from them in the first place.
+// idx must have been loaded with the content of its documents.
+func (idx *Index) Optimize(ctx context.Context) (*Index, error) {
+	for _, doc := range idx.docs {
+		if doc.Content == "" && doc.tokens() > 0 {
+			return nil, errors.New("cannot optimize an index stored without its documents' content")
+		}
+	}
+	rebuilt := idx.derived()
+	rebuilt.docs = maps.Clone(idx.docs)
+	maps.Copy(rebuilt.fields, idx.fields)
+	rebuilt.indexDirs()
+	if err := rebuilt.build(ctx); err != nil {
+		return nil, err
+	}
+	return rebuilt, nil
+}
+
+// CompactionPolicy says when an updated index is due to be optimized. A
+// zero threshold is never reached.
+type CompactionPolicy struct {
+	MaxUpdates      int     // updates since the index was built
+	MaxChangedRatio float64 // documents changed since, as a fraction of the index
+}
+
+// due reports whether f has reached one of the policy's thresholds.
+func (p CompactionPolicy) due(f Fragmentation) bool {
+	return (p.MaxUpdates > 0 && f.Updates >= p.MaxUpdates) ||
+		(p.MaxChangedRatio > 0 && f.ChangedRatio >= p.MaxChangedRatio)
+}
+
+// Compact optimizes the current index and swaps the result in if policy
+// says it's due, and reports whether it did.
+func (m *IndexManager) Compact(ctx context.Context, policy CompactionPolicy) (bool, error) {
+	if !policy.due(m.Index().Fragmentation()) {
+		return false, nil
+	}
+	err := m.Update(func(idx *Index) (*Index, error) {
+		return idx.Optimize(ctx)
+	})
+	return err == nil, err
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	docs := []Document{
+		{Name: "pond.md", Content: "walden pond froze in winter"},
+		{Name: "bean.md", Content: "walden bean field by summer"},
+		{Name: "town.md", Content: "walden village in winter"},
+		{Name: "hut.md", Content: "a hut by the railroad", Length: 5}, // added, not loaded
+	}
+	// walden is in every document of the first index, so it's pruned
+	index := mustIndex(t, memLoader(docs[:3]...), DocOpts{})
+	m := NewIndexManager(index)
+	in := NewIngester(m, IngestOpts{BatchSize: 1, Compaction: CompactionPolicy{MaxUpdates: 2}})
+	if err := m.Update(func(idx *Index) (*Index, error) { return idx.AddDocuments(docs[3:]) }); err != nil {
+		t.Fatal(err)
+	}
+	updated := m.Index()
+	if f := updated.Fragmentation(); f.Updates != 1 || f.ChangedDocs != 1 || f.ChangedRatio != 0.25 {
+		t.Errorf("unexpected fragmentation %+v", f)
+	}
+	if _, ok := updated.tmap["walden"]; ok {
+		t.Fatal("expected walden to stay pruned after an update")
+	}
+
+	optimized, err := updated.Optimize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(idx *Index) []byte {
+		var buf bytes.Buffer
+		if err := idx.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	if !bytes.Equal(write(optimized), write(mustIndex(t, memLoader(docs...), DocOpts{}))) {
+		t.Error("optimized index differs from the index built from all the documents")
+	}
+	if f := optimized.Fragmentation(); f.Updates != 0 {
+		t.Errorf("expected an optimized index to start over, got %+v", f)
+	}
+
+	// the ingester's second update reaches the policy's threshold
+	if err := in.Submit(Document{Name: "field.md", Content: "the bean field"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f := m.Index().Fragmentation(); f.Updates != 0 || m.Index().DocCount() != 5 {
+		t.Errorf("expected the ingester to compact the index, got %+v", f)
+	}
+}
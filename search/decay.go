@@ -0,0 +1,38 @@
+package search
+
+import (
+	"math"
+	"time"
+)
+
+// decay weighs documents by their age, for SearchOpts.HalfLife.
+type decay struct {
+	halfLife time.Duration
+	now      time.Time
+}
+
+// decay returns the decay of the search, or nil if it has none.
+func (opts SearchOpts) decay() *decay {
+	if opts.HalfLife <= 0 {
+		return nil
+	}
+	now := opts.DecayFrom
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return &decay{halfLife: opts.HalfLife, now: now}
+}
+
+// factor returns what the term frequencies of doc are multiplied by: 1 for
+// a document dated now, halving with every half-life of age. A document
+// without a parseable date, or dated in the future, isn't decayed.
+func (d *decay) factor(doc Document) float64 {
+	if d == nil {
+		return 1
+	}
+	t, ok := parseDate(doc.Date)
+	if !ok || !t.Before(d.now) {
+		return 1
+	}
+	return math.Exp2(-float64(d.now.Sub(t)) / float64(d.halfLife))
+}
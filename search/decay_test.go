@@ -0,0 +1,46 @@
+package search
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHalfLife(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	index := mustIndex(t, memLoader(
+		Document{Name: "old.md", Content: "the pond in winter ice", Date: now.AddDate(0, 0, -30).Format(time.RFC3339)},
+		Document{Name: "new.md", Content: "the pond in winter", Date: now.AddDate(0, 0, -1).Format(time.RFC3339)},
+		Document{Name: "city.md", Content: "the city streets"},
+	), DocOpts{})
+
+	plain, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 2 || plain[0].Name != "new.md" {
+		t.Fatalf("unexpected results %+v", plain)
+	}
+	// ice makes the old document the better match until age counts
+	plain, _ = index.Search(context.Background(), []string{"winter", "ice"}, SearchOpts{Limit: 2})
+	if plain[0].Name != "old.md" {
+		t.Fatalf("expected old.md first without decay, got %+v", plain)
+	}
+
+	decayed, err := index.Search(context.Background(), []string{"winter", "ice"}, SearchOpts{Limit: 2, HalfLife: 7 * 24 * time.Hour, DecayFrom: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decayed[0].Name != "new.md" {
+		t.Errorf("expected new.md first with decay, got %+v", decayed)
+	}
+	for _, r := range decayed {
+		if r.Name == "old.md" {
+			want := plain[0].Score * math.Exp2(-30.0/7)
+			if math.Abs(r.Score-want) > 1e-12 {
+				t.Errorf("old.md decayed to %g, want %g", r.Score, want)
+			}
+		}
+	}
+}
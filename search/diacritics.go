@@ -0,0 +1,57 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// diacriticFolds maps the accented Latin letters, and the ligatures, to their
+// unaccented forms: "é" -> "e", "ß" -> "ss", "Œ" -> "OE".
+var diacriticFolds = func() map[rune]string {
+	folds := make(map[rune]string)
+	for _, f := range []struct{ from, to string }{
+		{"ÀÁÂÃÄÅĀĂĄ", "A"}, {"àáâãäåāăą", "a"}, {"ÇĆĈĊČ", "C"}, {"çćĉċč", "c"},
+		{"ÐĎĐ", "D"}, {"ðďđ", "d"}, {"ÈÉÊËĒĔĖĘĚ", "E"}, {"èéêëēĕėęě", "e"},
+		{"ĜĞĠĢ", "G"}, {"ĝğġģ", "g"}, {"ĤĦ", "H"}, {"ĥħ", "h"},
+		{"ÌÍÎÏĨĪĬĮİ", "I"}, {"ìíîïĩīĭįı", "i"}, {"Ĵ", "J"}, {"ĵ", "j"},
+		{"Ķ", "K"}, {"ķ", "k"}, {"ĹĻĽĿŁ", "L"}, {"ĺļľŀł", "l"},
+		{"ÑŃŅŇ", "N"}, {"ñńņň", "n"}, {"ÒÓÔÕÖØŌŎŐ", "O"}, {"òóôõöøōŏő", "o"},
+		{"ŔŖŘ", "R"}, {"ŕŗř", "r"}, {"ŚŜŞŠȘ", "S"}, {"śŝşšș", "s"},
+		{"ŢŤŦȚ", "T"}, {"ţťŧț", "t"}, {"ÙÚÛÜŨŪŬŮŰŲ", "U"}, {"ùúûüũūŭůűų", "u"},
+		{"Ŵ", "W"}, {"ŵ", "w"}, {"ÝŶŸ", "Y"}, {"ýÿŷ", "y"}, {"ŹŻŽ", "Z"}, {"źżž", "z"},
+		{"Æ", "AE"}, {"æ", "ae"}, {"Œ", "OE"}, {"œ", "oe"}, {"Þ", "TH"}, {"þ", "th"}, {"ß", "ss"},
+	} {
+		for _, r := range f.from {
+			folds[r] = f.to
+		}
+	}
+	return folds
+}()
+
+// foldDiacritics strips the accents from the Latin letters of text, whether
+// they're precomposed, as "é" usually is, or a letter followed by combining
+// marks, as text pasted from some sources has it, so "café", "café"
+// and "cafe" are all "cafe". Other scripts are left as they are.
+func foldDiacritics(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			b.WriteByte(byte(r))
+		} else if fold, ok := diacriticFolds[r]; ok {
+			b.WriteString(fold)
+		} else if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// diacriticNormalizer returns normalize applied to text with its diacritics
+// folded.
+func diacriticNormalizer(normalize Normalizer) Normalizer {
+	return func(text string) string {
+		return normalize(foldDiacritics(text))
+	}
+}
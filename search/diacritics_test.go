@@ -0,0 +1,74 @@
+package search
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFoldDiacritics(t *testing.T) {
+	for in, want := range map[string]string{
+		"café":             "cafe",
+		"cafe\u0301":       "cafe",
+		"Œuvre Straße":     "OEuvre Strasse",
+		"Łódź, Ørsted":     "Lodz, Orsted",
+		"naïve résumé":     "naive resume",
+		"plain ascii":      "plain ascii",
+		"日本語 and ελληνικά": "日本語 and ελληνικά",
+	} {
+		if got := foldDiacritics(in); got != want {
+			t.Errorf("foldDiacritics(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFoldDiacriticsSearch(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "cafe.md", Content: "a café by the pond"},
+		Document{Name: "resume.md", Content: "my resume for the city"},
+		Document{Name: "woods.md", Content: "a walk in the woods"},
+	)
+	index := mustIndex(t, docs, DocOpts{FoldDiacritics: true})
+	for query, want := range map[string]string{
+		"cafe":       "cafe.md",
+		"café":       "cafe.md",
+		"cafe\u0301": "cafe.md",
+		"résumé":     "resume.md",
+	} {
+		results, err := index.Search(context.Background(), []string{query}, SearchOpts{Limit: 1, Highlight: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Name != want || len(results[0].Matches) != 1 {
+			t.Errorf("%q: expected %s with a match, got %+v", query, want, results)
+		}
+	}
+
+	plain := mustIndex(t, docs, DocOpts{})
+	if results, _ := plain.Search(context.Background(), []string{"cafe"}, SearchOpts{}); len(results) != 0 {
+		t.Errorf("expected no results without folding, got %+v", results)
+	}
+	if _, err := MergeIndexes(index, plain); err == nil {
+		t.Error("expected an error merging indexes that fold diacritics differently")
+	}
+}
+
+func TestPastedQuery(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "walden.md", Content: "Henry Thoreau at the pond"},
+		Document{Name: "essay.md", Content: "Ralph Emerson on the pond"},
+		Document{Name: "city.md", Content: "the city at night"},
+	), DocOpts{Entities: Gazetteer{"Henry Thoreau": "person", "Ralph Emerson": "person"}})
+	for _, query := range []string{
+		"person:“henry thoreau” pond",
+		"person:\"henry\u00a0thoreau\"\u00a0pond",
+		"person:\"henry thoreau\" po\u200bnd",
+	} {
+		results, err := index.Search(context.Background(), []string{query}, SearchOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Name != "walden.md" {
+			t.Errorf("%q: expected walden.md, got %+v", query, results)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package search
+
+import (
+	"path"
+	"strings"
+)
+
+// docDir returns the directory of a document: its Dir, or the directory
+// part of its name for documents loaded without one.
+func docDir(doc Document) string {
+	if doc.Dir != "" {
+		return doc.Dir
+	}
+	return path.Dir(doc.Name)
+}
+
+// indexDirs groups the document names by directory, so a search scoped to
+// some directories can pick out their documents without looking at the rest.
+func (idx *Index) indexDirs() {
+	idx.dirs = make(map[string][]string)
+	for name, doc := range idx.docs {
+		dir := docDir(doc)
+		idx.dirs[dir] = append(idx.dirs[dir], name)
+	}
+}
+
+// scope returns the names of the documents in dirs or beneath them that are
+// also in within, unless it's nil. The set mustn't be modified, as it may
+// be cached.
+func (idx Index) scope(dirs []string, within map[string]bool) map[string]bool {
+	inScope := idx.filters.get(dirsKey(dirs), func() map[string]bool {
+		scoped := make(map[string]bool)
+		for dir, names := range idx.dirs {
+			if inDirs(dir, dirs) {
+				for _, name := range names {
+					scoped[name] = true
+				}
+			}
+		}
+		return scoped
+	})
+	if within == nil {
+		return inScope
+	}
+	scoped := make(map[string]bool)
+	for name := range within {
+		if inScope[name] {
+			scoped[name] = true
+		}
+	}
+	return scoped
+}
+
+// inDirs reports whether dir is one of dirs or beneath one of them.
+func inDirs(dir string, dirs []string) bool {
+	for _, d := range dirs {
+		d = path.Clean(strings.Trim(d, "/"))
+		if d == "." || dir == d || strings.HasPrefix(dir, d+"/") {
+			return true
+		}
+	}
+	return false
+}
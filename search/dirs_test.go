@@ -0,0 +1,59 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDirectoryScope(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/intro.txt":                {Data: []byte("an introduction to virtue")},
+		"docs/philosophy/ethics.txt":    {Data: []byte("virtue and the good life")},
+		"docs/philosophy/stoics/ep.txt": {Data: []byte("virtue is the only good")},
+		"docs/gardening/roses.txt":      {Data: []byte("roses need sun and water")},
+	}
+	index := mustIndex(t, DefaultLoader, DocOpts{Load: LoadOpts{FS: fsys, Path: "docs", Content: true, Recursive: true}})
+	if doc := index.docs["philosophy/stoics/ep.txt"]; doc.Dir != "philosophy/stoics" {
+		t.Fatalf("expected documents named by their path with their directory, got %+v", index.docs)
+	}
+
+	for _, tc := range []struct {
+		dirs []string
+		want []string
+	}{
+		{nil, []string{"intro.txt", "philosophy/ethics.txt", "philosophy/stoics/ep.txt"}},
+		{[]string{"/philosophy"}, []string{"philosophy/ethics.txt", "philosophy/stoics/ep.txt"}},
+		{[]string{"philosophy/stoics", "gardening"}, []string{"philosophy/stoics/ep.txt"}},
+		{[]string{"."}, []string{"intro.txt", "philosophy/ethics.txt", "philosophy/stoics/ep.txt"}},
+		{[]string{"phil"}, nil},
+	} {
+		results, err := index.Search(context.Background(), []string{"virtue"}, SearchOpts{Limit: 10, Dirs: tc.dirs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("dirs %q: got %q, want %q", tc.dirs, got, tc.want)
+		}
+	}
+
+	data, err := index.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := UnmarshalProto(data, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ := loaded.Search(context.Background(), []string{"virtue"}, SearchOpts{Limit: 10, Dirs: []string{"philosophy/stoics"}})
+	if len(results) != 1 || results[0].Dir != "philosophy/stoics" {
+		t.Errorf("expected the directory to survive a round trip, got %+v", results)
+	}
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// jsonDocs is the saved form of stored documents in FormatJSON.
+type jsonDocs struct {
+	jsonHeader
+	Docs []Document `json:"docs"`
+}
+
+// WriteDocuments writes the stored documents of the index to w, sorted by
+// name, in the format and compression of its StorageOpts, as Save does when
+// DocsPath is set. A protobuf documents file is an infrared.v1.Index message
+// with documents but no terms, and a gob one likewise an index without terms.
+func (idx *Index) WriteDocuments(w io.Writer) error {
+	return idx.storage.compress(w, func(w io.Writer) error {
+		switch idx.storage.Format {
+		case FormatProto:
+			buf := appendVarintField(nil, 1, protoFormatVersion)
+			_, err := w.Write(idx.appendProtoDocs(buf))
+			return err
+		case FormatGob:
+			saved := gobIndex{Magic: indexMagic, Version: gobFormatVersion, Docs: gobDocs(idx.sortedDocs())}
+			return gob.NewEncoder(w).Encode(saved)
+		case FormatMapped:
+			return idx.encodeMapped(w, false, true)
+		}
+		return json.NewEncoder(w).Encode(jsonDocs{newJSONHeader(), idx.sortedDocs()})
+	})
+}
+
+// sortedDocs returns the stored documents of the index, sorted by name.
+func (idx *Index) sortedDocs() []Document {
+	docs := make([]Document, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs
+}
+
+// ReadDocuments reads documents written by WriteDocuments in format from r,
+// gzipped or not. Reading a protobuf or gob index saved with its documents
+// also works.
+func ReadDocuments(r io.Reader, format Format) ([]Document, error) {
+	return readDocuments(r, StorageOpts{Format: format})
+}
+
+// readDocuments reads documents as ReadDocuments does, in the format and
+// with the codec of storage.
+func readDocuments(r io.Reader, storage StorageOpts) ([]Document, error) {
+	format := storage.Format
+	src, err := storage.decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	switch format {
+	case FormatGob:
+		saved, err := decodeGob(src)
+		if err != nil {
+			return nil, err
+		}
+		return saved.documents(), nil
+	case FormatMapped:
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read documents: %w", err)
+		}
+		_, docs, err := decodeMapped(data)
+		return docs, err
+	case FormatJSON:
+		var saved jsonDocs
+		if err := json.NewDecoder(src).Decode(&saved); err != nil {
+			return nil, fmt.Errorf("%w: failed to unmarshal documents: %w", ErrCorruptIndex, err)
+		}
+		if err := saved.check(saved.Docs != nil); err != nil {
+			return nil, err
+		}
+		return saved.Docs, nil
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read documents: %w", err)
+	}
+	var docs []Document
+	version := uint64(0)
+	err = readProto(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == wireVarint:
+			version = v
+		case num == 3 && wire == wireBytes:
+			doc, err := unmarshalProtoDoc(b)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal documents: %w", err)
+	}
+	if err := checkVersion("protobuf", int(version), protoFormatVersion); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// LoadDocuments loads the documents saved at storage.DocsPath, without any postings.
+func LoadDocuments(storage StorageOpts) ([]Document, error) {
+	file, err := openIndexFile(storage.DocsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readDocuments(file, storage)
+}
+
+// DocumentLoader returns a Loader of the documents saved at storage.DocsPath,
+// for loading an index saved in two files. It ignores its LoadOpts.
+func DocumentLoader(storage StorageOpts) Loader {
+	return func(context.Context, LoadOpts) ([]Document, error) {
+		return LoadDocuments(storage)
+	}
+}
@@ -1,50 +1,323 @@
 package search
 
 import (
+	"fmt"
+	"io"
 	"io/fs"
+	"log/slog"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
+// DocOpts configures an index: where its documents come from, how it's
+// stored, and how it's built.
 type DocOpts struct {
-	IndexPath   string // path to save/load the index
-	LoadPath    string // directory to load documents from
-	LoadContent bool
-	LenPreview  int
-	Compressed  bool
+	Load    LoadOpts
+	Storage StorageOpts
+	// CompactPostings keeps postings in memory as delta-encoded varints
+	// rather than maps: much smaller, a little slower to query
+	CompactPostings bool
+	// Workers is the number of goroutines that tokenize documents while the
+	// index is built, each counting the terms of its share of them into a
+	// term map of its own. 0 uses up to GOMAXPROCS, when there are enough
+	// documents to be worth it; 1 builds serially. A spilled build, with a
+	// MemoryBudget, is serial.
+	Workers int
+	// MemoryBudget, if positive, caps the approximate bytes of term map held
+	// in memory while building; the excess is spilled to segment files in
+	// SpillDir (default os.TempDir) and merged at the end
+	MemoryBudget int64
+	SpillDir     string
+	Expansions   Expansions      // equivalent phrases applied at index and query time
+	Entities     EntityExtractor // if set, recognized entities are indexed under their kind, e.g. person:"thoreau"
+	Progress     ProgressFunc    // if set, called as each build phase starts, advances and finishes
+	// Transform changes each document, in order, after it's loaded and
+	// before it's indexed; see Transform
+	Transform []Transform
+	// StopwordRatio, if positive, makes terms in more than this fraction of
+	// the documents corpus stopwords, like "chapter" or "said" in a corpus of
+	// novels, which are dropped. The most common terms are always dropped;
+	// this catches the ones below that cut-off.
+	StopwordRatio float64
+	// StopwordWeight, if positive, keeps corpus stopwords but scales their
+	// weight in scores by it, between 0 and 1
+	StopwordWeight float64
+	// FoldPlurals indexes and searches plurals as their singular, so "laws"
+	// matches "law", without the aggressiveness of stemming: a trailing s or
+	// es is stripped and ies turned into y, except in short words and common
+	// words like "this" and "news"
+	FoldPlurals bool
+	// FoldDiacritics indexes and searches accented Latin letters without
+	// their accents, so "cafe", "café" and a pasted "café" in decomposed
+	// form all match one another. Like FoldPlurals, it applies to documents
+	// and queries alike, and an index must be loaded with the same setting.
+	FoldDiacritics bool
+	// SentenceNGrams stops n-grams at sentence and paragraph boundaries, so
+	// "...the law. Human..." doesn't index "law human". It makes the term map
+	// smaller, and phrases spanning two sentences no longer match as n-grams.
+	SentenceNGrams bool
+	// Positions keeps the position of each word in each document, so a
+	// quoted phrase like "\"moral law\"" matches only documents where its
+	// words are adjacent, phrases of any length included, rather than any
+	// document with the n-grams it's made of. Stop words in the phrase
+	// match any word. Positions take memory in proportion to the text;
+	// they're not saved, but rebuilt from stored content when the index is
+	// loaded with Positions.
+	Positions bool
+	// FieldAnalyzers names the analyzer, from Analyzers, of each entity
+	// field whose values shouldn't go through the index normalizer, e.g.
+	// {"tag": "keyword"}. They're saved with the index, and a loaded index
+	// uses its saved ones.
+	FieldAnalyzers map[string]string
+	// StopWords are removed from documents and queries, so they're neither
+	// indexed nor scored, but they leave a gap behind: "use of language"
+	// indexes "use _ language", which a search for "use of language" or
+	// "use in language" matches but one for "use language" doesn't. N-grams
+	// starting or ending with a gap aren't indexed. They're saved with the
+	// index, and a loaded index uses its saved ones.
+	StopWords []string
+	// Report keeps a BuildReport of the build: skipped files, timings,
+	// largest documents and the like. Save writes it next to the index.
+	Report bool
+	// Limits caps the work of each search; see Limits
+	Limits Limits
+	// Outliers truncates or down-weights documents far longer than the
+	// rest, which would otherwise skew length normalization; see Outliers
+	Outliers Outliers
+	// FilterCache is the number of filters, such as the field terms of
+	// "tag:blog", a SearchOpts.Dirs or an intent like "ext:md", whose
+	// documents are kept for searches repeating them, the least recently
+	// used dropped first; 0 keeps none. It's emptied when the index changes.
+	FilterCache int
+	// WithholdText keeps the text of documents from leaving the index, for
+	// deployments where it mustn't transit the search API: results carry
+	// names, scores and metadata but never a Preview or Content, Document
+	// returns documents without them, and Content fails. Searches asking
+	// for text, with SearchOpts.Fields naming "preview" or "content",
+	// SnippetCount, Summarize, a Summarizer or an Answerer, fail with
+	// ErrTextWithheld. The text is still indexed, and terms, as from Terms,
+	// aren't withheld.
+	WithholdText bool
+	// Audit, if set, records every search of the index: its terms, its
+	// options and the names of the documents it returned, as for
+	// compliance or offline relevance evaluation. A search that can't be
+	// recorded fails. An AuditLog's Record appends them to a file.
+	Audit AuditFunc
+	// Logger, if set, is told of skipped files, at debug level
+	Logger *slog.Logger
 }
 
+// LoadOpts controls where documents are loaded from and what's kept of them.
+// It's passed to the Loader.
+type LoadOpts struct {
+	Path       string // directory to load documents from (relative to FS or Root, if set)
+	FS         fs.FS  // filesystem to load documents from; defaults to the OS filesystem
+	Content    bool   // read and index each document's content, not just its metadata
+	LenPreview int    // length of Document.Preview, in bytes
+	Namespace  string // namespace of the loaded documents
+	Recursive  bool   // load the documents in subdirectories of Path too, named by their path beneath it
+	// Parser, if set, turns each file's bytes into the document's content,
+	// such as Markdown for stripping markup; files are read as they are
+	// without one
+	Parser ContentParser
+	// Previewer makes each document's Preview; DefaultPreview picks one by
+	// the file's extension
+	Previewer Previewer
+	// Skip, if set, is called with each file the loader passes over and why
+	Skip func(path, reason string)
+	// Unreadable is what the loader does with a file or subdirectory it
+	// can't read; by default it stops loading and returns the error
+	Unreadable UnreadablePolicy
+	// Root is the OS directory that documents must lie beneath, when FS
+	// isn't set; it defaults to Path. Paths leaving it, through ".." or
+	// symlinks, can't be read.
+	Root string
+}
+
+// UnreadablePolicy is what a loader does with a file it can't read, such as
+// one without read permission or removed while the directory is loaded.
+type UnreadablePolicy int
+
+const (
+	FailUnreadable   UnreadablePolicy = iota // stop loading and return a DocLoadError
+	SkipUnreadable                           // pass over it, telling Skip, and so the BuildReport and Logger, why
+	IgnoreUnreadable                         // pass over it without telling anyone
+)
+
+// StorageOpts controls where and how an index is saved and loaded.
+type StorageOpts struct {
+	Path       string // path to save/load the index
+	Format     Format
+	Compressed bool // gzip the index when saving; gzipped indexes are detected when loading
+	// CompressionWorkers is the number of goroutines gzipping a saved index,
+	// a block of it each; 0 uses GOMAXPROCS. The saved bytes are the same
+	// however many there are.
+	CompressionWorkers int
+	// Codec, if set, compresses the saved index in place of gzip, whatever
+	// Compressed says, and decompresses indexes it compressed when loading;
+	// see Codec and Zstd
+	Codec *Codec
+	// DocsPath, if set, splits the saved index in two: the stored documents
+	// are saved to DocsPath and the terms and postings to Path, so a server
+	// that only ranks can load the postings alone, and a renderer the
+	// documents alone (see LoadDocuments)
+	DocsPath string
+}
+
+// Format is the encoding of a saved index.
+type Format int
+
+const (
+	FormatJSON  Format = iota // JSON term map, with documents
+	FormatProto               // infrared.v1.Index protobuf, with documents (see MarshalProto)
+	// FormatGob is encoding/gob, with documents: smaller and faster to save
+	// and load than JSON, but only readable by Go
+	FormatGob
+	// FormatMapped is a binary layout that LoadIndex maps into memory rather
+	// than reading, leaving postings on disk until they're searched: for
+	// indexes too large to decode whole. See Index.Close
+	FormatMapped
+)
+
 type Document struct {
 	Name    string `json:"name"`
 	Date    string `json:"date"`
-	Preview string `json:"preview"` // first N characters, using ellipsis if truncated
-	Length  int    // number of words in the document
+	Preview string `json:"preview"` // first LenPreview bytes of text, using ellipsis if truncated; see Previewer
+	Length  int    // number of words in the document, as loaded
 	Content string // full content, lowercase
+	// TokenCount is the number of words the analyzer found in the content,
+	// set when the document is indexed. Term frequencies, and so all
+	// scoring, are relative to it.
+	TokenCount int `json:"token_count,omitempty"`
+	// Entities holds the normalized entities recognized in the document, by kind
+	Entities map[string][]string `json:"entities,omitempty"`
+	// Namespace is the tenant or corpus the document belongs to, for
+	// searches with SearchOpts.Namespace
+	Namespace string `json:"namespace,omitempty"`
+	// Dir is the directory the document was loaded from, relative to
+	// LoadOpts.Path ("." for Path itself), for searches with SearchOpts.Dirs
+	Dir string `json:"dir,omitempty"`
+	// ACL, if set, lists the principals (users, roles or groups) allowed
+	// to see the document; see SearchOpts.Principal. Documents without one
+	// are visible to everyone.
+	ACL []string `json:"acl,omitempty"`
+	// ExpiresAt, if set, is when the document goes stale, like an
+	// announcement or a job posting. Search leaves it out from then on, and
+	// IndexManager.SweepExpired removes it from the index.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// resultFields clears each stored field of a document, by the field's name
+// in SearchOpts.Fields.
+var resultFields = map[string]func(doc *Document){
+	"date":        func(doc *Document) { doc.Date = "" },
+	"preview":     func(doc *Document) { doc.Preview = "" },
+	"length":      func(doc *Document) { doc.Length = 0 },
+	"content":     func(doc *Document) { doc.Content = "" },
+	"entities":    func(doc *Document) { doc.Entities = nil },
+	"namespace":   func(doc *Document) { doc.Namespace = "" },
+	"token_count": func(doc *Document) { doc.TokenCount = 0 },
+	"dir":         func(doc *Document) { doc.Dir = "" },
+	"acl":         func(doc *Document) { doc.ACL = nil },
+	"expires_at":  func(doc *Document) { doc.ExpiresAt = nil },
+}
+
+// visibleTo reports whether principal, or someone with one of roles, may see doc.
+func (doc Document) visibleTo(principal string, roles []string) bool {
+	if len(doc.ACL) == 0 {
+		return true
+	}
+	if principal != "" && slices.Contains(doc.ACL, principal) {
+		return true
+	}
+	for _, role := range roles {
+		if slices.Contains(doc.ACL, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResultFields returns an error if any of fields isn't a stored field.
+func checkResultFields(fields []string) error {
+	for _, field := range fields {
+		if _, ok := resultFields[field]; !ok && field != "name" {
+			return fmt.Errorf("unknown result field %q", field)
+		}
+	}
+	return nil
+}
+
+// selectFields clears the fields of the results' documents that aren't in
+// fields. Each result has its own copy of its document.
+func selectFields(results []SearchResult, fields []string) {
+	keep := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		keep[field] = true
+	}
+	for i, r := range results {
+		results[i].fields = fields
+		for field, reset := range resultFields {
+			if !keep[field] {
+				reset(r.Document)
+			}
+		}
+	}
 }
 
 type SearchResult struct {
 	*Document
 	Score float64
+	// Matches holds the query words found in the document's content, with
+	// SearchOpts.Highlight
+	Matches []Match `json:"matches,omitempty"`
+	// Snippets are fragments of the document's content around the query
+	// words, with SearchOpts.SnippetCount
+	Snippets []Snippet `json:"snippets,omitempty"`
+	// Answer is the answer to the query extracted from the document, with
+	// SearchOpts.Answerer
+	Answer string `json:"answer,omitempty"`
+
+	fields []string // SearchOpts.Fields, for MarshalJSON
 }
 
-type MakeDoc func(file fs.DirEntry, opts DocOpts) (Document, error)
+type MakeDoc func(file fs.DirEntry, opts LoadOpts) (Document, error)
+
+// tokens returns the number of words that the document's term frequencies
+// are relative to: its TokenCount, or its Length in indexes saved before
+// there was a TokenCount.
+func (doc Document) tokens() int {
+	if doc.TokenCount > 0 {
+		return doc.TokenCount
+	}
+	return doc.Length
+}
 
-func NewDoc(file fs.DirEntry, opts DocOpts) (Document, error) {
+func NewDoc(file fs.DirEntry, opts LoadOpts) (Document, error) {
 	// create a new Document from the file
 	var content string
-	if opts.LoadContent {
-		data, err := os.ReadFile(opts.LoadPath + "/" + file.Name())
+	if opts.Content {
+		fsys, dir := opts.docFS()
+		data, err := fs.ReadFile(fsys, path.Join(dir, file.Name()))
 		if err != nil {
 			return Document{}, err
 		}
-		content = string(data)
+		if opts.Parser == nil {
+			content = string(data)
+		} else if content, err = opts.Parser.Parse(file.Name(), data); err != nil {
+			return Document{}, err
+		}
 	}
 
-	preview := content
-	if len(content) > opts.LenPreview {
-		preview = content[:opts.LenPreview]
+	previewer := opts.Previewer
+	if previewer == nil {
+		previewer = DefaultPreview
 	}
-	preview += "..."
+	preview := previewer(file.Name(), content, opts.LenPreview)
 
 	info, err := file.Info()
 	if err != nil {
@@ -52,11 +325,105 @@ func NewDoc(file fs.DirEntry, opts DocOpts) (Document, error) {
 	}
 
 	doc := Document{
-		Name:    file.Name(),
-		Date:    info.ModTime().String(),
-		Preview: preview,
-		Length:  len(strings.Fields(content)),
-		Content: content,
+		Name:      file.Name(),
+		Date:      info.ModTime().String(),
+		Preview:   preview,
+		Length:    len(strings.Fields(content)),
+		Content:   content,
+		Namespace: opts.Namespace,
 	}
 	return doc, nil
 }
+
+// Content returns the original bytes of the named document, read from where
+// its documents were loaded from, so that a server can serve a result
+// without knowing where it lives. An index whose LoadOpts don't name a
+// directory, like one read with its documents, returns the stored content.
+// A document that isn't in the index is ErrDocumentNotFound, and any
+// document of an index that withholds text ErrTextWithheld.
+func (idx *Index) Content(name string) (io.ReadCloser, error) {
+	doc, ok := idx.docs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrDocumentNotFound, name)
+	}
+	if idx.withholdText {
+		return nil, fmt.Errorf("%w: %q", ErrTextWithheld, name)
+	}
+	if idx.load.Path == "" && idx.load.FS == nil && idx.load.Root == "" {
+		return io.NopCloser(strings.NewReader(doc.Content)), nil
+	}
+	fsys, dir := idx.load.docFS()
+	return fsys.Open(path.Join(dir, name))
+}
+
+// docFS returns the filesystem and the directory within it that documents are loaded from.
+func (opts LoadOpts) docFS() (fs.FS, string) {
+	if opts.FS == nil {
+		if opts.Root == "" {
+			return rootedFS(opts.Path), "."
+		}
+		if opts.Path == "" {
+			return rootedFS(opts.Root), "."
+		}
+		// a Path leaving Root cleans to one starting with "..", which rootedFS rejects
+		return rootedFS(opts.Root), path.Clean(filepath.ToSlash(opts.Path))
+	}
+	if opts.Path == "" {
+		return opts.FS, "."
+	}
+	return opts.FS, path.Clean(opts.Path)
+}
+
+// rootedFS is the OS filesystem beneath a directory. Unlike os.DirFS, it
+// doesn't follow symlinks out of the directory.
+//
+// It resolves a name's symlinks, checks the result is beneath the root and
+// then opens it, so a directory on the way swapped for a symlink in between
+// could still lead out. The file is opened without following a final
+// symlink, and the path is resolved again once it's open and must lead to
+// the same file, which catches a swap that's still in place; one undone
+// while the file was being opened isn't caught. Ruling that out takes
+// opening each directory in turn, relative to the last, as os.Root does
+// from Go 1.24.
+type rootedFS string
+
+// Open opens the named file, if it's beneath the root once symlinks are resolved.
+func (root rootedFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	dir, err := filepath.EvalSymlinks(string(root))
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(dir, real); err != nil || !filepath.IsLocal(rel) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	file, err := os.OpenFile(real, os.O_RDONLY|oNoFollow, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !resolvesTo(real, file) {
+		file.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return file, nil
+}
+
+// resolvesTo reports whether path, with no symlinks in it when it was
+// checked, still has none and names the open file.
+func resolvesTo(path string, file *os.File) bool {
+	if again, err := filepath.EvalSymlinks(path); err != nil || again != path {
+		return false
+	}
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	checked, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, checked)
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Engine hosts many indexes in one process, such as one per project, and
+// shares between them what each would otherwise hold a copy of: the
+// analysis settings they're built with (stop words, field analyzers and
+// expansions, prepared once) and a table of interned terms, so that a term
+// in the vocabulary of twenty indexes is stored once rather than twenty
+// times. Indexes are served by a Catalog, under names and aliases.
+//
+// Terms stay in the shared table for as long as the engine lives, even
+// after the indexes that used them are removed. It's safe for concurrent use.
+type Engine struct {
+	opts    DocOpts
+	catalog *Catalog
+	// analysis prepared once from opts, handed to every index the engine builds
+	stopWords      map[string]bool
+	fieldAnalyzers map[string]string
+	expander       *expander
+
+	mu    sync.Mutex // guards terms
+	terms interner
+}
+
+// NewEngine returns an engine that builds its indexes with the analysis
+// and build settings of opts. Its LoadOpts are replaced by those given to
+// each Build.
+func NewEngine(opts DocOpts) (*Engine, error) {
+	var template Index
+	if err := template.configure(opts); err != nil {
+		return nil, err
+	}
+	return &Engine{
+		opts:           opts,
+		catalog:        NewCatalog(),
+		stopWords:      template.stopWords,
+		fieldAnalyzers: template.fieldAnalyzers,
+		expander:       template.expander,
+		terms:          make(interner),
+	}, nil
+}
+
+// Build builds an index of the documents loader loads with load, and adds
+// it under name, swapping it in if there's already an index of that name.
+func (e *Engine) Build(ctx context.Context, name string, loader Loader, load LoadOpts) error {
+	opts := e.opts
+	opts.Load = load
+	idx := &Index{stopWords: e.stopWords, fieldAnalyzers: e.fieldAnalyzers, expander: e.expander}
+	if err := idx.buildFrom(ctx, loader, opts); err != nil {
+		return fmt.Errorf("index %q: %w", name, err)
+	}
+	return e.Add(name, idx)
+}
+
+// Add adds an index built or loaded elsewhere under name, as Catalog.Add
+// does, sharing its terms with the other indexes of the engine. The index
+// must not be searched or updated while it's being added.
+func (e *Engine) Add(name string, idx *Index) error {
+	e.share(idx)
+	return e.catalog.Add(name, idx)
+}
+
+// Update updates the index that name, an index name or alias, refers to,
+// as IndexManager.Update does, sharing the terms of the new index.
+func (e *Engine) Update(name string, update func(*Index) (*Index, error)) error {
+	m, ok := e.catalog.Manager(name)
+	if !ok {
+		return fmt.Errorf("no index or alias named %q", name)
+	}
+	return m.Update(func(idx *Index) (*Index, error) {
+		next, err := update(idx)
+		if err == nil && next != idx {
+			// next isn't being searched yet, unlike idx
+			e.share(next)
+		}
+		return next, err
+	})
+}
+
+// Search searches the index that name, an index name or alias, refers to.
+func (e *Engine) Search(ctx context.Context, name string, terms []string, opts SearchOpts) ([]SearchResult, error) {
+	return e.catalog.Search(ctx, name, terms, opts)
+}
+
+// Catalog returns the catalog serving the engine's indexes, for aliasing,
+// listing and removing them. Indexes added to it directly rather than
+// through the engine don't share its terms.
+func (e *Engine) Catalog() *Catalog {
+	return e.catalog
+}
+
+// share rekeys the term map of idx with the engine's copies of its terms.
+func (e *Engine) share(idx *Index) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	tmap := make(map[string]TermFreq, len(idx.tmap))
+	for term, tfreq := range idx.tmap {
+		tmap[e.terms.intern(term)] = tfreq
+	}
+	idx.tmap = tmap
+}
@@ -0,0 +1,91 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestEngine(t *testing.T) {
+	opts := DocOpts{StopWords: []string{"the", "in"}}
+	e, err := NewEngine(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	winter := []Document{
+		{Name: "pond.md", Content: "the pond in winter"},
+		{Name: "woods.md", Content: "the woods in winter"},
+		{Name: "city.md", Content: "the city at night"},
+	}
+	summer := []Document{
+		{Name: "pond.md", Content: "the pond in summer"},
+		{Name: "field.md", Content: "the field in summer"},
+		{Name: "road.md", Content: "the road at night"},
+	}
+	ctx := context.Background()
+	if err := e.Build(ctx, "winter", memLoader(winter...), LoadOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Build(ctx, "summer", memLoader(summer...), LoadOpts{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// built as NewIndex would, with the engine's settings
+	write := func(idx *Index) []byte {
+		var buf bytes.Buffer
+		if err := idx.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	a, _ := e.Catalog().Manager("winter")
+	if !bytes.Equal(write(a.Index()), write(mustIndex(t, memLoader(winter...), opts))) {
+		t.Error("expected the engine's index to match one built on its own")
+	}
+	b, _ := e.Catalog().Manager("summer")
+	if a.Index().stopWords == nil || reflect.ValueOf(a.Index().stopWords).UnsafePointer() != reflect.ValueOf(b.Index().stopWords).UnsafePointer() {
+		t.Error("expected the indexes to share their stop words")
+	}
+	if !sameString(a.Index().tmap, b.Index().tmap, "pond") {
+		t.Error("expected the indexes to share the term pond")
+	}
+
+	if err := e.Catalog().Alias("now", "summer"); err != nil {
+		t.Fatal(err)
+	}
+	results, err := e.Search(ctx, "now", []string{"pond"}, SearchOpts{})
+	if err != nil || len(results) != 1 || results[0].Content != "the pond in summer" {
+		t.Errorf("unexpected results %+v, %v", results, err)
+	}
+
+	// updated indexes share their terms too
+	err = e.Update("now", func(idx *Index) (*Index, error) {
+		return idx.AddDocuments([]Document{{Name: "lake.md", Content: "the lake in winter", Length: 4}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = e.Catalog().Manager("summer")
+	if !sameString(a.Index().tmap, b.Index().tmap, "winter") {
+		t.Error("expected the updated index to share the term winter")
+	}
+	if err := e.Update("nope", nil); err == nil {
+		t.Error("expected an error updating a missing index")
+	}
+}
+
+// sameString reports whether the term keys of a and b share their bytes.
+func sameString(a, b map[string]TermFreq, term string) bool {
+	key := func(tmap map[string]TermFreq) *byte {
+		for k := range tmap {
+			if k == term {
+				return unsafe.StringData(k)
+			}
+		}
+		return nil
+	}
+	ka, kb := key(a), key(b)
+	return ka != nil && ka == kb
+}
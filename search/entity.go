@@ -0,0 +1,114 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// Entity is a named thing recognized in a document, such as a person, place or organization.
+type Entity struct {
+	Kind string // field the entity is indexed under, e.g. "person", "place", "org"
+	Text string
+}
+
+// EntityExtractor recognizes entities in document text. Plug in a real NER
+// model by implementing it; Gazetteer is a simple dictionary-based extractor.
+type EntityExtractor interface {
+	Extract(text string) []Entity
+}
+
+// Gazetteer is a dictionary extractor mapping entity names to their kind,
+// e.g. {"Thoreau": "person", "Concord": "place"}. Names may span several
+// words; the longest name wins where names overlap.
+type Gazetteer map[string]string
+
+// Extract returns every dictionary name occurring in text.
+func (g Gazetteer) Extract(text string) []Entity {
+	names := make(map[string]string, len(g))
+	maxWords := 0
+	for name, kind := range g {
+		key := strings.Join(strings.Fields(DefaultNormalizer(name)), " ")
+		names[key] = kind
+		maxWords = max(maxWords, len(strings.Fields(key)))
+	}
+
+	words := strings.Fields(DefaultNormalizer(text))
+	var entities []Entity
+	for i := 0; i < len(words); i++ {
+		for n := min(maxWords, len(words)-i); n > 0; n-- {
+			phrase := strings.Join(words[i:i+n], " ")
+			if kind, ok := names[phrase]; ok {
+				entities = append(entities, Entity{Kind: kind, Text: phrase})
+				i += n - 1
+				break
+			}
+		}
+	}
+	return entities
+}
+
+// fieldTerm returns the term-map key for a field-qualified value, e.g. "person:thoreau".
+// Normalized content never contains ':', so field terms can't collide with words.
+func fieldTerm(field, value string) string {
+	return field + ":" + value
+}
+
+// isFieldTerm reports whether a term-map key belongs to a field rather than the document text.
+func isFieldTerm(term string) bool {
+	return strings.IndexByte(term, ':') > 0
+}
+
+// extractEntities runs the extractor over the document and stores the distinct normalized entities by kind.
+func (idx *Index) extractEntities(doc *Document) {
+	if doc.Entities != nil {
+		// the loader recognized them already, as when reading saved documents
+		for kind := range doc.Entities {
+			idx.fields[kind] = true
+		}
+		return
+	}
+	if idx.entities == nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, e := range idx.entities.Extract(doc.Content) {
+		kind := strings.ToLower(e.Kind)
+		value := idx.fieldValue(kind, e.Text)
+		if kind == "" || value == "" || seen[kind+":"+value] {
+			continue
+		}
+		seen[kind+":"+value] = true
+		if doc.Entities == nil {
+			doc.Entities = make(map[string][]string)
+		}
+		doc.Entities[kind] = append(doc.Entities[kind], value)
+		idx.fields[kind] = true
+	}
+}
+
+// FacetCount is a field value and the number of results carrying it.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// EntityFacets counts the entities of the given kind across results, most frequent first.
+func EntityFacets(results []SearchResult, kind string) []FacetCount {
+	counts := make(map[string]int)
+	for _, r := range results {
+		for _, value := range r.Entities[kind] {
+			counts[value]++
+		}
+	}
+	facets := make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	return facets
+}
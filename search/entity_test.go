@@ -0,0 +1,111 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEntityFieldQueries(t *testing.T) {
+	opts := DocOpts{Entities: Gazetteer{
+		"Henry David Thoreau": "person",
+		"Thoreau":             "person",
+		"Emerson":             "person",
+		"Concord":             "place",
+	}}
+	index := mustIndex(t, memLoader(
+		Document{Name: "walden.txt", Content: "Henry David Thoreau lived by the pond near Concord"},
+		Document{Name: "essays.txt", Content: "Emerson wrote about self reliance in Concord"},
+		Document{Name: "letters.txt", Content: "Emerson and Thoreau exchanged letters about the pond"},
+	), opts)
+
+	if got := index.docs["walden.txt"].Entities; !reflect.DeepEqual(got, map[string][]string{
+		"person": {"henry david thoreau"},
+		"place":  {"concord"},
+	}) {
+		t.Errorf("unexpected entities %v", got)
+	}
+
+	names := func(query string) []string {
+		results, err := index.Search(context.Background(), strings.Fields(query), SearchOpts{Limit: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, r := range results {
+			out = append(out, r.Name)
+		}
+		return out
+	}
+
+	if got := names(`person:"Henry David Thoreau"`); !reflect.DeepEqual(got, []string{"walden.txt"}) {
+		t.Errorf("person phrase query: got %v", got)
+	}
+	// the field filters, the free text ranks
+	if got := names(`pond person:emerson`); !reflect.DeepEqual(got, []string{"letters.txt", "essays.txt"}) {
+		t.Errorf("filtered query: got %v", got)
+	}
+	// "place" is known but "planet" is not a field, so it stays free text
+	if got := names(`planet:concord`); len(got) != 0 {
+		t.Errorf("unknown field should not match: got %v", got)
+	}
+
+	results, _ := index.Search(context.Background(), []string{"place:concord"}, SearchOpts{Limit: 5})
+	facets := EntityFacets(results, "person")
+	want := []FacetCount{{"emerson", 1}, {"henry david thoreau", 1}}
+	if !reflect.DeepEqual(facets, want) {
+		t.Errorf("facets: got %v, want %v", facets, want)
+	}
+}
+
+// pathExtractor extracts the first line of a document as its path.
+type pathExtractor struct{}
+
+func (pathExtractor) Extract(text string) []Entity {
+	path, _, _ := strings.Cut(text, "\n")
+	return []Entity{{Kind: "path", Text: path}}
+}
+
+func TestFieldAnalyzers(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "a.md", Content: "src/Search.go\nthe search loop"},
+		Document{Name: "b.md", Content: "src/search_test.go\nthe search tests"},
+		Document{Name: "c.md", Content: "docs/index.md\nthe docs"},
+	)
+	index, err := NewIndexBuilder().Source(docs, LoadOpts{}).
+		Entities(pathExtractor{}).
+		FieldAnalyzer("path", "keyword").
+		Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := index.docs["a.md"].Entities["path"]; !reflect.DeepEqual(got, []string{"src/search.go"}) {
+		t.Fatalf("expected the path kept whole, got %v", got)
+	}
+
+	for _, storage := range []StorageOpts{{Format: FormatJSON}, {Format: FormatProto}} {
+		index.storage = storage
+		var buf bytes.Buffer
+		if err := index.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		// the saved analyzer is used without being configured again
+		loaded, err := ReadIndex(context.Background(), &buf, docs, DocOpts{Entities: pathExtractor{}, Storage: storage})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := loaded.Search(context.Background(), []string{`path:"SRC/search.go"`}, SearchOpts{Limit: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Name != "a.md" {
+			t.Errorf("%v: expected a.md, got %+v", storage.Format, results)
+		}
+	}
+
+	if _, err := NewIndexBuilder().Source(docs, LoadOpts{}).FieldAnalyzer("path", "nope").Build(context.Background()); err == nil {
+		t.Error("expected an error for an unknown analyzer")
+	}
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Errors returned, possibly wrapped, by the functions of the package. Test
+// for them with errors.Is.
+var (
+	// ErrIndexNotFound means there's no saved index (or documents file)
+	// where one was expected: build one.
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrCorruptIndex means a saved index couldn't be decoded.
+	ErrCorruptIndex = errors.New("corrupt index")
+	// ErrUnsupportedFormat means a saved index is of a format version this
+	// package doesn't know, such as one written by a newer version.
+	ErrUnsupportedFormat = errors.New("unsupported index format")
+	// ErrEmptyCorpus means there were no documents to build an index from.
+	ErrEmptyCorpus = errors.New("empty corpus")
+	// ErrDocumentNotFound means a document isn't in the index.
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrTextWithheld means the text of documents was asked of an index
+	// that withholds it; see DocOpts.WithholdText.
+	ErrTextWithheld = errors.New("document text is withheld")
+)
+
+// DocLoadError records a document, or directory of documents, that couldn't
+// be loaded, and why.
+type DocLoadError struct {
+	Path string
+	Err  error
+}
+
+func (e *DocLoadError) Error() string {
+	return fmt.Sprintf("failed to load %s: %v", e.Path, e.Err)
+}
+
+func (e *DocLoadError) Unwrap() error {
+	return e.Err
+}
+
+// openIndexFile opens a saved index or documents file. A missing file is
+// reported as ErrIndexNotFound, as well as fs.ErrNotExist.
+func openIndexFile(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrIndexNotFound, err)
+	}
+	return f, err
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := LoadDocuments(StorageOpts{DocsPath: filepath.Join(dir, "missing")})
+	if !errors.Is(err, ErrIndexNotFound) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: got %v", err)
+	}
+	if _, err := LoadCatalog(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing catalog: got %v", err)
+	}
+
+	for format, data := range map[Format][]byte{
+		FormatJSON:  []byte(`{"t_map": `),
+		FormatProto: {0x12, 0x05, 0x0a},
+	} {
+		_, err := ReadIndex(context.Background(), bytes.NewReader(data), nil, DocOpts{Storage: StorageOpts{Format: format}})
+		if !errors.Is(err, ErrCorruptIndex) {
+			t.Errorf("format %v: expected ErrCorruptIndex, got %v", format, err)
+		}
+	}
+	for data, want := range map[string]error{
+		`{"magic": "infrared-index", "format_version": 2, "t_map": {}}`: ErrUnsupportedFormat,
+		`{"magic": "infrared-index", "t_map": {}}`:                      ErrUnsupportedFormat,
+		`{"magic": "something-else", "format_version": 1}`:              ErrCorruptIndex,
+		`{"name": "not an index"}`:                                      ErrCorruptIndex,
+	} {
+		if _, err := ReadIndex(context.Background(), strings.NewReader(data), nil, DocOpts{}); !errors.Is(err, want) {
+			t.Errorf("%s: expected %v, got %v", data, want, err)
+		}
+	}
+	if _, err := ReadDocuments(strings.NewReader(`{"magic": "infrared-index", "format_version": 2, "docs": []}`), FormatJSON); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat for newer documents, got %v", err)
+	}
+	future := appendVarintField(nil, 1, protoFormatVersion+1)
+	if _, err := UnmarshalProto(future, DocOpts{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+
+	_, err = DefaultLoader(context.Background(), LoadOpts{Path: filepath.Join(dir, "nope")})
+	var loadErr *DocLoadError
+	if !errors.As(err, &loadErr) || loadErr.Path != filepath.Join(dir, "nope") {
+		t.Errorf("expected a DocLoadError for the directory, got %v", err)
+	}
+	if _, err := NewIndex(context.Background(), DefaultLoader, DocOpts{Load: LoadOpts{Path: filepath.Join(dir, "nope")}}); !errors.As(err, &loadErr) {
+		t.Errorf("expected NewIndex to return the DocLoadError, got %v", err)
+	}
+	if _, err := LoadIndex(context.Background(), nil, DocOpts{Storage: StorageOpts{Path: filepath.Join(dir, "nope.json")}}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected LoadIndex to return a missing file's error, got %v", err)
+	}
+
+	if _, err := NewIndexBuilder().Source(memLoader(), LoadOpts{}).Build(context.Background()); !errors.Is(err, ErrEmptyCorpus) {
+		t.Errorf("expected ErrEmptyCorpus, got %v", err)
+	}
+}
+
+func TestUnversionedJSON(t *testing.T) {
+	// saved before indexes had a header, and before documents had a TokenCount
+	legacy := `{"t_map": {"winter": {"idf": 2, "tf_map": {"pond.md": 0.25}}},
+		"docs": [{"name": "pond.md", "Length": 4, "Content": "the pond in winter"}, {"name": "city.md", "Length": 4}]}`
+	idx, err := ReadIndex(context.Background(), strings.NewReader(legacy), nil, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := idx.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 1})
+	if err != nil || len(results) != 1 || results[0].Name != "pond.md" {
+		t.Fatalf("expected pond.md, got %+v (%v)", results, err)
+	}
+
+	var buf bytes.Buffer
+	if err := idx.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), `{"magic":"infrared-index","format_version":1,`) {
+		t.Errorf("expected a resaved index to have a header, got %.60s", buf.String())
+	}
+}
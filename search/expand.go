@@ -0,0 +1,76 @@
+package search
+
+import "strings"
+
+// Expansions is a dictionary of equivalent phrases, such as acronyms and their
+// long forms: {"IR": {"information retrieval"}}. Equivalence is symmetric, so
+// "IR" also matches documents that spell out "information retrieval" and vice
+// versa. The dictionary is applied to documents at index time and to queries
+// at search time.
+type Expansions map[string][]string
+
+// expander is an Expansions dictionary compiled with the index normalizer.
+type expander struct {
+	entries  map[string][]string // normalized phrase -> equivalent normalized phrases
+	maxWords int                 // length of the longest phrase, in words
+	ngrams   ngramRange
+}
+
+func newExpander(dict Expansions, normalize Normalizer, ngrams ngramRange) *expander {
+	if len(dict) == 0 {
+		return nil
+	}
+	e := &expander{entries: make(map[string][]string), ngrams: ngrams}
+	add := func(from, to string) {
+		if from == "" || to == "" || from == to {
+			return
+		}
+		for _, existing := range e.entries[from] {
+			if existing == to {
+				return
+			}
+		}
+		e.entries[from] = append(e.entries[from], to)
+		e.maxWords = max(e.maxWords, len(strings.Fields(from)))
+	}
+	for key, values := range dict {
+		k := strings.Join(strings.Fields(normalize(key)), " ")
+		for _, value := range values {
+			v := strings.Join(strings.Fields(normalize(value)), " ")
+			add(k, v)
+			add(v, k)
+		}
+	}
+	return e
+}
+
+// expand scans words for dictionary phrases, preferring the longest match at
+// each position, and returns the terms of every equivalent phrase. A
+// multi-word equivalent contributes its own words and n-grams, so a document
+// containing "IR" gets "information", "retrieval" and "information retrieval"
+// just as if the phrase had been written out; n-grams never straddle the
+// boundary between an expansion and the surrounding text.
+func (e *expander) expand(words []string) []string {
+	if e == nil {
+		return nil
+	}
+	var terms []string
+	for i := 0; i < len(words); {
+		matched := 0
+		for n := min(e.maxWords, len(words)-i); n > 0; n-- {
+			phrase := strings.Join(words[i:i+n], " ")
+			if equivalents, ok := e.entries[phrase]; ok {
+				for _, eq := range equivalents {
+					terms = append(terms, e.ngrams.terms(strings.Fields(eq))...)
+				}
+				matched = n
+				break
+			}
+		}
+		if matched == 0 {
+			matched = 1
+		}
+		i += matched
+	}
+	return terms
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestExpansionsMatchBothForms(t *testing.T) {
+	opts := DocOpts{Expansions: Expansions{"IR": {"information retrieval"}}}
+	index := mustIndex(t, memLoader(
+		Document{Name: "short.txt", Content: "IR systems rank documents"},
+		Document{Name: "long.txt", Content: "information retrieval is an old field"},
+		Document{Name: "other.txt", Content: "recipes for bread"},
+	), opts)
+
+	for _, query := range [][]string{{"ir"}, {"information", "retrieval"}} {
+		results, err := index.Search(context.Background(), query, SearchOpts{Limit: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := map[string]bool{}
+		for _, r := range results {
+			names[r.Name] = true
+		}
+		if !names["short.txt"] || !names["long.txt"] || names["other.txt"] {
+			t.Errorf("query %v: expected short.txt and long.txt, got %v", query, names)
+		}
+	}
+}
+
+func TestExpansionsPreferLongestMatch(t *testing.T) {
+	e := newExpander(Expansions{
+		"information retrieval":        {"ir"},
+		"information retrieval system": {"search engine"},
+	}, DefaultNormalizer, defaultNGrams)
+
+	got := map[string]bool{}
+	for _, term := range e.expand([]string{"an", "information", "retrieval", "system"}) {
+		got[term] = true
+	}
+	want := map[string]bool{"search": true, "engine": true, "search engine": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// expired reports whether the document has expired by now.
+func (doc Document) expired(now time.Time) bool {
+	return doc.ExpiresAt != nil && !now.Before(*doc.ExpiresAt)
+}
+
+// Expired returns the sorted names of the documents that have expired by now.
+func (idx *Index) Expired(now time.Time) []string {
+	var names []string
+	for name, doc := range idx.docs {
+		if doc.expired(now) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RemoveExpired removes the documents of the current index that have
+// expired by now, and returns how many it removed. Search already leaves
+// expired documents out; removing them frees their postings and stops them
+// from counting towards term statistics.
+func (m *IndexManager) RemoveExpired(now time.Time) (int, error) {
+	if len(m.Index().Expired(now)) == 0 {
+		// nothing to swap in
+		return 0, nil
+	}
+	removed := 0
+	err := m.Update(func(idx *Index) (*Index, error) {
+		names := idx.Expired(now)
+		removed = len(names)
+		if removed == 0 {
+			return idx, nil
+		}
+		return idx.RemoveDocuments(names)
+	})
+	return removed, err
+}
+
+// SweepExpired calls RemoveExpired every interval until ctx is done, and
+// returns ctx's error, or the error of the first sweep that failed. It's
+// meant to run in a goroutine of its own:
+//
+//	go m.SweepExpired(ctx, time.Hour)
+func (m *IndexManager) SweepExpired(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if _, err := m.RemoveExpired(now); err != nil {
+				return err
+			}
+		}
+	}
+}
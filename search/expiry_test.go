@@ -0,0 +1,51 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	index := mustIndex(t, memLoader(
+		Document{Name: "old.md", Content: "job posting for a winter caretaker", ExpiresAt: &past},
+		Document{Name: "new.md", Content: "job posting for a summer gardener", ExpiresAt: &future},
+		Document{Name: "page.md", Content: "about the pond"},
+	), DocOpts{})
+
+	results, err := index.Search(context.Background(), []string{"job"}, SearchOpts{Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "new.md" {
+		t.Errorf("expected the expired posting to be left out, got %+v", results)
+	}
+
+	data, err := index.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := UnmarshalProto(data, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc, _ := loaded.Document("new.md"); doc.ExpiresAt == nil || !doc.ExpiresAt.Equal(future) {
+		t.Errorf("expected the expiry to be saved with the index, got %v", doc.ExpiresAt)
+	}
+
+	m := NewIndexManager(index)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- m.SweepExpired(ctx, time.Millisecond) }()
+	for m.Index().DocCount() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected the sweep to stop when canceled, got %v", err)
+	}
+	if _, ok := m.Index().Document("old.md"); ok {
+		t.Error("expected the sweep to remove the expired document")
+	}
+}
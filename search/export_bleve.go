@@ -0,0 +1,138 @@
+package search
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// bleveField and bleveDocMapping mirror the JSON form of Bleve's
+// mapping.FieldMapping and mapping.DocumentMapping.
+type bleveField struct {
+	Type         string `json:"type"`
+	Analyzer     string `json:"analyzer,omitempty"`
+	Store        bool   `json:"store"`
+	Index        bool   `json:"index"`
+	IncludeInAll bool   `json:"include_in_all"`
+	DocValues    bool   `json:"docvalues"`
+}
+
+type bleveDocMapping struct {
+	Enabled    bool                       `json:"enabled"`
+	Dynamic    bool                       `json:"dynamic"`
+	Properties map[string]bleveDocMapping `json:"properties,omitempty"`
+	Fields     []bleveField               `json:"fields,omitempty"`
+}
+
+type bleveIndexMapping struct {
+	DefaultMapping  bleveDocMapping `json:"default_mapping"`
+	TypeField       string          `json:"type_field"`
+	DefaultType     string          `json:"default_type"`
+	DefaultAnalyzer string          `json:"default_analyzer"`
+	DefaultField    string          `json:"default_field"`
+	StoreDynamic    bool            `json:"store_dynamic"`
+	IndexDynamic    bool            `json:"index_dynamic"`
+}
+
+// BleveDoc is a document in the shape described by BleveMapping.
+type BleveDoc struct {
+	Name     string              `json:"name"`
+	Date     string              `json:"date,omitempty"` // RFC 3339, omitted if Document.Date can't be parsed
+	Preview  string              `json:"preview"`
+	Content  string              `json:"content"`
+	Length   int                 `json:"length"`
+	Entities map[string][]string `json:"entities,omitempty"`
+}
+
+// BleveMapping returns a Bleve index mapping, as JSON, describing the fields
+// of this index: name and entities as exact-match keywords, content as
+// analyzed text, date as a datetime and preview as a stored-only field.
+// Unmarshal it into a bleve.NewIndexMapping() to create the Bleve index.
+func (idx *Index) BleveMapping() ([]byte, error) {
+	field := func(typ, analyzer string, store, index bool) bleveDocMapping {
+		return bleveDocMapping{Enabled: true, Fields: []bleveField{{
+			Type: typ, Analyzer: analyzer, Store: store, Index: index, IncludeInAll: index && typ == "text", DocValues: index,
+		}}}
+	}
+
+	props := map[string]bleveDocMapping{
+		"name":    field("text", "keyword", true, true),
+		"date":    field("datetime", "", true, true),
+		"preview": field("text", "", true, false),
+		"content": field("text", "standard", false, true),
+		"length":  field("number", "", true, true),
+	}
+	if len(idx.fields) > 0 {
+		entities := bleveDocMapping{Enabled: true, Properties: make(map[string]bleveDocMapping)}
+		for kind := range idx.fields {
+			entities.Properties[kind] = field("text", "keyword", true, true)
+		}
+		props["entities"] = entities
+	}
+
+	return json.MarshalIndent(bleveIndexMapping{
+		DefaultMapping:  bleveDocMapping{Enabled: true, Properties: props},
+		TypeField:       "_type",
+		DefaultType:     "_default",
+		DefaultAnalyzer: "standard",
+		DefaultField:    "_all",
+	}, "", "  ")
+}
+
+// BleveDocs returns the indexed documents, sorted by name, ready to be passed
+// to bleve.Index.Index(doc.Name, doc).
+func (idx *Index) BleveDocs() []BleveDoc {
+	docs := make([]BleveDoc, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		bd := BleveDoc{
+			Name:     doc.Name,
+			Preview:  doc.Preview,
+			Content:  doc.Content,
+			Length:   doc.Length,
+			Entities: doc.Entities,
+		}
+		if t, ok := parseDate(doc.Date); ok {
+			bd.Date = t.Format(time.RFC3339)
+		}
+		docs = append(docs, bd)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs
+}
+
+// ExportBleve writes dir/mapping.json and one dir/docs/<name>.json file per
+// document, the layout expected by the bleve command line tool:
+//
+//	bleve create index.bleve --mapping dir/mapping.json
+//	bleve index index.bleve dir/docs
+//
+// Document names are path-escaped to make valid file names.
+func (idx *Index) ExportBleve(dir string) error {
+	docsDir := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(docsDir, 0755); err != nil {
+		return err
+	}
+
+	mapping, err := idx.BleveMapping()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "mapping.json"), mapping, 0644); err != nil {
+		return err
+	}
+
+	for _, doc := range idx.BleveDocs() {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		name := url.PathEscape(doc.Name) + ".json"
+		if err := os.WriteFile(filepath.Join(docsDir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
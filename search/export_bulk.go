@@ -0,0 +1,68 @@
+package search
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+)
+
+// bulkKeywords is the number of keywords exported per document.
+const bulkKeywords = 10
+
+type bulkAction struct {
+	Index struct {
+		ID string `json:"_id"`
+	} `json:"index"`
+}
+
+type bulkSource struct {
+	BleveDoc
+	Keywords []string `json:"keywords,omitempty"` // the document's highest tf-idf words
+}
+
+// ExportBulk writes every document in the Elasticsearch/OpenSearch _bulk
+// NDJSON format: an index action keyed by document name followed by the
+// document source, including computed metadata (length, normalized date,
+// entities and top keywords). No _index is set, so post the output to
+// /<index>/_bulk.
+func (idx *Index) ExportBulk(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	keywords := idx.keywords(bulkKeywords)
+	for _, doc := range idx.BleveDocs() {
+		var action bulkAction
+		action.Index.ID = doc.Name
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(bulkSource{BleveDoc: doc, Keywords: keywords[doc.Name]}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// keywords returns up to n single-word terms per document, ordered by tf-idf.
+func (idx *Index) keywords(n int) map[string][]string {
+	weights := make(map[string][]TermWeight)
+	for term, tfreq := range idx.tmap {
+		if strings.Contains(term, " ") || isFieldTerm(term) {
+			continue
+		}
+		logIdf := math.Log(idx.idf(term))
+		idx.eachPosting(tfreq, func(name string, tf float64) {
+			weights[name] = append(weights[name], TermWeight{Term: term, Weight: tf * logIdf})
+		})
+	}
+
+	keywords := make(map[string][]string, len(weights))
+	for name, ws := range weights {
+		sortWeights(ws)
+		for i := 0; i < len(ws) && i < n; i++ {
+			keywords[name] = append(keywords[name], ws[i].Term)
+		}
+	}
+	return keywords
+}
@@ -0,0 +1,211 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// lunrVersion is the lunr.js release whose serialized index format ExportLunr produces.
+const lunrVersion = "2.3.9"
+
+// lunr's BM25 parameters, matching lunr.Builder defaults.
+const (
+	lunrK1 = 1.2
+	lunrB  = 0.75
+)
+
+type lunrIndex struct {
+	Version       string   `json:"version"`
+	Fields        []string `json:"fields"`
+	FieldVectors  [][2]any `json:"fieldVectors"`  // [ "field/ref", [termIndex, score, ...] ]
+	InvertedIndex [][2]any `json:"invertedIndex"` // [ term, { "_index": n, field: { ref: {} } } ]
+	Pipeline      []string `json:"pipeline"`
+}
+
+// ExportLunr writes a prebuilt lunr.js index (load it with lunr.Index.load)
+// over the name and content fields, with document names as refs. Terms are
+// produced by this index's normalizer instead of lunr's pipeline, and the
+// exported search pipeline is empty, so browser queries should be lowercased
+// and stripped of punctuation the same way.
+func (idx *Index) ExportLunr(w io.Writer) error {
+	fields := []string{"name", "content"}
+	docs := idx.BleveDocs()
+
+	// term counts per field and document
+	counts := make(map[string][]map[string]int, len(fields))
+	lengths := make(map[string][]int, len(fields))
+	avg := make(map[string]float64, len(fields))
+	df := make(map[string]int)
+	for _, field := range fields {
+		counts[field] = make([]map[string]int, len(docs))
+		lengths[field] = make([]int, len(docs))
+	}
+	for i, doc := range docs {
+		seen := make(map[string]bool)
+		for _, field := range fields {
+			text := doc.Content
+			if field == "name" {
+				text = nameText(doc.Name)
+			}
+			tokens := strings.Fields(idx.normalizer(text))
+			counts[field][i] = make(map[string]int)
+			for _, tok := range tokens {
+				counts[field][i][tok]++
+				if !seen[tok] {
+					seen[tok] = true
+					df[tok]++
+				}
+			}
+			lengths[field][i] = len(tokens)
+			avg[field] += float64(len(tokens)) / float64(len(docs))
+		}
+	}
+
+	terms := make([]string, 0, len(df))
+	for term := range df {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	termIndex := make(map[string]int, len(terms))
+	for i, term := range terms {
+		termIndex[term] = i
+	}
+
+	out := lunrIndex{Version: lunrVersion, Fields: fields, Pipeline: []string{}}
+	postings := make([]map[string]map[string]struct{}, len(terms))
+	for i := range postings {
+		postings[i] = make(map[string]map[string]struct{}, len(fields))
+		for _, field := range fields {
+			postings[i][field] = make(map[string]struct{})
+		}
+	}
+
+	n := float64(len(docs))
+	for _, field := range fields {
+		for i, doc := range docs {
+			var vector []any
+			fieldTerms := make([]string, 0, len(counts[field][i]))
+			for term := range counts[field][i] {
+				fieldTerms = append(fieldTerms, term)
+			}
+			sort.Slice(fieldTerms, func(a, b int) bool { return termIndex[fieldTerms[a]] < termIndex[fieldTerms[b]] })
+			for _, term := range fieldTerms {
+				tf := float64(counts[field][i][term])
+				d := float64(df[term])
+				idf := math.Log(1 + math.Abs((n-d+0.5)/(d+0.5)))
+				norm := 1.0
+				if avg[field] > 0 {
+					norm = float64(lengths[field][i]) / avg[field]
+				}
+				score := idf * ((lunrK1 + 1) * tf) / (lunrK1*(1-lunrB+lunrB*norm) + tf)
+				vector = append(vector, termIndex[term], math.Round(score*1000)/1000)
+				postings[termIndex[term]][field][doc.Name] = struct{}{}
+			}
+			out.FieldVectors = append(out.FieldVectors, [2]any{field + "/" + doc.Name, nonNil(vector)})
+		}
+	}
+	for i, term := range terms {
+		entry := map[string]any{"_index": i}
+		for field, refs := range postings[i] {
+			entry[field] = refs
+		}
+		out.InvertedIndex = append(out.InvertedIndex, [2]any{term, entry})
+	}
+
+	return json.NewEncoder(w).Encode(out)
+}
+
+type fuseKey struct {
+	Path   []string `json:"path"`
+	ID     string   `json:"id"`
+	Weight float64  `json:"weight"`
+	Src    string   `json:"src"`
+}
+
+type fuseValue struct {
+	V string  `json:"v"`
+	N float64 `json:"n"`
+}
+
+type fuseRecord struct {
+	I int                  `json:"i"`
+	S map[string]fuseValue `json:"$"`
+}
+
+type fuseIndex struct {
+	Keys    []fuseKey    `json:"keys"`
+	Records []fuseRecord `json:"records"`
+}
+
+// ExportFuse writes a prebuilt fuse.js index (load it with Fuse.parseIndex)
+// to index and the matching document list, as a JSON array of objects, to
+// docs. Keys select the document fields to search and may be any of "name",
+// "date", "preview" and "content"; the default is name and preview.
+//
+//	const fuse = new Fuse(docs, { keys }, Fuse.parseIndex(index))
+func (idx *Index) ExportFuse(index, docs io.Writer, keys ...string) error {
+	if len(keys) == 0 {
+		keys = []string{"name", "preview"}
+	}
+	out := fuseIndex{Records: []fuseRecord{}}
+	for _, key := range keys {
+		switch key {
+		case "name", "date", "preview", "content":
+		default:
+			return fmt.Errorf("unsupported fuse key %q", key)
+		}
+		out.Keys = append(out.Keys, fuseKey{Path: []string{key}, ID: key, Weight: 1, Src: key})
+	}
+
+	list := []map[string]string{}
+	for i, doc := range idx.BleveDocs() {
+		values := map[string]string{"name": doc.Name, "date": doc.Date, "preview": doc.Preview, "content": doc.Content}
+		item := make(map[string]string, len(keys))
+		rec := fuseRecord{I: i, S: make(map[string]fuseValue)}
+		for k, key := range keys {
+			item[key] = values[key]
+			if values[key] != "" {
+				rec.S[fmt.Sprint(k)] = fuseValue{V: values[key], N: fuseNorm(values[key])}
+			}
+		}
+		list = append(list, item)
+		out.Records = append(out.Records, rec)
+	}
+
+	if err := json.NewEncoder(index).Encode(out); err != nil {
+		return err
+	}
+	return json.NewEncoder(docs).Encode(list)
+}
+
+// fuseNorm is fuse.js's field-length norm: 1/sqrt(number of space-separated tokens), to 3 decimals.
+func fuseNorm(value string) float64 {
+	tokens := len(strings.FieldsFunc(value, func(r rune) bool { return r == ' ' }))
+	if tokens == 0 {
+		return 1
+	}
+	return math.Round(1/math.Sqrt(float64(tokens))*1000) / 1000
+}
+
+// nameText turns separators in a document name into spaces so its parts tokenize as words.
+func nameText(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, name)
+}
+
+// nonNil returns an empty slice instead of nil so it encodes as [] rather than null.
+func nonNil(v []any) []any {
+	if v == nil {
+		return []any{}
+	}
+	return v
+}
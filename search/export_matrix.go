@@ -0,0 +1,117 @@
+package search
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MatrixOpts selects the terms of an exported term-document matrix.
+type MatrixOpts struct {
+	// MaxN is the longest n-gram exported, in words; 0 exports single words
+	// only, as most topic models expect
+	MaxN int
+	// Fields exports entity field terms, like person:thoreau, as well
+	Fields bool
+}
+
+// ExportMatrix writes the term-document matrix of the index to dir, for
+// topic models and the like to run on the index's own tokenization:
+//
+//	matrix.mtx  the matrix in Matrix Market coordinate format: one row per
+//	            document, one column per term, and the number of times the
+//	            term occurs in the document as the entry
+//	docs.txt    the document names, one per line, in row order
+//	terms.txt   the terms, one per line, in column order
+//
+// Rows and columns are numbered from 1 and sorted by name; entries are
+// sorted by row, then column. scipy.io.mmread and gensim's MmCorpus read
+// the matrix as it is. Only terms the index kept are exported, so stop
+// words and the terms pruned as too common are missing. The index needs
+// its stored documents, for their lengths.
+func (idx *Index) ExportMatrix(dir string, opts MatrixOpts) error {
+	if len(idx.docs) == 0 && len(idx.tmap) > 0 {
+		return errors.New("cannot export the matrix of an index without its stored documents")
+	}
+	maxN := max(opts.MaxN, 1)
+	var terms []string
+	for term := range idx.tmap {
+		if isFieldTerm(term) {
+			if opts.Fields {
+				terms = append(terms, term)
+			}
+		} else if strings.Count(term, " ") < maxN {
+			terms = append(terms, term)
+		}
+	}
+	sort.Strings(terms)
+	names := make([]string, 0, len(idx.docs))
+	for name := range idx.docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make(map[string]int, len(names))
+	for i, name := range names {
+		rows[name] = i
+	}
+
+	// the entries of each row, gathered column by column so they're in order
+	type entry struct{ col, count int }
+	entries := make([][]entry, len(names))
+	nonzero := 0
+	for col, term := range terms {
+		idx.eachPosting(idx.tmap[term], func(name string, tf float64) {
+			row, ok := rows[name]
+			if !ok {
+				return
+			}
+			count := int(math.Round(tf * float64(idx.docs[name].tokens())))
+			entries[row] = append(entries[row], entry{col, max(count, 1)})
+			nonzero++
+		})
+	}
+	for _, es := range entries {
+		sort.Slice(es, func(i, j int) bool { return es[i].col < es[j].col })
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	err := writeFile(filepath.Join(dir, "matrix.mtx"), func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		fmt.Fprintln(bw, "%%MatrixMarket matrix coordinate integer general")
+		fmt.Fprintln(bw, "% rows are the documents of docs.txt, columns the terms of terms.txt")
+		fmt.Fprintf(bw, "%d %d %d\n", len(names), len(terms), nonzero)
+		for row, es := range entries {
+			for _, e := range es {
+				fmt.Fprintf(bw, "%d %d %d\n", row+1, e.col+1, e.count)
+			}
+		}
+		return bw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeLines(filepath.Join(dir, "docs.txt"), names); err != nil {
+		return err
+	}
+	return writeLines(filepath.Join(dir, "terms.txt"), terms)
+}
+
+// writeLines writes lines to the file at path, one per line.
+func writeLines(path string, lines []string) error {
+	return writeFile(path, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		for _, line := range lines {
+			bw.WriteString(line)
+			bw.WriteByte('\n')
+		}
+		return bw.Flush()
+	})
+}
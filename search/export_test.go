@@ -0,0 +1,186 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportBleve(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "notes/a.md", Date: "2022-05-09", Content: "Thoreau at the pond"},
+		Document{Name: "b.md", Content: "nothing here"},
+	), DocOpts{Entities: Gazetteer{"Thoreau": "person"}})
+
+	dir := t.TempDir()
+	if err := index.ExportBleve(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var mapping bleveIndexMapping
+	data, err := os.ReadFile(filepath.Join(dir, "mapping.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		t.Fatal(err)
+	}
+	props := mapping.DefaultMapping.Properties
+	if props["content"].Fields[0].Analyzer != "standard" || props["name"].Fields[0].Analyzer != "keyword" {
+		t.Errorf("unexpected field analyzers: %+v", props)
+	}
+	if _, ok := props["entities"].Properties["person"]; !ok {
+		t.Error("expected an entities.person field")
+	}
+
+	var doc BleveDoc
+	data, err = os.ReadFile(filepath.Join(dir, "docs", "notes%2Fa.md.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Date != "2022-05-09T00:00:00Z" || doc.Entities["person"][0] != "thoreau" {
+		t.Errorf("unexpected exported doc %+v", doc)
+	}
+}
+
+func TestExportBulk(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "a.md", Content: "pond pond water"},
+		Document{Name: "b.md", Content: "city streets water"},
+	), DocOpts{})
+
+	var buf bytes.Buffer
+	if err := index.ExportBulk(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 NDJSON lines, got %d:\n%s", len(lines), buf.String())
+	}
+	if lines[0] != `{"index":{"_id":"a.md"}}` {
+		t.Errorf("unexpected action line %s", lines[0])
+	}
+	var src bulkSource
+	if err := json.Unmarshal([]byte(lines[1]), &src); err != nil {
+		t.Fatal(err)
+	}
+	if src.Name != "a.md" || src.Length != 3 || len(src.Keywords) == 0 || src.Keywords[0] != "pond" {
+		t.Errorf("unexpected source %+v", src)
+	}
+}
+
+func TestExportLunrAndFuse(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond_notes.md", Preview: "by the pond", Content: "pond pond water"},
+		Document{Name: "city.md", Preview: "the city", Content: "city streets water"},
+	), DocOpts{})
+
+	var lunr bytes.Buffer
+	if err := index.ExportLunr(&lunr); err != nil {
+		t.Fatal(err)
+	}
+	var li struct {
+		Fields        []string
+		FieldVectors  [][2]json.RawMessage
+		InvertedIndex [][2]json.RawMessage
+	}
+	if err := json.Unmarshal(lunr.Bytes(), &li); err != nil {
+		t.Fatal(err)
+	}
+	if len(li.FieldVectors) != 4 {
+		t.Errorf("expected a vector per field and document, got %d", len(li.FieldVectors))
+	}
+	var first string
+	json.Unmarshal(li.InvertedIndex[0][0], &first)
+	if first != "city" {
+		t.Errorf("expected sorted inverted index starting with city, got %q", first)
+	}
+	var pond map[string]json.RawMessage
+	for _, entry := range li.InvertedIndex {
+		var term string
+		json.Unmarshal(entry[0], &term)
+		if term == "pond" {
+			json.Unmarshal(entry[1], &pond)
+		}
+	}
+	if string(pond["content"]) != `{"pond_notes.md":{}}` || string(pond["name"]) != `{"pond_notes.md":{}}` {
+		t.Errorf("unexpected pond posting %s", pond)
+	}
+
+	var fi, fd bytes.Buffer
+	if err := index.ExportFuse(&fi, &fd, "name"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(fi.String()); got != `{"keys":[{"path":["name"],"id":"name","weight":1,"src":"name"}],"records":[{"i":0,"$":{"0":{"v":"city.md","n":1}}},{"i":1,"$":{"0":{"v":"pond_notes.md","n":1}}}]}` {
+		t.Errorf("unexpected fuse index %s", got)
+	}
+	if got := strings.TrimSpace(fd.String()); got != `[{"name":"city.md"},{"name":"pond_notes.md"}]` {
+		t.Errorf("unexpected fuse docs %s", got)
+	}
+	if err := index.ExportFuse(&fi, &fd, "secret"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+func TestExportMatrix(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "a.md", Content: "pond pond water"},
+		Document{Name: "b.md", Content: "city streets water"},
+		Document{Name: "c.md", Content: "deep dark woods"},
+	), DocOpts{})
+
+	dir := t.TempDir()
+	if err := index.ExportMatrix(dir, MatrixOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) []string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	if docs := read("docs.txt"); strings.Join(docs, ",") != "a.md,b.md,c.md" {
+		t.Errorf("unexpected documents %q", docs)
+	}
+	terms := read("terms.txt")
+	col := make(map[string]int)
+	for i, term := range terms {
+		if strings.Contains(term, " ") {
+			t.Errorf("unexpected n-gram %q", term)
+		}
+		col[term] = i + 1
+	}
+	matrix := read("matrix.mtx")
+	if matrix[0] != "%%MatrixMarket matrix coordinate integer general" {
+		t.Errorf("unexpected header %q", matrix[0])
+	}
+	entries := make(map[string]bool)
+	for _, line := range matrix[2:] {
+		entries[line] = true
+	}
+	for _, want := range []string{
+		fmt.Sprintf("3 %d %d", len(terms), len(matrix)-3),
+		fmt.Sprintf("1 %d 2", col["pond"]),
+		fmt.Sprintf("2 %d 1", col["water"]),
+		fmt.Sprintf("3 %d 1", col["woods"]),
+	} {
+		if !entries[want] {
+			t.Errorf("expected the line %q in %q", want, matrix)
+		}
+	}
+
+	if err := index.ExportMatrix(dir, MatrixOpts{MaxN: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(read("terms.txt")) <= len(terms) {
+		t.Error("expected bigrams with MaxN 2")
+	}
+}
@@ -0,0 +1,215 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Steps of SearchFallback, in the order they're tried.
+const (
+	RelaxMinScore = "min_score" // SearchOpts.MinScore was ignored
+	RelaxField    = "field"     // the field terms matching the fewest documents were dropped
+	RelaxSpelling = "spelling"  // words that aren't in the index were corrected
+)
+
+// Relaxation describes how SearchFallback relaxed a query that found
+// nothing, for a "showing results for" line.
+type Relaxation struct {
+	// Applied lists the steps taken, in order; it's empty if the query
+	// found results as it was
+	Applied []string `json:"applied,omitempty"`
+	// Terms is the query that found the results, or the last one tried
+	Terms []string `json:"terms"`
+	// Corrections maps each corrected word to its correction
+	Corrections map[string]string `json:"corrections,omitempty"`
+}
+
+// SearchFallback searches like Search but, when nothing is found, relaxes
+// the query a step at a time until something is: first it ignores
+// MinScore, then it drops field terms, those matching the fewest documents
+// first, then it corrects misspelled words to the nearest indexed word.
+// Each step keeps the ones before it, and the filters of Intents apply to
+// all of them. The Relaxation says which were
+// needed, so they can be shown alongside the results.
+func (idx Index) SearchFallback(ctx context.Context, terms []string, opts SearchOpts) ([]SearchResult, Relaxation, error) {
+	relax := Relaxation{Terms: terms}
+	results, err := idx.Search(ctx, terms, opts)
+	if err != nil || len(results) > 0 {
+		return results, relax, err
+	}
+
+	// the intents' filters are kept through every step, and their words
+	// kept out of the query relaxed
+	cleaned, filters := opts.Intents.extract(cleanTerms(terms))
+	q := idx.ParseQuery(cleaned)
+	for _, rewrite := range opts.Rewriters {
+		q = rewrite(q)
+	}
+	// search the relaxed query as it is, rather than parse it again
+	search := func(q Query, step string) ([]SearchResult, error) {
+		relax.Applied = append(relax.Applied, step)
+		relax.Terms = q.terms()
+		for _, filter := range filters {
+			relax.Terms = append(relax.Terms, filter.word)
+		}
+		relaxed := opts
+		relaxed.Rewriters = []func(Query) Query{func(Query) Query { return q }}
+		relaxed.Intents = nil
+		relaxed.filters = append(relaxed.filters, filters...)
+		return idx.Search(ctx, nil, relaxed)
+	}
+
+	if opts.MinScore > 0 {
+		opts.MinScore = 0
+		if results, err = search(q, RelaxMinScore); err != nil || len(results) > 0 {
+			return results, relax, err
+		}
+	}
+
+	fields := append([]FieldTerm(nil), q.Fields...)
+	sort.SliceStable(fields, func(i, j int) bool {
+		return idx.docFreq(idx.tmap[fieldTerm(fields[i].Field, fields[i].Value)]) <
+			idx.docFreq(idx.tmap[fieldTerm(fields[j].Field, fields[j].Value)])
+	})
+	for len(fields) > 0 && (len(q.Fields) > 1 || len(q.Terms) > 0) {
+		drop := fields[0]
+		fields = fields[1:]
+		q.Fields = without(q.Fields, drop)
+		if results, err = search(q, RelaxField); err != nil || len(results) > 0 {
+			return results, relax, err
+		}
+	}
+
+	// corrections come only from documents the search could return
+	now := time.Now()
+	visible := func(name string) bool {
+		doc := idx.docs[name]
+		return (opts.Namespace == "" || doc.Namespace == opts.Namespace) &&
+			doc.visibleTo(opts.Principal, opts.Roles) && !doc.expired(now)
+	}
+	corrected := false
+	words := make([]string, len(q.Terms))
+	for i, term := range q.Terms {
+		words[i] = term
+		if correction, ok := idx.correct(idx.queryWord(term), visible); ok {
+			if relax.Corrections == nil {
+				relax.Corrections = make(map[string]string)
+			}
+			relax.Corrections[term] = correction
+			words[i] = correction
+			corrected = true
+		}
+	}
+	if corrected {
+		q.Terms = words
+		results, err = search(q, RelaxSpelling)
+	}
+	return results, relax, err
+}
+
+// without returns fields without the first occurrence of ft.
+func without(fields []FieldTerm, ft FieldTerm) []FieldTerm {
+	kept := make([]FieldTerm, 0, len(fields))
+	for i, f := range fields {
+		if f == ft {
+			return append(kept, fields[i+1:]...)
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// terms renders the query as search terms, quoting field values of several words.
+func (q Query) terms() []string {
+	terms := append([]string(nil), q.Terms...)
+	for _, ft := range q.Fields {
+		value := ft.Value
+		if strings.ContainsAny(value, " \t\n") {
+			value = `"` + value + `"`
+		}
+		terms = append(terms, ft.Field+":"+value)
+	}
+	return terms
+}
+
+// correct returns the indexed word nearest to word by edit distance, at
+// most 1 for words of up to 4 letters and 2 for longer ones, preferring
+// words in more documents. Only the documents for which visible is true
+// count, so that no correction reveals a word of another namespace or
+// of a document the principal may not see. Words
+// in those documents, and common words that may have been pruned from the
+// index, aren't corrected.
+func (idx Index) correct(word string, visible func(name string) bool) (string, bool) {
+	if tfreq, ok := idx.tmap[word]; (ok && idx.visibleFreq(tfreq, visible) > 0) || questionStopwords[word] {
+		return "", false
+	}
+	n := utf8.RuneCountInString(word)
+	maxDist := 1
+	if n > 4 {
+		maxDist = 2
+	}
+	best, bestDist, bestFreq := "", maxDist+1, 0
+	for term, tfreq := range idx.tmap {
+		if strings.ContainsAny(term, " :") {
+			continue // n-grams and field terms
+		}
+		if diff := utf8.RuneCountInString(term) - n; diff > maxDist || -diff > maxDist {
+			continue
+		}
+		dist := editDistance(word, term, maxDist)
+		if dist > min(bestDist, maxDist) {
+			continue
+		}
+		freq := idx.visibleFreq(tfreq, visible)
+		if freq == 0 {
+			continue
+		}
+		if dist < bestDist || freq > bestFreq || (freq == bestFreq && term < best) {
+			best, bestDist, bestFreq = term, dist, freq
+		}
+	}
+	return best, best != ""
+}
+
+// visibleFreq returns the number of documents for which visible is true
+// that contain the term.
+func (idx Index) visibleFreq(tfreq TermFreq, visible func(name string) bool) int {
+	n := 0
+	idx.eachPosting(tfreq, func(name string, _ float64) {
+		if visible(name) {
+			n++
+		}
+	})
+	return n
+}
+
+// editDistance returns the Levenshtein distance between a and b, or a value
+// greater than limit once it's known to exceed it.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
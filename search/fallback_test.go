@@ -0,0 +1,116 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchFallback(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter", Entities: map[string][]string{"place": {"walden"}}},
+		Document{Name: "city.md", Content: "the city streets", Entities: map[string][]string{"place": {"boston"}}},
+		Document{Name: "woods.md", Content: "the woods in autumn", Entities: map[string][]string{"place": {"walden"}}},
+	), DocOpts{})
+
+	results, relax, err := index.SearchFallback(context.Background(), []string{"pond"}, SearchOpts{Limit: 3})
+	if err != nil || len(results) != 1 || relax.Applied != nil {
+		t.Errorf("expected the query to need no relaxing, got %v %+v %v", results, relax, err)
+	}
+
+	// no document is in both places; boston, in fewer documents, is dropped
+	results, relax, err = index.SearchFallback(context.Background(), []string{"winter", "place:boston", "place:walden"}, SearchOpts{Limit: 3})
+	if err != nil || len(results) != 2 || results[0].Name != "pond.md" {
+		t.Fatalf("got %v, %v", results, err)
+	}
+	if !reflect.DeepEqual(relax.Applied, []string{RelaxField}) || !reflect.DeepEqual(relax.Terms, []string{"winter", "place:walden"}) {
+		t.Errorf("unexpected relaxation %+v", relax)
+	}
+
+	results, relax, err = index.SearchFallback(context.Background(), []string{"wintr", "streetz"}, SearchOpts{Limit: 3})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("got %v, %v", results, err)
+	}
+	want := map[string]string{"wintr": "winter", "streetz": "streets"}
+	if !reflect.DeepEqual(relax.Applied, []string{RelaxSpelling}) || !reflect.DeepEqual(relax.Corrections, want) {
+		t.Errorf("unexpected relaxation %+v", relax)
+	}
+
+	if _, relax, _ = index.SearchFallback(context.Background(), []string{"xyzzy"}, SearchOpts{Limit: 3}); relax.Applied != nil {
+		t.Errorf("expected no correction for a word unlike any other, got %+v", relax)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"winter", "winter", 2, 0},
+		{"wintr", "winter", 2, 1},
+		{"café", "cafe", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 1, 2},
+	} {
+		if got := editDistance(tc.a, tc.b, tc.limit); got != tc.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tc.a, tc.b, tc.limit, got, tc.want)
+		}
+	}
+}
+
+func TestSearchFallbackNamespace(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	index := mustIndex(t, memLoader(
+		Document{Name: "alice.md", Namespace: "alice", Content: "the zanzibarcorp merger plans"},
+		Document{Name: "bob.md", Namespace: "bob", Content: "the pond in winter"},
+		Document{Name: "old.md", Namespace: "bob", Content: "the quagmirexyz of last year", ExpiresAt: &past},
+		Document{Name: "sky.md", Namespace: "bob", Content: "a starry sky above"},
+	), DocOpts{})
+
+	for _, query := range []string{"zanzibarcorq", "quagmirexyy"} {
+		results, relax, err := index.SearchFallback(context.Background(), []string{query}, SearchOpts{Namespace: "bob"})
+		if err != nil || len(results) != 0 || relax.Corrections != nil {
+			t.Errorf("expected no correction from an unseen document for %q, got %v %+v %v", query, results, relax, err)
+		}
+	}
+	results, relax, err := index.SearchFallback(context.Background(), []string{"zanzibarcorq"}, SearchOpts{Namespace: "alice"})
+	if err != nil || len(results) != 1 || relax.Corrections["zanzibarcorq"] != "zanzibarcorp" {
+		t.Errorf("expected the correction within alice's namespace, got %v %+v %v", results, relax, err)
+	}
+}
+
+func TestSearchFallbackACL(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "secret.md", ACL: []string{"alice"}, Content: "a quixotically private plan"},
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "sky.md", Content: "a starry sky above"},
+	), DocOpts{})
+
+	results, relax, err := index.SearchFallback(context.Background(), []string{"quixoticaly"}, SearchOpts{Principal: "bob"})
+	if err != nil || len(results) != 0 || relax.Corrections != nil {
+		t.Errorf("expected no correction from a document bob may not see, got %v %+v %v", results, relax, err)
+	}
+	results, relax, err = index.SearchFallback(context.Background(), []string{"quixoticaly"}, SearchOpts{Principal: "alice"})
+	if err != nil || len(results) != 1 || relax.Corrections["quixoticaly"] != "quixotically" {
+		t.Errorf("expected alice's correction, got %v %+v %v", results, relax, err)
+	}
+}
+
+func TestSearchFallbackIntents(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "a.md", Content: "the moral law within"},
+		Document{Name: "b.txt", Content: "a moral tale told"},
+		Document{Name: "sky.md", Content: "the starry sky above"},
+	), DocOpts{})
+
+	opts := SearchOpts{Intents: DefaultIntents}
+	results, relax, err := index.SearchFallback(context.Background(), []string{"morl", "ext:md"}, opts)
+	if err != nil || len(results) != 1 || results[0].Name != "a.md" {
+		t.Fatalf("expected the intent to filter the corrected query, got %v %v", results, err)
+	}
+	if !reflect.DeepEqual(relax.Terms, []string{"moral", "ext:md"}) {
+		t.Errorf("expected the intent among the relaxed terms, got %+v", relax)
+	}
+}
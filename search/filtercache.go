@@ -0,0 +1,139 @@
+package search
+
+import (
+	"container/list"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// filterCache keeps the sets of documents matching the filters of recent
+// searches, keyed by the filter's expression: the field terms of
+// "tag:blog", the directories of SearchOpts.Dirs or an intent's word, such
+// as "ext:md". A query repeating a filter then looks its documents up
+// rather than evaluating the filter over the corpus again. It holds the
+// sets of up to size filters, dropping the least recently used, and is
+// cleared whenever the index changes in place; an index derived from
+// another, as by AddDocuments, starts with an empty one. The sets it
+// returns are shared, and must not be modified. It's safe for concurrent
+// use, as searches are.
+type filterCache struct {
+	size int
+
+	mu     sync.Mutex
+	sets   map[string]*list.Element // of recent, by key
+	recent *list.List               // of *filterSet, most recently used first
+}
+
+// filterSet is a filter's key and the names of the documents it matches.
+type filterSet struct {
+	key  string
+	docs map[string]bool
+}
+
+// newFilterCache returns a cache of the sets of size filters, or nil, which
+// caches nothing, if size isn't positive.
+func newFilterCache(size int) *filterCache {
+	if size <= 0 {
+		return nil
+	}
+	return &filterCache{size: size, sets: make(map[string]*list.Element), recent: list.New()}
+}
+
+// get returns the set of documents of the filter with key, computing it
+// with docs on a miss, or every time if c is nil.
+func (c *filterCache) get(key string, docs func() map[string]bool) map[string]bool {
+	if c == nil {
+		return docs()
+	}
+	c.mu.Lock()
+	if e, ok := c.sets[key]; ok {
+		c.recent.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*filterSet).docs
+	}
+	c.mu.Unlock()
+
+	// computed unlocked, so a slow filter doesn't hold up other searches;
+	// concurrent misses for the same key compute the same set
+	set := docs()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.sets[key]; !ok {
+		c.sets[key] = c.recent.PushFront(&filterSet{key, set})
+		if c.recent.Len() > c.size {
+			oldest := c.recent.Remove(c.recent.Back()).(*filterSet)
+			delete(c.sets, oldest.key)
+		}
+	}
+	return set
+}
+
+// empty returns an empty cache of the size of c, for an index derived from
+// that of c.
+func (c *filterCache) empty() *filterCache {
+	if c == nil {
+		return nil
+	}
+	return newFilterCache(c.size)
+}
+
+// clear empties the cache, as when the documents of its index change.
+func (c *filterCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.sets)
+	c.recent.Init()
+}
+
+// len returns the number of filters cached.
+func (c *filterCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recent.Len()
+}
+
+// dirsKey returns the cache key of a filter on dirs, the same for the same
+// directories in any order or form.
+func dirsKey(dirs []string) string {
+	cleaned := make([]string, len(dirs))
+	for i, d := range dirs {
+		cleaned[i] = path.Clean(strings.Trim(d, "/"))
+	}
+	sort.Strings(cleaned)
+	return "dirs:" + strings.Join(cleaned, "\x00")
+}
+
+// fieldsKey returns the cache key of the filter of field terms.
+func fieldsKey(fields []FieldTerm) string {
+	terms := make([]string, len(fields))
+	for i, ft := range fields {
+		terms[i] = fieldTerm(ft.Field, ft.Value)
+	}
+	sort.Strings(terms)
+	return "fields:" + strings.Join(terms, "\x00")
+}
+
+// phraseKey returns the cache key of the filter of a phrase.
+func phraseKey(phrase []string) string {
+	return "phrase:" + strings.Join(phrase, "\x00")
+}
+
+// filterDocs returns the names of the documents of idx that keep returns
+// true for.
+func (idx Index) filterDocs(keep func(Document) bool) map[string]bool {
+	docs := make(map[string]bool)
+	for name, doc := range idx.docs {
+		if keep(doc) {
+			docs[name] = true
+		}
+	}
+	return docs
+}
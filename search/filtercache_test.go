@@ -0,0 +1,69 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFilterCache(t *testing.T) {
+	docs := []Document{
+		{Name: "essays/walden.md", Content: "Thoreau at the pond in winter"},
+		{Name: "essays/civil.txt", Content: "Thoreau on the pond and the state"},
+		{Name: "notes/pond.md", Content: "notes on the pond"},
+		{Name: "notes/city.md", Content: "the city streets"},
+	}
+	opts := DocOpts{Entities: Gazetteer{"Thoreau": "person"}, FilterCache: 2}
+	cached := mustIndex(t, memLoader(docs...), opts)
+	opts.FilterCache = 0
+	plain := mustIndex(t, memLoader(docs...), opts)
+	search := func(idx *Index, terms []string, opts SearchOpts) []string {
+		t.Helper()
+		results, err := idx.Search(context.Background(), terms, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	queries := []struct {
+		terms []string
+		opts  SearchOpts
+	}{
+		{[]string{"pond"}, SearchOpts{Dirs: []string{"essays"}}},
+		{[]string{"pond", "person:thoreau"}, SearchOpts{}},
+		{[]string{"pond", "ext:md"}, SearchOpts{Intents: DefaultIntents}},
+		{[]string{"pond"}, SearchOpts{Dirs: []string{"/essays/"}}},
+	}
+	for round := 0; round < 2; round++ {
+		for _, q := range queries {
+			got, want := search(cached, q.terms, q.opts), search(plain, q.terms, q.opts)
+			if len(got) == 0 || len(got) == len(docs) || !reflect.DeepEqual(got, want) {
+				t.Errorf("%v %+v: got %v, want %v", q.terms, q.opts, got, want)
+			}
+		}
+	}
+	if n := cached.filters.len(); n != 2 {
+		t.Errorf("expected the 2 most recent filters to be cached, got %d", n)
+	}
+	if plain.filters.len() != 0 {
+		t.Error("expected no cache without FilterCache")
+	}
+
+	// a change to the index empties its cache
+	if err := cached.AddDocument(Document{Name: "essays/journal.md", Content: "the pond at dawn", Length: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if n := cached.filters.len(); n != 0 {
+		t.Errorf("expected an empty cache after a change, got %d filters", n)
+	}
+	if got := search(cached, []string{"pond"}, SearchOpts{Dirs: []string{"essays"}}); len(got) != 3 {
+		t.Errorf("expected the added document in the directory, got %v", got)
+	}
+}
@@ -0,0 +1,185 @@
+package search
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// gobFormatVersion is the version of FormatGob written and read.
+const gobFormatVersion = 1
+
+// gobIndex is the saved form of an index in FormatGob. Maps are saved as
+// sorted slices, as gob writes maps in random order, so that equal indexes
+// save to identical bytes as in the other formats. A documents file is a
+// gobIndex with documents alone.
+type gobIndex struct {
+	Magic   string
+	Version int
+	// Names are the names of the documents with postings, sorted
+	Names []string
+	Terms []gobTerm // sorted by text
+	// FieldAnalyzers holds field and analyzer pairs, sorted by field
+	FieldAnalyzers [][2]string
+	StopWords      []string
+	Pruned         []string // terms pruned as too common, sorted
+	Docs           []gobDoc // sorted by name, unless saved apart
+}
+
+// gobTerm is a term and its postings. Docs holds indexes into Names, each
+// as the gap from the one before, which gob writes in fewer bytes than the
+// names themselves.
+type gobTerm struct {
+	Text string
+	Idf  float64
+	Docs []uint32
+	Tfs  []float64
+}
+
+// gobDoc is a stored document, with its entities sorted by kind.
+type gobDoc struct {
+	Doc      Document // without its Entities
+	Kinds    []string
+	Entities [][]string
+}
+
+// encodeGob writes the index in FormatGob, with or without its stored
+// documents.
+func (idx *Index) encodeGob(w io.Writer, withDocs bool) error {
+	saved := gobIndex{Magic: indexMagic, Version: gobFormatVersion, StopWords: idx.stopWordList(), Pruned: idx.prunedList()}
+
+	rows := make(map[string]uint32)
+	terms := make([]string, 0, len(idx.tmap))
+	for term, tfreq := range idx.tmap {
+		terms = append(terms, term)
+		idx.eachPosting(tfreq, func(name string, _ float64) { rows[name] = 0 })
+	}
+	sort.Strings(terms)
+	saved.Names = make([]string, 0, len(rows))
+	for name := range rows {
+		saved.Names = append(saved.Names, name)
+	}
+	sort.Strings(saved.Names)
+	for i, name := range saved.Names {
+		rows[name] = uint32(i)
+	}
+
+	saved.Terms = make([]gobTerm, len(terms))
+	for i, term := range terms {
+		tfreq := idx.tmap[term]
+		t := gobTerm{Text: term, Idf: tfreq.Idf}
+		idx.eachPosting(tfreq, func(name string, tf float64) {
+			t.Docs = append(t.Docs, rows[name])
+			t.Tfs = append(t.Tfs, tf)
+		})
+		sort.Sort(byRow(t))
+		for j := len(t.Docs) - 1; j > 0; j-- {
+			t.Docs[j] -= t.Docs[j-1]
+		}
+		saved.Terms[i] = t
+	}
+
+	fields := make([]string, 0, len(idx.fieldAnalyzers))
+	for field := range idx.fieldAnalyzers {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		saved.FieldAnalyzers = append(saved.FieldAnalyzers, [2]string{field, idx.fieldAnalyzers[field]})
+	}
+	if withDocs {
+		saved.Docs = gobDocs(idx.sortedDocs())
+	}
+	return gob.NewEncoder(w).Encode(saved)
+}
+
+// byRow sorts the postings of a gobTerm by document.
+type byRow gobTerm
+
+func (t byRow) Len() int           { return len(t.Docs) }
+func (t byRow) Less(i, j int) bool { return t.Docs[i] < t.Docs[j] }
+func (t byRow) Swap(i, j int) {
+	t.Docs[i], t.Docs[j] = t.Docs[j], t.Docs[i]
+	t.Tfs[i], t.Tfs[j] = t.Tfs[j], t.Tfs[i]
+}
+
+func gobDocs(docs []Document) []gobDoc {
+	saved := make([]gobDoc, len(docs))
+	for i, doc := range docs {
+		d := gobDoc{Doc: doc}
+		d.Doc.Entities = nil
+		for kind := range doc.Entities {
+			d.Kinds = append(d.Kinds, kind)
+		}
+		sort.Strings(d.Kinds)
+		for _, kind := range d.Kinds {
+			d.Entities = append(d.Entities, doc.Entities[kind])
+		}
+		saved[i] = d
+	}
+	return saved
+}
+
+// decodeGob reads a gobIndex written by encodeGob from r.
+func decodeGob(r io.Reader) (*gobIndex, error) {
+	var saved gobIndex
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode index: %w", ErrCorruptIndex, err)
+	}
+	if saved.Magic != indexMagic {
+		return nil, fmt.Errorf("%w: not an infrared index", ErrCorruptIndex)
+	}
+	if err := checkVersion("gob", saved.Version, gobFormatVersion); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// index returns the terms and settings of the saved index, without its
+// documents.
+func (saved *gobIndex) index() (*Index, error) {
+	idx := &Index{tmap: make(map[string]TermFreq, len(saved.Terms))}
+	for _, t := range saved.Terms {
+		if len(t.Docs) != len(t.Tfs) {
+			return nil, fmt.Errorf("%w: term %q has %d documents and %d frequencies", ErrCorruptIndex, t.Text, len(t.Docs), len(t.Tfs))
+		}
+		tfMap := make(map[string]float64, len(t.Docs))
+		row := uint32(0)
+		for i, gap := range t.Docs {
+			row += gap
+			if int(row) >= len(saved.Names) {
+				return nil, fmt.Errorf("%w: term %q refers to document %d of %d", ErrCorruptIndex, t.Text, row, len(saved.Names))
+			}
+			tfMap[saved.Names[row]] = t.Tfs[i]
+		}
+		idx.tmap[t.Text] = TermFreq{Idf: t.Idf, TfMap: tfMap}
+	}
+	if len(saved.FieldAnalyzers) > 0 {
+		idx.fieldAnalyzers = make(map[string]string, len(saved.FieldAnalyzers))
+		for _, pair := range saved.FieldAnalyzers {
+			idx.fieldAnalyzers[pair[0]] = pair[1]
+		}
+	}
+	idx.stopWords = wordSet(saved.StopWords)
+	idx.pruned = wordSet(saved.Pruned)
+	return idx, nil
+}
+
+// documents returns the saved documents.
+func (saved *gobIndex) documents() []Document {
+	docs := make([]Document, len(saved.Docs))
+	for i, d := range saved.Docs {
+		doc := d.Doc
+		if len(d.Kinds) > 0 {
+			doc.Entities = make(map[string][]string, len(d.Kinds))
+			for j, kind := range d.Kinds {
+				if j < len(d.Entities) {
+					doc.Entities[kind] = d.Entities[j]
+				}
+			}
+		}
+		docs[i] = doc
+	}
+	return docs
+}
@@ -0,0 +1,83 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGobRoundTrip(t *testing.T) {
+	opts := DocOpts{
+		Load:     LoadOpts{Path: "../example/docs", Content: true, LenPreview: 100},
+		Entities: Gazetteer{"Walden": "place", "Concord": "place", "Thoreau": "person"},
+	}
+	index := mustIndex(t, DefaultLoader, opts)
+	write := func(format Format) []byte {
+		index.storage.Format = format
+		var buf bytes.Buffer
+		if err := index.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	read := func(data []byte, format Format) *Index {
+		idx, err := ReadIndex(context.Background(), bytes.NewReader(data), nil, DocOpts{Storage: StorageOpts{Format: format}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+
+	data := write(FormatGob)
+	if !bytes.Equal(data, write(FormatGob)) {
+		t.Error("expected identical bytes for the same index")
+	}
+	jsonData := write(FormatJSON)
+	if len(data) >= len(jsonData) {
+		t.Errorf("gob index of %d bytes isn't smaller than the JSON one of %d", len(data), len(jsonData))
+	}
+
+	fromGob, fromJSON := read(data, FormatGob), read(jsonData, FormatJSON)
+	if !reflect.DeepEqual(fromGob.tmap, fromJSON.tmap) {
+		t.Error("term maps of gob and JSON indexes differ")
+	}
+	if !reflect.DeepEqual(fromGob.docs, fromJSON.docs) || !reflect.DeepEqual(fromGob.docs, index.docs) {
+		t.Error("documents of gob and JSON indexes differ")
+	}
+	results, _ := fromGob.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 1})
+	if len(results) != 1 || results[0].Name != "civil_disobedience.txt" || results[0].Preview == "" {
+		t.Errorf("unexpected results from decoded index: %+v", results)
+	}
+
+	if _, err := ReadIndex(context.Background(), bytes.NewReader(jsonData), nil, DocOpts{Storage: StorageOpts{Format: FormatGob}}); !errors.Is(err, ErrCorruptIndex) {
+		t.Errorf("expected ErrCorruptIndex for a JSON index read as gob, got %v", err)
+	}
+}
+
+func BenchmarkSaveLoad(b *testing.B) {
+	index := mustIndex(b, DefaultLoader, DocOpts{Load: LoadOpts{Path: "../example/docs", Content: true}})
+	for _, format := range []Format{FormatJSON, FormatProto, FormatGob, FormatMapped} {
+		name := []string{"json", "proto", "gob", "mapped"}[format]
+		index.storage.Format = format
+		var buf bytes.Buffer
+		b.Run(name+"/save", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := index.Write(&buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(buf.Len())/1024, "KB")
+		})
+		b.Run(name+"/load", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := ReadIndex(context.Background(), bytes.NewReader(buf.Bytes()), nil, DocOpts{Storage: StorageOpts{Format: format}})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,13 +1,24 @@
 package search
 
+// resultHeap is a min-heap of results, with the lowest ranked at the root.
 type resultHeap []SearchResult
 
+// ranksAbove reports whether a ranks above b: it scores higher, or as high
+// with a name that sorts first, so that results are ordered the same way
+// on every search and pages at different offsets don't overlap.
+func ranksAbove(a, b SearchResult) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Name < b.Name
+}
+
 func (h resultHeap) Len() int {
 	return len(h)
 }
 
 func (h resultHeap) Less(i, j int) bool {
-	return h[i].Score < h[j].Score
+	return ranksAbove(h[j], h[i])
 }
 
 func (h resultHeap) Swap(i, j int) {
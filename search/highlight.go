@@ -0,0 +1,108 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Match is an occurrence of a query word in a document, as byte offsets
+// into the document's original content, before normalization.
+type Match struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Word  string `json:"word"` // the normalized query word it matched
+}
+
+// highlight sets the matches of the query words in each result's content.
+// Documents loaded without content have none.
+func (idx *Index) highlight(terms []string, results []SearchResult) {
+	words := idx.queryWords(terms)
+	for i := range results {
+		results[i].Matches = idx.matches(results[i].Content, words)
+	}
+}
+
+// queryWords returns the set of normalized words of the query terms.
+func (idx *Index) queryWords(terms []string) map[string]bool {
+	words := make(map[string]bool)
+	for _, term := range terms {
+		for _, word := range strings.Fields(idx.normalizer(term)) {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// matches finds the words of text that normalize to one of words. Each
+// whitespace-separated word of the original text is normalized on its own,
+// and its match excludes any leading or trailing characters the normalizer
+// drops, like the comma of "law,".
+func (idx *Index) matches(text string, words map[string]bool) []Match {
+	var matches []Match
+	start := -1
+	for i := 0; i <= len(text); {
+		r, size := utf8.RuneError, 1
+		if i < len(text) {
+			r, size = utf8.DecodeRuneInString(text[i:])
+		}
+		if i < len(text) && !unicode.IsSpace(r) {
+			if start < 0 {
+				start = i
+			}
+			i += size
+			continue
+		}
+		if start >= 0 {
+			word := strings.Join(strings.Fields(idx.normalizer(text[start:i])), " ")
+			if words[word] {
+				s, e := idx.trimDropped(text, start, i)
+				matches = append(matches, Match{Start: s, End: e, Word: word})
+			}
+			start = -1
+		}
+		i += size
+	}
+	return matches
+}
+
+// trimDropped narrows text[start:end] to exclude the leading and trailing
+// runes that normalize to nothing.
+func (idx *Index) trimDropped(text string, start, end int) (int, int) {
+	for start < end {
+		r, size := utf8.DecodeRuneInString(text[start:end])
+		if idx.normalizer(string(r)) != "" {
+			break
+		}
+		start += size
+	}
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[start:end])
+		if idx.normalizer(string(r)) != "" {
+			break
+		}
+		end -= size
+	}
+	return start, end
+}
+
+// MarkHTML returns text as HTML with each of the matches, as returned in
+// SearchResult.Matches for that text, wrapped in <mark id="match-N">, so a
+// page rendering a document can highlight its matches and link to the Nth
+// with #match-N.
+func MarkHTML(text string, matches []Match) string {
+	var b strings.Builder
+	last := 0
+	for i, m := range matches {
+		if m.Start < last || m.End > len(text) {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:m.Start]))
+		fmt.Fprintf(&b, `<mark id="match-%d">%s</mark>`, i, html.EscapeString(text[m.Start:m.End]))
+		last = m.End
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package search
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	content := "# Walden\n\nI went to the *Woods*, because I wished to live deliberately."
+	index := mustIndex(t, memLoader(
+		Document{Name: "walden.md", Content: content},
+		Document{Name: "city.md", Content: "the city streets"},
+	), DocOpts{})
+
+	results, err := index.Search(context.Background(), []string{"woods", "deliberately"}, SearchOpts{Limit: 1, Highlight: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", results)
+	}
+	matches := results[0].Matches
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %+v", matches)
+	}
+	if got := content[matches[0].Start:matches[0].End]; got != "Woods" {
+		t.Errorf("first match: got %q, want Woods", got)
+	}
+	if got := content[matches[1].Start:matches[1].End]; got != "deliberately" {
+		t.Errorf("second match: got %q, want deliberately", got)
+	}
+
+	want := "# Walden\n\nI went to the *<mark id=\"match-0\">Woods</mark>*, because I wished to live <mark id=\"match-1\">deliberately</mark>."
+	if got := MarkHTML(content, matches); got != want {
+		t.Errorf("MarkHTML:\ngot  %q\nwant %q", got, want)
+	}
+}
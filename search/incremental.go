@@ -0,0 +1,155 @@
+package search
+
+import "fmt"
+
+// AddDocument adds doc to idx in place. Only doc is tokenized and only the
+// postings of its terms change; the idf of every term is recomputed, which
+// is cheap next to copying the postings as AddDocuments does. Terms that
+// idx had pruned as too common stay pruned.
+//
+// Unlike AddDocuments it modifies idx, so it mustn't run while idx is being
+// searched: an index served by an IndexManager is updated with
+// AddDocuments instead, and one searched concurrently is wrapped in a
+// SyncIndex. The postings of an index with compact postings are
+// expanded and compacted again, which costs as much as copying them. idx
+// needs its stored documents, and a document whose name is already in it
+// is an error.
+func (idx *Index) AddDocument(doc Document) error {
+	if err := idx.checkIncremental("add to"); err != nil {
+		return err
+	}
+	if _, ok := idx.docs[doc.Name]; ok {
+		return fmt.Errorf("document %q is already in the index", doc.Name)
+	}
+	if err := idx.transform(&doc); err != nil {
+		return err
+	}
+	idx.change(func() { idx.addPostings(doc) })
+	return nil
+}
+
+// RemoveDocument removes the named document from idx in place, as
+// AddDocument adds one. Terms that idx had pruned as too common stay pruned.
+// A name that isn't in idx is ErrDocumentNotFound.
+func (idx *Index) RemoveDocument(name string) error {
+	if err := idx.checkIncremental("remove from"); err != nil {
+		return err
+	}
+	if _, ok := idx.docs[name]; !ok {
+		return fmt.Errorf("%w: %q", ErrDocumentNotFound, name)
+	}
+	idx.change(func() { idx.removePostings(name) })
+	return nil
+}
+
+// UpdateDocument replaces the document of idx named doc.Name with doc in
+// place, as RemoveDocument and AddDocument would, but as one update. A name
+// that isn't in idx is ErrDocumentNotFound.
+func (idx *Index) UpdateDocument(doc Document) error {
+	if err := idx.checkIncremental("update"); err != nil {
+		return err
+	}
+	if _, ok := idx.docs[doc.Name]; !ok {
+		return fmt.Errorf("%w: %q", ErrDocumentNotFound, doc.Name)
+	}
+	if err := idx.transform(&doc); err != nil {
+		return err
+	}
+	idx.change(func() {
+		idx.removePostings(doc.Name)
+		idx.addPostings(doc)
+	})
+	return nil
+}
+
+// checkIncremental returns an error if idx can't be changed a document at a
+// time, for lack of its stored documents.
+func (idx *Index) checkIncremental(op string) error {
+	if len(idx.docs) == 0 && len(idx.tmap) > 0 {
+		return fmt.Errorf("cannot %s an index without its stored documents", op)
+	}
+	return nil
+}
+
+// change applies a change of one document's postings to idx, with its
+// postings expanded to maps if they're compact, then recomputes the idfs.
+func (idx *Index) change(apply func()) {
+	compact := idx.docTable != nil
+	if compact {
+		for term, tfreq := range idx.tmap {
+			idx.tmap[term] = TermFreq{Idf: tfreq.Idf, TfMap: idx.postings(tfreq)}
+		}
+		idx.docTable = nil
+	}
+	apply()
+	idx.filters.clear()
+	idx.reweighAll()
+	if compact {
+		idx.compactPostings()
+	}
+	idx.updates, idx.changedDocs = idx.updates+1, idx.changedDocs+1
+}
+
+// addPostings tokenizes doc and adds its postings, as term frequencies, to
+// the term map and its terms to the filter, but for the terms pruned as too
+// common.
+func (idx *Index) addPostings(doc Document) {
+	idx.extractEntities(&doc)
+	counts := make(map[string]TermFreq)
+	var tok tokenizer
+	idx.indexDoc(&tok, counts, &doc)
+	if idx.positions != nil {
+		idx.addPositions(&tok, idx.positions, &doc)
+	}
+	idx.docs[doc.Name] = doc
+	for term, c := range counts {
+		if idx.pruned[term] {
+			continue
+		}
+		tfreq, ok := idx.tmap[term]
+		if !ok {
+			tfreq = TermFreq{TfMap: make(map[string]float64, 1)}
+			idx.tmap[term] = tfreq
+			idx.filter.add(term)
+		}
+		tfreq.TfMap[doc.Name] = c.TfMap[doc.Name] / float64(doc.tokens())
+	}
+	dir := docDir(doc)
+	idx.dirs[dir] = append(idx.dirs[dir], doc.Name)
+}
+
+// removePostings removes the postings of the named document, and the terms
+// only it had, and the document itself.
+func (idx *Index) removePostings(name string) {
+	for term, tfreq := range idx.tmap {
+		if _, ok := tfreq.TfMap[name]; !ok {
+			continue
+		}
+		delete(tfreq.TfMap, name)
+		if len(tfreq.TfMap) == 0 {
+			delete(idx.tmap, term)
+		}
+	}
+	idx.positions.remove(name)
+	delete(idx.docs, name)
+	idx.indexDirs()
+	clear(idx.fields)
+	for _, doc := range idx.docs {
+		for kind := range doc.Entities {
+			idx.fields[kind] = true
+		}
+	}
+}
+
+// reweighAll recomputes the idf of every term, which depends on the number
+// of documents, and the mean document length, after documents change.
+func (idx *Index) reweighAll() {
+	for term, tfreq := range idx.tmap {
+		if tfreq, keep := idx.reweigh(term, tfreq); keep {
+			idx.tmap[term] = tfreq
+		} else {
+			delete(idx.tmap, term)
+		}
+	}
+	idx.avgTokens = idx.meanTokens()
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestIncremental(t *testing.T) {
+	docs := []Document{
+		{Name: "pond.md", Content: "the pond in winter"},
+		{Name: "woods.md", Content: "the woods in winter"},
+		{Name: "city.md", Content: "a city at night"},
+		{Name: "road.md", Content: "a road at dawn"},
+	}
+	write := func(idx *Index) []byte {
+		var buf bytes.Buffer
+		if err := idx.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	whole := mustIndex(t, memLoader(docs...), DocOpts{})
+
+	for _, compact := range []bool{false, true} {
+		opts := DocOpts{CompactPostings: compact}
+		idx := mustIndex(t, memLoader(docs[:3]...), opts)
+		if err := idx.AddDocument(docs[3]); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(write(idx), write(whole)) {
+			t.Errorf("compact %v: adding a document differs from building with it", compact)
+		}
+		if err := idx.AddDocument(docs[3]); err == nil {
+			t.Errorf("compact %v: expected an error adding a document twice", compact)
+		}
+		results, _ := idx.Search(context.Background(), []string{"dawn"}, SearchOpts{})
+		if len(results) != 1 || results[0].Name != "road.md" {
+			t.Errorf("compact %v: expected the added document to be found, got %+v", compact, results)
+		}
+
+		if err := idx.RemoveDocument("road.md"); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(write(idx), write(mustIndex(t, memLoader(docs[:3]...), DocOpts{}))) {
+			t.Errorf("compact %v: removing a document differs from building without it", compact)
+		}
+		if err := idx.RemoveDocument("road.md"); !errors.Is(err, ErrDocumentNotFound) {
+			t.Errorf("compact %v: expected ErrDocumentNotFound, got %v", compact, err)
+		}
+
+		edited := Document{Name: "city.md", Content: "a city at dawn", Length: 4}
+		if err := idx.UpdateDocument(edited); err != nil {
+			t.Fatal(err)
+		}
+		want := mustIndex(t, memLoader(docs[0], docs[1], edited), DocOpts{})
+		if !bytes.Equal(write(idx), write(want)) {
+			t.Errorf("compact %v: updating a document differs from building with the new version", compact)
+		}
+		if f := idx.Fragmentation(); f.Updates != 3 || f.ChangedDocs != 3 {
+			t.Errorf("compact %v: unexpected fragmentation %+v", compact, f)
+		}
+	}
+}
+
+func TestIncrementalPrunedTerm(t *testing.T) {
+	docs := []Document{
+		{Name: "pond.md", Content: "the pond in winter"},
+		{Name: "woods.md", Content: "the woods in winter"},
+		{Name: "hut.md", Content: "the hut by the railroad"},
+	}
+	idx := mustIndex(t, memLoader(docs...), DocOpts{})
+	search := func() []string {
+		results, err := idx.Search(context.Background(), []string{"the pond"}, SearchOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Name)
+		}
+		return names
+	}
+	before := search()
+	if len(before) != 1 || before[0] != "pond.md" {
+		t.Fatalf("expected only pond.md, got %v", before)
+	}
+
+	// "the" was pruned as in every document; the new one mustn't revive it
+	if err := idx.AddDocument(Document{Name: "note.md", Content: "the the the note"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.UpdateDocument(Document{Name: "hut.md", Content: "the hut by the pond"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.tmap["the"]; ok {
+		t.Error("expected the pruned term to stay pruned")
+	}
+	if after := search(); len(after) != 2 || after[0] != "pond.md" || after[1] != "hut.md" {
+		t.Errorf("expected pond.md then hut.md, got %v", after)
+	}
+}
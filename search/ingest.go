@@ -0,0 +1,197 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrIngesterClosed is returned by Submit once the Ingester is closed.
+var ErrIngesterClosed = errors.New("ingester closed")
+
+// IngestOpts configures an Ingester.
+type IngestOpts struct {
+	// BatchSize is the number of waiting documents that are applied at
+	// once, without waiting for the interval (default 100)
+	BatchSize int
+	// Interval is how long a document may wait before it's applied (default 1s)
+	Interval time.Duration
+	// Buffer is the number of submitted documents that can queue up
+	// while a batch is being applied, after which Submit blocks (default
+	// BatchSize)
+	Buffer int
+	// OnError, if set, is called with the error and the documents of each
+	// batch that couldn't be applied. The documents are dropped. A failed
+	// compaction is reported without documents.
+	OnError func(err error, docs []Document)
+	// Journal, if set, journals each batch before it's applied, so that
+	// the documents of a server that crashes aren't lost.
+	Journal *Journal
+	// Compaction, if set, optimizes the index after a batch once it's due
+	Compaction CompactionPolicy
+}
+
+// Ingester adds documents from streaming sources, like feeds or webhook
+// handlers, to the index an IndexManager serves. Documents are submitted
+// from any number of goroutines, and applied in batches by a goroutine of
+// the Ingester's own, so that each batch builds one new index rather than
+// one per document. Searches carry on against the current index meanwhile.
+//
+// A full queue blocks Submit, pushing back on sources faster than the
+// index can take them; TrySubmit and Pending let a source see that
+// coming. Close applies whatever is still queued.
+type Ingester struct {
+	manager *IndexManager
+	opts    IngestOpts
+	docs    chan Document
+	flush   chan chan error
+	done    chan struct{}
+
+	mu     sync.RWMutex // held to send, and exclusively to close, docs
+	closed bool
+	err    error // first batch that failed, for Close
+}
+
+// NewIngester returns an Ingester applying documents to m's index, and
+// starts its goroutine.
+func NewIngester(m *IndexManager, opts IngestOpts) *Ingester {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = opts.BatchSize
+	}
+	in := &Ingester{
+		manager: m,
+		opts:    opts,
+		docs:    make(chan Document, opts.Buffer),
+		flush:   make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	go in.run()
+	return in
+}
+
+// Submit queues doc to be added to the index, blocking while the queue is full.
+func (in *Ingester) Submit(doc Document) error {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if in.closed {
+		return ErrIngesterClosed
+	}
+	in.docs <- doc
+	return nil
+}
+
+// TrySubmit queues doc unless the queue is full or the Ingester closed,
+// and reports whether it did.
+func (in *Ingester) TrySubmit(doc Document) bool {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if in.closed {
+		return false
+	}
+	select {
+	case in.docs <- doc:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pending returns the number of queued documents, out of Buffer.
+func (in *Ingester) Pending() int {
+	return len(in.docs)
+}
+
+// Flush applies the queued documents now, and returns the error of
+// applying them, if any.
+func (in *Ingester) Flush() error {
+	reply := make(chan error)
+	select {
+	case in.flush <- reply:
+		return <-reply
+	case <-in.done:
+		return ErrIngesterClosed
+	}
+}
+
+// Close stops the Ingester once it has applied the queued documents, and
+// returns the error of the first batch that failed, if any.
+func (in *Ingester) Close() error {
+	in.mu.Lock()
+	if !in.closed {
+		in.closed = true
+		close(in.docs)
+	}
+	in.mu.Unlock()
+	<-in.done
+	return in.err
+}
+
+// run collects submitted documents into batches and applies them.
+func (in *Ingester) run() {
+	defer close(in.done)
+	ticker := time.NewTicker(in.opts.Interval)
+	defer ticker.Stop()
+	var batch []Document
+	apply := func() error {
+		err := in.apply(batch)
+		batch = nil
+		return err
+	}
+	for {
+		select {
+		case doc, ok := <-in.docs:
+			if !ok {
+				apply()
+				return
+			}
+			if batch = append(batch, doc); len(batch) >= in.opts.BatchSize {
+				apply()
+			}
+		case <-ticker.C:
+			apply()
+		case reply := <-in.flush:
+			for queued := len(in.docs); queued > 0; queued-- {
+				if doc, ok := <-in.docs; ok {
+					batch = append(batch, doc)
+				}
+			}
+			reply <- apply()
+		}
+	}
+}
+
+// apply adds a batch of documents to the index.
+func (in *Ingester) apply(batch []Document) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	var err error
+	if in.opts.Journal != nil {
+		err = in.opts.Journal.AddDocuments(in.manager, batch)
+	} else {
+		err = in.manager.Update(func(idx *Index) (*Index, error) {
+			return idx.AddDocuments(batch)
+		})
+	}
+	if err == nil {
+		// the batch is in; a failed compaction loses no documents
+		batch = nil
+		_, err = in.manager.Compact(context.Background(), in.opts.Compaction)
+	}
+	if err != nil {
+		if in.err == nil {
+			in.err = err
+		}
+		if in.opts.OnError != nil {
+			in.opts.OnError(err, batch)
+		}
+	}
+	return err
+}
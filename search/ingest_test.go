@@ -0,0 +1,55 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIngester(t *testing.T) {
+	m := NewIndexManager(mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city streets"},
+	), DocOpts{}))
+	var failed []Document
+	in := NewIngester(m, IngestOpts{BatchSize: 1, Buffer: 1, Interval: time.Hour, OnError: func(err error, docs []Document) {
+		failed = append(failed, docs...)
+	}})
+
+	// stall the ingester applying its first document, so the next fills the queue
+	m.reload.Lock()
+	if err := in.Submit(Document{Name: "woods.md", Content: "the woods in autumn", Length: 4}); err != nil {
+		t.Fatal(err)
+	}
+	for in.Pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := in.Submit(Document{Name: "hut.md", Content: "the hut by the railroad", Length: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if in.TrySubmit(Document{Name: "field.md", Content: "the bean field"}) || in.Pending() != 1 {
+		t.Errorf("expected a full queue to push back, with 1 pending, got %d", in.Pending())
+	}
+	m.reload.Unlock()
+
+	if err := in.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Index().DocCount() != 4 {
+		t.Fatalf("expected 4 documents after flushing, got %d", m.Index().DocCount())
+	}
+	results, _ := m.Search(context.Background(), []string{"railroad"}, SearchOpts{Limit: 5})
+	if len(results) != 1 || results[0].Name != "hut.md" {
+		t.Errorf("expected the ingested document to be searchable, got %+v", results)
+	}
+
+	// a document already in the index fails its batch, which Close reports
+	in.Submit(Document{Name: "pond.md", Content: "again"})
+	if err := in.Close(); err == nil || len(failed) != 1 {
+		t.Errorf("expected the duplicate to fail, got %v and %v", err, failed)
+	}
+	if err := in.Submit(Document{Name: "late.md"}); !errors.Is(err, ErrIngesterClosed) {
+		t.Errorf("expected ErrIngesterClosed, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Intent recognizes a structured fragment of a free-text query, such as
+// "after:2022", and turns it into a filter on the documents. Patterns are
+// matched against whole whitespace-separated words of the query, outside
+// double quotes; a matching word is taken out of the query and its filter
+// applied to the candidates before they're scored, so it narrows the
+// results of the rest of the query rather than being a query of its own.
+type Intent struct {
+	Pattern *regexp.Regexp
+	// Filter returns the filter of a matching word, given the submatches
+	// of Pattern as regexp.FindStringSubmatch returns them. Documents it
+	// returns false for are left out of the results.
+	Filter func(match []string) func(Document) bool
+}
+
+// Intents is a registry of intents, tried in order against each query word;
+// the first that matches a word handles it. Append to DefaultIntents, or
+// build one from scratch, and set it with SearchOpts.Intents.
+type Intents []Intent
+
+// DefaultIntents recognizes:
+//
+//	after:2022       documents dated 2022 or later; also after:2022-06, after:2022-06-01
+//	before:2022      documents dated before 2022, with the same forms
+//	in:essays        documents in the essays directory or beneath it
+//	ext:md           documents whose name has the .md extension
+//
+// Undated documents, or ones with a Date parseDate doesn't understand, are
+// left out of date-filtered results.
+var DefaultIntents = Intents{
+	{Pattern: regexp.MustCompile(`^after:(\d{4}(?:-\d{2}){0,2})$`), Filter: dateIntent(false)},
+	{Pattern: regexp.MustCompile(`^before:(\d{4}(?:-\d{2}){0,2})$`), Filter: dateIntent(true)},
+	{Pattern: regexp.MustCompile(`^in:(\S+)$`), Filter: func(match []string) func(Document) bool {
+		dirs := []string{match[1]}
+		return func(doc Document) bool { return inDirs(docDir(doc), dirs) }
+	}},
+	{Pattern: regexp.MustCompile(`^ext:\.?(\w+)$`), Filter: func(match []string) func(Document) bool {
+		ext := "." + strings.ToLower(match[1])
+		return func(doc Document) bool { return strings.ToLower(path.Ext(doc.Name)) == ext }
+	}},
+}
+
+// dateIntent filters documents dated before the start of the matched year,
+// month or day if before is set, and those dated at or after it otherwise.
+func dateIntent(before bool) func(match []string) func(Document) bool {
+	return func(match []string) func(Document) bool {
+		var start time.Time
+		for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+			if t, err := time.Parse(layout, match[1]); err == nil {
+				start = t
+				break
+			}
+		}
+		if start.IsZero() {
+			// a well-formed but impossible date, like 2022-13; nothing matches it
+			return func(Document) bool { return false }
+		}
+		return func(doc Document) bool {
+			date, ok := parseDate(doc.Date)
+			return ok && date.Before(start) == before
+		}
+	}
+}
+
+// extract takes the words the intents recognize out of terms, and returns
+// the remaining terms and the filters of the recognized words.
+func (intents Intents) extract(terms []string) ([]string, []intentFilter) {
+	if len(intents) == 0 {
+		return terms, nil
+	}
+	var rest []string
+	var filters []intentFilter
+	inQuote := false
+	for _, word := range strings.Fields(strings.Join(terms, " ")) {
+		if !inQuote {
+			if filter, ok := intents.match(word); ok {
+				filters = append(filters, filter)
+				continue
+			}
+		}
+		if strings.Count(word, `"`)%2 == 1 {
+			inQuote = !inQuote
+		}
+		rest = append(rest, word)
+	}
+	return rest, filters
+}
+
+// intentFilter is the filter of a word an intent recognized, with its key
+// in a filterCache: the intent's pattern and the word. Intents with the
+// same pattern are taken to filter alike.
+type intentFilter struct {
+	word string
+	key  string
+	keep func(Document) bool
+}
+
+// match returns the filter of the first intent matching word, and whether
+// there was one.
+func (intents Intents) match(word string) (intentFilter, bool) {
+	for _, intent := range intents {
+		if match := intent.Pattern.FindStringSubmatch(word); match != nil {
+			return intentFilter{word, "intent:" + intent.Pattern.String() + "\x00" + word, intent.Filter(match)}, true
+		}
+	}
+	return intentFilter{}, false
+}
@@ -0,0 +1,75 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIntents(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "essays/walden.md", Dir: "essays", Date: "2021-07-04", Content: "life in the woods by the pond"},
+		Document{Name: "essays/stoics/letters.txt", Dir: "essays/stoics", Date: "2022-03-01", Content: "letters on life and the pond"},
+		Document{Name: "notes/pond.md", Dir: "notes", Date: "2023-01-15", Content: "the pond froze in winter"},
+		Document{Name: "notes/undated.md", Dir: "notes", Content: "a pond without a date"},
+		Document{Name: "misc/a.md", Dir: "misc", Content: "civil disobedience"},
+		Document{Name: "misc/b.md", Dir: "misc", Content: "the state and the citizen"},
+		Document{Name: "misc/c.md", Dir: "misc", Content: "economy and simplicity"},
+		Document{Name: "misc/d.md", Dir: "misc", Content: "the village and the railroad"},
+	), DocOpts{})
+
+	search := func(query string, intents Intents) []string {
+		t.Helper()
+		results, err := index.Search(context.Background(), strings.Fields(query), SearchOpts{Intents: intents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	for query, want := range map[string][]string{
+		"pond after:2022":           {"essays/stoics/letters.txt", "notes/pond.md"},
+		"pond before:2022-03":       {"essays/walden.md"},
+		"pond after:2021-07-05":     {"essays/stoics/letters.txt", "notes/pond.md"},
+		"pond in:essays":            {"essays/stoics/letters.txt", "essays/walden.md"},
+		"pond in:essays ext:md":     {"essays/walden.md"},
+		"pond ext:.TXT":             {"essays/stoics/letters.txt"},
+		"pond after:2022-13":        nil,
+		"pond in:notes before:2030": {"notes/pond.md"},
+	} {
+		if got := search(query, DefaultIntents); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+
+	// without intents the fragments are free text, which matches nothing more
+	if got := search("pond in:essays", nil); len(got) != 4 {
+		t.Errorf("expected intents to be off by default, got %v", got)
+	}
+
+	// custom handlers extend the registry
+	intents := append(Intents{{
+		Pattern: regexp.MustCompile(`^lang:(\w+)$`),
+		Filter: func(match []string) func(Document) bool {
+			return func(doc Document) bool { return match[1] == "txt" && strings.HasSuffix(doc.Name, ".txt") }
+		},
+	}}, DefaultIntents...)
+	if got := search("pond lang:txt", intents); !reflect.DeepEqual(got, []string{"essays/stoics/letters.txt"}) {
+		t.Errorf("expected the custom intent to filter, got %v", got)
+	}
+}
+
+func TestIntentsSkipQuotes(t *testing.T) {
+	rest, filters := DefaultIntents.extract([]string{`title:"notes`, `in:essays"`, "ext:md"})
+	if len(filters) != 1 || !reflect.DeepEqual(rest, []string{`title:"notes`, `in:essays"`}) {
+		t.Errorf("expected quoted words to be left alone, got %v and %d filters", rest, len(filters))
+	}
+}
@@ -0,0 +1,46 @@
+package search
+
+import "strings"
+
+// interner deduplicates strings, so that every copy of a term or document
+// name in the index shares one allocation.
+type interner map[string]string
+
+// intern returns the shared copy of s. The first copy is cloned, so it doesn't
+// pin a larger string (like a document's full text) that s was sliced from.
+func (in interner) intern(s string) string {
+	if shared, ok := in[s]; ok {
+		return shared
+	}
+	s = strings.Clone(s)
+	in[s] = s
+	return s
+}
+
+// internPostings rebuilds the postings of a decoded index so that they share
+// the document name strings, instead of holding one copy per posting.
+func (idx *Index) internPostings() {
+	names := make(interner, len(idx.docs))
+	for name := range idx.docs {
+		names[name] = name
+	}
+	for term, tfreq := range idx.tmap {
+		tfMap := make(map[string]float64, len(tfreq.TfMap))
+		for name, tf := range tfreq.TfMap {
+			tfMap[names.intern(name)] = tf
+		}
+		tfreq.TfMap = tfMap
+		idx.tmap[term] = tfreq
+	}
+}
+
+// appendNGram appends the space-separated words to buf.
+func appendNGram(buf []byte, words []string) []byte {
+	for i, w := range words {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, w...)
+	}
+	return buf
+}
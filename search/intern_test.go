@@ -0,0 +1,34 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"unsafe"
+)
+
+func TestInternPostings(t *testing.T) {
+	docs := []Document{
+		{Name: "a.md", Content: "pond water pond"},
+		{Name: "b.md", Content: "city streets"},
+	}
+	data, err := json.Marshal(mustIndex(t, memLoader(docs...), DocOpts{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadIndex(context.Background(), bytes.NewReader(data), memLoader(docs...), DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name := range loaded.docs {
+		for term, tfreq := range loaded.tmap {
+			for posting := range tfreq.TfMap {
+				if posting == name && unsafe.StringData(posting) != unsafe.StringData(name) {
+					t.Errorf("posting of %s under %q doesn't share the document name", name, term)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Journal is a write-ahead log of the documents added to and removed from
+// an index since its last saved snapshot. Changes made through it are
+// written and synced to the journal file before the changed index is
+// served, so a server that crashes can load the snapshot and Replay the
+// journal rather than rebuild the index. A change that fails, such as
+// adding a document that's already in the index, isn't journaled:
+//
+//	snapshot, err := LoadIndex(nil, opts)
+//	idx, err := j.Replay(snapshot)
+//	m := NewIndexManager(idx)
+//	j.AddDocuments(m, docs)
+//	j.Checkpoint(m, opts.Storage.Path)
+//
+// It's safe for concurrent use.
+type Journal struct {
+	mu   sync.Mutex // held while a change is written and applied, and during checkpoints
+	file *os.File
+}
+
+// journalEntry is one change, a line of JSON in the journal file.
+type journalEntry struct {
+	Op   string    `json:"op"` // "add" or "remove"
+	Doc  *Document `json:"doc,omitempty"`
+	Name string    `json:"name,omitempty"`
+}
+
+// OpenJournal opens the journal at path, creating it if it doesn't exist.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{file: file}, nil
+}
+
+// AddDocuments adds docs to m's index, journaling them first.
+func (j *Journal) AddDocuments(m *IndexManager, docs []Document) error {
+	entries := make([]journalEntry, len(docs))
+	for i := range docs {
+		entries[i] = journalEntry{Op: "add", Doc: &docs[i]}
+	}
+	return j.apply(m, entries, func(idx *Index) (*Index, error) { return idx.AddDocuments(docs) })
+}
+
+// RemoveDocuments removes the named documents from m's index, journaling
+// their removal first.
+func (j *Journal) RemoveDocuments(m *IndexManager, names []string) error {
+	entries := make([]journalEntry, len(names))
+	for i, name := range names {
+		entries[i] = journalEntry{Op: "remove", Name: name}
+	}
+	return j.apply(m, entries, func(idx *Index) (*Index, error) { return idx.RemoveDocuments(names) })
+}
+
+// apply updates m, writing entries to the journal and syncing it once the
+// update has succeeded but before the updated index replaces the current
+// one.
+func (j *Journal) apply(m *IndexManager, entries []journalEntry, update func(*Index) (*Index, error)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return m.Update(func(idx *Index) (*Index, error) {
+		updated, err := update(idx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := j.file.Write(buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to write journal: %w", err)
+		}
+		if err := j.file.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to sync journal: %w", err)
+		}
+		return updated, nil
+	})
+}
+
+// Replay applies the journaled changes to idx and returns the result.
+// Changes that can't apply are skipped: one that's already in idx, as when a
+// checkpoint saved the snapshot but crashed before clearing the journal, a
+// second addition of the same document, and the removal of one that isn't
+// there. So is a last entry cut short by a crash.
+func (j *Journal) Replay(idx *Index) (*Index, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(j.file)
+	// consecutive additions are applied together
+	var adds []Document
+	added := make(map[string]bool)
+	flush := func() error {
+		if len(adds) == 0 {
+			return nil
+		}
+		var err error
+		idx, err = idx.AddDocuments(adds)
+		adds = nil
+		clear(added)
+		return err
+	}
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// an unterminated line was being written when the server stopped
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e journalEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("%w: journal line %d: %w", ErrCorruptIndex, line, err)
+		}
+		switch {
+		case e.Op == "add" && e.Doc != nil:
+			if _, ok := idx.docs[e.Doc.Name]; !ok && !added[e.Doc.Name] {
+				adds = append(adds, *e.Doc)
+				added[e.Doc.Name] = true
+			}
+		case e.Op == "remove":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if _, ok := idx.docs[e.Name]; ok {
+				if idx, err = idx.RemoveDocuments([]string{e.Name}); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%w: journal line %d: unknown entry %q", ErrCorruptIndex, line, e.Op)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Checkpoint saves m's index to path, as Index.Save does, and then clears
+// the journal, whose changes the saved index now holds. The snapshot is
+// synced to disk, renamed into place and its directory synced before the
+// journal is cleared, so a crash at any point leaves either the old
+// snapshot and its journal or the new snapshot. Changes wait for the
+// checkpoint to finish.
+func (j *Journal) Checkpoint(m *IndexManager, path string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	idx := m.Index()
+	if err := idx.Save(path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if docs := idx.storage.DocsPath; docs != "" {
+		if err := syncDir(filepath.Dir(docs)); err != nil {
+			return fmt.Errorf("failed to sync snapshot: %w", err)
+		}
+	}
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// syncDir syncs the directory dir, so that files renamed into it stay
+// renamed after a crash. Windows can't sync directories, and doesn't need
+// to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	docs := []Document{
+		{Name: "pond.md", Content: "pond froze in winter"},
+		{Name: "bean.md", Content: "bean field by summer"},
+		{Name: "town.md", Content: "village in winter"},
+		{Name: "hut.md", Content: "hut by railroad"},
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.journal")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := mustIndex(t, memLoader(docs[:2]...), DocOpts{})
+	m := NewIndexManager(snapshot)
+	if err := j.AddDocuments(m, docs[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.RemoveDocuments(m, []string{"bean.md"}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// a crash left half an entry at the end of the journal
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"add","doc":{"na`)
+	f.Close()
+
+	write := func(idx *Index) []byte {
+		var buf bytes.Buffer
+		if err := idx.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	if j, err = OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	replayed, err := j.Replay(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(write(replayed), write(m.Index())) {
+		t.Error("replayed index differs from the index before the crash")
+	}
+	// replaying onto an index that has the changes already changes nothing
+	again, err := j.Replay(replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(write(again), write(replayed)) {
+		t.Error("replaying twice changed the index")
+	}
+
+	// a checkpoint that can't save its snapshot keeps the journal
+	if err := j.Checkpoint(m, filepath.Join(dir, "missing", "index.json.gz")); err == nil {
+		t.Error("expected a checkpoint into a missing directory to fail")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("expected the journal to survive a failed checkpoint, got %v, %v", info, err)
+	}
+	snapshotPath := filepath.Join(dir, "index.json.gz")
+	if err := j.Checkpoint(m, snapshotPath); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("expected an empty journal after a checkpoint, got %v, %v", info, err)
+	}
+	if entries, _ := filepath.Glob(snapshotPath + ".tmp*"); len(entries) > 0 {
+		t.Errorf("expected no temporary snapshots to be left, got %v", entries)
+	}
+	loaded := mustLoad(t, nil, DocOpts{Storage: StorageOpts{Path: snapshotPath, Compressed: true}})
+	if loaded.DocCount() != m.Index().DocCount() {
+		t.Errorf("expected the snapshot to hold %d documents, got %d", m.Index().DocCount(), loaded.DocCount())
+	}
+}
+
+func TestJournalFailedChange(t *testing.T) {
+	docs := []Document{
+		{Name: "pond.md", Content: "pond froze in winter"},
+		{Name: "bean.md", Content: "bean field by summer"},
+	}
+	path := filepath.Join(t.TempDir(), "index.journal")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	snapshot := mustIndex(t, memLoader(docs[:1]...), DocOpts{})
+	m := NewIndexManager(snapshot)
+	if err := j.AddDocuments(m, docs[1:]); err != nil {
+		t.Fatal(err)
+	}
+	journaled, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.AddDocuments(m, docs[1:]); err == nil {
+		t.Error("expected an error adding a document twice")
+	}
+	if err := j.RemoveDocuments(m, []string{"hut.md"}); err == nil {
+		t.Error("expected an error removing a missing document")
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, journaled) {
+		t.Errorf("expected failed changes to be left out of the journal, got %s", data)
+	}
+	if _, err := j.Replay(snapshot); err != nil {
+		t.Errorf("expected the journal to replay, got %v", err)
+	}
+
+	// a journal written by an earlier version may still hold failed changes
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(journaled)
+	f.WriteString(`{"op":"remove","name":"hut.md"}` + "\n")
+	f.Close()
+	replayed, err := j.Replay(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.DocCount() != 2 {
+		t.Errorf("expected 2 documents, got %d", replayed.DocCount())
+	}
+}
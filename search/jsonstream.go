@@ -0,0 +1,95 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// encodeJSON writes the index to w in FormatJSON, as json.Marshal would
+// encode its jsonIndex, followed by a newline. It's written a term and a
+// document at a time rather than marshaled whole, so that saving holds at
+// most one term's postings in encoded form, however large the index: only
+// the sorted list of terms is held throughout. Compact postings are
+// expanded one term at a time too.
+func (idx *Index) encodeJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	header, err := json.Marshal(newJSONHeader())
+	if err != nil {
+		return err
+	}
+	// continue the header's object with the fields of jsonIndex
+	bw.Write(bytes.TrimSuffix(header, []byte("}")))
+
+	terms := make([]string, 0, len(idx.tmap))
+	for term := range idx.tmap {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	bw.WriteString(`,"t_map":{`)
+	for i, term := range terms {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		tfreq := idx.tmap[term]
+		if err := writeJSONField(bw, term, TermFreq{Idf: tfreq.Idf, TfMap: idx.postings(tfreq)}); err != nil {
+			return fmt.Errorf("failed to encode term %q: %w", term, err)
+		}
+	}
+	bw.WriteByte('}')
+
+	if len(idx.fieldAnalyzers) > 0 {
+		bw.WriteByte(',')
+		if err := writeJSONField(bw, "field_analyzers", idx.fieldAnalyzers); err != nil {
+			return err
+		}
+	}
+	if words := idx.stopWordList(); len(words) > 0 {
+		bw.WriteByte(',')
+		if err := writeJSONField(bw, "stop_words", words); err != nil {
+			return err
+		}
+	}
+	if len(idx.pruned) > 0 {
+		bw.WriteByte(',')
+		if err := writeJSONField(bw, "pruned", idx.prunedList()); err != nil {
+			return err
+		}
+	}
+	if idx.storage.DocsPath == "" && len(idx.docs) > 0 {
+		bw.WriteString(`,"docs":[`)
+		for i, doc := range idx.sortedDocs() {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return fmt.Errorf("failed to encode document %s: %w", doc.Name, err)
+			}
+			bw.Write(data)
+		}
+		bw.WriteByte(']')
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// writeJSONField writes "key":value, with the value as json.Marshal encodes
+// it.
+func writeJSONField(w *bufio.Writer, key string, value any) error {
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	w.Write(k)
+	w.WriteByte(':')
+	_, err = w.Write(v)
+	return err
+}
@@ -0,0 +1,51 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded means a search went over one of the index's Limits.
+var ErrLimitExceeded = errors.New("search limit exceeded")
+
+// Limits are hard caps on the work a single search may do, protecting a
+// server from pathological queries, such as ones that rewriters or
+// expansions blow up into thousands of terms. A search over a limit fails
+// with a *LimitError rather than running. Zero means no limit.
+type Limits struct {
+	// MaxTerms caps the terms a query is expanded into and looked up: its
+	// n-grams, dictionary expansions and field terms. A query of n words has
+	// up to 3n-3 n-grams with the default n-gram range.
+	MaxTerms int
+	// MaxCandidates caps the documents that match any query term and would
+	// be scored.
+	MaxCandidates int
+	// MaxResults caps SearchOpts.Offset plus Limit, the results up to the
+	// end of the page, or the rerank depth if it's larger. A search without
+	// a Limit isn't over it but returns at most MaxResults results, counting
+	// those skipped by its Offset, so none if its Offset reaches MaxResults.
+	MaxResults int
+}
+
+// LimitError records the limit a search exceeded.
+type LimitError struct {
+	Limit string // "terms", "candidates" or "results"
+	Max   int
+	Got   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %d %s, over the maximum of %d", ErrLimitExceeded, e.Got, e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// checkLimit returns a *LimitError if got is over max, unless max is 0.
+func checkLimit(limit string, max, got int) error {
+	if max > 0 && got > max {
+		return &LimitError{Limit: limit, Max: max, Got: got}
+	}
+	return nil
+}
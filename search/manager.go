@@ -0,0 +1,118 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// IndexManager serves an index that can be replaced while it's being
+// searched. Readers never take a lock: they pin the current index with an
+// atomic reference count, and a replaced index is only reported drained once
+// the last search started against it has finished.
+//
+// The concurrency model is snapshot isolation by copy-on-write. A built
+// Index is never modified, so any number of goroutines may search it, and a
+// search sees the index that was current when it started, from start to
+// finish, however many rebuilds or updates are swapped in meanwhile. Writers
+// (Swap, Reload and Update) never modify the index being searched: they
+// build a new one, sharing whatever hasn't changed, and swap it in.
+// Reload and Update run one at a time.
+type IndexManager struct {
+	current atomic.Pointer[generation]
+	reload  sync.Mutex // serializes Reload and Update calls
+}
+
+// generation is one index served by a manager, with the searches pinning it.
+type generation struct {
+	index   *Index
+	refs    atomic.Int64
+	retired atomic.Bool
+	once    sync.Once
+	drained chan struct{}
+}
+
+func newGeneration(idx *Index) *generation {
+	return &generation{index: idx, drained: make(chan struct{})}
+}
+
+func (g *generation) release() {
+	if g.refs.Add(-1) == 0 && g.retired.Load() {
+		g.once.Do(func() { close(g.drained) })
+	}
+}
+
+// NewIndexManager returns a manager serving idx.
+func NewIndexManager(idx *Index) *IndexManager {
+	m := &IndexManager{}
+	m.current.Store(newGeneration(idx))
+	return m
+}
+
+// Acquire returns the current index and a release function that must be
+// called once the caller is done with it. Until then, a Swap waiting for the
+// index to drain keeps waiting.
+func (m *IndexManager) Acquire() (*Index, func()) {
+	for {
+		g := m.current.Load()
+		g.refs.Add(1)
+		if m.current.Load() == g {
+			return g.index, g.release
+		}
+		// swapped out between the load and the increment; try the new one
+		g.release()
+	}
+}
+
+// Index returns the current index without pinning it.
+func (m *IndexManager) Index() *Index {
+	return m.current.Load().index
+}
+
+// Search searches the current index.
+func (m *IndexManager) Search(ctx context.Context, terms []string, opts SearchOpts) ([]SearchResult, error) {
+	idx, release := m.Acquire()
+	defer release()
+	return idx.Search(ctx, terms, opts)
+}
+
+// Swap makes idx the current index. The returned channel is closed once
+// every search of the previous index has finished, after which the caller
+// may release anything the old index holds.
+func (m *IndexManager) Swap(idx *Index) <-chan struct{} {
+	old := m.current.Swap(newGeneration(idx))
+	old.retired.Store(true)
+	if old.refs.Load() == 0 {
+		old.once.Do(func() { close(old.drained) })
+	}
+	return old.drained
+}
+
+// Reload builds or loads a new index with load and swaps it in, then waits
+// for the previous index to drain. Searches keep being served from the
+// previous index while load runs, so Reload is meant to be called from its
+// own goroutine. If load fails the current index stays in place.
+// Concurrent reloads run one at a time.
+func (m *IndexManager) Reload(load func() (*Index, error)) error {
+	return m.Update(func(*Index) (*Index, error) { return load() })
+}
+
+// Update derives a new index from the current one with update, swaps it in,
+// and waits for the previous index to drain. update must not modify the
+// index it's given, since it's still being searched, but return a new one,
+// which may share the parts that haven't changed:
+//
+//	m.Update(func(idx *Index) (*Index, error) { return MergeIndexes(idx, delta) })
+//
+// Updates run one at a time, each given the result of the last, so none is
+// lost. If update fails the current index stays in place.
+func (m *IndexManager) Update(update func(*Index) (*Index, error)) error {
+	m.reload.Lock()
+	defer m.reload.Unlock()
+	idx, err := update(m.Index())
+	if err != nil {
+		return err
+	}
+	<-m.Swap(idx)
+	return nil
+}
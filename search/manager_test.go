@@ -0,0 +1,103 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestIndexManagerSwap(t *testing.T) {
+	city := Document{Name: "city.md", Content: "the city streets"}
+	winter := mustIndex(t, memLoader(city, Document{Name: "winter.md", Content: "the pond in winter"}), DocOpts{})
+	summer := mustIndex(t, memLoader(city, Document{Name: "summer.md", Content: "the pond in summer"}), DocOpts{})
+	m := NewIndexManager(winter)
+
+	idx, release := m.Acquire()
+	drained := m.Swap(summer)
+	select {
+	case <-drained:
+		t.Fatal("old index drained while still acquired")
+	default:
+	}
+	if idx != winter || m.Index() != summer {
+		t.Fatal("expected the pinned index to stay, and new searches to use the new one")
+	}
+	release()
+	<-drained
+
+	results, err := m.Search(context.Background(), []string{"pond"}, SearchOpts{Limit: 1})
+	if err != nil || len(results) != 1 || results[0].Name != "summer.md" {
+		t.Errorf("expected summer.md, got %+v (%v)", results, err)
+	}
+
+	if err := m.Reload(func() (*Index, error) { return nil, errors.New("broken") }); err == nil {
+		t.Error("expected the load error")
+	}
+	if m.Index() != summer {
+		t.Error("a failed reload replaced the index")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := m.Search(context.Background(), []string{"pond"}, SearchOpts{Limit: 1}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		next := winter
+		if i%2 == 1 {
+			next = summer
+		}
+		if err := m.Reload(func() (*Index, error) { return next, nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestIndexManagerUpdateIsolation(t *testing.T) {
+	city := Document{Name: "city.md", Content: "the city streets"}
+	pond := Document{Name: "pond.md", Content: "the pond in winter"}
+	m := NewIndexManager(mustIndex(t, memLoader(city, pond), DocOpts{}))
+	delta := mustIndex(t, memLoader(
+		Document{Name: "lake.md", Content: "the lake in winter"},
+		Document{Name: "field.md", Content: "the bean field"},
+	), DocOpts{})
+
+	snapshot, release := m.Acquire()
+	done := make(chan error)
+	go func() {
+		done <- m.Update(func(idx *Index) (*Index, error) { return MergeIndexes(idx, delta) })
+	}()
+	for m.Index() == snapshot {
+		runtime.Gosched()
+	}
+
+	// a search pinned before the update still sees the old documents and postings
+	results, err := snapshot.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 5})
+	if err != nil || len(results) != 1 || snapshot.DocCount() != 2 {
+		t.Errorf("snapshot changed under a pinned search: %d docs, %+v (%v)", snapshot.DocCount(), results, err)
+	}
+	select {
+	case <-done:
+		t.Fatal("update finished while the old index was pinned")
+	default:
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = m.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 5})
+	if err != nil || len(results) != 2 {
+		t.Errorf("expected both winter documents after the update, got %+v (%v)", results, err)
+	}
+}
@@ -0,0 +1,265 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// mappedMagic starts an index in FormatMapped, which is laid out so that
+// LoadIndex can map it into memory and search it in place: a term's
+// postings, the bulk of a large index, are left in the file, compact, and
+// read through the mapping rather than decoded onto the heap. Only the term
+// directory and the stored documents are decoded. All numbers are uvarints
+// but idfs, which are little-endian float64s:
+//
+//	magic        "IRMAPPED"
+//	version      1
+//	metadata     length, then an infrared.v1.Metadata message
+//	documents    count, then the name (length, bytes) and length in words of each, by name
+//	terms        count, then the text (length, bytes), idf and postings (length,
+//	             bytes) of each, by text; postings are (document number delta,
+//	             count) pairs as in compact postings
+//	stored docs  count, then each as a length and an infrared.v1.Document message
+//
+// A documents file, as saved at StorageOpts.DocsPath, has no documents or
+// terms, only stored docs.
+const mappedMagic = "IRMAPPED"
+
+// mappedFormatVersion is the version of FormatMapped written and read.
+const mappedFormatVersion = 1
+
+// encodeMapped writes the index in FormatMapped, with or without its terms
+// and its stored documents.
+func (idx *Index) encodeMapped(w io.Writer, withTerms, withDocs bool) error {
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	uvarint := func(n uint64) {
+		buf = binary.AppendUvarint(buf[:0], n)
+		bw.Write(buf)
+	}
+	bytes := func(b []byte) {
+		uvarint(uint64(len(b)))
+		bw.Write(b)
+	}
+	bw.WriteString(mappedMagic)
+	uvarint(mappedFormatVersion)
+	bytes(idx.protoMeta())
+
+	if !withTerms {
+		uvarint(0)
+		uvarint(0)
+	} else {
+		table := idx.docTable
+		var ids map[string]uint32
+		if table == nil {
+			table, ids = idx.newDocTable()
+		}
+		uvarint(uint64(len(table.names)))
+		for i, name := range table.names {
+			bytes([]byte(name))
+			uvarint(uint64(table.lengths[i]))
+		}
+		terms := make([]string, 0, len(idx.tmap))
+		for term := range idx.tmap {
+			terms = append(terms, term)
+		}
+		sort.Strings(terms)
+		uvarint(uint64(len(terms)))
+		for _, term := range terms {
+			tfreq := idx.tmap[term]
+			bytes([]byte(term))
+			buf = binary.LittleEndian.AppendUint64(buf[:0], math.Float64bits(tfreq.Idf))
+			bw.Write(buf)
+			if ids != nil {
+				bytes(table.encode(tfreq.TfMap, ids))
+			} else {
+				bytes(tfreq.postings)
+			}
+		}
+	}
+
+	if !withDocs {
+		uvarint(0)
+	} else {
+		docs := idx.sortedDocs()
+		uvarint(uint64(len(docs)))
+		for _, doc := range docs {
+			bytes(marshalProtoDoc(doc))
+		}
+	}
+	return bw.Flush()
+}
+
+// mappedReader reads the fields of a FormatMapped index from data, keeping
+// the first error.
+type mappedReader struct {
+	data []byte
+	err  error
+}
+
+func (r *mappedReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(r.data)
+	if size <= 0 {
+		r.err = fmt.Errorf("%w: truncated mapped index", ErrCorruptIndex)
+		return 0
+	}
+	r.data = r.data[size:]
+	return n
+}
+
+// bytes returns the next length-prefixed field, a slice of data.
+func (r *mappedReader) bytes() []byte {
+	return r.next(r.uvarint())
+}
+
+func (r *mappedReader) next(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)) {
+		r.err = fmt.Errorf("%w: truncated mapped index", ErrCorruptIndex)
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *mappedReader) float64() float64 {
+	if b := r.next(8); r.err == nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// count returns the next count of items of at least size bytes each, or 0
+// with an error if there aren't bytes enough for them.
+func (r *mappedReader) count(size int) int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)/size) {
+		r.err = fmt.Errorf("%w: truncated mapped index", ErrCorruptIndex)
+		return 0
+	}
+	return int(n)
+}
+
+// decodeMapped decodes an index in FormatMapped, and its stored documents.
+// Postings are left in data, which must stay unchanged while the index is
+// used; term texts, names and documents are copied out of it.
+func decodeMapped(data []byte) (*Index, []Document, error) {
+	if !bytes.HasPrefix(data, []byte(mappedMagic)) {
+		return nil, nil, fmt.Errorf("%w: not a mapped index", ErrCorruptIndex)
+	}
+	r := &mappedReader{data: data[len(mappedMagic):]}
+	if err := checkVersion("mapped", int(r.uvarint()), mappedFormatVersion); r.err == nil && err != nil {
+		return nil, nil, err
+	}
+	idx := &Index{tmap: make(map[string]TermFreq)}
+	if meta := r.bytes(); r.err == nil {
+		if err := unmarshalProtoMeta(meta, idx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	table := &docTable{}
+	for i, n := 0, r.count(2); i < n; i++ {
+		table.names = append(table.names, string(r.bytes()))
+		table.lengths = append(table.lengths, uint32(max(r.uvarint(), 1)))
+	}
+	for i, n := 0, r.count(10); i < n && r.err == nil; i++ {
+		term := string(r.bytes())
+		idf := r.float64()
+		postings := r.bytes()
+		if r.err == nil && !table.valid(postings) {
+			return nil, nil, fmt.Errorf("%w: term %q has invalid postings", ErrCorruptIndex, term)
+		}
+		idx.tmap[term] = TermFreq{Idf: idf, postings: postings}
+	}
+	if len(table.names) > 0 {
+		idx.docTable = table
+	}
+
+	var docs []Document
+	for i, n := 0, r.count(1); i < n && r.err == nil; i++ {
+		doc, err := unmarshalProtoDoc(r.bytes())
+		if err != nil {
+			return nil, nil, err
+		}
+		docs = append(docs, doc)
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	return idx, docs, nil
+}
+
+// valid reports whether postings only number documents of the table, so
+// that decoding them can't go out of range.
+func (table *docTable) valid(postings []byte) bool {
+	id := uint64(0)
+	for len(postings) > 0 {
+		delta, a := binary.Uvarint(postings)
+		if a <= 0 {
+			return false
+		}
+		_, b := binary.Uvarint(postings[a:])
+		if b <= 0 {
+			return false
+		}
+		postings = postings[a+b:]
+		if id += delta; id >= uint64(len(table.names)) {
+			return false
+		}
+	}
+	return true
+}
+
+// openMapped opens the FormatMapped index of file by mapping the file into
+// memory, where its postings stay until the index is closed. An index that
+// isn't mapped, as when it's compressed, is read as ReadIndex reads it.
+func openMapped(ctx context.Context, file *os.File, loader Loader, opts DocOpts) (*Index, error) {
+	data, err := mapFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map index file: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty index file", ErrCorruptIndex)
+	}
+	if !bytes.HasPrefix(data, []byte(mappedMagic)) {
+		defer unmapFile(data)
+		return ReadIndex(ctx, bytes.NewReader(data), loader, opts)
+	}
+	idx, docs, err := decodeMapped(data)
+	if err == nil {
+		err = idx.finishRead(ctx, docs, loader, opts)
+	}
+	if err != nil {
+		unmapFile(data)
+		return nil, err
+	}
+	idx.mapping = data
+	return idx, nil
+}
+
+// Close releases the memory mapping of an index LoadIndex opened in
+// FormatMapped, after which the index mustn't be used. Indexes derived from
+// it, as by AddDocuments, have their own postings and stay usable. Closing
+// any other index does nothing.
+func (idx *Index) Close() error {
+	if idx.mapping == nil {
+		return nil
+	}
+	data := idx.mapping
+	idx.mapping, idx.tmap, idx.docTable = nil, nil, nil
+	return unmapFile(data)
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMappedIndex(t *testing.T) {
+	opts := DocOpts{
+		Load:     LoadOpts{Path: "../example/docs", Content: true, LenPreview: 100},
+		Entities: Gazetteer{"Walden": "place", "Concord": "place", "Thoreau": "person"},
+		Storage:  StorageOpts{Format: FormatMapped},
+	}
+	index := mustIndex(t, DefaultLoader, opts)
+	opts.Storage.Path = filepath.Join(t.TempDir(), "index.irm")
+	if err := index.Save(opts.Storage.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped := mustLoad(t, nil, opts)
+	if mapped.mapping == nil {
+		t.Fatal("expected the index to be mapped")
+	}
+	if len(mapped.tmap) != len(index.tmap) {
+		t.Fatalf("expected %d terms, got %d", len(index.tmap), len(mapped.tmap))
+	}
+	for term, tfreq := range index.tmap {
+		got, ok := mapped.tmap[term]
+		if !ok || got.Idf != tfreq.Idf || !reflect.DeepEqual(mapped.postings(got), index.postings(tfreq)) {
+			t.Errorf("postings of %q differ", term)
+			break
+		}
+	}
+	if !reflect.DeepEqual(mapped.docs, index.docs) {
+		t.Error("documents of the mapped index differ")
+	}
+	want, _ := index.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 3})
+	got, err := mapped.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || got[0].Name != want[0].Name || got[0].Score != want[0].Score {
+		t.Errorf("expected results %+v, got %+v", want, got)
+	}
+
+	// derived indexes have their own postings
+	added, err := mapped.AddDocuments([]Document{{Name: "new.md", Content: "a moral law of ponds"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mapped.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := added.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 3}); len(results) == 0 {
+		t.Error("expected results from an index derived from a closed one")
+	}
+
+	// ReadIndex decodes the same file
+	data, err := os.ReadFile(opts.Storage.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadIndex(context.Background(), bytes.NewReader(data), nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.TermCount() != index.TermCount() || read.DocCount() != index.DocCount() {
+		t.Errorf("expected %d terms and %d documents, got %d and %d",
+			index.TermCount(), index.DocCount(), read.TermCount(), read.DocCount())
+	}
+
+	for _, n := range []int{len(data) / 2, len(data) - 1} {
+		if _, err := ReadIndex(context.Background(), bytes.NewReader(data[:n]), nil, opts); !errors.Is(err, ErrCorruptIndex) {
+			t.Errorf("expected ErrCorruptIndex for an index truncated to %d bytes, got %v", n, err)
+		}
+	}
+}
+
+func TestSaveMappedOverItself(t *testing.T) {
+	opts := DocOpts{
+		Load:    LoadOpts{Path: "../example/docs", Content: true},
+		Storage: StorageOpts{Format: FormatMapped},
+	}
+	opts.Storage.Path = filepath.Join(t.TempDir(), "index.irm")
+	if err := mustIndex(t, DefaultLoader, opts).Save(opts.Storage.Path); err != nil {
+		t.Fatal(err)
+	}
+	mapped := mustLoad(t, nil, opts)
+	defer mapped.Close()
+	want, _ := mapped.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 3})
+
+	// the mapping keeps reading the replaced file
+	if err := mapped.Save(opts.Storage.Path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := mapped.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 3})
+	if err != nil || len(got) == 0 || len(got) != len(want) || got[0].Name != want[0].Name {
+		t.Errorf("expected results %+v after saving over the mapped file, got %+v, %v", want, got, err)
+	}
+	resaved := mustLoad(t, nil, opts)
+	defer resaved.Close()
+	if resaved.TermCount() != mapped.TermCount() || resaved.DocCount() != mapped.DocCount() {
+		t.Error("expected the resaved index to load as it was")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(opts.Storage.Path)); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %v", entries)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.irm")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts.Storage.Path = empty
+	if _, err := LoadIndex(context.Background(), nil, opts); !errors.Is(err, ErrCorruptIndex) {
+		t.Errorf("expected ErrCorruptIndex for an empty file, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+)
+
+// MergeIndexes returns an index of the documents of both a and b, built from
+// their postings rather than by re-tokenizing the documents. Term counts are
+// recovered from the stored term frequencies and document lengths, so idf is
+// recomputed and common terms pruned over the combined corpus. Terms that
+// either index had pruned as too common stay pruned, as their postings there
+// are gone; otherwise merging two indexes of disjoint corpora gives the same
+// index as building one from all the documents.
+//
+// Both indexes need their stored documents, must index the same n-gram
+// lengths, and mustn't share document names. The result has a's
+// configuration; neither a nor b is modified.
+func MergeIndexes(a, b *Index) (*Index, error) {
+	for _, idx := range []*Index{a, b} {
+		if len(idx.docs) == 0 && len(idx.tmap) > 0 {
+			return nil, errors.New("cannot merge an index without its stored documents")
+		}
+	}
+	if a.foldPlurals != b.foldPlurals {
+		return nil, errors.New("cannot merge an index that folds plurals with one that doesn't")
+	}
+	if a.foldDiacritics != b.foldDiacritics {
+		return nil, errors.New("cannot merge an index that folds diacritics with one that doesn't")
+	}
+	if !maps.Equal(a.fieldAnalyzers, b.fieldAnalyzers) {
+		return nil, errors.New("cannot merge indexes with different field analyzers")
+	}
+	if !maps.Equal(a.stopWords, b.stopWords) {
+		return nil, errors.New("cannot merge indexes with different stop words")
+	}
+	if a.ngrams != b.ngrams {
+		return nil, fmt.Errorf("cannot merge indexes of %d to %d-grams and %d to %d-grams",
+			a.ngrams.min, a.ngrams.max, b.ngrams.min, b.ngrams.max)
+	}
+
+	merged := a.derived()
+	merged.docs = make(map[string]Document, len(a.docs)+len(b.docs))
+	for _, idx := range []*Index{a, b} {
+		for name, doc := range idx.docs {
+			if _, ok := merged.docs[name]; ok {
+				return nil, fmt.Errorf("document %q is in both indexes", name)
+			}
+			merged.docs[name] = doc
+		}
+		for kind := range idx.fields {
+			merged.fields[kind] = true
+		}
+	}
+
+	// postings share the names of the stored documents
+	names := make(interner, len(merged.docs))
+	for name := range merged.docs {
+		names[name] = name
+	}
+	merged.pruned = make(map[string]bool, len(a.pruned)+len(b.pruned))
+	maps.Copy(merged.pruned, a.pruned)
+	maps.Copy(merged.pruned, b.pruned)
+	merged.tmap = make(map[string]TermFreq, max(len(a.tmap), len(b.tmap)))
+	a.addCounts(merged.tmap, names)
+	b.addCounts(merged.tmap, names)
+	if merged.positions != nil {
+		if b.positions != nil {
+			merged.positions.merge(a.positions)
+			merged.positions.merge(b.positions)
+		} else {
+			merged.indexPositions()
+		}
+	}
+	merged.indexDirs()
+	merged.prune()
+	return merged, nil
+}
+
+// derived returns an empty index with the configuration of idx.
+func (idx *Index) derived() *Index {
+	return &Index{
+		normalizer:   idx.normalizer,
+		expander:     idx.expander,
+		entities:     idx.entities,
+		fields:       make(map[string]bool),
+		storage:      idx.storage,
+		load:         idx.load,
+		ngrams:       idx.ngrams,
+		workers:      idx.workers,
+		compact:      idx.compact,
+		memoryBudget: idx.memoryBudget,
+		spillDir:     idx.spillDir,
+		// stopwords are rediscovered over the combined corpus
+		stopwordRatio:  idx.stopwordRatio,
+		stopwordWeight: idx.stopwordWeight,
+		foldPlurals:    idx.foldPlurals,
+		foldDiacritics: idx.foldDiacritics,
+		sentenceNGrams: idx.sentenceNGrams,
+		fieldAnalyzers: idx.fieldAnalyzers,
+		stopWords:      idx.stopWords,
+		limits:         idx.limits,
+		outliers:       idx.outliers,
+		filters:        idx.filters.empty(),
+		transforms:     idx.transforms,
+		withholdText:   idx.withholdText,
+		audit:          idx.audit,
+		positions:      idx.positions.empty(),
+	}
+}
+
+// addCounts adds the postings of idx to tmap as term counts, as indexDoc
+// would have counted them, with document names taken from names.
+func (idx *Index) addCounts(tmap map[string]TermFreq, names interner) {
+	for term, tfreq := range idx.tmap {
+		counts, ok := tmap[term]
+		if !ok {
+			counts = TermFreq{TfMap: make(map[string]float64)}
+			tmap[term] = counts
+		}
+		for name, tf := range idx.postings(tfreq) {
+			counts.TfMap[names.intern(name)] = math.Round(tf * float64(idx.docs[name].tokens()))
+		}
+	}
+}
+
+// AddDocuments returns an index of the documents of idx and docs, leaving
+// idx as it is, as IndexManager.Update needs:
+//
+//	m.Update(func(idx *Index) (*Index, error) { return idx.AddDocuments(docs) })
+//
+// Only docs are tokenized; the documents of idx keep their postings, as in
+// MergeIndexes, and idf is recomputed over all of them. As there, terms that
+// idx had pruned as too common stay pruned. Entities are extracted from docs
+// with the index's extractor, after its transforms. idx needs its stored
+// documents, and a document whose name is already in it is an error.
+func (idx *Index) AddDocuments(docs []Document) (*Index, error) {
+	if len(idx.docs) == 0 && len(idx.tmap) > 0 {
+		return nil, errors.New("cannot add to an index without its stored documents")
+	}
+	added := idx.derived()
+	added.docs = make(map[string]Document, len(idx.docs)+len(docs))
+	maps.Copy(added.docs, idx.docs)
+	maps.Copy(added.fields, idx.fields)
+	added.pruned = maps.Clone(idx.pruned)
+
+	names := make(interner, len(idx.docs))
+	for name := range idx.docs {
+		names[name] = name
+	}
+	added.tmap = make(map[string]TermFreq, len(idx.tmap))
+	idx.addCounts(added.tmap, names)
+	added.positions.merge(idx.positions)
+	var tok tokenizer
+	for _, doc := range docs {
+		if _, ok := added.docs[doc.Name]; ok {
+			return nil, fmt.Errorf("document %q is already in the index", doc.Name)
+		}
+		if err := added.transform(&doc); err != nil {
+			return nil, err
+		}
+		added.extractEntities(&doc)
+		added.indexDoc(&tok, added.tmap, &doc)
+		if added.positions != nil {
+			added.addPositions(&tok, added.positions, &doc)
+		}
+		added.docs[doc.Name] = doc
+	}
+	added.indexDirs()
+	added.prune()
+	added.updates, added.changedDocs = idx.updates+1, idx.changedDocs+len(docs)
+	return added, nil
+}
+
+// RemoveDocuments returns an index of the documents of idx but the named
+// ones, leaving idx as it is, as AddDocuments does. The remaining documents
+// keep their postings and idf is recomputed over them, but terms that idx
+// had pruned as too common stay pruned. A name that isn't in idx is
+// ErrDocumentNotFound.
+func (idx *Index) RemoveDocuments(names []string) (*Index, error) {
+	if len(idx.docs) == 0 && len(idx.tmap) > 0 {
+		return nil, errors.New("cannot remove from an index without its stored documents")
+	}
+	removed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := idx.docs[name]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrDocumentNotFound, name)
+		}
+		removed[name] = true
+	}
+
+	kept := idx.derived()
+	kept.docs = make(map[string]Document, len(idx.docs))
+	interned := make(interner, len(idx.docs))
+	for name, doc := range idx.docs {
+		if !removed[name] {
+			kept.docs[name] = doc
+			interned[name] = name
+			for kind := range doc.Entities {
+				kept.fields[kind] = true
+			}
+		}
+	}
+	kept.pruned = maps.Clone(idx.pruned)
+	kept.tmap = make(map[string]TermFreq, len(idx.tmap))
+	idx.addCounts(kept.tmap, interned)
+	for term, counts := range kept.tmap {
+		for name := range removed {
+			delete(counts.TfMap, name)
+		}
+		if len(counts.TfMap) == 0 {
+			delete(kept.tmap, term)
+		}
+	}
+	kept.positions = idx.positions.without(removed)
+	kept.indexDirs()
+	kept.prune()
+	kept.updates, kept.changedDocs = idx.updates+1, idx.changedDocs+len(removed)
+	return kept, nil
+}
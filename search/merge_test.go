@@ -0,0 +1,141 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMergeIndexes(t *testing.T) {
+	docs := []Document{
+		{Name: "pond.md", Content: "the pond froze in winter"},
+		{Name: "bean.md", Content: "the bean field by summer"},
+		{Name: "town.md", Content: "the village in winter"},
+		{Name: "hut.md", Content: "the hut by the railroad"},
+	}
+	write := func(idx *Index) []byte {
+		var buf bytes.Buffer
+		if err := idx.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	whole := mustIndex(t, memLoader(docs...), DocOpts{})
+	a := mustIndex(t, memLoader(docs[:2]...), DocOpts{})
+	b := mustIndex(t, memLoader(docs[2:]...), DocOpts{CompactPostings: true})
+	merged, err := MergeIndexes(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.DocCount() != 4 {
+		t.Fatalf("expected 4 documents, got %d", merged.DocCount())
+	}
+	if !bytes.Equal(write(merged), write(whole)) {
+		t.Error("merged index differs from the index of all the documents")
+	}
+	results, err := merged.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("expected 2 results for winter, got %+v", results)
+	}
+
+	if _, err := MergeIndexes(a, a); err == nil {
+		t.Error("expected an error merging indexes with the same documents")
+	}
+
+	// added documents are weighed with the rest, not pruned on their own
+	docs = []Document{
+		{Name: "pond.md", Content: "pond froze in winter"},
+		{Name: "bean.md", Content: "bean field by summer"},
+		{Name: "town.md", Content: "village in winter"},
+		{Name: "hut.md", Content: "hut by railroad"},
+	}
+	whole = mustIndex(t, memLoader(docs...), DocOpts{})
+	added, err := mustIndex(t, memLoader(docs[:3]...), DocOpts{}).AddDocuments(docs[3:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(write(added), write(whole)) {
+		t.Error("index with added documents differs from the index of all the documents")
+	}
+	if _, err := added.AddDocuments(docs[:1]); err == nil {
+		t.Error("expected an error adding a document that's already in the index")
+	}
+
+	removed, err := whole.RemoveDocuments([]string{"hut.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(write(removed), write(mustIndex(t, memLoader(docs[:3]...), DocOpts{}))) {
+		t.Error("index with a removed document differs from the index of the rest")
+	}
+	if _, err := removed.RemoveDocuments([]string{"hut.md"}); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound removing a missing document, got %v", err)
+	}
+}
+
+func TestMergePrunedTerm(t *testing.T) {
+	a := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond froze in winter"},
+		Document{Name: "bean.md", Content: "the bean field by summer"},
+	), DocOpts{})
+	b := mustIndex(t, memLoader(
+		Document{Name: "town.md", Content: "the village in winter"},
+		Document{Name: "hut.md", Content: "a hut by a railroad"},
+	), DocOpts{})
+	if !a.pruned["the"] || b.pruned["the"] {
+		t.Fatalf("expected the to be pruned from a alone, got %v and %v", a.pruned, b.pruned)
+	}
+
+	// the postings of a are gone, so those of b alone mustn't bring it back
+	merged, err := MergeIndexes(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := merged.tmap["the"]; ok || !merged.pruned["the"] {
+		t.Error("expected the to stay pruned in the merged index")
+	}
+	added, err := a.AddDocuments([]Document{{Name: "town.md", Content: "the village in winter"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := added.tmap["the"]; ok {
+		t.Error("expected the to stay pruned with an added document")
+	}
+	removed, err := merged.RemoveDocuments([]string{"pond.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed.pruned["the"] {
+		t.Error("expected the to stay pruned with a removed document")
+	}
+
+	var buf bytes.Buffer
+	if err := a.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadIndex(context.Background(), &buf, nil, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.pruned["the"] {
+		t.Errorf("expected the pruned terms to be saved, got %v", loaded.pruned)
+	}
+	data, err := a.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = UnmarshalProto(data, DocOpts{}); err != nil || !loaded.pruned["the"] {
+		t.Errorf("expected the pruned terms in the protobuf, got %v %v", loaded.pruned, err)
+	}
+	if err := loaded.AddDocument(Document{Name: "town.md", Content: "the village in winter"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.tmap["the"]; ok {
+		t.Error("expected the to stay pruned in a loaded index")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package search
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the whole of file, where it can't be mapped into memory, so
+// that FormatMapped is still readable, if not any lighter.
+func mapFile(file *os.File) ([]byte, error) {
+	return io.ReadAll(file)
+}
+
+// unmapFile does nothing, as mapFile's memory is the garbage collector's.
+func unmapFile([]byte) error {
+	return nil
+}
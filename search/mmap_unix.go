@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package search
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the whole of file into memory, read-only. The mapping
+// outlives the file being closed. An empty file has nothing to map.
+func mapFile(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file too large to map")
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile releases a mapping of mapFile.
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
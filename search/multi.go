@@ -0,0 +1,141 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// Calibration is how a MultiIndex makes the scores of its indexes
+// comparable before merging their results.
+type Calibration int
+
+const (
+	// CalibrateNone merges raw scores, which are only comparable between
+	// indexes of similar corpora.
+	CalibrateNone Calibration = iota
+	// CalibrateZScore replaces each score by its number of standard
+	// deviations from the mean score of its index's results.
+	CalibrateZScore
+	// CalibrateMinMax scales the scores of each index's results to 0 to 1.
+	CalibrateMinMax
+	// CalibrateGlobalIDF scores every index with idfs computed over all of
+	// them, as if they were one corpus. Corpus stopwords keep their
+	// weight, since their demotion is local to an index.
+	CalibrateGlobalIDF
+)
+
+// MultiIndex searches several indexes as one, such as one per source or
+// tenant, merging their results into a single ranking.
+type MultiIndex struct {
+	indexes     []*Index
+	calibration Calibration
+	idfs        map[string]float64 // with CalibrateGlobalIDF
+}
+
+// NewMultiIndex returns a MultiIndex over indexes, calibrating their scores
+// as calibration says. With CalibrateGlobalIDF it builds the shared idf
+// table up front, from the term maps of all the indexes.
+func NewMultiIndex(calibration Calibration, indexes ...*Index) *MultiIndex {
+	m := &MultiIndex{indexes: indexes, calibration: calibration}
+	if calibration == CalibrateGlobalIDF {
+		docs := 0
+		docFreqs := make(map[string]int)
+		for _, idx := range indexes {
+			docs += idx.corpusSize()
+			for term, tfreq := range idx.tmap {
+				docFreqs[term] += idx.docFreq(tfreq)
+			}
+		}
+		m.idfs = make(map[string]float64, len(docFreqs))
+		for term, df := range docFreqs {
+			m.idfs[term] = float64(docs) / float64(df)
+		}
+	}
+	return m
+}
+
+// corpusSize returns the number of documents the index was built from,
+// counting the documents in its postings if it was read without them.
+func (idx *Index) corpusSize() int {
+	if len(idx.docs) > 0 {
+		return len(idx.docs)
+	}
+	names := make(map[string]bool)
+	for _, tfreq := range idx.tmap {
+		for name := range idx.postings(tfreq) {
+			names[name] = true
+		}
+	}
+	return len(names)
+}
+
+// Search searches every index with opts and returns the best opts.Limit
+// results of all of them, after opts.Offset, by calibrated score. Z-score
+// and min-max calibration use the statistics of each index's top results
+// up to the end of the page.
+func (m *MultiIndex) Search(ctx context.Context, terms []string, opts SearchOpts) ([]SearchResult, error) {
+	offset := max(opts.Offset, 0)
+	// each index's results up to the end of the page may be on it
+	each := opts
+	each.idfs = m.idfs
+	each.Offset = 0
+	if opts.Limit > 0 {
+		each.Limit = opts.pageEnd()
+	}
+	var merged []SearchResult
+	for _, idx := range m.indexes {
+		results, err := idx.Search(ctx, terms, each)
+		if err != nil {
+			return nil, err
+		}
+		m.calibrate(results)
+		merged = append(merged, results...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	merged = merged[min(offset, len(merged)):]
+	if opts.Limit > 0 && len(merged) > opts.Limit {
+		merged = merged[:opts.Limit]
+	}
+	return merged, nil
+}
+
+// calibrate rescales the scores of one index's results in place.
+func (m *MultiIndex) calibrate(results []SearchResult) {
+	if len(results) == 0 {
+		return
+	}
+	switch m.calibration {
+	case CalibrateZScore:
+		mean, sq := 0.0, 0.0
+		for _, r := range results {
+			mean += r.Score
+		}
+		mean /= float64(len(results))
+		for _, r := range results {
+			sq += (r.Score - mean) * (r.Score - mean)
+		}
+		std := math.Sqrt(sq / float64(len(results)))
+		for i := range results {
+			if std == 0 {
+				results[i].Score = 0
+			} else {
+				results[i].Score = (results[i].Score - mean) / std
+			}
+		}
+	case CalibrateMinMax:
+		lo, hi := results[0].Score, results[0].Score
+		for _, r := range results {
+			lo, hi = min(lo, r.Score), max(hi, r.Score)
+		}
+		for i := range results {
+			if hi == lo {
+				results[i].Score = 1
+			} else {
+				results[i].Score = (results[i].Score - lo) / (hi - lo)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package search
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestMultiIndex(t *testing.T) {
+	a := mustIndex(t, memLoader(
+		Document{Name: "a1.md", Content: "winter pond ice"},
+		Document{Name: "a2.md", Content: "winter"},
+		Document{Name: "a3.md", Content: "summer city streets"},
+	), DocOpts{})
+	b := mustIndex(t, memLoader(
+		Document{Name: "b1.md", Content: "winter woods"},
+		Document{Name: "b2.md", Content: "spring rain"},
+	), DocOpts{})
+
+	results, err := NewMultiIndex(CalibrateMinMax, a, b).Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("got %v, %v", results, err)
+	}
+	best := 0
+	for _, r := range results {
+		if r.Score == 1 {
+			best++
+		}
+	}
+	if best != 2 {
+		t.Errorf("expected the best result of each index to score 1, got %+v", results)
+	}
+
+	results, _ = NewMultiIndex(CalibrateZScore, a, b).Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 2})
+	if len(results) != 2 || results[0].Score < results[1].Score {
+		t.Errorf("expected the best 2 results in order, got %+v", results)
+	}
+
+	m := NewMultiIndex(CalibrateGlobalIDF, a, b)
+	if idf := m.idfs["winter"]; math.Abs(idf-5.0/3) > 1e-9 {
+		t.Errorf("got a global idf of %g for winter, want 5/3", idf)
+	}
+	// the weights of winter and pond in a1's score are the global ones
+	local, _ := a.Search(context.Background(), []string{"winter", "pond", "ice"}, SearchOpts{Limit: 1})
+	results, err = m.Search(context.Background(), []string{"winter", "pond", "ice"}, SearchOpts{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Name == "a1.md" && r.Score == local[0].Score {
+			t.Errorf("expected a1.md scored with global idfs, got the local score %g", r.Score)
+		}
+	}
+}
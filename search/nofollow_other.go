@@ -0,0 +1,7 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package search
+
+// oNoFollow is nothing where open has no flag to refuse symlinks; rootedFS
+// relies on its check after opening alone.
+const oNoFollow = 0
@@ -0,0 +1,8 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package search
+
+import "syscall"
+
+// oNoFollow makes opening a symlink fail rather than open its target.
+const oNoFollow = syscall.O_NOFOLLOW
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+// Outliers limits how much documents far longer than the rest, like a
+// 500k-word dump in a corpus of articles, weigh at index time.
+type Outliers struct {
+	// MaxTokens, if positive, makes documents of more tokens outliers
+	MaxTokens int
+	// DownWeight indexes outliers whole, but counts them as MaxTokens long
+	// in the mean document length and BM25's length normalization, as if
+	// they were a sample of MaxTokens tokens. Otherwise only their first
+	// MaxTokens tokens are indexed, though their Content is kept whole.
+	DownWeight bool
+}
+
+// truncate cuts words, and the sentence bounds into them if there are any,
+// to the first MaxTokens words if the outliers are truncated.
+func (o Outliers) truncate(words []string, bounds []int) ([]string, []int) {
+	if o.MaxTokens <= 0 || o.DownWeight || len(words) <= o.MaxTokens {
+		return words, bounds
+	}
+	words = words[:o.MaxTokens]
+	if bounds == nil {
+		return words, nil
+	}
+	i := sort.SearchInts(bounds, len(words))
+	return words, append(bounds[:i], len(words))
+}
+
+// length returns the number of tokens doc counts as in length statistics.
+func (o Outliers) length(doc Document) int {
+	n := doc.tokens()
+	if o.MaxTokens > 0 && n > o.MaxTokens {
+		return o.MaxTokens
+	}
+	return n
+}
+
+// DocLengths summarizes the lengths of an index's documents, in tokens.
+// Percentiles are nearest-rank: P90 is the length that 90% of the
+// documents are no longer than.
+type DocLengths struct {
+	Min int `json:"min"`
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+	P99 int `json:"p99"`
+	Max int `json:"max"`
+}
+
+// docLengths returns the length percentiles of the documents.
+func (idx *Index) docLengths() DocLengths {
+	if len(idx.docs) == 0 {
+		return DocLengths{}
+	}
+	lengths := make([]int, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		lengths = append(lengths, doc.tokens())
+	}
+	sort.Ints(lengths)
+	rank := func(p float64) int {
+		return lengths[int(math.Ceil(p*float64(len(lengths))))-1]
+	}
+	return DocLengths{
+		Min: lengths[0],
+		P50: rank(0.5),
+		P90: rank(0.9),
+		P99: rank(0.99),
+		Max: lengths[len(lengths)-1],
+	}
+}
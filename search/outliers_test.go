@@ -0,0 +1,49 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOutliers(t *testing.T) {
+	corpus := func() Loader {
+		return memLoader(
+			Document{Name: "a.md", Content: "the pond in winter"},
+			Document{Name: "b.md", Content: "the woods in summer"},
+			Document{Name: "c.md", Content: "the law of the land"},
+			Document{Name: "dump.md", Content: strings.Repeat("ledger entry ", 500) + "appendix"},
+		)
+	}
+
+	plain := mustIndex(t, corpus(), DocOpts{})
+	lengths := plain.Stats().DocLengths
+	if lengths.Min != 4 || lengths.P50 != 4 || lengths.Max != 1001 {
+		t.Errorf("unexpected document lengths %+v", lengths)
+	}
+
+	truncated := mustIndex(t, corpus(), DocOpts{Outliers: Outliers{MaxTokens: 10}})
+	if got := truncated.docs["dump.md"].TokenCount; got != 10 {
+		t.Errorf("expected the outlier to be truncated to 10 tokens, got %d", got)
+	}
+	if results, _ := truncated.Search(context.Background(), []string{"appendix"}, SearchOpts{Limit: 5}); len(results) != 0 {
+		t.Errorf("expected the truncated tail not to be indexed, got %+v", results)
+	}
+	if results, _ := truncated.Search(context.Background(), []string{"ledger"}, SearchOpts{Limit: 5}); len(results) != 1 {
+		t.Errorf("expected the indexed head to match, got %+v", results)
+	}
+	if max := truncated.Stats().DocLengths.Max; max != 10 {
+		t.Errorf("expected the longest document to be 10 tokens, got %d", max)
+	}
+
+	weighted := mustIndex(t, corpus(), DocOpts{Outliers: Outliers{MaxTokens: 10, DownWeight: true}})
+	if results, _ := weighted.Search(context.Background(), []string{"appendix"}, SearchOpts{Limit: 5}); len(results) != 1 {
+		t.Errorf("expected a down-weighted outlier to be indexed whole, got %+v", results)
+	}
+	if got, want := weighted.avgTokens, (4+4+5+10)/4.0; got != want {
+		t.Errorf("expected a mean length of %v with the outlier capped, got %v", want, got)
+	}
+	if plain.avgTokens <= weighted.avgTokens {
+		t.Errorf("expected the outlier to raise the mean length of the plain index")
+	}
+}
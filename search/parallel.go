@@ -0,0 +1,141 @@
+package search
+
+import (
+	"container/heap"
+	"context"
+	"runtime"
+	"sync"
+)
+
+// minPerWorker is the fewest candidates worth handing to a scoring goroutine.
+const minPerWorker = 2048
+
+// minDocsPerWorker is the fewest documents worth handing to a goroutine
+// tokenizing them during a build.
+const minDocsPerWorker = 32
+
+// cancelCheck is how many candidates are scored between looks at whether the
+// search's context is done.
+const cancelCheck = 1024
+
+// concurrency returns the number of goroutines used to score n candidates.
+func (opts SearchOpts) concurrency(n int) int {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+		workers = min(workers, n/minPerWorker)
+	}
+	return max(1, min(workers, n))
+}
+
+// buildWorkers returns the number of goroutines used to tokenize n
+// documents.
+func (idx *Index) buildWorkers(n int) int {
+	workers := idx.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+		workers = min(workers, n/minDocsPerWorker)
+	}
+	return max(1, min(workers, n))
+}
+
+// scoring is what decides which scored candidates are kept.
+type scoring struct {
+	queryTerms []queryTerm
+	keepZero   bool    // keep candidates that no term scored
+	minScore   float64 // drop candidates scoring below this
+	limit      int     // keep at most this many
+	decay      *decay  // weighs documents by age, if set
+	bm25       *bm25   // scores by BM25 rather than tf-idf, if set
+}
+
+// topResults scores the candidates in s and returns the best limit of them as
+// a min-heap. The candidates are split into one range per worker; each worker
+// keeps its own top-K heap and the partial heaps are merged at the end. The
+// returned heap is newly allocated, so it outlives s. Scoring stops early,
+// with the heap incomplete, once ctx is done.
+func (idx Index) topResults(ctx context.Context, s *scratch, sc scoring, workers int) resultHeap {
+	h := make(resultHeap, 0, min(sc.limit, len(s.candidates)))
+	if workers <= 1 {
+		i := 0
+		for name := range s.candidates {
+			if i++; i%cancelCheck == 0 && ctx.Err() != nil {
+				return h
+			}
+			idx.pushResult(&h, name, sc)
+		}
+		return h
+	}
+
+	for name := range s.candidates {
+		s.names = append(s.names, name)
+	}
+	names := s.names
+	partials := s.workerHeaps(workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(partial *resultHeap, names []string) {
+			defer wg.Done()
+			for i, name := range names {
+				if (i+1)%cancelCheck == 0 && ctx.Err() != nil {
+					return
+				}
+				idx.pushResult(partial, name, sc)
+			}
+		}(&partials[w], names[w*len(names)/workers:(w+1)*len(names)/workers])
+	}
+	wg.Wait()
+
+	for _, partial := range partials {
+		for _, sr := range partial {
+			pushTop(&h, sr, sc.limit)
+		}
+	}
+	return h
+}
+
+// score returns the lexical score of the named document.
+func (idx *Index) score(name string, sc scoring) float64 {
+	var score float64
+	if sc.bm25 != nil {
+		score = sc.bm25.score(idx, sc.queryTerms, name)
+	} else {
+		score = idx.docScore(sc.queryTerms, name)
+	}
+	if sc.decay != nil {
+		// every tf of the document decays alike, and so does its score
+		score *= sc.decay.factor(idx.docs[name])
+	}
+	return score
+}
+
+// pushResult scores one candidate and offers it to the heap. The document is
+// only copied out of the index once it makes it into the heap.
+func (idx Index) pushResult(h *resultHeap, name string, sc scoring) {
+	score := idx.score(name, sc)
+	if (score <= 0 && !sc.keepZero) || score < sc.minScore {
+		return
+	}
+	if h.Len() >= sc.limit {
+		if low := (*h)[0]; score < low.Score || (score == low.Score && name > low.Name) {
+			return
+		}
+	}
+	doc, ok := idx.docs[name]
+	if !ok {
+		// the index was loaded without its documents
+		doc = Document{Name: name}
+	}
+	pushTop(h, SearchResult{Document: &doc, Score: score}, sc.limit)
+}
+
+// pushTop adds sr to the min-heap h, keeping at most limit results.
+func pushTop(h *resultHeap, sr SearchResult, limit int) {
+	if h.Len() < limit {
+		heap.Push(h, sr)
+	} else if ranksAbove(sr, (*h)[0]) {
+		heap.Pop(h)
+		heap.Push(h, sr)
+	}
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParallelScoring(t *testing.T) {
+	var docs []Document
+	for i := 0; i < 300; i++ {
+		content := fmt.Sprintf("doc%d filler", i)
+		if i%10 == 0 {
+			content += strings.Repeat(" pond", i%7+1)
+		}
+		if i%15 == 0 {
+			content += " winter"
+		}
+		docs = append(docs, Document{Name: fmt.Sprintf("%03d.md", i), Content: content})
+	}
+	index := mustIndex(t, memLoader(docs...), DocOpts{})
+
+	serial, err := index.Search(context.Background(), []string{"pond", "winter"}, SearchOpts{Limit: 20, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := index.Search(context.Background(), []string{"pond", "winter"}, SearchOpts{Limit: 20, Concurrency: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serial) != 20 || len(parallel) != 20 {
+		t.Fatalf("expected 20 results, got %d and %d", len(serial), len(parallel))
+	}
+	for i := range serial {
+		// tf norms are summed in map order, so scores can differ in the last bits
+		if math.Abs(serial[i].Score-parallel[i].Score) > 1e-12 {
+			t.Errorf("result %d: serial score %f, parallel score %f", i, serial[i].Score, parallel[i].Score)
+		}
+	}
+}
+
+func TestParallelBuild(t *testing.T) {
+	var docs []Document
+	for i := 0; i < 200; i++ {
+		docs = append(docs, Document{Name: fmt.Sprintf("doc%d.md", i), Content: fmt.Sprintf("doc%d about topic%d and topic%d", i, i%7, i%11)})
+	}
+	write := func(workers int) string {
+		t.Helper()
+		idx := mustIndex(t, memLoader(docs...), DocOpts{Workers: workers})
+		if n := idx.buildWorkers(len(docs)); workers > 0 && n != workers {
+			t.Errorf("expected %d workers, got %d", workers, n)
+		}
+		var buf strings.Builder
+		if err := idx.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	serial := write(1)
+	for _, workers := range []int{0, 3, 8} {
+		if write(workers) != serial {
+			t.Errorf("%d workers: expected the same index as a serial build", workers)
+		}
+	}
+}
+
+func TestPagingTies(t *testing.T) {
+	var docs []Document
+	for i := 0; i < 200; i++ {
+		content := fmt.Sprintf("doc%d filler", i)
+		if i%5 == 0 {
+			content += " pond in winter" // 40 documents tied on score
+		}
+		docs = append(docs, Document{Name: fmt.Sprintf("%03d.md", i), Content: content})
+	}
+	index := mustIndex(t, memLoader(docs...), DocOpts{})
+
+	for _, concurrency := range []int{1, 8} {
+		seen := make(map[string]bool)
+		var listing []string
+		for offset := 0; offset < 50; offset += 7 {
+			page, err := index.Search(context.Background(), []string{"pond", "winter"},
+				SearchOpts{Limit: 7, Offset: offset, Concurrency: concurrency})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range page {
+				if seen[r.Name] {
+					t.Errorf("concurrency %d: %s is on more than one page", concurrency, r.Name)
+				}
+				seen[r.Name] = true
+				listing = append(listing, r.Name)
+			}
+		}
+		if len(seen) != 40 {
+			t.Errorf("concurrency %d: expected the pages to list all 40 matches, got %d", concurrency, len(seen))
+		}
+		for i := 1; i < len(listing); i++ {
+			if listing[i-1] > listing[i] {
+				t.Errorf("concurrency %d: expected tied results in name order, got %s before %s", concurrency, listing[i-1], listing[i])
+			}
+		}
+	}
+}
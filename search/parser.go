@@ -0,0 +1,91 @@
+package search
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ContentParser turns the bytes of a loaded file into the text that's
+// indexed, stored as the document's Content and previewed, such as by
+// stripping markup. Set one with LoadOpts.Parser; files are kept as they
+// are without one.
+type ContentParser interface {
+	Parse(name string, data []byte) (string, error)
+}
+
+// ContentParserFunc adapts a function to the ContentParser interface.
+type ContentParserFunc func(name string, data []byte) (string, error)
+
+// Parse calls f.
+func (f ContentParserFunc) Parse(name string, data []byte) (string, error) {
+	return f(name, data)
+}
+
+// PlainText keeps file contents as they are.
+var PlainText ContentParser = ContentParserFunc(func(name string, data []byte) (string, error) {
+	return string(data), nil
+})
+
+// Markdown strips Markdown markup, keeping the text a reader sees: headings,
+// list and quote markers, emphasis, code fences, HTML tags and link
+// targets are removed, and links and images are replaced by their text.
+// It's a line-based approximation rather than a CommonMark parser; plug a
+// full one in through ContentParserFunc if it's not enough.
+var Markdown ContentParser = ContentParserFunc(parseMarkdown)
+
+// ParsersByExt picks a parser by file extension, such as ".md", leaving
+// files of other extensions as they are.
+type ParsersByExt map[string]ContentParser
+
+// Parse parses data with the parser of name's extension.
+func (p ParsersByExt) Parse(name string, data []byte) (string, error) {
+	if parser, ok := p[strings.ToLower(path.Ext(name))]; ok {
+		return parser.Parse(name, data)
+	}
+	return string(data), nil
+}
+
+var (
+	mdBlock    = regexp.MustCompile(`^\s{0,3}(#{1,6}\s+|>\s?|[-*+]\s+|\d+[.)]\s+)`)
+	mdRule     = regexp.MustCompile(`^\s{0,3}([-*_=]\s*){3,}$`)
+	mdRefDef   = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s`)
+	mdLink     = regexp.MustCompile(`!?\[([^\]]*)\](\([^)]*\)|\[[^\]]*\])`)
+	mdAutolink = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	mdTag      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdEmphasis = regexp.MustCompile("\\*{1,3}|~~|`+")
+	// underscores only emphasize at the edges of words, unlike in snake_case
+	mdUnderscoreOpen  = regexp.MustCompile(`(^|[^\w])_{1,3}(\w)`)
+	mdUnderscoreClose = regexp.MustCompile(`(\w)_{1,3}([^\w]|$)`)
+	mdClosingHashes   = regexp.MustCompile(`\s+#+\s*$`) // of "## Heading ##"
+)
+
+// parseMarkdown strips Markdown markup from data.
+func parseMarkdown(name string, data []byte) (string, error) {
+	lines := strings.Split(string(data), "\n")
+	var b strings.Builder
+	fenced := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		if !fenced {
+			if mdRule.MatchString(line) || mdRefDef.MatchString(line) {
+				continue
+			}
+			line = mdBlock.ReplaceAllString(line, "")
+			line = mdClosingHashes.ReplaceAllString(line, "")
+			line = mdLink.ReplaceAllString(line, "$1")
+			line = mdAutolink.ReplaceAllString(line, "$1")
+			line = mdTag.ReplaceAllString(line, "")
+			line = mdEmphasis.ReplaceAllString(line, "")
+			line = mdUnderscoreOpen.ReplaceAllString(line, "$1$2")
+			line = mdUnderscoreClose.ReplaceAllString(line, "$1$2")
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
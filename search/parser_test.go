@@ -0,0 +1,35 @@
+package search
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMarkdownParser(t *testing.T) {
+	md := "# Walden ##\n\nI went to the **woods** because I wished to live _deliberately_.\n" +
+		"See [the pond](https://example.com/pond) and ![a cabin](cabin.png).\n\n" +
+		"- a list item with `code`\n> quoted <em>text</em>\n\n---\n\n```go\nsnake_case := 1\n```\n" +
+		"[pond]: https://example.com/pond\n"
+	want := "Walden\n\nI went to the woods because I wished to live deliberately.\n" +
+		"See the pond and a cabin.\n\na list item with code\nquoted text\n\n\nsnake_case := 1\n"
+	got, err := Markdown.Parse("walden.md", []byte(md))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	fsys := fstest.MapFS{
+		"docs/pond.md":  {Data: []byte("the **pond** in [winter](w.md)")},
+		"docs/city.txt": {Data: []byte("the **city** in summer")},
+	}
+	parsers := ParsersByExt{".md": Markdown}
+	index := mustIndex(t, DefaultLoader, DocOpts{Load: LoadOpts{FS: fsys, Path: "docs", Content: true, Parser: parsers}})
+	if doc, _ := index.Document("pond.md"); doc.Content != "the pond in winter" {
+		t.Errorf("expected the Markdown to be parsed, got %q", doc.Content)
+	}
+	if doc, _ := index.Document("city.txt"); doc.Content != "the **city** in summer" {
+		t.Errorf("expected plain text to be kept, got %q", doc.Content)
+	}
+}
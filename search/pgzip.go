@@ -0,0 +1,100 @@
+package search
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"runtime"
+)
+
+// gzipBlockSize is the size of the blocks a parallelGzip compresses apart.
+const gzipBlockSize = 1 << 20
+
+// parallelGzip gzips what's written to it in blocks, each compressed by a
+// goroutine of its own as a separate gzip member, and writes the members in
+// order. Concatenated members are a valid gzip file, which gzip.Reader and
+// the gzip command read as one. Blocks are cut at fixed offsets, so the
+// output doesn't depend on the number of workers.
+type parallelGzip struct {
+	w       io.Writer
+	workers int
+	block   []byte
+	pending []chan gzipped // blocks being compressed, in order
+	err     error
+}
+
+// gzipped is a compressed block, or the error compressing it.
+type gzipped struct {
+	data []byte
+	err  error
+}
+
+// newParallelGzip returns a parallelGzip writing to w with up to workers
+// blocks compressed at once, or GOMAXPROCS if workers isn't positive.
+func newParallelGzip(w io.Writer, workers int) *parallelGzip {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &parallelGzip{w: w, workers: workers, block: make([]byte, 0, gzipBlockSize)}
+}
+
+func (z *parallelGzip) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && z.err == nil {
+		k := min(len(p), gzipBlockSize-len(z.block))
+		z.block = append(z.block, p[:k]...)
+		p = p[k:]
+		if len(z.block) == gzipBlockSize {
+			z.compress()
+		}
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	return n, nil
+}
+
+// compress starts compressing the current block, first writing out the
+// oldest one if as many as there are workers are under way.
+func (z *parallelGzip) compress() {
+	if len(z.pending) == z.workers {
+		z.writeOldest()
+	}
+	block := z.block
+	z.block = make([]byte, 0, gzipBlockSize)
+	done := make(chan gzipped, 1)
+	z.pending = append(z.pending, done)
+	go func() {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(block)
+		if err == nil {
+			err = gz.Close()
+		}
+		done <- gzipped{buf.Bytes(), err}
+	}()
+}
+
+// writeOldest waits for the oldest pending block and writes it.
+func (z *parallelGzip) writeOldest() {
+	out := <-z.pending[0]
+	z.pending = z.pending[1:]
+	if z.err == nil {
+		z.err = out.err
+	}
+	if z.err == nil {
+		_, z.err = z.w.Write(out.data)
+	}
+}
+
+// Close compresses the last block and writes every pending one. An empty
+// input is written as a single empty member, as gzip.Writer writes it.
+func (z *parallelGzip) Close() error {
+	if len(z.block) > 0 || (len(z.pending) == 0 && z.err == nil) {
+		z.compress()
+	}
+	for len(z.pending) > 0 {
+		z.writeOldest()
+	}
+	return z.err
+}
@@ -0,0 +1,52 @@
+package search
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestParallelGzip(t *testing.T) {
+	// a few blocks of compressible text, ending in a partial one
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"pond ", "winter ", "law ", "field ", "woods "}
+	var input bytes.Buffer
+	for input.Len() < 3*gzipBlockSize+1000 {
+		input.WriteString(words[rng.Intn(len(words))])
+	}
+
+	var outputs [][]byte
+	for _, workers := range []int{1, 4} {
+		var buf bytes.Buffer
+		z := newParallelGzip(&buf, workers)
+		// odd-sized writes straddle the blocks
+		for data := input.Bytes(); len(data) > 0; {
+			n := min(len(data), 77777)
+			if _, err := z.Write(data[:n]); err != nil {
+				t.Fatal(err)
+			}
+			data = data[n:]
+		}
+		if err := z.Close(); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, buf.Bytes())
+
+		gz, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, input.Bytes()) {
+			t.Errorf("%d workers: decompressed %d bytes, want the %d written", workers, len(got), input.Len())
+		}
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("expected the same bytes however many workers compress them")
+	}
+}
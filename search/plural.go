@@ -0,0 +1,72 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// nonPlurals are common words ending in s that aren't plurals, and so are
+// left alone by foldPlural.
+var nonPlurals = map[string]bool{
+	"always": true, "analysis": true, "basis": true, "bias": true, "bus": true,
+	"chaos": true, "does": true, "gas": true, "has": true, "his": true,
+	"hers": true, "its": true, "lens": true, "mathematics": true, "means": true,
+	"news": true, "ours": true, "perhaps": true, "physics": true, "politics": true,
+	"series": true, "species": true, "themselves": true, "this": true, "thus": true,
+	"towards": true, "was": true, "whereas": true, "yes": true, "yours": true,
+	"ourselves": true, "yourselves": true, "besides": true, "afterwards": true,
+}
+
+// foldPlural returns the singular of an English plural, by stripping a
+// trailing s or es, or turning ies into y: "laws" -> "law", "boxes" -> "box",
+// "cities" -> "city". It's much gentler than stemming: words that don't end
+// in s, words of three letters or fewer, words ending in ss, us or is, and
+// the nonPlurals are returned as they are. Irregular plurals aren't folded.
+func foldPlural(word string) string {
+	if len(word) <= 3 || word[len(word)-1] != 's' || nonPlurals[word] {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		return word
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "zes"),
+		strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"):
+		return word[:len(word)-2]
+	}
+	return word[:len(word)-1]
+}
+
+// foldingNormalizer returns normalize followed by foldPlural on every word.
+// Whitespace is kept as it is, so sentence and line breaks survive.
+func foldingNormalizer(normalize Normalizer) Normalizer {
+	return func(text string) string {
+		text = normalize(text)
+		var b strings.Builder
+		b.Grow(len(text))
+		start := -1
+		for i := 0; i <= len(text); {
+			r, size := rune(' '), 1
+			if i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+			}
+			if !unicode.IsSpace(r) {
+				if start < 0 {
+					start = i
+				}
+			} else {
+				if start >= 0 {
+					b.WriteString(foldPlural(text[start:i]))
+					start = -1
+				}
+				if i < len(text) {
+					b.WriteRune(r)
+				}
+			}
+			i += size
+		}
+		return b.String()
+	}
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFoldPlural(t *testing.T) {
+	for word, want := range map[string]string{
+		"laws":    "law",
+		"cities":  "city",
+		"boxes":   "box",
+		"classes": "class",
+		"houses":  "house",
+		"class":   "class",
+		"status":  "status",
+		"basis":   "basis",
+		"news":    "news",
+		"this":    "this",
+		"its":     "its",
+		"law":     "law",
+	} {
+		if got := foldPlural(word); got != want {
+			t.Errorf("foldPlural(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestFoldPluralsSearch(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "civil.md", Content: "unjust laws exist"},
+		Document{Name: "city.md", Content: "the city streets"},
+		Document{Name: "pond.md", Content: "the pond in winter"},
+	)
+	index := mustIndex(t, docs, DocOpts{FoldPlurals: true})
+	for _, query := range []string{"law", "Laws", "cities"} {
+		results, err := index.Search(context.Background(), []string{query}, SearchOpts{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Errorf("%s: expected a result, got none", query)
+		}
+	}
+	if results, _ := mustIndex(t, docs, DocOpts{}).Search(context.Background(), []string{"law"}, SearchOpts{Limit: 1}); len(results) != 0 {
+		t.Errorf("expected no match for law without folding, got %+v", results)
+	}
+}
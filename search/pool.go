@@ -0,0 +1,49 @@
+package search
+
+import "sync"
+
+// maxPooledCandidates bounds the candidate sets kept for reuse, so one huge
+// query doesn't pin its memory in the pool.
+const maxPooledCandidates = 1 << 16
+
+// scratch is the working memory of one Search call. It's pooled, so a busy
+// server reuses the same maps and slices instead of allocating them per query.
+type scratch struct {
+	candidates map[string]bool
+	names      []string
+	heaps      []resultHeap
+}
+
+var scratchPool = sync.Pool{
+	New: func() any {
+		return &scratch{candidates: make(map[string]bool)}
+	},
+}
+
+func getScratch() *scratch {
+	return scratchPool.Get().(*scratch)
+}
+
+// release clears s and returns it to the pool. Nothing handed out to the
+// caller of Search may still point into it.
+func (s *scratch) release() {
+	if len(s.candidates) > maxPooledCandidates {
+		return
+	}
+	clear(s.candidates)
+	clear(s.names)
+	s.names = s.names[:0]
+	for i := range s.heaps {
+		clear(s.heaps[i])
+		s.heaps[i] = s.heaps[i][:0]
+	}
+	scratchPool.Put(s)
+}
+
+// workerHeaps returns n empty per-worker heaps.
+func (s *scratch) workerHeaps(n int) []resultHeap {
+	for len(s.heaps) < n {
+		s.heaps = append(s.heaps, nil)
+	}
+	return s.heaps[:n]
+}
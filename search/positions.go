@@ -0,0 +1,200 @@
+package search
+
+import (
+	"encoding/binary"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// positions are the positions of the words of the documents of an index
+// built with DocOpts.Positions: for each word, the documents it's in, and
+// for each of those the positions it's at, counted in words from the start
+// of the document as uvarint deltas. Positions count the words the index
+// was built from, after normalization, so stop words take up a position
+// but have none of their own. Unlike the term map, nothing is pruned.
+//
+// Positions aren't saved with the index. An index loaded with Positions
+// gets them from the content of its stored documents, as Optimize does.
+type positions map[string]map[string][]byte
+
+// empty returns empty positions if p is set, for an index derived from
+// that of p, and nil if it isn't.
+func (p positions) empty() positions {
+	if p == nil {
+		return nil
+	}
+	return make(positions)
+}
+
+// without returns a copy of p without the positions of the named
+// documents. The positions of the other documents are shared.
+func (p positions) without(names map[string]bool) positions {
+	if p == nil {
+		return nil
+	}
+	copied := make(positions, len(p))
+	for word, docs := range p {
+		kept := make(map[string][]byte, len(docs))
+		for name, pos := range docs {
+			if !names[name] {
+				kept[name] = pos
+			}
+		}
+		if len(kept) > 0 {
+			copied[word] = kept
+		}
+	}
+	return copied
+}
+
+// merge adds the positions of src to p, which must be of other documents.
+// Their encoded positions are shared, but not the maps holding them.
+func (p positions) merge(src positions) {
+	for word, docs := range src {
+		if existing, ok := p[word]; ok {
+			maps.Copy(existing, docs)
+		} else {
+			p[word] = maps.Clone(docs)
+		}
+	}
+}
+
+// remove removes the positions of the named document from p, in place.
+func (p positions) remove(name string) {
+	for word, docs := range p {
+		delete(docs, name)
+		if len(docs) == 0 {
+			delete(p, word)
+		}
+	}
+}
+
+// at returns the positions of word in the named document, in order.
+func (p positions) at(word, name string) []uint32 {
+	data := p[word][name]
+	var pos []uint32
+	prev := uint64(0)
+	for len(data) > 0 {
+		delta, n := binary.Uvarint(data)
+		data = data[n:]
+		prev += delta
+		pos = append(pos, uint32(prev))
+	}
+	return pos
+}
+
+// addPositions adds the positions of the words of doc to p.
+func (idx *Index) addPositions(tok *tokenizer, p positions, doc *Document) {
+	words, _ := idx.docWords(tok, doc)
+	if idx.stopWords != nil {
+		idx.gapStopWords(words)
+	}
+	last := make(map[string]int, len(words))
+	for i, word := range words {
+		if word == gap {
+			continue
+		}
+		docs, ok := p[word]
+		if !ok {
+			docs = make(map[string][]byte)
+			p[strings.Clone(word)] = docs
+		}
+		docs[doc.Name] = binary.AppendUvarint(docs[doc.Name], uint64(i-last[word]))
+		last[word] = i
+	}
+}
+
+// indexPositions sets the positions of the stored documents of an index
+// built with DocOpts.Positions, tokenizing them across the build's workers.
+func (idx *Index) indexPositions() {
+	if idx.positions == nil {
+		return
+	}
+	docs := make([]Document, 0, len(idx.docs))
+	for _, doc := range idx.docs {
+		docs = append(docs, doc)
+	}
+	workers := idx.buildWorkers(len(docs))
+	partials := make([]positions, workers)
+	var wg sync.WaitGroup
+	for w := range partials {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			p := make(positions)
+			var tok tokenizer
+			for i := w; i < len(docs); i += workers {
+				idx.addPositions(&tok, p, &docs[i])
+			}
+			partials[w] = p
+		}(w)
+	}
+	wg.Wait()
+	idx.positions = partials[0]
+	for _, p := range partials[1:] {
+		idx.positions.merge(p)
+	}
+}
+
+// phraseDocs returns the names of the documents in which the words of
+// phrase occur one after the other. The phrase is analyzed as documents
+// are, and its stop words match any word, as they do in n-grams.
+func (idx *Index) phraseDocs(phrase []string) map[string]bool {
+	words := idx.Analyze(strings.Join(phrase, " "))
+	if idx.stopWords != nil {
+		idx.gapStopWords(words)
+	}
+	var offsets []int
+	for i, word := range words {
+		if word != gap {
+			offsets = append(offsets, i)
+		}
+	}
+	docs := make(map[string]bool)
+	if len(offsets) == 0 {
+		return docs
+	}
+	// start from the rarest word, so the fewest documents are checked
+	sort.SliceStable(offsets, func(i, j int) bool {
+		return len(idx.positions[words[offsets[i]]]) < len(idx.positions[words[offsets[j]]])
+	})
+
+	first := words[offsets[0]]
+	for name := range idx.positions[first] {
+		// phrases starting with stop words can't start before the document
+		var starts []uint32
+		for _, pos := range idx.positions.at(first, name) {
+			if pos >= uint32(offsets[0]) {
+				starts = append(starts, pos-uint32(offsets[0]))
+			}
+		}
+		for _, o := range offsets[1:] {
+			starts = followedBy(starts, idx.positions.at(words[o], name), uint32(o))
+			if len(starts) == 0 {
+				break
+			}
+		}
+		if len(starts) > 0 {
+			docs[name] = true
+		}
+	}
+	return docs
+}
+
+// followedBy returns the starts s such that s+offset is among positions.
+// Both are sorted, and so is the result.
+func followedBy(starts, positions []uint32, offset uint32) []uint32 {
+	kept := starts[:0]
+	j := 0
+	for _, s := range starts {
+		for j < len(positions) && positions[j] < s+offset {
+			j++
+		}
+		if j < len(positions) && positions[j] == s+offset {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// phraseResults returns the sorted names of the results of query.
+func phraseResults(t *testing.T, index *Index, query string) []string {
+	t.Helper()
+	results, err := index.Search(context.Background(), []string{query}, SearchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPhraseQuery(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "adjacent.md", Content: "the moral law within us"},
+		Document{Name: "apart.md", Content: "law is not always moral"},
+		Document{Name: "reversed.md", Content: "a law moral and strange"},
+		Document{Name: "sky.md", Content: "the starry sky above us"},
+	)
+	index := mustIndex(t, docs, DocOpts{Positions: true})
+	if got := phraseResults(t, index, `"moral law"`); len(got) != 1 || got[0] != "adjacent.md" {
+		t.Errorf("expected only adjacent.md, got %v", got)
+	}
+	if got := phraseResults(t, index, `"moral law" sky`); len(got) != 1 || got[0] != "adjacent.md" {
+		t.Errorf("expected the phrase to filter the other terms, got %v", got)
+	}
+	if got := phraseResults(t, index, "moral law"); len(got) != 3 {
+		t.Errorf("expected unquoted words to match apart, got %v", got)
+	}
+	if got := phraseResults(t, index, `"the moral law within"`); len(got) != 1 {
+		t.Errorf("expected a longer phrase to match, got %v", got)
+	}
+
+	plain := mustIndex(t, docs, DocOpts{})
+	if got := phraseResults(t, plain, `"moral law"`); len(got) < 2 {
+		t.Errorf("expected phrases to match their words without positions, got %v", got)
+	}
+}
+
+func TestPhraseStopWords(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "of.md", Content: "the use of language here"},
+		Document{Name: "in.md", Content: "a use in language there"},
+		Document{Name: "none.md", Content: "use language every day"},
+		Document{Name: "sky.md", Content: "the starry sky above us"},
+	), DocOpts{Positions: true, StopWords: []string{"of", "the", "a"}})
+	if got := phraseResults(t, index, `"use of language"`); len(got) != 2 || got[0] != "in.md" || got[1] != "of.md" {
+		t.Errorf("expected the stop word to match any word, got %v", got)
+	}
+	if got := phraseResults(t, index, `"use language"`); len(got) != 1 || got[0] != "none.md" {
+		t.Errorf("expected only none.md, got %v", got)
+	}
+}
+
+func TestPositionsMaintained(t *testing.T) {
+	opts := DocOpts{Positions: true}
+	index := mustIndex(t, memLoader(
+		Document{Name: "adjacent.md", Content: "the moral law within us"},
+		Document{Name: "apart.md", Content: "law is not always moral"},
+		Document{Name: "sky.md", Content: "the starry sky above us"},
+	), opts)
+
+	opts.Storage.Path = filepath.Join(t.TempDir(), "index.json")
+	if err := index.Save(opts.Storage.Path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := mustLoad(t, nil, opts)
+	if got := phraseResults(t, loaded, `"moral law"`); len(got) != 1 || got[0] != "adjacent.md" {
+		t.Errorf("expected a loaded index to match the phrase, got %v", got)
+	}
+
+	added, err := index.AddDocuments([]Document{{Name: "new.md", Content: "a moral law of ponds"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := phraseResults(t, added, `"moral law"`); len(got) != 2 || got[1] != "new.md" {
+		t.Errorf("expected the added document to match, got %v", got)
+	}
+	if got := phraseResults(t, index, `"moral law"`); len(got) != 1 {
+		t.Errorf("expected AddDocuments to leave the index as it was, got %v", got)
+	}
+	removed, err := added.RemoveDocuments([]string{"adjacent.md"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := phraseResults(t, removed, `"moral law"`); len(got) != 1 || got[0] != "new.md" {
+		t.Errorf("expected only new.md after removing adjacent.md, got %v", got)
+	}
+
+	merged, err := MergeIndexes(index, mustIndex(t, memLoader(
+		Document{Name: "other.md", Content: "no moral law applies"},
+		Document{Name: "pond.md", Content: "the pond in winter"},
+	), DocOpts{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := phraseResults(t, merged, `"moral law"`); len(got) != 2 || got[1] != "other.md" {
+		t.Errorf("expected both indexes' documents to match, got %v", got)
+	}
+
+	if err := index.UpdateDocument(Document{Name: "apart.md", Content: "a moral law after all"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.RemoveDocument("adjacent.md"); err != nil {
+		t.Fatal(err)
+	}
+	if got := phraseResults(t, index, `"moral law"`); len(got) != 1 || got[0] != "apart.md" {
+		t.Errorf("expected only the updated apart.md, got %v", got)
+	}
+}
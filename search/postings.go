@@ -0,0 +1,158 @@
+package search
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// docTable numbers the documents of an index with compact postings. IDs are
+// assigned in name order, so a term's postings can be delta-encoded.
+type docTable struct {
+	names   []string
+	lengths []uint32 // words per document; a tf is stored as count/length
+}
+
+// compactPostings replaces every term's TfMap with a byte slice of
+// (docID delta, count) uvarint pairs, sorted by docID. A posting then takes
+// two or three bytes instead of a map entry, at the cost of decoding a
+// term's postings each time a query uses it.
+//
+// Term frequencies are stored as word counts, so the length of every
+// document is needed. Documents missing from the index (it was loaded
+// without them) get the length implied by their smallest tf, which is exact
+// as long as some indexed term occurs only once in them.
+func (idx *Index) compactPostings() {
+	if idx.docTable != nil {
+		return
+	}
+	table, ids := idx.newDocTable()
+	for term, tfreq := range idx.tmap {
+		tfreq.postings = table.encode(tfreq.TfMap, ids)
+		tfreq.TfMap = nil
+		idx.tmap[term] = tfreq
+	}
+	idx.docTable = table
+}
+
+// newDocTable numbers every document of the index, whether stored or only
+// named in a posting, and returns the table with its name-to-ID mapping.
+func (idx *Index) newDocTable() (*docTable, map[string]uint32) {
+	minTf := make(map[string]float64, len(idx.docs))
+	for name := range idx.docs {
+		minTf[name] = math.Inf(1)
+	}
+	for _, tfreq := range idx.tmap {
+		for name, tf := range tfreq.TfMap {
+			if m, ok := minTf[name]; !ok || tf < m {
+				minTf[name] = tf
+			}
+		}
+	}
+	table := &docTable{names: make([]string, 0, len(minTf))}
+	for name := range minTf {
+		table.names = append(table.names, name)
+	}
+	sort.Strings(table.names)
+	ids := make(map[string]uint32, len(table.names))
+	table.lengths = make([]uint32, len(table.names))
+	for i, name := range table.names {
+		ids[name] = uint32(i)
+		if doc, ok := idx.docs[name]; ok && doc.tokens() > 0 {
+			table.lengths[i] = uint32(doc.tokens())
+		} else {
+			table.lengths[i] = uint32(max(1, math.Round(1/minTf[name])))
+		}
+	}
+	return table, ids
+}
+
+// encode returns the compact form of the postings in tfMap.
+func (table *docTable) encode(tfMap map[string]float64, ids map[string]uint32) []byte {
+	type posting struct {
+		id    uint32
+		count uint64
+	}
+	ps := make([]posting, 0, len(tfMap))
+	for name, tf := range tfMap {
+		id := ids[name]
+		ps = append(ps, posting{id, uint64(math.Round(tf * float64(table.lengths[id])))})
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].id < ps[j].id })
+	buf := make([]byte, 0, 3*len(ps))
+	prev := uint32(0)
+	for _, p := range ps {
+		buf = binary.AppendUvarint(buf, uint64(p.id-prev))
+		buf = binary.AppendUvarint(buf, p.count)
+		prev = p.id
+	}
+	return buf
+}
+
+// eachPosting calls fn with every document containing the term and the
+// term's frequency in it, decoding compact postings as it goes.
+func (idx *Index) eachPosting(tfreq TermFreq, fn func(name string, tf float64)) {
+	if tfreq.postings == nil {
+		for name, tf := range tfreq.TfMap {
+			fn(name, tf)
+		}
+		return
+	}
+	data, id := tfreq.postings, uint64(0)
+	for len(data) > 0 {
+		delta, n := binary.Uvarint(data)
+		data = data[n:]
+		count, n := binary.Uvarint(data)
+		data = data[n:]
+		id += delta
+		fn(idx.docTable.names[id], float64(count)/float64(idx.docTable.lengths[id]))
+	}
+}
+
+// docFreq returns the number of documents containing the term.
+func (idx *Index) docFreq(tfreq TermFreq) int {
+	if tfreq.postings == nil {
+		return len(tfreq.TfMap)
+	}
+	n := 0
+	for data := tfreq.postings; len(data) > 0; n++ {
+		_, a := binary.Uvarint(data)
+		_, b := binary.Uvarint(data[a:])
+		data = data[a+b:]
+	}
+	return n
+}
+
+// postings returns the term's postings as a map from document name to tf.
+// For compact postings the map is decoded fresh on every call.
+func (idx *Index) postings(tfreq TermFreq) map[string]float64 {
+	if tfreq.postings == nil {
+		return tfreq.TfMap
+	}
+	m := make(map[string]float64)
+	idx.eachPosting(tfreq, func(name string, tf float64) { m[name] = tf })
+	return m
+}
+
+// MarshalJSON encodes the index in the same format whether or not its
+// postings are compact. The stored documents are included unless the
+// StorageOpts save them apart, at DocsPath. Save and Write stream the same
+// encoding rather than marshal it whole; see encodeJSON.
+func (idx Index) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := idx.encodeJSON(&buf); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// jsonIndex is the saved form of an index in FormatJSON.
+type jsonIndex struct {
+	jsonHeader
+	TMap           map[string]TermFreq `json:"t_map"`
+	FieldAnalyzers map[string]string   `json:"field_analyzers,omitempty"`
+	StopWords      []string            `json:"stop_words,omitempty"`
+	Pruned         []string            `json:"pruned,omitempty"` // terms pruned as too common
+	Docs           []Document          `json:"docs,omitempty"`   // sorted by name
+}
@@ -0,0 +1,55 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestCompactPostings(t *testing.T) {
+	opts := DocOpts{Load: LoadOpts{Path: "../example/docs", Content: true}}
+	plain := mustIndex(t, DefaultLoader, opts)
+	opts.CompactPostings = true
+	compact := mustIndex(t, DefaultLoader, opts)
+
+	for term, tfreq := range plain.tmap {
+		got := compact.postings(compact.tmap[term])
+		if len(got) != len(tfreq.TfMap) {
+			t.Fatalf("%q: got %d postings, want %d", term, len(got), len(tfreq.TfMap))
+		}
+		for name, tf := range tfreq.TfMap {
+			if math.Abs(got[name]-tf) > 1e-12 {
+				t.Fatalf("%q in %s: got tf %g, want %g", term, name, got[name], tf)
+			}
+		}
+	}
+
+	for _, q := range [][]string{{"moral", "law"}, {"use", "of", "language"}} {
+		want, _ := plain.Search(context.Background(), q, SearchOpts{Limit: 5})
+		got, _ := compact.Search(context.Background(), q, SearchOpts{Limit: 5})
+		for i := range want {
+			if got[i].Name != want[i].Name || math.Abs(got[i].Score-want[i].Score) > 1e-9 {
+				t.Errorf("%v result %d: got %s %f, want %s %f", q, i, got[i].Name, got[i].Score, want[i].Name, want[i].Score)
+			}
+		}
+	}
+
+	// compact postings are saved in the usual format, and can be loaded compact without documents
+	data, err := json.Marshal(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadIndex(context.Background(), bytes.NewReader(data), nil, DocOpts{CompactPostings: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ := loaded.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 1})
+	if len(results) != 1 || results[0].Name != "civil_disobedience.txt" {
+		t.Errorf("unexpected results after reload: %+v", results)
+	}
+	if !bytes.Contains(data, []byte(`"tf_map":{`)) {
+		t.Error("expected expanded tf maps in the saved index")
+	}
+}
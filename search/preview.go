@@ -0,0 +1,80 @@
+package search
+
+import (
+	"encoding/csv"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Previewer makes a document's Preview, of at most n bytes and an ellipsis,
+// from its content. The file name tells previewers that depend on the type
+// of content what it is. Set one with LoadOpts.Previewer; DefaultPreview
+// is used without one.
+type Previewer func(name, content string, n int) string
+
+// DefaultPreview previews HTML files (.html, .htm) with HTMLPreview, CSV and
+// TSV files (.csv, .tsv) with CSVPreview, and anything else with TextPreview.
+func DefaultPreview(name, content string, n int) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		return HTMLPreview(name, content, n)
+	case ".csv", ".tsv":
+		return CSVPreview(name, content, n)
+	}
+	return TextPreview(name, content, n)
+}
+
+// TextPreview previews plain text: its whitespace collapsed, cut at the
+// last word that fits in n bytes, with an ellipsis if it was cut.
+func TextPreview(name, content string, n int) string {
+	text := strings.Join(strings.Fields(content), " ")
+	if len(text) <= n {
+		return text
+	}
+	cut := strings.LastIndexByte(text[:n+1], ' ')
+	if cut <= 0 {
+		// a single word longer than n; cut it on a character boundary
+		for cut = n; cut > 0 && !utf8.RuneStart(text[cut]); cut-- {
+		}
+	}
+	return text[:cut] + "..."
+}
+
+// htmlHidden matches the elements of an HTML page whose text isn't shown.
+var htmlHidden = regexp.MustCompile(`(?is)<head\b.*?</head>|<script\b.*?</script>|<style\b.*?</style>|<!--.*?-->`)
+
+// HTMLPreview previews the visible text of an HTML page, without its tags,
+// scripts and styles, and with character references decoded.
+func HTMLPreview(name, content string, n int) string {
+	text := htmlHidden.ReplaceAllString(content, " ")
+	text = mdTag.ReplaceAllString(text, " ")
+	return TextPreview(name, html.UnescapeString(text), n)
+}
+
+// CSVPreview previews the first record of a table with a header row as
+// "column: value; column: value". A .tsv file is read as tab-separated.
+// Content that isn't such a table is previewed as text.
+func CSVPreview(name, content string, n int) string {
+	r := csv.NewReader(strings.NewReader(content))
+	if strings.EqualFold(path.Ext(name), ".tsv") {
+		r.Comma = '\t'
+	}
+	header, err := r.Read()
+	if err != nil {
+		return TextPreview(name, content, n)
+	}
+	record, err := r.Read()
+	if err != nil {
+		return TextPreview(name, content, n)
+	}
+	fields := make([]string, 0, len(record))
+	for i, value := range record {
+		if i < len(header) && value != "" {
+			fields = append(fields, header[i]+": "+value)
+		}
+	}
+	return TextPreview(name, strings.Join(fields, "; "), n)
+}
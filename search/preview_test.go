@@ -0,0 +1,25 @@
+package search
+
+import "testing"
+
+func TestPreviews(t *testing.T) {
+	for _, tc := range []struct {
+		name, content string
+		n             int
+		want          string
+	}{
+		{"walden.txt", "I went to the\nwoods because I wished", 20, "I went to the woods..."},
+		{"short.txt", "the pond", 20, "the pond"},
+		{"long.txt", "Donaudampfschifffahrt", 6, "Donaud..."},
+		{"café.txt", "café", 4, "caf..."},
+		{"page.html", "<html><head><title>Walden</title><style>p{}</style></head>" +
+			"<body><p>Life in the <b>woods</b> &amp; the pond</p><script>x()</script></body></html>", 40, "Life in the woods & the pond"},
+		{"books.csv", "title,author,year\nWalden,Thoreau,1854\nNature,Emerson,1836\n", 60, "title: Walden; author: Thoreau; year: 1854"},
+		{"books.tsv", "title\tauthor\nWalden\tThoreau\n", 60, "title: Walden; author: Thoreau"},
+		{"notes.csv", "just one line", 60, "just one line"},
+	} {
+		if got := DefaultPreview(tc.name, tc.content, tc.n); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
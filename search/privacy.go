@@ -0,0 +1,36 @@
+package search
+
+import (
+	"fmt"
+	"slices"
+)
+
+// checkWithheld returns ErrTextWithheld if the index withholds text and
+// opts asks for some, so a caller isn't left wondering why it's missing.
+func (idx *Index) checkWithheld(opts SearchOpts) error {
+	if !idx.withholdText {
+		return nil
+	}
+	var asked string
+	switch {
+	case slices.Contains(opts.Fields, "preview"), slices.Contains(opts.Fields, "content"):
+		asked = "preview and content fields"
+	case opts.SnippetCount > 0:
+		asked = "snippets"
+	case opts.Summarize || opts.Summarizer != nil:
+		asked = "summaries"
+	case opts.Answerer != nil:
+		asked = "answers"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: cannot return %s", ErrTextWithheld, asked)
+}
+
+// withholdText clears the text of the results' documents, each of which is
+// a copy of its own.
+func withholdText(results []SearchResult) {
+	for _, r := range results {
+		r.Preview, r.Content = "", ""
+	}
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithholdText(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "pond.md", Content: "the secret pond in winter", Preview: "the secret pond"},
+		Document{Name: "city.md", Content: "the city in summer", Preview: "the city"},
+		Document{Name: "woods.md", Content: "the woods at night", Preview: "the woods"},
+	)
+	index := mustIndex(t, docs, DocOpts{WithholdText: true})
+
+	results, err := index.Search(context.Background(), []string{"pond"}, SearchOpts{Highlight: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "pond.md" || results[0].Score == 0 || len(results[0].Matches) != 1 {
+		t.Fatalf("expected pond.md with its score and match, got %+v", results)
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("expected no document text in %s", data)
+	}
+
+	for _, opts := range []SearchOpts{
+		{Fields: []string{"name", "content"}},
+		{Fields: []string{"preview"}},
+		{SnippetCount: 1},
+		{Summarize: true},
+		{Answerer: func(string, string, *Document) (string, error) { return "", nil }},
+	} {
+		if _, err := index.Search(context.Background(), []string{"pond"}, opts); !errors.Is(err, ErrTextWithheld) {
+			t.Errorf("%+v: expected ErrTextWithheld, got %v", opts, err)
+		}
+	}
+
+	if doc, ok := index.Document("pond.md"); !ok || doc.Content != "" || doc.Preview != "" {
+		t.Errorf("expected pond.md without its text, got %+v", doc)
+	}
+	if _, err := index.Content("pond.md"); !errors.Is(err, ErrTextWithheld) {
+		t.Errorf("expected ErrTextWithheld, got %v", err)
+	}
+
+	// indexes derived from it withhold text too
+	added, err := index.AddDocuments([]Document{{Name: "lake.md", Content: "a secret lake"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := added.Search(context.Background(), []string{"lake"}, SearchOpts{}); len(results) != 1 || results[0].Content != "" {
+		t.Errorf("expected lake.md without its text, got %+v", results)
+	}
+}
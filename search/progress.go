@@ -0,0 +1,82 @@
+package search
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Phase is a stage of building an index.
+type Phase string
+
+const (
+	PhaseLoad     Phase = "loading"           // running the loader and extracting entities; counts documents
+	PhaseTokenize Phase = "tokenizing"        // splitting documents into terms; counts documents
+	PhasePostings Phase = "building postings" // merging per-worker term maps or spilled segments; counts terms
+	PhaseIDF      Phase = "computing idf"     // weighing and pruning terms; counts terms
+)
+
+// Progress reports how far a build phase has got.
+type Progress struct {
+	Phase    Phase
+	Done     int           // items processed so far
+	Total    int           // items in the phase, or 0 if not known up front
+	Elapsed  time.Duration // since the phase started
+	Finished bool          // the last report of the phase
+}
+
+// ProgressFunc receives build progress. Reports of a phase are serialized
+// and throttled, but may come from any goroutine.
+type ProgressFunc func(Progress)
+
+// progressInterval is the minimum time between reports within a phase.
+const progressInterval = 100 * time.Millisecond
+
+// phaseReporter reports the progress of one phase to a ProgressFunc. A nil
+// reporter, used when there's no ProgressFunc, reports nothing.
+type phaseReporter struct {
+	fn    ProgressFunc
+	phase Phase
+	total int
+	start time.Time
+	done  atomic.Int64
+	mu    sync.Mutex
+	last  time.Time
+}
+
+// startPhase reports the start of a phase of total items.
+func (idx *Index) startPhase(phase Phase, total int) *phaseReporter {
+	if idx.progress == nil {
+		return nil
+	}
+	now := time.Now()
+	r := &phaseReporter{fn: idx.progress, phase: phase, total: total, start: now, last: now}
+	r.fn(Progress{Phase: phase, Total: total})
+	return r
+}
+
+// add counts n more items done, reporting if it's been a while since the last report.
+func (r *phaseReporter) add(n int) {
+	if r == nil {
+		return
+	}
+	done := r.done.Add(int64(n))
+	if time.Since(r.last) < progressInterval || !r.mu.TryLock() {
+		return
+	}
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.last) >= progressInterval {
+		r.last = now
+		r.fn(Progress{Phase: r.phase, Done: int(done), Total: r.total, Elapsed: now.Sub(r.start)})
+	}
+}
+
+// finish reports the end of the phase.
+func (r *phaseReporter) finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fn(Progress{Phase: r.phase, Done: int(r.done.Load()), Total: r.total, Elapsed: time.Since(r.start), Finished: true})
+}
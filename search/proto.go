@@ -0,0 +1,418 @@
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// protoFormatVersion is the version written to and accepted from the
+// format_version field of proto/infrared/v1/index.proto. It's always the
+// first field written, so it heads the encoded index.
+const protoFormatVersion = 1
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errProtoTruncated = fmt.Errorf("%w: truncated protobuf message", ErrCorruptIndex)
+
+// MarshalProto encodes the index, including its stored documents, as an
+// infrared.v1.Index message (see proto/infrared/v1/index.proto), so services
+// in other languages can read it with generated protobuf code. Terms,
+// postings and documents are written in sorted order, so identical indexes
+// always encode to identical bytes.
+func (idx *Index) MarshalProto() ([]byte, error) {
+	return idx.marshalProto(true), nil
+}
+
+// ETag returns a strong HTTP entity tag, quotes included, identifying the
+// contents of the index: its terms, postings, stored documents and
+// settings. Identical indexes share an ETag, and rebuilding from changed
+// documents changes it, so a server can tag search and document responses
+// with it and answer a request whose If-None-Match matches with 304 Not
+// Modified, letting browsers and CDNs cache results between rebuilds.
+// It hashes the whole encoded index, so compute it once per index, as when
+// it's loaded or swapped in, rather than per request.
+func (idx *Index) ETag() string {
+	sum := sha256.Sum256(idx.marshalProto(true))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// marshalProto encodes the index, with or without its stored documents.
+func (idx *Index) marshalProto(withDocs bool) []byte {
+	var buf []byte
+	buf = appendVarintField(buf, 1, protoFormatVersion)
+
+	terms := make([]string, 0, len(idx.tmap))
+	for term := range idx.tmap {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	for _, term := range terms {
+		tfreq := idx.tmap[term]
+		tfMap := idx.postings(tfreq)
+		var msg []byte
+		msg = appendStringField(msg, 1, term)
+		msg = appendDoubleField(msg, 2, tfreq.Idf)
+		names := make([]string, 0, len(tfMap))
+		for name := range tfMap {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var posting []byte
+			posting = appendStringField(posting, 1, name)
+			posting = appendDoubleField(posting, 2, tfMap[name])
+			msg = appendBytesField(msg, 3, posting)
+		}
+		buf = appendBytesField(buf, 2, msg)
+	}
+
+	if withDocs {
+		buf = idx.appendProtoDocs(buf)
+	}
+
+	return appendBytesField(buf, 4, idx.protoMeta())
+}
+
+// protoMeta encodes the Metadata message of the index.
+func (idx *Index) protoMeta() []byte {
+	var meta []byte
+	meta = appendVarintField(meta, 1, uint64(idx.DocCount()))
+	meta = appendVarintField(meta, 2, uint64(idx.TermCount()))
+	meta = appendVarintField(meta, 3, uint64(idx.TotalWords()))
+	fields := make([]string, 0, len(idx.fieldAnalyzers))
+	for field := range idx.fieldAnalyzers {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		var entry []byte
+		entry = appendStringField(entry, 1, field)
+		entry = appendStringField(entry, 2, idx.fieldAnalyzers[field])
+		meta = appendBytesField(meta, 4, entry)
+	}
+	for _, word := range idx.stopWordList() {
+		meta = appendStringField(meta, 5, word)
+	}
+	for _, term := range idx.prunedList() {
+		meta = appendStringField(meta, 6, term)
+	}
+	return meta
+}
+
+// appendProtoDocs appends the stored documents, sorted by name, as the
+// documents field of an Index message.
+func (idx *Index) appendProtoDocs(buf []byte) []byte {
+	names := make([]string, 0, len(idx.docs))
+	for name := range idx.docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf = appendBytesField(buf, 3, marshalProtoDoc(idx.docs[name]))
+	}
+	return buf
+}
+
+func marshalProtoDoc(doc Document) []byte {
+	var msg []byte
+	msg = appendStringField(msg, 1, doc.Name)
+	msg = appendStringField(msg, 2, doc.Date)
+	msg = appendStringField(msg, 3, doc.Preview)
+	msg = appendVarintField(msg, 4, uint64(doc.Length))
+	msg = appendStringField(msg, 5, doc.Content)
+	kinds := make([]string, 0, len(doc.Entities))
+	for kind := range doc.Entities {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		var entity []byte
+		entity = appendStringField(entity, 1, kind)
+		for _, value := range doc.Entities[kind] {
+			entity = appendStringField(entity, 2, value)
+		}
+		msg = appendBytesField(msg, 6, entity)
+	}
+	msg = appendStringField(msg, 7, doc.Namespace)
+	msg = appendVarintField(msg, 8, uint64(doc.TokenCount))
+	msg = appendStringField(msg, 9, doc.Dir)
+	for _, p := range doc.ACL {
+		msg = appendStringField(msg, 10, p)
+	}
+	if doc.ExpiresAt != nil {
+		msg = appendVarintField(msg, 11, uint64(doc.ExpiresAt.UnixNano()))
+	}
+	return msg
+}
+
+// UnmarshalProto decodes an index encoded by MarshalProto, including its
+// stored documents. Unknown fields are skipped so that newer writers stay
+// readable; an unknown format version is an error.
+func UnmarshalProto(data []byte, opts DocOpts) (*Index, error) {
+	return unmarshalProto(context.Background(), data, nil, opts)
+}
+
+// unmarshalProto decodes an index, populating its documents with loader if
+// it was saved without them and loader isn't nil.
+func unmarshalProto(ctx context.Context, data []byte, loader Loader, opts DocOpts) (*Index, error) {
+	idx := &Index{tmap: make(map[string]TermFreq)}
+	idx.docs = make(map[string]Document)
+
+	version := uint64(0)
+	err := readProto(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == wireVarint:
+			version = v
+		case num == 2 && wire == wireBytes:
+			return unmarshalProtoTerm(b, idx)
+		case num == 3 && wire == wireBytes:
+			doc, err := unmarshalProtoDoc(b)
+			if err != nil {
+				return err
+			}
+			idx.docs[doc.Name] = doc
+		case num == 4 && wire == wireBytes:
+			return unmarshalProtoMeta(b, idx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal index: %w", err)
+	}
+	if err := checkVersion("protobuf", int(version), protoFormatVersion); err != nil {
+		return nil, err
+	}
+	if err := idx.configure(opts); err != nil {
+		return nil, err
+	}
+	if len(idx.docs) == 0 && loader != nil {
+		if err := idx.populate(ctx, loader, opts); err != nil {
+			return nil, err
+		}
+	}
+	idx.indexStoredDocs()
+	idx.finishLoad()
+	return idx, nil
+}
+
+func unmarshalProtoTerm(data []byte, idx *Index) error {
+	var term string
+	tfreq := TermFreq{TfMap: make(map[string]float64)}
+	err := readProto(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			term = string(b)
+		case num == 2 && wire == wireFixed64:
+			tfreq.Idf = math.Float64frombits(v)
+		case num == 3 && wire == wireBytes:
+			var doc string
+			var tf float64
+			err := readProto(b, func(num int, wire int, v uint64, b []byte) error {
+				switch {
+				case num == 1 && wire == wireBytes:
+					doc = string(b)
+				case num == 2 && wire == wireFixed64:
+					tf = math.Float64frombits(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			tfreq.TfMap[doc] = tf
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	idx.tmap[term] = tfreq
+	return nil
+}
+
+// unmarshalProtoMeta reads the saved configuration from the metadata; the
+// counts are derived from the rest of the index.
+func unmarshalProtoMeta(data []byte, idx *Index) error {
+	return readProto(data, func(num int, wire int, v uint64, b []byte) error {
+		if num == 5 && wire == wireBytes {
+			if idx.stopWords == nil {
+				idx.stopWords = make(map[string]bool)
+			}
+			idx.stopWords[string(b)] = true
+			return nil
+		}
+		if num == 6 && wire == wireBytes {
+			idx.markPruned(string(b))
+			return nil
+		}
+		if num != 4 || wire != wireBytes {
+			return nil
+		}
+		var field, analyzer string
+		err := readProto(b, func(num int, wire int, v uint64, b []byte) error {
+			switch {
+			case num == 1 && wire == wireBytes:
+				field = string(b)
+			case num == 2 && wire == wireBytes:
+				analyzer = string(b)
+			}
+			return nil
+		})
+		if idx.fieldAnalyzers == nil {
+			idx.fieldAnalyzers = make(map[string]string)
+		}
+		idx.fieldAnalyzers[field] = analyzer
+		return err
+	})
+}
+
+func unmarshalProtoDoc(data []byte) (Document, error) {
+	var doc Document
+	err := readProto(data, func(num int, wire int, v uint64, b []byte) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			doc.Name = string(b)
+		case num == 2 && wire == wireBytes:
+			doc.Date = string(b)
+		case num == 3 && wire == wireBytes:
+			doc.Preview = string(b)
+		case num == 4 && wire == wireVarint:
+			doc.Length = int(v)
+		case num == 5 && wire == wireBytes:
+			doc.Content = string(b)
+		case num == 8 && wire == wireVarint:
+			doc.TokenCount = int(v)
+		case num == 9 && wire == wireBytes:
+			doc.Dir = string(b)
+		case num == 10 && wire == wireBytes:
+			doc.ACL = append(doc.ACL, string(b))
+		case num == 11 && wire == wireVarint:
+			expires := time.Unix(0, int64(v)).UTC()
+			doc.ExpiresAt = &expires
+		case num == 6 && wire == wireBytes:
+			var kind string
+			var values []string
+			err := readProto(b, func(num int, wire int, v uint64, b []byte) error {
+				switch {
+				case num == 1 && wire == wireBytes:
+					kind = string(b)
+				case num == 2 && wire == wireBytes:
+					values = append(values, string(b))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if doc.Entities == nil {
+				doc.Entities = make(map[string][]string)
+			}
+			doc.Entities[kind] = values
+		case num == 7 && wire == wireBytes:
+			doc.Namespace = string(b)
+		}
+		return nil
+	})
+	return doc, err
+}
+
+// readProto calls fn for every field in a protobuf message. Varint and
+// fixed-width values are passed in v, length-delimited values in b.
+func readProto(data []byte, fn func(num int, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+
+		var v uint64
+		var b []byte
+		switch wire {
+		case wireVarint:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errProtoTruncated
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errProtoTruncated
+			}
+			v = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errProtoTruncated
+			}
+			v = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errProtoTruncated
+			}
+			b = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			return fmt.Errorf("%w: unsupported protobuf wire type %d", ErrCorruptIndex, wire)
+		}
+		if err := fn(num, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendTag(buf []byte, num, wire int) []byte {
+	return binary.AppendUvarint(buf, uint64(num)<<3|uint64(wire))
+}
+
+// appendVarintField appends a varint field, omitting it if zero as proto3 does.
+func appendVarintField(buf []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = appendTag(buf, num, wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+// appendDoubleField appends a double field, omitting it if zero as proto3 does.
+func appendDoubleField(buf []byte, num int, f float64) []byte {
+	if f == 0 {
+		return buf
+	}
+	buf = appendTag(buf, num, wireFixed64)
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+// appendStringField appends a string field, omitting it if empty as proto3 does.
+func appendStringField(buf []byte, num int, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	buf = appendTag(buf, num, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendBytesField appends an embedded message. Unlike scalars it is always
+// written, since an empty element of a repeated field is still an element.
+func appendBytesField(buf []byte, num int, b []byte) []byte {
+	buf = appendTag(buf, num, wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
@@ -0,0 +1,66 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	opts := DocOpts{
+		Load: LoadOpts{Path: "../example/docs", Content: true, LenPreview: 100},
+	}
+	index := mustIndex(t, DefaultLoader, opts)
+
+	data, err := index.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := index.MarshalProto()
+	if !bytes.Equal(data, again) {
+		t.Error("expected identical bytes for the same index")
+	}
+
+	loaded, err := UnmarshalProto(data, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.tmap, index.tmap) {
+		t.Error("term map differs after round trip")
+	}
+	if !reflect.DeepEqual(loaded.docs, index.docs) {
+		t.Error("documents differ after round trip")
+	}
+
+	results, _ := loaded.Search(context.Background(), []string{"moral", "law"}, SearchOpts{Limit: 1})
+	if len(results) != 1 || results[0].Name != "civil_disobedience.txt" || results[0].Preview == "" {
+		t.Errorf("unexpected results from decoded index: %+v", results)
+	}
+
+	// format_version 2 is unknown
+	if _, err := UnmarshalProto(append([]byte{0x08, 0x02}, data[2:]...), DocOpts{}); err == nil {
+		t.Error("expected an error for an unknown format version")
+	}
+	if _, err := UnmarshalProto(data[:len(data)-3], DocOpts{}); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
+
+func TestETag(t *testing.T) {
+	docs := []Document{
+		{Name: "pond.md", Content: "the pond in winter"},
+		{Name: "city.md", Content: "the city in summer"},
+	}
+	etag := mustIndex(t, memLoader(docs...), DocOpts{}).ETag()
+	if again := mustIndex(t, memLoader(docs...), DocOpts{}).ETag(); again != etag {
+		t.Errorf("expected the same ETag for the same documents, got %s and %s", etag, again)
+	}
+	docs[1].Content = "the city in autumn"
+	if changed := mustIndex(t, memLoader(docs...), DocOpts{}).ETag(); changed == etag {
+		t.Error("expected a new ETag after a document changed")
+	}
+	if len(etag) != 34 || etag[0] != '"' || etag[33] != '"' {
+		t.Errorf("expected a quoted ETag, got %s", etag)
+	}
+}
@@ -0,0 +1,113 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Query is a search query split into free text and field-qualified terms.
+type Query struct {
+	Terms  []string    // free-text words
+	Fields []FieldTerm // terms restricted to a field, e.g. person:"thoreau"
+	// Phrases are the quoted free text of several words, e.g. "moral law",
+	// whose words are also among Terms. With DocOpts.Positions, only
+	// documents with the words of each phrase in a row match.
+	Phrases [][]string
+	// Match, if set, restricts the results to the documents matching it,
+	// as when the query used the operators AND or NOT; see BoolQuery.
+	Match *BoolQuery
+}
+
+// FieldTerm is a value that must occur in a document field.
+type FieldTerm struct {
+	Field string
+	Value string
+}
+
+// ParseQuery splits search terms into free text and field:value pairs. Only
+// fields known to the index are recognized; anything else stays free text.
+// Values may be quoted to span several words: person:"henry david thoreau".
+// Quoted free text of several words is a phrase. A query using AND or NOT
+// is parsed into Match instead, fields and phrases included; see
+// parseBoolean.
+func (idx *Index) ParseQuery(terms []string) Query {
+	var q Query
+	tokens := quotedFields(cleanQuery(strings.Join(terms, " ")))
+	if hasOperators(tokens) {
+		idx.parseBoolean(&q, tokens)
+		return q
+	}
+	for _, tok := range tokens {
+		field, value, ok := strings.Cut(tok, ":")
+		if field = strings.ToLower(field); ok && idx.fields[field] {
+			if value = idx.fieldValue(field, value); value != "" {
+				q.Fields = append(q.Fields, FieldTerm{Field: field, Value: value})
+			}
+			continue
+		}
+		words := strings.Fields(tok)
+		if len(words) > 1 {
+			q.Phrases = append(q.Phrases, words)
+		}
+		q.Terms = append(q.Terms, words...)
+	}
+	return q
+}
+
+// cleanQuery replaces the typographic characters of text pasted into a
+// query with the ones typed on a keyboard, so it parses as if it had been
+// typed: curly and angled quotes become straight ones, so person:“henry
+// thoreau” is quoted, non-breaking and other Unicode spaces become spaces,
+// and invisible zero-width characters and soft hyphens are removed.
+// Accents are left to the index normalizer; see DocOpts.FoldDiacritics.
+func cleanQuery(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '“', '”', '„', '‟', '«', '»', '″':
+			return '"'
+		case '‘', '’', '‚', '‛', '′':
+			return '\''
+		case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff', '\u00ad':
+			return -1
+		}
+		if r > unicode.MaxASCII && unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// cleanTerms returns the terms of a query, each cleaned as cleanQuery
+// cleans it.
+func cleanTerms(terms []string) []string {
+	cleaned := make([]string, len(terms))
+	for i, term := range terms {
+		cleaned[i] = cleanQuery(term)
+	}
+	return cleaned
+}
+
+// quotedFields splits s on whitespace, keeping double-quoted spans together
+// and dropping the quotes.
+func quotedFields(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
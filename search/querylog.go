@@ -0,0 +1,148 @@
+package search
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryBucket is the granularity at which a QueryLog counts queries over time.
+const queryBucket = time.Hour
+
+// QueryLog counts the queries people search for, to suggest popular ones
+// as they type and to find the ones trending. Unlike Index.Terms, which
+// completes words of the corpus, it only knows what's been searched. It's
+// safe for concurrent use.
+type QueryLog struct {
+	mu      sync.Mutex
+	queries map[string]*loggedQuery
+	first   time.Time // earliest query logged
+}
+
+// loggedQuery is the count of a query, in all and by hour.
+type loggedQuery struct {
+	total   int
+	buckets map[int64]int // by hour since the Unix epoch
+}
+
+// QuerySuggestion is a logged query and how often it's been searched.
+type QuerySuggestion struct {
+	Query string  `json:"query"`
+	Count int     `json:"count"`           // searches, in all or within the trending window
+	Score float64 `json:"score,omitempty"` // how far the query is trending above its usual rate
+}
+
+// NewQueryLog returns an empty query log.
+func NewQueryLog() *QueryLog {
+	return &QueryLog{queries: make(map[string]*loggedQuery)}
+}
+
+// normalizeQuery lowercases a query and collapses its whitespace, so that
+// the same query typed differently is counted once.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// Add logs a search for query at the given time. Empty queries are ignored.
+func (l *QueryLog) Add(query string, at time.Time) {
+	query = normalizeQuery(query)
+	if query == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q, ok := l.queries[query]
+	if !ok {
+		q = &loggedQuery{buckets: make(map[int64]int)}
+		l.queries[query] = q
+	}
+	q.total++
+	q.buckets[at.Unix()/int64(queryBucket/time.Second)]++
+	if l.first.IsZero() || at.Before(l.first) {
+		l.first = at
+	}
+}
+
+// Ingest logs the queries read from r, one per line. A line may start with
+// an RFC 3339 time and a tab, as in "2024-05-01T10:00:00Z\tcivil
+// disobedience"; lines without one are logged at the time of reading.
+func (l *QueryLog) Ingest(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		at := time.Now()
+		if stamp, query, ok := strings.Cut(line, "\t"); ok {
+			if t, err := time.Parse(time.RFC3339, stamp); err == nil {
+				at, line = t, query
+			}
+		}
+		l.Add(line, at)
+	}
+	return scanner.Err()
+}
+
+// Suggest returns up to k of the logged queries starting with prefix, most
+// searched first.
+func (l *QueryLog) Suggest(prefix string, k int) []QuerySuggestion {
+	prefix = strings.ToLower(strings.TrimLeft(prefix, " \t"))
+	l.mu.Lock()
+	var suggestions []QuerySuggestion
+	for query, q := range l.queries {
+		if strings.HasPrefix(query, prefix) {
+			suggestions = append(suggestions, QuerySuggestion{Query: query, Count: q.total})
+		}
+	}
+	l.mu.Unlock()
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Count != suggestions[j].Count {
+			return suggestions[i].Count > suggestions[j].Count
+		}
+		return suggestions[i].Query < suggestions[j].Query
+	})
+	return suggestions[:min(len(suggestions), k)]
+}
+
+// Trending returns up to k of the queries searched in the window before
+// now, by how far they exceed their usual rate: the number of searches in
+// the window, divided by one more than the average number per window
+// before it. A query new to the window scores its count; one searched as
+// often as ever scores about 1. The window is rounded out to whole hours.
+func (l *QueryLog) Trending(window time.Duration, now time.Time, k int) []QuerySuggestion {
+	perBucket := int64(queryBucket / time.Second)
+	from := now.Add(-window).Unix() / perBucket
+	to := now.Unix() / perBucket
+	l.mu.Lock()
+	// the windows of history before this one
+	windows := float64(now.Add(-window).Sub(l.first)) / float64(window)
+	var trending []QuerySuggestion
+	for query, q := range l.queries {
+		recent := 0
+		for b, n := range q.buckets {
+			if b >= from && b <= to {
+				recent += n
+			}
+		}
+		if recent == 0 {
+			continue
+		}
+		usual := 0.0
+		if windows > 0 {
+			usual = float64(q.total-recent) / max(1, windows)
+		}
+		trending = append(trending, QuerySuggestion{Query: query, Count: recent, Score: float64(recent) / (1 + usual)})
+	}
+	l.mu.Unlock()
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].Score != trending[j].Score {
+			return trending[i].Score > trending[j].Score
+		}
+		if trending[i].Count != trending[j].Count {
+			return trending[i].Count > trending[j].Count
+		}
+		return trending[i].Query < trending[j].Query
+	})
+	return trending[:min(len(trending), k)]
+}
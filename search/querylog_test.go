@@ -0,0 +1,44 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryLog(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	log := NewQueryLog()
+	// civil disobedience is searched every day; walden only today
+	for day := 9; day >= 0; day-- {
+		log.Add("Civil  Disobedience", now.Add(-time.Duration(day)*24*time.Hour))
+		log.Add("civil rights", now.Add(-time.Duration(day)*24*time.Hour))
+	}
+	log.Add("civil war", now.Add(-48*time.Hour))
+	err := log.Ingest(strings.NewReader(
+		"2024-05-10T11:00:00Z\twalden\n" +
+			"2024-05-10T11:30:00Z\tWalden\n" +
+			"2024-05-10T11:45:00Z\twalden pond\n" +
+			"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suggestions := log.Suggest("civil", 2)
+	if len(suggestions) != 2 || suggestions[0] != (QuerySuggestion{Query: "civil disobedience", Count: 10}) {
+		t.Errorf("unexpected suggestions %+v", suggestions)
+	}
+	if got := log.Suggest("wal", 5); len(got) != 2 || got[0].Query != "walden" || got[0].Count != 2 {
+		t.Errorf("unexpected suggestions %+v", got)
+	}
+
+	trending := log.Trending(24*time.Hour, now, 3)
+	if len(trending) != 3 || trending[0].Query != "walden" || trending[0].Count != 2 {
+		t.Fatalf("expected walden to be trending, got %+v", trending)
+	}
+	for _, q := range trending {
+		if q.Query == "civil war" {
+			t.Errorf("expected a query from outside the window not to trend, got %+v", trending)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package search
+
+import "strings"
+
+// defaultQuestionBoost is the weight multiplier for content words in question mode.
+const defaultQuestionBoost = 2.0
+
+// questionScaffolds are leading phrases that carry no topical meaning in a
+// natural-language question. The longest matching scaffold is stripped.
+var questionScaffolds = map[string]bool{
+	"what": true, "what is": true, "what are": true, "what was": true, "what were": true,
+	"what does": true, "what do": true, "what is the": true, "what are the": true,
+	"who": true, "who is": true, "who was": true, "who were": true,
+	"where": true, "where is": true, "where are": true, "where can i": true, "where do i": true,
+	"when": true, "when is": true, "when was": true, "when did": true,
+	"why": true, "why is": true, "why are": true, "why do": true, "why does": true, "why did": true,
+	"which": true, "which is": true,
+	"how": true, "how is": true, "how are": true, "how does": true, "how do": true,
+	"how do i": true, "how do you": true, "how can i": true, "how to": true,
+	"is there": true, "are there": true, "can you": true, "can i": true,
+	"tell me about": true, "explain": true, "define": true,
+}
+
+// maxScaffoldWords is the length of the longest entry in questionScaffolds.
+const maxScaffoldWords = 3
+
+// questionStopwords are dropped as standalone terms in question mode. They are
+// kept inside n-grams so that phrases like "use of language" still match.
+var questionStopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "to": true, "in": true, "on": true,
+	"for": true, "and": true, "or": true, "is": true, "are": true, "was": true, "were": true,
+	"be": true, "do": true, "does": true, "did": true, "i": true, "me": true, "my": true,
+	"you": true, "your": true, "it": true, "its": true, "this": true, "that": true,
+	"with": true, "by": true, "about": true, "from": true, "at": true, "as": true,
+}
+
+func (opts SearchOpts) questionBoost() float64 {
+	if opts.QuestionBoost <= 0 {
+		return defaultQuestionBoost
+	}
+	return opts.QuestionBoost
+}
+
+// stripQuestion removes the leading question scaffold from analyzed words.
+func stripQuestion(words []string) []string {
+	for n := min(maxScaffoldWords, len(words)); n > 0; n-- {
+		if questionScaffolds[strings.Join(words[:n], " ")] {
+			return words[n:]
+		}
+	}
+	return words
+}
+
+// questionTerms builds query terms for a natural-language question: n-grams
+// of the stripped question at normal weight, plus its content words boosted.
+func (idx Index) questionTerms(words []string, boost float64) []queryTerm {
+	words = stripQuestion(words)
+
+	var content []string
+	for _, w := range words {
+		if !questionStopwords[w] && !idx.stopWords[w] {
+			content = append(content, w)
+		}
+	}
+	if len(content) == 0 {
+		// a question made only of stopwords: fall back to searching for them
+		content = words
+	}
+
+	qts := withBoost(content, boost)
+	gapped := idx.gapStopWords(append([]string(nil), words...))
+	for n := max(2, idx.ngrams.min); n <= idx.ngrams.max && n <= len(words); n++ {
+		for _, term := range ngrams(gapped, n) {
+			if !isGapped([]byte(term)) {
+				qts = append(qts, queryTerm{text: term, boost: 1})
+			}
+		}
+	}
+	return append(qts, withBoost(idx.expander.expand(words), 1)...)
+}
@@ -0,0 +1,50 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripQuestion(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"What is the moral law?", []string{"moral", "law"}},
+		{"how do I own land", []string{"own", "land"}},
+		{"human nature", []string{"human", "nature"}},
+	}
+	for _, tt := range tests {
+		got := stripQuestion(strings.Fields(DefaultNormalizer(tt.query)))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQuestionSearch(t *testing.T) {
+	opts := DocOpts{
+		Load: LoadOpts{Path: "../example/docs", Content: true},
+	}
+	index := mustIndex(t, DefaultLoader, opts)
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"What is the moral law?", "civil_disobedience.txt"},
+		{"How much land does a man need?", "how_much_land.txt"},
+		{"Why is the use of language declining?", "politics_and_the_english_language.txt"},
+	}
+	for _, tt := range tests {
+		results, err := index.Search(context.Background(), strings.Fields(tt.query), SearchOpts{Limit: 5, Question: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) == 0 || results[0].Name != tt.expected {
+			t.Errorf("question %q: expected top result %q, got %+v", tt.query, tt.expected, results)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BuildReport describes how an index was built, so that a job rebuilding
+// it can warn or fail on anomalies such as no documents being loaded. It's
+// kept with DocOpts.Report, and saved next to the index by Save.
+type BuildReport struct {
+	Documents int           `json:"documents"`
+	Skipped   []SkippedFile `json:"skipped,omitempty"` // files the loader passed over
+	// Extensions counts the documents by file extension, "" for none
+	Extensions map[string]int `json:"extensions"`
+	Largest    []DocSize      `json:"largest"` // the largest documents by TokenCount, largest first
+	Phases     []PhaseTiming  `json:"phases"`
+	// TopTerms are the kept words in the most documents, weighted by the
+	// number of documents they're in
+	TopTerms []TermWeight `json:"top_terms"`
+	// Warnings describes anything that looks wrong, like an empty corpus
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// SkippedFile is a file a loader didn't load, and why.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// DocSize is the size of a document, in words.
+type DocSize struct {
+	Name   string `json:"name"`
+	Tokens int    `json:"tokens"`
+}
+
+// PhaseTiming is how long a build phase took.
+type PhaseTiming struct {
+	Phase   Phase         `json:"phase"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+// number of documents and terms listed in a report
+const reportTop = 10
+
+// BuildReport returns the report of the index's build, or nil if it wasn't
+// built with DocOpts.Report.
+func (idx *Index) BuildReport() *BuildReport {
+	return idx.report
+}
+
+// recordPhases returns a ProgressFunc that times each phase into the
+// report, and passes the progress on to next if it isn't nil. Phases run
+// one after another, so the timings aren't locked.
+func (r *BuildReport) recordPhases(next ProgressFunc) ProgressFunc {
+	return func(p Progress) {
+		if p.Finished {
+			r.Phases = append(r.Phases, PhaseTiming{Phase: p.Phase, Elapsed: p.Elapsed})
+		}
+		if next != nil {
+			next(p)
+		}
+	}
+}
+
+// recordSkips returns a LoadOpts.Skip that lists skipped files in the
+// report, and passes them on to next if it isn't nil. Loaders may skip
+// files from several goroutines.
+func (r *BuildReport) recordSkips(next func(path, reason string)) func(path, reason string) {
+	var mu sync.Mutex
+	return func(path, reason string) {
+		mu.Lock()
+		r.Skipped = append(r.Skipped, SkippedFile{Path: path, Reason: reason})
+		mu.Unlock()
+		if next != nil {
+			next(path, reason)
+		}
+	}
+}
+
+// finish fills in the parts of the report that describe the built index.
+func (r *BuildReport) finish(idx *Index) {
+	r.Documents = len(idx.docs)
+	r.Extensions = make(map[string]int)
+	empty := 0
+	for name, doc := range idx.docs {
+		r.Extensions[strings.ToLower(path.Ext(name))]++
+		r.Largest = append(r.Largest, DocSize{Name: name, Tokens: doc.tokens()})
+		if doc.TokenCount == 0 {
+			empty++
+		}
+	}
+	sort.Slice(r.Largest, func(i, j int) bool {
+		if r.Largest[i].Tokens != r.Largest[j].Tokens {
+			return r.Largest[i].Tokens > r.Largest[j].Tokens
+		}
+		return r.Largest[i].Name < r.Largest[j].Name
+	})
+	r.Largest = r.Largest[:min(len(r.Largest), reportTop)]
+
+	for term, tfreq := range idx.tmap {
+		if !strings.ContainsAny(term, " :") {
+			r.TopTerms = append(r.TopTerms, TermWeight{Term: term, Weight: float64(idx.docFreq(tfreq))})
+		}
+	}
+	sortWeights(r.TopTerms)
+	r.TopTerms = r.TopTerms[:min(len(r.TopTerms), reportTop)]
+
+	if r.Documents == 0 {
+		r.Warnings = append(r.Warnings, "no documents loaded")
+	}
+	if empty > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d of %d documents have no words", empty, r.Documents))
+	}
+	if len(r.Skipped) > 0 {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%d files skipped", len(r.Skipped)))
+	}
+}
+
+// WriteBuildReport writes the build report of the index to w as JSON.
+func (idx *Index) WriteBuildReport(w io.Writer) error {
+	if idx.report == nil {
+		return fmt.Errorf("index was built without a report")
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(idx.report)
+}
+
+// reportPath returns the path of the build report saved with the index at
+// indexPath: "index.json.gz" has "index.report.json".
+func reportPath(indexPath string) string {
+	base := strings.TrimSuffix(indexPath, ".gz")
+	if ext := filepath.Ext(base); ext == ".json" || ext == ".pb" || ext == ".gob" || ext == ".irm" {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base + ".report.json"
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBuildReport(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/pond.txt":   {Data: []byte("the pond in winter, the pond in spring")},
+		"docs/city.md":    {Data: []byte("the city in summer")},
+		"docs/blank.txt":  {Data: []byte("...")},
+		"docs/sub/x.txt":  {Data: []byte("in a subdirectory")},
+		"docs/sub/y.txt":  {Data: []byte("also in a subdirectory")},
+		"docs/other/z.md": {Data: []byte("another")},
+	}
+	var skipped []string
+	opts := DocOpts{
+		Load:   LoadOpts{FS: fsys, Path: "docs", Content: true, Skip: func(path, reason string) { skipped = append(skipped, path) }},
+		Report: true,
+	}
+	index := mustIndex(t, DefaultLoader, opts)
+	report := index.BuildReport()
+	if report == nil {
+		t.Fatal("expected a report")
+	}
+	if report.Documents != 3 || !reflect.DeepEqual(report.Extensions, map[string]int{".txt": 2, ".md": 1}) {
+		t.Errorf("unexpected counts %+v", report)
+	}
+	if len(report.Skipped) != 2 || len(skipped) != 2 || report.Skipped[0].Reason != "directory" {
+		t.Errorf("expected the subdirectories to be skipped, got %+v and %q", report.Skipped, skipped)
+	}
+	if report.Largest[0] != (DocSize{Name: "pond.txt", Tokens: 8}) {
+		t.Errorf("unexpected largest documents %+v", report.Largest)
+	}
+	if len(report.Phases) != 4 || report.Phases[0].Phase != PhaseLoad {
+		t.Errorf("unexpected phases %+v", report.Phases)
+	}
+	want := []string{"1 of 3 documents have no words", "2 files skipped"}
+	if !reflect.DeepEqual(report.Warnings, want) {
+		t.Errorf("got warnings %q, want %q", report.Warnings, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.json.gz")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), "index.report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved BuildReport
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Documents != 3 {
+		t.Errorf("unexpected saved report %s: %v", data, err)
+	}
+
+	empty := mustIndex(t, memLoader(), DocOpts{Report: true})
+	if w := empty.BuildReport().Warnings; len(w) != 1 || w[0] != "no documents loaded" {
+		t.Errorf("expected a warning for an empty corpus, got %q", w)
+	}
+}
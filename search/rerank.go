@@ -0,0 +1,104 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Eratosthenes/infrared/vectors"
+)
+
+// defaultRerankDepth is the number of lexical candidates handed to a Reranker.
+const defaultRerankDepth = 100
+
+// Reranker rescores the top lexical candidates of a query with a more
+// expensive relevance model. It returns the candidates with updated scores;
+// Search takes care of re-sorting them and applying the limit.
+type Reranker interface {
+	Rerank(terms []string, candidates []SearchResult) ([]SearchResult, error)
+}
+
+// RerankFunc adapts a per-document scoring callback, such as a cross-encoder,
+// to the Reranker interface.
+type RerankFunc func(query string, doc *Document) (float64, error)
+
+// Rerank scores each candidate with f.
+func (f RerankFunc) Rerank(terms []string, candidates []SearchResult) ([]SearchResult, error) {
+	query := strings.Join(terms, " ")
+	for i := range candidates {
+		score, err := f(query, candidates[i].Document)
+		if err != nil {
+			return nil, err
+		}
+		candidates[i].Score = score
+	}
+	return candidates, nil
+}
+
+// EmbeddingReranker scores candidates by the cosine similarity between the
+// query embedding and the document embedding. Wrap the embedder in a
+// vectors.CachedEmbedder so documents are only embedded once.
+type EmbeddingReranker struct {
+	Embedder  vectors.Embedder
+	BatchSize int
+}
+
+// Rerank embeds the query and candidate documents and scores them by similarity, clamped to [0, 1].
+func (er EmbeddingReranker) Rerank(terms []string, candidates []SearchResult) ([]SearchResult, error) {
+	texts := make([]string, len(candidates)+1)
+	texts[0] = strings.Join(terms, " ")
+	for i, c := range candidates {
+		texts[i+1] = c.Content
+		if texts[i+1] == "" {
+			texts[i+1] = c.Preview
+		}
+	}
+	vecs, err := vectors.EmbedAll(er.Embedder, texts, er.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range candidates {
+		sim := float64(vectors.Cosine(vecs[0], vecs[i+1]))
+		candidates[i].Score = max(sim, 0)
+	}
+	return candidates, nil
+}
+
+// rerank applies opts.Reranker to the lexical results and trims them to
+// the results up to the end of the page.
+func (opts SearchOpts) rerank(terms []string, results []SearchResult) ([]SearchResult, error) {
+	results, err := opts.Reranker.Rerank(terms, results)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > opts.pageEnd() {
+		results = results[:opts.pageEnd()]
+	}
+	return results, nil
+}
+
+// pageEnd returns the number of results up to the end of the requested
+// page, which is all of them without a Limit. It saturates at math.MaxInt
+// rather than overflow for huge offsets.
+func (opts SearchOpts) pageEnd() int {
+	offset := max(opts.Offset, 0)
+	if opts.Limit <= 0 || opts.Limit > math.MaxInt-offset {
+		return math.MaxInt
+	}
+	return offset + opts.Limit
+}
+
+// candidateLimit returns how many lexical results Search should keep before reranking.
+func (opts SearchOpts) candidateLimit() int {
+	if opts.Reranker == nil {
+		return opts.pageEnd()
+	}
+	depth := opts.RerankDepth
+	if depth <= 0 {
+		depth = defaultRerankDepth
+	}
+	return max(depth, opts.pageEnd())
+}
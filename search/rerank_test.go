@@ -0,0 +1,37 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRerankReordersLexicalCandidates(t *testing.T) {
+	opts := DocOpts{
+		Load: LoadOpts{Path: "../example/docs", Content: true},
+	}
+	index := mustIndex(t, DefaultLoader, opts)
+
+	seen := 0
+	prefer := RerankFunc(func(query string, doc *Document) (float64, error) {
+		seen++
+		if query != "moral law" {
+			t.Errorf("unexpected query %q", query)
+		}
+		if doc.Name == "how_much_land.txt" {
+			return 1, nil
+		}
+		return 0.5, nil
+	})
+
+	results, err := index.Search(context.Background(), strings.Fields("moral law"), SearchOpts{Limit: 1, Reranker: prefer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "how_much_land.txt" {
+		t.Fatalf("expected reranked top result how_much_land.txt, got %+v", results)
+	}
+	if seen < 2 {
+		t.Errorf("expected the reranker to see more candidates than the limit, saw %d", seen)
+	}
+}
@@ -0,0 +1,53 @@
+package search
+
+import "sort"
+
+// Scorer scores documents against one query, for Rescore.
+type Scorer interface {
+	Score(doc *Document) float64
+}
+
+// ScorerFunc adapts a function to the Scorer interface.
+type ScorerFunc func(doc *Document) float64
+
+// Score calls f.
+func (f ScorerFunc) Score(doc *Document) float64 {
+	return f(doc)
+}
+
+// Scorer returns the lexical scorer of the query terms, scoring documents
+// as Search would with opts: by its Ranking, BM25 parameters, Question
+// boosts, Rewriters and decay. Filters, limits and MinScore don't apply;
+// it scores whatever documents it's given. As in Search, RankBM25 needs
+// the index's stored documents.
+func (idx Index) Scorer(terms []string, opts SearchOpts) Scorer {
+	q, queryTerms := idx.analyzeQuery(terms, opts)
+	queryTerms = idx.resolve(queryTerms, opts.idfs)
+	sc := opts.scoring(&idx, q, queryTerms)
+	return ScorerFunc(func(doc *Document) float64 {
+		return idx.score(doc.Name, sc)
+	})
+}
+
+// Rescore scores results again with scorer and returns them sorted by their
+// new scores, leaving results as they are, so that an A/B ranking
+// experiment can run the candidates of one query through both models and
+// compare them:
+//
+//	results, _ := idx.Search(ctx, terms, opts)
+//	bm25 := opts
+//	bm25.Ranking = RankBM25
+//	rescored := idx.Rescore(results, idx.Scorer(terms, bm25))
+//
+// Results with equal new scores keep their order.
+func (idx Index) Rescore(results []SearchResult, scorer Scorer) []SearchResult {
+	rescored := make([]SearchResult, len(results))
+	for i, r := range results {
+		r.Score = scorer.Score(r.Document)
+		rescored[i] = r
+	}
+	sort.SliceStable(rescored, func(i, j int) bool {
+		return rescored[i].Score > rescored[j].Score
+	})
+	return rescored
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRescore(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "short.md", Content: "the law of the land"},
+		Document{Name: "long.md", Content: "the law " + strings.Repeat("and the state and the citizen ", 20)},
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "woods.md", Content: "the woods in winter"},
+	), DocOpts{})
+	ctx := context.Background()
+	terms := []string{"law"}
+
+	results, err := index.Search(ctx, terms, SearchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := results[0].Score
+	bm25 := SearchOpts{Ranking: RankBM25}
+	rescored := index.Rescore(results, index.Scorer(terms, bm25))
+	want, err := index.Search(ctx, terms, bm25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rescored) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(rescored))
+	}
+	for i := range want {
+		if rescored[i].Name != want[i].Name || math.Abs(rescored[i].Score-want[i].Score) > 1e-12 {
+			t.Errorf("result %d: expected %s at %v, got %s at %v", i, want[i].Name, want[i].Score, rescored[i].Name, rescored[i].Score)
+		}
+	}
+	if results[0].Score != before {
+		t.Error("expected the results given to Rescore to be left as they are")
+	}
+
+	byLength := ScorerFunc(func(doc *Document) float64 { return float64(doc.TokenCount) })
+	if rescored := index.Rescore(results, byLength); rescored[0].Name != "long.md" {
+		t.Errorf("expected the custom scorer to put the long document first, got %+v", rescored)
+	}
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+)
+
+// SearchResponse is the results of a search as served to clients. Encoded
+// as JSON, each result follows the schema of SearchResult.MarshalJSON.
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+	// Relaxation says how a SearchFallback query was relaxed, if it was
+	Relaxation *Relaxation `json:"relaxation,omitempty"`
+}
+
+// resultJSON is the stable JSON schema of a SearchResult.
+type resultJSON struct {
+	Name      string              `json:"name"`
+	Score     float64             `json:"score"`
+	Date      string              `json:"date,omitempty"`
+	Dir       string              `json:"dir,omitempty"`
+	Namespace string              `json:"namespace,omitempty"`
+	Preview   string              `json:"preview,omitempty"`
+	Length    int                 `json:"length,omitempty"`
+	ExpiresAt *time.Time          `json:"expires_at,omitempty"`
+	Entities  map[string][]string `json:"entities,omitempty"`
+	Matches   []Match             `json:"matches,omitempty"`
+	Snippets  []Snippet           `json:"snippets,omitempty"`
+	Answer    string              `json:"answer,omitempty"`
+	Content   string              `json:"content,omitempty"`
+	ACL       []string            `json:"acl,omitempty"`
+}
+
+// scoreDigits is the number of decimal places of encoded scores.
+const scoreDigits = 4
+
+// MarshalJSON encodes the result as an object of its document's name, path
+// and metadata, and its score rounded to 4 decimal places:
+//
+//	{"name": "walden/ch1.md", "score": 0.8123, "date": "...", "dir": "walden",
+//	 "namespace": "...", "preview": "...", "length": 2810,
+//	 "entities": {"person": ["thoreau"]}, "matches": [{"start": 10, ...}],
+//	 "snippets": [{"text": "...", "start": 0, "end": 152, "matches": [...]}],
+//	 "answer": "..."}
+//
+// Empty fields are left out. The heavy or sensitive fields "content" and
+// "acl" are only included when the search's SearchOpts.Fields names them,
+// so serving results doesn't ship whole documents, or who may see them, by
+// default. Like Fields, leaving a field out of SearchOpts.Fields excludes it.
+func (r SearchResult) MarshalJSON() ([]byte, error) {
+	scale := math.Pow(10, scoreDigits)
+	out := resultJSON{Score: math.Round(r.Score*scale) / scale, Matches: r.Matches, Snippets: r.Snippets, Answer: r.Answer}
+	if doc := r.Document; doc != nil {
+		out.Name, out.Date, out.Dir, out.Namespace = doc.Name, doc.Date, doc.Dir, doc.Namespace
+		out.Preview, out.Length, out.ExpiresAt, out.Entities = doc.Preview, doc.Length, doc.ExpiresAt, doc.Entities
+		if slices.Contains(r.fields, "content") {
+			out.Content = doc.Content
+		}
+		if slices.Contains(r.fields, "acl") {
+			out.ACL = doc.ACL
+		}
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestResultJSON(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Date: "2021-03-01", Preview: "the pond...", Content: "the pond in winter", ACL: []string{"alice"}},
+		Document{Name: "city.md", Content: "the city in summer"},
+	), DocOpts{})
+
+	results, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 5, Principal: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(SearchResponse{Query: "winter", Results: results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Results []map[string]any `json:"results"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got := decoded.Results[0]
+	if got["name"] != "pond.md" || got["date"] != "2021-03-01" || got["preview"] != "the pond..." {
+		t.Errorf("expected the document's metadata, got %s", data)
+	}
+	if _, ok := got["content"]; ok || strings.Contains(string(data), "alice") {
+		t.Errorf("expected no content or ACL by default, got %s", data)
+	}
+	if score := got["score"].(float64); math.Abs(score*1e4-math.Round(score*1e4)) > 1e-6 {
+		t.Errorf("expected the score rounded to 4 places, got %v", score)
+	}
+
+	results, _ = index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 5, Principal: "alice", Fields: []string{"content"}})
+	data, _ = json.Marshal(results[0])
+	if !strings.Contains(string(data), `"content":"the pond in winter"`) || strings.Contains(string(data), "date") {
+		t.Errorf("expected only the requested content, got %s", data)
+	}
+}
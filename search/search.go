@@ -1,26 +1,76 @@
 package search
 
 import (
-	"container/heap"
+	"context"
+	"errors"
 	"math"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 /*
 Index: {docs, tMap:{term: TermFreq:{idf, tfMap:{doc1: tf1, doc2: tf2, ...}}}}
+
+Searching an Index doesn't modify it, so it's safe to search from any
+number of goroutines. Only AddDocument, RemoveDocument, UpdateDocument and
+Close modify an index in place, and they mustn't run while anything else
+uses it. To change an index while it's being searched, either serve it
+through an IndexManager, which swaps in changed copies of it, or wrap it in
+a SyncIndex, which changes it in place between searches.
 */
 type Index struct {
-	TMap       map[string]TermFreq `json:"t_map"` // term map
+	tmap       map[string]TermFreq // term map
 	docs       map[string]Document
 	normalizer Normalizer
-	compressed bool
+	expander   *expander
+	entities   EntityExtractor
+	fields     map[string]bool // entity kinds that can be queried as field:value
+	storage    StorageOpts
+	load       LoadOpts // where the documents were loaded from, for Content
+	ngrams     ngramRange
+	workers    int  // goroutines tokenizing documents during build, 0 for up to GOMAXPROCS
+	compact    bool // store postings compactly, see compactPostings
+	// build in segments of at most memoryBudget bytes, see buildSpilled
+	memoryBudget int64
+	spillDir     string
+	docTable     *docTable    // document IDs of compact postings
+	mapping      []byte       // the mapped file holding the postings, see FormatMapped
+	filter       *bloom       // terms in tmap, for cheap negative lookups
+	progress     ProgressFunc // build progress, if anyone's listening
+	// terms in more than stopwordRatio of the documents are dropped, or
+	// demoted by stopwordWeight if it's positive
+	stopwordRatio  float64
+	stopwordWeight float64
+	foldPlurals    bool      // the normalizer folds plurals, and so must queries
+	foldDiacritics bool      // the normalizer folds diacritics, and so must queries
+	sentenceNGrams bool      // n-grams stop at sentence and paragraph boundaries
+	positions      positions // where each word is in each document, with DocOpts.Positions
+	// names of the Analyzers of fields that don't use the normalizer; saved with the index
+	fieldAnalyzers map[string]string
+	stopWords      map[string]bool     // removed from documents and queries, leaving gaps; saved with the index
+	pruned         map[string]bool     // terms dropped as too common, which stay out as documents are added; saved with the index
+	dirs           map[string][]string // names of the documents in each directory, see indexDirs
+	report         *BuildReport        // how the index was built, with DocOpts.Report
+	limits         Limits              // caps on the work of a search
+	outliers       Outliers            // how overly long documents are indexed
+	filters        *filterCache        // the documents of recent filters, with DocOpts.FilterCache
+	transforms     []Transform         // applied to documents as they're loaded or added
+	withholdText   bool                // keep document text out of results, see DocOpts.WithholdText
+	audit          AuditFunc           // records each search, see DocOpts.Audit
+	// updates, and the documents they changed, since the index was built; see Fragmentation
+	updates, changedDocs int
+	avgTokens            float64       // mean document length, for BM25
+	buildTime            time.Duration // loading and indexing the documents, if the index was built
 }
 
 // key: Document name, value: normalized tf-idf
 type TermFreq struct {
 	Idf   float64            `json:"idf"`
 	TfMap map[string]float64 `json:"tf_map"` // key: doc name, value: tf in doc
+
+	postings []byte // TfMap in compact form, when the index has compact postings
 }
 
 // DocCount returns the number of documents in the index.
@@ -30,58 +80,460 @@ func (idx Index) DocCount() int {
 
 // TermCount returns the number of unique terms in the index.
 func (idx Index) TermCount() int {
-	return len(idx.TMap)
+	return len(idx.tmap)
+}
+
+// Terms returns an iterator over the indexed terms beginning with prefix, in
+// sorted order, with the number of documents containing each. Call it with a
+// yield function, which returns false to stop early:
+//
+//	idx.Terms("law")(func(term string, docFreq int) bool {
+//		fmt.Println(term, docFreq)
+//		return true
+//	})
+//
+// Each call sorts the matching terms afresh, so an empty prefix costs a sort
+// of the whole term map.
+func (idx *Index) Terms(prefix string) func(yield func(term string, docFreq int) bool) {
+	return func(yield func(string, int) bool) {
+		var terms []string
+		for term := range idx.tmap {
+			if strings.HasPrefix(term, prefix) {
+				terms = append(terms, term)
+			}
+		}
+		sort.Strings(terms)
+		for _, term := range terms {
+			if !yield(term, idx.docFreq(idx.tmap[term])) {
+				return
+			}
+		}
+	}
 }
 
-// Return the total number of words in all documents.
+// Return the total number of words in all documents, as counted by the analyzer.
 func (idx Index) TotalWords() int {
 	total := 0
 	for _, doc := range idx.docs {
-		total += doc.Length
+		total += doc.tokens()
 	}
 	return total
 }
 
 type SearchOpts struct {
+	// Limit is the number of results returned, the best ones kept in a
+	// bounded heap as candidates are scored; 0 returns every result
 	Limit int
-	// Future options: MinScore, SortBy, TimeOut, etc.
+	// Offset skips the first Offset results, to page through them: the
+	// third page of ten is Offset 20, Limit 10.
+	Offset int
+	// Reranker, if set, rescores the top RerankDepth lexical results (default 100) before Limit is applied.
+	Reranker    Reranker
+	RerankDepth int
+	// Question strips question scaffolding ("what is", "how do I") and stopwords from the
+	// query and multiplies the weight of the remaining content words by QuestionBoost (default 2).
+	Question      bool
+	QuestionBoost float64
+	// Summarize replaces each result's Preview with a query-specific summary from
+	// Summarizer, or from the index's SentenceSummarizer if Summarizer is nil.
+	Summarize  bool
+	Summarizer Summarizer
+	// Concurrency is the number of goroutines that score candidates. 0 uses up to
+	// GOMAXPROCS goroutines when there are enough candidates to be worth it; 1 scores serially.
+	Concurrency int
+	// MinScore drops results whose lexical score is below it, before any reranking.
+	MinScore float64
+	// Highlight sets the Matches of each result: the byte offsets of the query
+	// words in its original content. See MarkHTML.
+	Highlight bool
+	// SnippetCount, if positive, sets up to that many Snippets of each
+	// result: fragments of its content of about SnippetLength bytes
+	// (default 160) around the query words, the ones matching the most
+	// words first, so a narrow screen can ask for one short snippet and a
+	// wide one for three longer ones from the same index. With
+	// MergeSnippets, matches close enough for their snippets to overlap or
+	// touch share one longer snippet rather than each getting their own.
+	SnippetCount  int
+	SnippetLength int
+	MergeSnippets bool
+	// Answerer, if set, extracts an Answer for each result from the passage
+	// of its content of about PassageLength bytes (default 600) that best
+	// matches the query; see Answerer. An error it returns fails the search.
+	Answerer      Answerer
+	PassageLength int
+	// HalfLife, if positive, decays the term frequencies of each document
+	// by its age, halving them every HalfLife, so recent documents rank
+	// higher. Ages are taken from Document.Date at DecayFrom (default now);
+	// documents without a parseable date aren't decayed. The decay is
+	// applied when scoring, so the index itself never changes.
+	HalfLife  time.Duration
+	DecayFrom time.Time
+	// Namespace, if set, restricts results to the documents of that
+	// namespace. Documents the index wasn't loaded with are never in one.
+	// Term statistics are shared by all namespaces, so the other namespaces
+	// affect scores, but never which documents are returned.
+	Namespace string
+	// Rewriters are applied in order to the parsed query before it's run,
+	// to apply domain rules such as expanding product codes. Field values
+	// they add should be normalized as the index normalizes documents.
+	Rewriters []func(Query) Query
+	// Fields, if set, names the stored fields populated on each result's
+	// Document, as in its JSON: "date", "preview", "length", "content",
+	// "entities", "namespace", "token_count", "dir", "acl" or "expires_at". The name is always set.
+	// Leaving out the content of results that are only listed saves copying
+	// and serializing it.
+	Fields []string
+	// Dirs, if set, restricts results to the documents in these directories
+	// or beneath them, as in Document.Dir: "philosophy" includes
+	// "philosophy/stoics". Only those documents are scored.
+	Dirs []string
+	// Principal is the user the search is made for, and Roles the roles or
+	// groups they have. Documents with an ACL are only candidates if it
+	// lists the principal or one of the roles, so they're neither scored
+	// nor returned, previews and all, to anyone else. Documents without an
+	// ACL are visible to everyone.
+	Principal string
+	Roles     []string
+
+	// Ranking is the function documents are scored by, RankTFIDF by
+	// default, and BM25 tunes RankBM25. Reranking, decay and MinScore
+	// apply to either.
+	Ranking Ranking
+	BM25    BM25
+	// Intents, if set, recognize structured fragments of the query, such
+	// as "after:2022" or "ext:md" with DefaultIntents, and turn them into
+	// filters on the results; see Intent
+	Intents Intents
+
+	// idfs, if set, replace the idfs of the index, as a MultiIndex's shared
+	// table does
+	idfs map[string]float64
+	// filters are those of intents already taken out of the query, as they
+	// are for SearchFallback's relaxed queries
+	filters []intentFilter
+	// Future options: SortBy, TimeOut, etc.
+}
+
+// Search returns an ordering of the documents based on the search terms. It
+// stops scoring and returns ctx's error if ctx is done first.
+func (idx Index) Search(ctx context.Context, terms []string, opts SearchOpts) ([]SearchResult, error) {
+	start := time.Now()
+	results, err := idx.search(ctx, terms, opts, nil)
+	return idx.audited(start, terms, opts, results, err)
+}
+
+// Refine searches only the documents of previous results, for a "search
+// within these results" box. The results are the previous documents that
+// match terms, scored by terms alone; pass the earlier query's terms along
+// with the new ones to score by both.
+func (idx Index) Refine(ctx context.Context, previous []SearchResult, terms []string, opts SearchOpts) ([]SearchResult, error) {
+	start := time.Now()
+	within := make(map[string]bool, len(previous))
+	for _, r := range previous {
+		within[r.Name] = true
+	}
+	results, err := idx.search(ctx, terms, opts, within)
+	return idx.audited(start, terms, opts, results, err)
 }
 
-// Search returns an ordering of the documents based on the search terms
-func (idx Index) Search(terms []string, opts SearchOpts) ([]SearchResult, error) {
-	queryTerms := buildNGrams(terms)
+// search searches the documents in within, or all of them if within is nil.
+func (idx Index) search(ctx context.Context, terms []string, opts SearchOpts, within map[string]bool) ([]SearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkResultFields(opts.Fields); err != nil {
+		return nil, err
+	}
+	if err := idx.checkWithheld(opts); err != nil {
+		return nil, err
+	}
+	if opts.Limit <= 0 && idx.limits.MaxResults > 0 {
+		// an unlimited search gets the results up to the cap, and none past it
+		if opts.Offset >= idx.limits.MaxResults {
+			return nil, nil
+		}
+		opts.Limit = idx.limits.MaxResults - max(opts.Offset, 0)
+	}
+	if err := checkLimit("results", idx.limits.MaxResults, opts.candidateLimit()); err != nil {
+		return nil, err
+	}
+	if opts.Ranking == RankBM25 && len(idx.docs) == 0 && len(idx.tmap) > 0 {
+		return nil, errors.New("BM25 needs the lengths of the stored documents")
+	}
+	if len(opts.Dirs) > 0 {
+		within = idx.scope(opts.Dirs, within)
+	}
+	terms, filters := opts.Intents.extract(cleanTerms(terms))
+	filters = append(filters, opts.filters...)
+	q, queryTerms := idx.analyzeQuery(terms, opts)
+	terms = q.Terms
+	// field terms are only among the query terms without free text
+	nterms := len(queryTerms)
+	if len(terms) > 0 {
+		nterms += len(q.Fields)
+	}
+	if err := checkLimit("terms", idx.limits.MaxTerms, nterms); err != nil {
+		return nil, err
+	}
+	queryTerms = idx.resolve(queryTerms, opts.idfs)
+
+	s := getScratch()
+	idx.candidates(s.candidates, q, queryTerms, within)
+	if err := checkLimit("candidates", idx.limits.MaxCandidates, len(s.candidates)); err != nil {
+		s.release()
+		return nil, err
+	}
+	if opts.Namespace != "" {
+		for name := range s.candidates {
+			if idx.docs[name].Namespace != opts.Namespace {
+				delete(s.candidates, name)
+			}
+		}
+	}
+	now := time.Now()
+	for name := range s.candidates {
+		if doc := idx.docs[name]; !doc.visibleTo(opts.Principal, opts.Roles) || doc.expired(now) {
+			delete(s.candidates, name)
+		}
+	}
+	for _, filter := range filters {
+		keep := filter.keep
+		if idx.filters != nil {
+			docs := idx.filters.get(filter.key, func() map[string]bool { return idx.filterDocs(filter.keep) })
+			keep = func(doc Document) bool { return docs[doc.Name] }
+		}
+		for name := range s.candidates {
+			if !keep(idx.docs[name]) {
+				delete(s.candidates, name)
+			}
+		}
+	}
+	if idx.positions != nil {
+		for _, phrase := range q.Phrases {
+			docs := idx.filters.get(phraseKey(phrase), func() map[string]bool { return idx.phraseDocs(phrase) })
+			for name := range s.candidates {
+				if !docs[name] {
+					delete(s.candidates, name)
+				}
+			}
+		}
+	}
 
-	// collect all docs containing at least one term
-	candidates := make(map[string]bool)
-	for _, term := range queryTerms {
-		if entry, ok := idx.TMap[term]; ok {
-			for docName := range entry.TfMap {
+	sc := opts.scoring(&idx, q, queryTerms)
+	h := idx.topResults(ctx, s, sc, opts.concurrency(len(s.candidates)))
+	s.release()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(h, func(i, j int) bool {
+		return ranksAbove(h[i], h[j])
+	})
+
+	results := []SearchResult(h)
+	if opts.Reranker != nil {
+		var err error
+		if results, err = opts.rerank(terms, results); err != nil {
+			return nil, err
+		}
+	}
+	results = results[min(max(opts.Offset, 0), len(results)):]
+	if opts.Summarize || opts.Summarizer != nil {
+		opts.summarize(&idx, terms, results)
+	}
+	if opts.Highlight {
+		idx.highlight(terms, results)
+	}
+	if opts.SnippetCount > 0 {
+		idx.snippets(terms, results, opts)
+	}
+	if opts.Answerer != nil {
+		if err := idx.answer(terms, results, opts); err != nil {
+			return nil, err
+		}
+	}
+	if idx.withholdText {
+		withholdText(results)
+	}
+	if opts.Fields != nil {
+		selectFields(results, opts.Fields)
+	}
+	return results, nil
+}
+
+// analyzeQuery parses terms, applies the rewriters of opts and returns the
+// query with its unresolved query terms.
+func (idx Index) analyzeQuery(terms []string, opts SearchOpts) (Query, []queryTerm) {
+	q := idx.ParseQuery(terms)
+	for _, rewrite := range opts.Rewriters {
+		q = rewrite(q)
+	}
+	queryTerms := idx.queryTerms(q.Terms, opts)
+	// field terms filter; they only rank when there's no free text to rank by
+	if len(q.Terms) == 0 {
+		for _, ft := range q.Fields {
+			queryTerms = append(queryTerms, queryTerm{text: fieldTerm(ft.Field, ft.Value), boost: 1})
+		}
+	}
+	return q, queryTerms
+}
+
+// scoring returns how the candidates of q are scored and kept.
+func (opts SearchOpts) scoring(idx *Index, q Query, queryTerms []queryTerm) scoring {
+	return scoring{
+		queryTerms: queryTerms,
+		// candidates of a field query matched every filter, even if no term scored
+		keepZero: len(q.Fields) > 0 || q.Match != nil,
+		minScore: opts.MinScore,
+		limit:    opts.candidateLimit(),
+		decay:    opts.decay(),
+		bm25:     opts.bm25(idx, queryTerms),
+	}
+}
+
+// candidates collects the docs containing at least one query term, restricted
+// to the docs matching every field term of the query, and to those in within
+// unless it's nil. The candidates of a boolean query are the docs matching
+// it.
+func (idx Index) candidates(candidates map[string]bool, q Query, queryTerms []queryTerm, within map[string]bool) {
+	if q.Match != nil {
+		matching := idx.filters.get(boolKey(q.Match), func() map[string]bool { return idx.boolDocs(q.Match) })
+		for docName := range matching {
+			if within == nil || within[docName] {
+				candidates[docName] = true
+			}
+		}
+		return
+	}
+	if len(q.Fields) > 0 {
+		matching := idx.filters.get(fieldsKey(q.Fields), func() map[string]bool { return idx.fieldDocs(q.Fields) })
+		for docName := range matching {
+			if within == nil || within[docName] {
 				candidates[docName] = true
 			}
 		}
+		return
 	}
 
-	h := &resultHeap{}
-	heap.Init(h)
+	if within != nil {
+		// probe the postings for each of the documents rather than walk them
+		for docName := range within {
+			for _, qt := range queryTerms {
+				if _, ok := qt.tfs[docName]; ok {
+					candidates[docName] = true
+					break
+				}
+			}
+		}
+		return
+	}
+	for _, qt := range queryTerms {
+		for docName := range qt.tfs {
+			candidates[docName] = true
+		}
+	}
+}
 
-	for name := range candidates {
-		doc := idx.docs[name]
-		sr := idx.docScore(terms, &doc)
-		if sr.Score > 0 {
-			if h.Len() < opts.Limit {
-				heap.Push(h, sr)
-			} else if sr.Score > (*h)[0].Score {
-				heap.Pop(h)
-				heap.Push(h, sr)
+// fieldDocs returns the names of the documents matching every field term.
+func (idx Index) fieldDocs(fields []FieldTerm) map[string]bool {
+	docs := make(map[string]bool)
+	for i, ft := range fields {
+		postings := idx.postings(idx.tmap[fieldTerm(ft.Field, ft.Value)])
+		if i == 0 {
+			for docName := range postings {
+				docs[docName] = true
+			}
+			continue
+		}
+		for docName := range docs {
+			if _, ok := postings[docName]; !ok {
+				delete(docs, docName)
 			}
 		}
 	}
+	return docs
+}
 
-	sort.Slice(*h, func(i, j int) bool {
-		return (*h)[i].Score > (*h)[j].Score
-	})
+// queryTerm is a term looked up in the term map, with a multiplier for its weight in the score.
+type queryTerm struct {
+	text  string
+	boost float64
+
+	// set by resolve
+	tfs    map[string]float64 // postings
+	logIdf float64
+	norm   float64 // L2 norm of the term's tf-idf weights
+}
+
+// resolve looks the query terms up in the term map, decoding their postings
+// and computing their norms once per query rather than once per candidate.
+// Terms that aren't indexed are dropped; the term filter rules most of them
+// out without a term map lookup. The idfs of terms in idfs are taken from it.
+func (idx Index) resolve(queryTerms []queryTerm, idfs map[string]float64) []queryTerm {
+	resolved := queryTerms[:0]
+	seen := make(map[string]queryTerm, len(queryTerms))
+	for _, qt := range queryTerms {
+		if r, ok := seen[qt.text]; ok {
+			r.boost = qt.boost
+			resolved = append(resolved, r)
+			continue
+		}
+		if !idx.filter.mayContain(qt.text) {
+			continue
+		}
+		tfreq, ok := idx.tmap[qt.text]
+		if !ok {
+			continue
+		}
+		qt.tfs = idx.postings(tfreq)
+		qt.logIdf = math.Log(tfreq.Idf)
+		if idf, ok := idfs[qt.text]; ok {
+			qt.logIdf = math.Log(idf)
+		}
+		normSum := 0.0
+		for _, tf := range qt.tfs {
+			normSum += (qt.logIdf * tf) * (qt.logIdf * tf)
+		}
+		qt.norm = 1.0
+		if normSum != 0 {
+			qt.norm = math.Sqrt(normSum)
+		}
+		seen[qt.text] = qt
+		resolved = append(resolved, qt)
+	}
+	return resolved
+}
+
+// queryTerms lowercases the search terms and expands them into the n-grams and
+// dictionary expansions that are looked up in the term map.
+func (idx Index) queryTerms(terms []string, opts SearchOpts) []queryTerm {
+	words := idx.Analyze(strings.Join(terms, " "))
+	if opts.Question {
+		return idx.questionTerms(words, opts.questionBoost())
+	}
+	return withBoost(append(idx.ngramTerms(words), idx.expander.expand(words)...), 1)
+}
+
+// Analyze returns the words the index makes of text: normalized by its
+// analyzer, plural folding included, and split on whitespace. Documents and
+// queries both go through it, so a query word matches wherever the same
+// word, however it's cased or punctuated, was indexed. N-grams and stop
+// word gaps are formed from these words.
+func (idx Index) Analyze(text string) []string {
+	return appendWords(nil, idx.normalizer(text))
+}
+
+// queryWord analyzes a single query word, as Analyze does.
+func (idx Index) queryWord(term string) string {
+	return strings.Join(idx.Analyze(term), " ")
+}
 
-	return *h, nil
+// withBoost converts terms into query terms sharing the same boost.
+func withBoost(terms []string, boost float64) []queryTerm {
+	qts := make([]queryTerm, len(terms))
+	for i, term := range terms {
+		qts[i] = queryTerm{text: term, boost: boost}
+	}
+	return qts
 }
 
 // ngrams generates n-grams from a slice of words.
@@ -97,40 +549,235 @@ func ngrams(words []string, n int) []string {
 	return ngrams
 }
 
-// buildNGrams builds bigrams and trigrams from the content and appends them to the original words.
-func buildNGrams(content []string) []string {
-	bigrams := ngrams(content, 2)
-	trigrams := ngrams(content, 3)
-	content = append(content, bigrams...)
-	content = append(content, trigrams...)
-	return content
+// ngramRange is the range of n-gram lengths that are indexed and searched.
+type ngramRange struct {
+	min, max int
+}
+
+// defaultNGrams indexes words, bigrams and trigrams.
+var defaultNGrams = ngramRange{1, 3}
+
+// terms returns the n-grams of words for every n in the range, shortest first.
+func (r ngramRange) terms(words []string) []string {
+	var terms []string
+	for n := r.min; n <= r.max; n++ {
+		terms = append(terms, ngrams(words, n)...)
+	}
+	return terms
 }
 
-// build the search index from the documents
-func (idx *Index) build() {
-	// build the term map
-	idx.TMap = make(map[string]TermFreq)
+// build the search index from the documents, stopping early if ctx is done
+func (idx *Index) build(ctx context.Context) error {
+	if idx.memoryBudget > 0 {
+		if err := idx.buildSpilled(ctx); err != nil {
+			return err
+		}
+		idx.indexPositions()
+		return nil
+	}
+
+	// build the term map; each worker counts the terms of every workers'th
+	// document into its own map, and the maps are merged at the end
+	docs := make([]Document, 0, len(idx.docs))
 	for _, doc := range idx.docs {
-		text := idx.normalizer(doc.Content)
-		words := buildNGrams(strings.Fields(text))
-		for _, word := range words {
-			if _, ok := idx.TMap[word]; !ok {
-				idx.TMap[word] = TermFreq{TfMap: make(map[string]float64)}
+		docs = append(docs, doc)
+	}
+	workers := idx.buildWorkers(len(docs))
+	partials := make([]map[string]TermFreq, workers)
+	tokenizing := idx.startPhase(PhaseTokenize, len(docs))
+	var wg sync.WaitGroup
+	for w := range partials {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// terms are assembled in the tokenizer's buffer and only
+			// allocated the first time they're seen
+			tmap := make(map[string]TermFreq)
+			var tok tokenizer
+			for i := w; i < len(docs) && ctx.Err() == nil; i += workers {
+				idx.indexDoc(&tok, tmap, &docs[i])
+				tokenizing.add(1)
 			}
-			idx.TMap[word].TfMap[doc.Name] += 1.0 / float64(doc.Length)
+			partials[w] = tmap
+		}(w)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tokenizing.finish()
+	for _, doc := range docs {
+		idx.docs[doc.Name] = doc
+	}
+
+	merging := idx.startPhase(PhasePostings, 0)
+	idx.tmap = partials[0]
+	merging.add(len(idx.tmap))
+	for _, tmap := range partials[1:] {
+		mergeTermMaps(idx.tmap, tmap)
+		merging.add(len(tmap))
+	}
+	merging.finish()
+	idx.prune()
+	idx.indexPositions()
+	return nil
+}
+
+// mergeTermMaps adds the postings of src to dst. The maps must have been
+// built from different documents.
+func mergeTermMaps(dst, src map[string]TermFreq) {
+	for term, tfreq := range src {
+		existing, ok := dst[term]
+		if !ok {
+			dst[term] = tfreq
+			continue
+		}
+		for name, tf := range tfreq.TfMap {
+			existing.TfMap[name] = tf
+		}
+	}
+}
+
+// prune calculates the idf of each term and drops the common ones, then
+// prepares the finished term map for searching.
+func (idx *Index) prune() {
+	weighing := idx.startPhase(PhaseIDF, len(idx.tmap))
+	for term, tfreq := range idx.tmap {
+		if tfreq, keep := idx.weigh(term, tfreq); keep {
+			idx.tmap[term] = tfreq
+		} else {
+			delete(idx.tmap, term)
 		}
+		weighing.add(1)
+	}
+	weighing.finish()
+	if idx.compact {
+		idx.compactPostings()
 	}
+	idx.filter = newBloom(idx.tmap)
+	idx.avgTokens = idx.meanTokens()
+}
 
-	// calculate the idf for each term
-	for term, tf := range idx.TMap {
-		tfreq := idx.TMap[term]
-		tfreq.Idf = float64(len(idx.docs)) / float64(len(tf.TfMap)) // always >= 1
-		idx.TMap[term] = tfreq
+// indexDoc adds the postings of doc to tmap, sets its TokenCount, and
+// returns the approximate number of bytes they added to it.
+// Postings hold term counts until weigh turns them into term frequencies.
+func (idx *Index) indexDoc(tok *tokenizer, tmap map[string]TermFreq, doc *Document) int {
+	size := 0
+	name := doc.Name
+	addPosting := func(term []byte) { size += addPosting(tmap, term, name) }
 
-		if 1/tfreq.Idf >= idx.maxThreshold() {
-			delete(idx.TMap, term)
+	words, bounds := idx.docWords(tok, doc)
+	doc.TokenCount = len(words)
+	tok.terms(addPosting, idx.expander.expand(words)...)
+	emit := addPosting
+	if idx.stopWords != nil {
+		idx.gapStopWords(words)
+		emit = func(term []byte) {
+			if !isGapped(term) {
+				addPosting(term)
+			}
 		}
 	}
+	tok.ngrams(words, bounds, idx.ngrams, emit)
+	for kind, values := range doc.Entities {
+		for _, value := range values {
+			tok.terms(addPosting, fieldTerm(kind, value))
+		}
+	}
+	return size
+}
+
+// docWords returns the words of doc as they're indexed, before stop words
+// are gapped, with the sentence bounds of SentenceNGrams. They're valid
+// until the tokenizer's next use.
+func (idx *Index) docWords(tok *tokenizer, doc *Document) ([]string, []int) {
+	var words []string
+	var bounds []int
+	if idx.sentenceNGrams {
+		words, bounds = tok.sentences(doc.Content, idx.normalizer)
+	} else {
+		words = tok.split(idx.normalizer(doc.Content))
+	}
+	return idx.outliers.truncate(words, bounds)
+}
+
+// approximate memory used by a term map entry and a posting
+const (
+	termOverhead    = 96
+	postingOverhead = 48
+)
+
+// addPosting counts an occurrence of term in docName and returns the
+// approximate number of bytes that added to tmap. The term is copied out of
+// the buffer only when it's new to the map.
+func addPosting(tmap map[string]TermFreq, term []byte, docName string) int {
+	size := 0
+	tfreq, ok := tmap[string(term)]
+	if !ok {
+		tfreq = TermFreq{TfMap: make(map[string]float64)}
+		tmap[string(term)] = tfreq
+		size += termOverhead + len(term)
+	}
+	if _, ok := tfreq.TfMap[docName]; !ok {
+		size += postingOverhead
+	}
+	tfreq.TfMap[docName]++
+	return size
+}
+
+// weigh turns the term counts of a term's postings into term frequencies and
+// sets its idf, and reports whether the term is rare enough to keep. A tf is
+// always computed as count/length, however the index was built, so equal
+// indexes hold bit-identical frequencies and serialize identically.
+func (idx *Index) weigh(term string, tfreq TermFreq) (TermFreq, bool) {
+	for name, count := range tfreq.TfMap {
+		tfreq.TfMap[name] = count / float64(idx.docs[name].tokens())
+	}
+	return idx.reweigh(term, tfreq)
+}
+
+// reweigh sets the idf of a term whose postings hold term frequencies, and
+// reports whether it's rare enough to keep. A term that's too common is
+// recorded as pruned, and stays pruned: its postings are gone, so later
+// documents alone would give it an idf it never had.
+func (idx *Index) reweigh(term string, tfreq TermFreq) (TermFreq, bool) {
+	tfreq.Idf = float64(len(idx.docs)) / float64(len(tfreq.TfMap)) // always >= 1
+	// field terms are filters and must survive pruning even when they're common
+	if isFieldTerm(term) {
+		return tfreq, true
+	}
+	if idx.pruned[term] || 1/tfreq.Idf >= idx.maxThreshold() {
+		idx.markPruned(term)
+		return tfreq, false
+	}
+	if idx.stopwordRatio > 0 && 1/tfreq.Idf > idx.stopwordRatio {
+		if idx.stopwordWeight <= 0 {
+			idx.markPruned(term)
+			return tfreq, false
+		}
+		// scales the term's log idf, and so its weight in scores
+		tfreq.Idf = math.Pow(tfreq.Idf, idx.stopwordWeight)
+	}
+	return tfreq, true
+}
+
+// markPruned records term as pruned as too common.
+func (idx *Index) markPruned(term string) {
+	if idx.pruned == nil {
+		idx.pruned = make(map[string]bool)
+	}
+	idx.pruned[term] = true
+}
+
+// prunedList returns the terms pruned as too common in sorted order, for
+// saving.
+func (idx *Index) prunedList() []string {
+	terms := make([]string, 0, len(idx.pruned))
+	for term := range idx.pruned {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
 }
 
 // maxThreshold returns the maximum threshold for a term to be included in the index
@@ -143,51 +790,38 @@ func (idx Index) maxThreshold() float64 {
 	return f
 }
 
-func (idx *Index) tfNorm(term string) float64 {
-	normSum := 0.0
-	tfreq := idx.TMap[term]
-	for _, tf := range idx.TMap[term].TfMap {
-		normSum += (math.Log(tfreq.Idf) * tf) * (math.Log(tfreq.Idf) * tf)
-	}
-	if normSum == 0 {
-		return 1.0
-	}
-	return math.Sqrt(normSum)
-}
-
-func (idx *Index) tf(term, docName string) float64 {
-	return idx.TMap[term].TfMap[docName]
-}
-
 func (idx *Index) idf(term string) float64 {
-	if idx.TMap[term].Idf == 0 {
+	if idx.tmap[term].Idf == 0 {
 		return 1.0
 	}
-	return idx.TMap[term].Idf
-}
-
-func (idx *Index) tfLogIdf(term, docName string) float64 {
-	return idx.tf(term, docName) * math.Log(idx.idf(term)) / idx.tfNorm(term)
+	return idx.tmap[term].Idf
 }
 
-// docScore calculates the score of a document based on the weighted geometric mean of search terms scores
-func (idx *Index) docScore(terms []string, doc *Document) SearchResult {
+// docScore calculates the score of a document based on the weighted geometric mean of query terms scores
+func (idx *Index) docScore(queryTerms []queryTerm, docName string) float64 {
 	weightedSum := 0.0
 	weightTotal := 0.0
-	for _, term := range buildNGrams(terms) {
-		termScore := idx.tfLogIdf(strings.ToLower(term), doc.Name)
+	for _, qt := range queryTerms {
+		termScore := qt.tfs[docName] * qt.logIdf / qt.norm
 		if termScore > 0 {
-			w := math.Log(idx.idf(term))
+			w := qt.logIdf * qt.boost
 			weightedSum += w * math.Log(termScore)
 			weightTotal += w
 		}
 	}
 
-	var docScore float64
 	if weightTotal == 0 {
-		docScore = 0
-	} else {
-		docScore = math.Exp(weightedSum / weightTotal)
+		return 0
+	}
+	return math.Exp(weightedSum / weightTotal)
+}
+
+// Document returns the stored document with the given name, without its
+// Preview and Content if the index withholds text.
+func (idx Index) Document(name string) (Document, bool) {
+	doc, ok := idx.docs[name]
+	if idx.withholdText {
+		doc.Preview, doc.Content = "", ""
 	}
-	return SearchResult{Document: doc, Score: docScore}
+	return doc, ok
 }
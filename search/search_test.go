@@ -1,19 +1,23 @@
 package search
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestSearchEngine(t *testing.T) {
 	opts := DocOpts{
-		LoadPath:    "../example/docs",
-		LoadContent: true,
+		Load: LoadOpts{Path: "../example/docs", Content: true},
 	}
 
-	index := NewIndex(DefaultLoader, opts)
+	index := mustIndex(t, DefaultLoader, opts)
 	if index.DocCount() == 0 {
 		t.Fatalf("expected >0 documents, got %d", index.DocCount())
 	}
@@ -29,7 +33,7 @@ func TestSearchEngine(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		results, err := index.Search(strings.Fields(tt.query), SearchOpts{Limit: 5})
+		results, err := index.Search(context.Background(), strings.Fields(tt.query), SearchOpts{Limit: 5})
 		if err != nil {
 			t.Fatalf("search error for %q: %v", tt.query, err)
 		}
@@ -47,15 +51,14 @@ func TestSearchEngine(t *testing.T) {
 
 func TestNormalizationConsistency(t *testing.T) {
 	opts := DocOpts{
-		LoadPath:    "../example/docs",
-		LoadContent: true,
+		Load: LoadOpts{Path: "../example/docs", Content: true},
 	}
-	index := NewIndex(DefaultLoader, opts)
+	index := mustIndex(t, DefaultLoader, opts)
 
 	// Ensure normalization produces comparable scores
 	sopts := SearchOpts{Limit: 5}
-	r1, _ := index.Search(strings.Fields("freedom and law"), sopts)
-	r2, _ := index.Search(strings.Fields("moral law"), sopts)
+	r1, _ := index.Search(context.Background(), strings.Fields("freedom and law"), sopts)
+	r2, _ := index.Search(context.Background(), strings.Fields("moral law"), sopts)
 
 	if len(r1) == 0 || len(r2) == 0 {
 		t.Skip("not enough results for comparison")
@@ -69,15 +72,27 @@ func TestNormalizationConsistency(t *testing.T) {
 	}
 }
 
+func TestMinScore(t *testing.T) {
+	index := mustIndex(t, DefaultLoader, DocOpts{Load: LoadOpts{Path: "../example/docs", Content: true}})
+
+	all, _ := index.Search(context.Background(), []string{"land"}, SearchOpts{Limit: 5})
+	if len(all) < 2 {
+		t.Fatalf("expected a weak tail match for land, got %+v", all)
+	}
+	kept, _ := index.Search(context.Background(), []string{"land"}, SearchOpts{Limit: 5, MinScore: 0.5})
+	if len(kept) != 1 || kept[0].Name != "how_much_land.txt" {
+		t.Errorf("expected only how_much_land.txt above 0.5, got %+v", kept)
+	}
+}
+
 func TestSaveLoadSearch(t *testing.T) {
 	opts := DocOpts{
-		IndexPath:   "test_index.json",
-		LoadPath:    "../example/docs",
-		LoadContent: true,
+		Load:    LoadOpts{Path: "../example/docs", Content: true},
+		Storage: StorageOpts{Path: "test_index.json"},
 	}
 
 	// --- Build index
-	idx := NewIndex(DefaultLoader, opts)
+	idx := mustIndex(t, DefaultLoader, opts)
 	if idx.DocCount() == 0 {
 		t.Fatal("expected non-empty index")
 	}
@@ -91,17 +106,17 @@ func TestSaveLoadSearch(t *testing.T) {
 	}
 
 	// --- Load from disk
-	loaded := LoadIndex(DefaultLoader, opts)
+	loaded := mustLoad(t, DefaultLoader, opts)
 	if loaded.DocCount() != idx.DocCount() {
 		t.Errorf("doc count mismatch: got %d, want %d", loaded.DocCount(), idx.DocCount())
 	}
-	if len(loaded.TMap) != len(idx.TMap) {
-		t.Errorf("term map size mismatch: got %d, want %d", len(loaded.TMap), len(idx.TMap))
+	if len(loaded.tmap) != len(idx.tmap) {
+		t.Errorf("term map size mismatch: got %d, want %d", len(loaded.tmap), len(idx.tmap))
 	}
 
 	// --- Run a sample query
 	sopts := SearchOpts{Limit: 5}
-	results, err := loaded.Search([]string{"moral", "law"}, sopts)
+	results, err := loaded.Search(context.Background(), []string{"moral", "law"}, sopts)
 	if err != nil {
 		t.Fatalf("search on loaded index failed: %v", err)
 	}
@@ -118,13 +133,12 @@ func TestSaveLoadSearch(t *testing.T) {
 
 func BenchmarkBuildIndex(b *testing.B) {
 	opts := DocOpts{
-		LoadPath:    "../example/docs",
-		LoadContent: true,
+		Load: LoadOpts{Path: "../example/docs", Content: true},
 	}
 
 	for i := 0; i < b.N; i++ {
 		start := time.Now()
-		NewIndex(DefaultLoader, opts)
+		mustIndex(b, DefaultLoader, opts)
 		elapsed := time.Since(start)
 		b.ReportMetric(float64(elapsed.Milliseconds()), "ms/index")
 	}
@@ -132,10 +146,9 @@ func BenchmarkBuildIndex(b *testing.B) {
 
 func BenchmarkSearch(b *testing.B) {
 	opts := DocOpts{
-		LoadPath:    "../example/docs",
-		LoadContent: true,
+		Load: LoadOpts{Path: "../example/docs", Content: true},
 	}
-	index := NewIndex(DefaultLoader, opts)
+	index := mustIndex(b, DefaultLoader, opts)
 
 	queries := [][]string{
 		{"moral", "law"},
@@ -145,10 +158,11 @@ func BenchmarkSearch(b *testing.B) {
 		{"land"},
 	}
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		q := queries[i%len(queries)]
-		results, _ := index.Search(q, SearchOpts{Limit: 5})
+		results, _ := index.Search(context.Background(), q, SearchOpts{Limit: 5})
 		if len(results) == 0 {
 			b.Fatalf("no results for %v", q)
 		}
@@ -157,11 +171,10 @@ func BenchmarkSearch(b *testing.B) {
 
 func BenchmarkIndexSize(b *testing.B) {
 	opts := DocOpts{
-		LoadPath:    "../example/docs",
-		LoadContent: true,
-		Compressed:  true,
+		Load:    LoadOpts{Path: "../example/docs", Content: true},
+		Storage: StorageOpts{Compressed: true},
 	}
-	index := NewIndex(DefaultLoader, opts)
+	index := mustIndex(b, DefaultLoader, opts)
 
 	tmpfile := "bench_index.json.gz"
 	defer os.Remove(tmpfile)
@@ -186,3 +199,380 @@ func BenchmarkIndexSize(b *testing.B) {
 	b.ReportMetric(bytesPerTerm, "B/term")
 	b.ReportMetric(float64(elapsed.Milliseconds()), "ms/save")
 }
+
+func TestCorpusStopwords(t *testing.T) {
+	var docs []Document
+	for i, word := range strings.Fields("pond bean field town hut lake woods snow road cabin") {
+		content := "walden " + word
+		if i < 6 {
+			content = "chapter " + content
+		}
+		docs = append(docs, Document{Name: word + ".md", Content: content})
+	}
+
+	plain := mustIndex(t, memLoader(docs...), DocOpts{})
+	if _, ok := plain.tmap["chapter"]; !ok {
+		t.Fatal("expected chapter to survive the default pruning")
+	}
+	dropped := mustIndex(t, memLoader(docs...), DocOpts{StopwordRatio: 0.5})
+	if _, ok := dropped.tmap["chapter"]; ok {
+		t.Error("expected chapter to be dropped as a corpus stopword")
+	}
+	if _, ok := dropped.tmap["pond"]; !ok {
+		t.Error("expected pond to be kept")
+	}
+	demoted := mustIndex(t, memLoader(docs...), DocOpts{StopwordRatio: 0.5, StopwordWeight: 0.5})
+	want := math.Sqrt(plain.tmap["chapter"].Idf)
+	if got := demoted.tmap["chapter"].Idf; math.Abs(got-want) > 1e-12 {
+		t.Errorf("demoted idf: got %g, want %g", got, want)
+	}
+}
+
+func TestRefine(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter ice"},
+		Document{Name: "lake.md", Content: "the lake in winter"},
+		Document{Name: "field.md", Content: "the bean field in summer"},
+		Document{Name: "rink.md", Content: "skating on ice"},
+	), DocOpts{})
+
+	winter, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(winter) != 2 {
+		t.Fatalf("expected 2 winter results, got %+v", winter)
+	}
+	refined, err := index.Refine(context.Background(), winter, []string{"ice"}, SearchOpts{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refined) != 1 || refined[0].Name != "pond.md" {
+		t.Errorf("expected only pond.md, got %+v", refined)
+	}
+}
+
+func TestRewriters(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+	), DocOpts{})
+
+	legacy := func(q Query) Query {
+		for i, term := range q.Terms {
+			if strings.EqualFold(term, "lake") {
+				q.Terms[i] = "pond"
+			}
+		}
+		return q
+	}
+	results, err := index.Search(context.Background(), []string{"Lake"}, SearchOpts{Limit: 1, Rewriters: []func(Query) Query{legacy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "pond.md" {
+		t.Errorf("expected the rewritten query to find pond.md, got %+v", results)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "alice/pond.md", Content: "the pond in winter", Namespace: "alice"},
+		Document{Name: "alice/city.md", Content: "the city streets", Namespace: "alice"},
+		Document{Name: "bob/lake.md", Content: "the lake in winter", Namespace: "bob"},
+		Document{Name: "shared.md", Content: "a field in summer"},
+	), DocOpts{})
+
+	for ns, want := range map[string]string{"alice": "alice/pond.md", "bob": "bob/lake.md"} {
+		results, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10, Namespace: ns})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Name != want {
+			t.Errorf("%s: expected only %s, got %+v", ns, want, results)
+		}
+	}
+	results, _ := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10})
+	if len(results) != 2 {
+		t.Errorf("expected both namespaces without one set, got %+v", results)
+	}
+	if results, _ := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10, Namespace: "carol"}); len(results) != 0 {
+		t.Errorf("expected nothing from an unknown namespace, got %+v", results)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "ponds.md", Content: "ponds and a pond"},
+		Document{Name: "city.md", Content: "the city streets"},
+		Document{Name: "field.md", Content: "the bean field"},
+	)
+	for _, opts := range []DocOpts{{}, {CompactPostings: true}} {
+		index := mustIndex(t, docs, opts)
+		var got []string
+		index.Terms("pond")(func(term string, docFreq int) bool {
+			got = append(got, term)
+			if term == "pond" && docFreq != 2 {
+				t.Errorf("pond: got document frequency %d, want 2", docFreq)
+			}
+			return true
+		})
+		want := []string{"pond", "pond in", "pond in winter", "ponds", "ponds and", "ponds and a"}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("got terms %q, want %q", got, want)
+		}
+
+		n := 0
+		index.Terms("")(func(string, int) bool {
+			n++
+			return n < 3
+		})
+		if n != 3 {
+			t.Errorf("expected iteration to stop after 3 terms, got %d", n)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city streets"},
+	), DocOpts{})
+	stats := index.Stats()
+	if stats.Documents != 2 || stats.TotalWords != 7 || stats.AvgDocLength != 3.5 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+	// every n-gram but "the", which is in both documents and pruned
+	want := map[int]int{1: 5, 2: 5, 3: 3}
+	for n, count := range want {
+		if stats.NGrams[n] != count {
+			t.Errorf("%d-grams: got %d, want %d", n, stats.NGrams[n], count)
+		}
+	}
+	if stats.Terms != 13 || stats.BuildTime <= 0 || stats.MemoryBytes <= 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTokenCount(t *testing.T) {
+	// the dash is a word to the loader but not to the analyzer
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond — in winter"},
+		Document{Name: "city.md", Content: "the city streets"},
+	), DocOpts{})
+	doc := index.docs["pond.md"]
+	if doc.Length != 5 || doc.TokenCount != 4 {
+		t.Errorf("got length %d and token count %d, want 5 and 4", doc.Length, doc.TokenCount)
+	}
+	if tf := index.tmap["pond"].TfMap["pond.md"]; tf != 0.25 {
+		t.Errorf("got tf %g, want 1/4", tf)
+	}
+	if index.TotalWords() != 7 {
+		t.Errorf("got %d total words, want 7", index.TotalWords())
+	}
+}
+
+func TestResultFields(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Date: "2021-03-01", Preview: "the pond...", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city streets"},
+	), DocOpts{})
+	results, err := index.Search(context.Background(), []string{"pond"}, SearchOpts{Limit: 1, Fields: []string{"name", "date"}})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("got %v, %v", results, err)
+	}
+	if doc := results[0].Document; doc.Name != "pond.md" || doc.Date != "2021-03-01" || doc.Preview != "" || doc.Content != "" {
+		t.Errorf("unexpected fields %+v", doc)
+	}
+	if index.docs["pond.md"].Content == "" {
+		t.Error("selecting fields cleared the stored document")
+	}
+	if _, err := index.Search(context.Background(), []string{"pond"}, SearchOpts{Limit: 1, Fields: []string{"path"}}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "lake.md", Content: "the lake in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+		Document{Name: "field.md", Content: "the bean field"},
+	), DocOpts{Limits: Limits{MaxTerms: 6, MaxCandidates: 2, MaxResults: 10}})
+
+	if _, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10}); err != nil {
+		t.Fatalf("expected a search within the limits to run, got %v", err)
+	}
+	for _, tc := range []struct {
+		limit string
+		terms []string
+		opts  SearchOpts
+	}{
+		{"results", []string{"winter"}, SearchOpts{Limit: 11}},
+		{"terms", []string{"pond", "in", "cold", "winter"}, SearchOpts{Limit: 10}},
+		{"candidates", []string{"winter", "summer"}, SearchOpts{Limit: 10}},
+	} {
+		_, err := index.Search(context.Background(), tc.terms, tc.opts)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != tc.limit || !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("expected the %s limit to be exceeded, got %v", tc.limit, err)
+		}
+	}
+
+	capped := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "lake.md", Content: "the lake in winter"},
+		Document{Name: "woods.md", Content: "the woods in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+	), DocOpts{Limits: Limits{MaxResults: 2}})
+	if results, err := capped.Search(context.Background(), []string{"winter"}, SearchOpts{}); err != nil || len(results) != 2 {
+		t.Errorf("expected a search without a limit to return up to the cap, got %v %v", results, err)
+	}
+	if results, err := capped.Search(context.Background(), []string{"winter"}, SearchOpts{Offset: 1}); err != nil || len(results) != 1 {
+		t.Errorf("expected the offset to count towards the cap, got %v %v", results, err)
+	}
+	for _, offset := range []int{2, 5} {
+		if results, err := capped.Search(context.Background(), []string{"winter"}, SearchOpts{Offset: offset}); err != nil || len(results) != 0 {
+			t.Errorf("offset %d: expected an empty page past the cap, got %v %v", offset, results, err)
+		}
+	}
+	multi := NewMultiIndex(CalibrateNone, capped)
+	if results, err := multi.Search(context.Background(), []string{"winter"}, SearchOpts{}); err != nil || len(results) != 2 {
+		t.Errorf("expected a MultiIndex search without a limit to run, got %v %v", results, err)
+	}
+}
+
+func TestACL(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "alice/diary.md", Content: "the pond in winter", ACL: []string{"alice"}},
+		Document{Name: "staff/plan.md", Content: "the winter plan", ACL: []string{"alice", "staff"}},
+		Document{Name: "public.md", Content: "a walk in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+	), DocOpts{})
+
+	for _, tc := range []struct {
+		principal string
+		roles     []string
+		want      int
+	}{
+		{"alice", nil, 3},
+		{"bob", []string{"staff"}, 2},
+		{"bob", nil, 1},
+		{"", nil, 1},
+	} {
+		results, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10, Principal: tc.principal, Roles: tc.roles})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != tc.want {
+			t.Errorf("%s %v: expected %d results, got %+v", tc.principal, tc.roles, tc.want, results)
+		}
+	}
+
+	data, err := index.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := UnmarshalProto(data, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := loaded.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10, Principal: "bob"}); len(results) != 1 {
+		t.Errorf("expected the ACLs to be saved with the index, got %+v", results)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "a.md", Content: "winter"},
+		Document{Name: "b.md", Content: "winter in the woods"},
+		Document{Name: "c.md", Content: "a long winter by the pond in the woods"},
+		Document{Name: "d.md", Content: "the pond froze that winter and the ice was thick for weeks"},
+		Document{Name: "e.md", Content: "summer"},
+	), DocOpts{})
+
+	all, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected 4 results, got %+v", all)
+	}
+	if unlimited, _ := index.Search(context.Background(), []string{"winter"}, SearchOpts{Offset: 1}); len(unlimited) != 3 {
+		t.Errorf("expected every result after the first without a limit, got %+v", unlimited)
+	}
+	if past, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 1, Offset: math.MaxInt}); err != nil || len(past) != 0 {
+		t.Errorf("expected no results past the largest offset, got %+v %v", past, err)
+	}
+	for offset := 0; offset <= 4; offset += 2 {
+		page, err := index.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 2, Offset: offset})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := all[offset:min(offset+2, len(all))]
+		if len(page) != len(want) {
+			t.Fatalf("offset %d: expected %d results, got %+v", offset, len(want), page)
+		}
+		for i := range page {
+			if page[i].Name != want[i].Name {
+				t.Errorf("offset %d: expected %s at %d, got %s", offset, want[i].Name, i, page[i].Name)
+			}
+		}
+	}
+
+	multi := NewMultiIndex(CalibrateNone, index)
+	page, err := multi.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Name != all[2].Name {
+		t.Errorf("expected the MultiIndex to page the same way, got %+v", page)
+	}
+}
+
+// cancelAfter is a context that's canceled once its Err has been checked n times.
+type cancelAfter struct {
+	context.Context
+	n atomic.Int32
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n.Add(-1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := DocOpts{Load: LoadOpts{Path: "../example/docs", Content: true}}
+	if _, err := NewIndex(canceled, DefaultLoader, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected NewIndex to be canceled, got %v", err)
+	}
+
+	docs := make([]Document, 2500)
+	query := make([]string, 50)
+	for i := range docs {
+		docs[i] = Document{Name: fmt.Sprintf("%d.md", i), Content: fmt.Sprintf("pond%d notes", i%50)}
+	}
+	for i := range query {
+		query[i] = fmt.Sprintf("pond%d", i)
+	}
+	index := mustIndex(t, memLoader(docs...), DocOpts{})
+	if _, err := index.Search(canceled, query, SearchOpts{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled search to fail, got %v", err)
+	}
+	// canceled after the search starts, while its candidates are scored
+	for _, workers := range []int{1, 2} {
+		ctx := &cancelAfter{Context: context.Background()}
+		ctx.n.Store(1)
+		if _, err := index.Search(ctx, query, SearchOpts{Concurrency: workers}); !errors.Is(err, context.Canceled) {
+			t.Errorf("%d workers: expected the search to stop while scoring, got %v", workers, err)
+		}
+	}
+	if results, err := index.Search(context.Background(), query, SearchOpts{}); err != nil || len(results) != len(docs) {
+		t.Errorf("expected every document, got %d results and %v", len(results), err)
+	}
+}
@@ -0,0 +1,137 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Snippet is a fragment of a result's content around matches of the query
+// words, to show in place of its Preview.
+type Snippet struct {
+	Text  string `json:"text"`
+	Start int    `json:"start"` // byte offset of Text in the content; > 0 if it's cut at the start
+	End   int    `json:"end"`   // byte offset of the end of Text; < len(content) if it's cut at the end
+	// Matches are the matches in Text, with offsets into Text, so that
+	// MarkHTML(s.Text, s.Matches) highlights them
+	Matches []Match `json:"matches,omitempty"`
+}
+
+// defaultSnippetLength is the length of snippets, in bytes, if
+// SearchOpts.SnippetLength isn't set: two lines or so of a results page.
+const defaultSnippetLength = 160
+
+// snippets sets the snippets of each result, as opts.SnippetCount,
+// SnippetLength and MergeSnippets say.
+func (idx *Index) snippets(terms []string, results []SearchResult, opts SearchOpts) {
+	words := idx.queryWords(terms)
+	length := opts.SnippetLength
+	if length <= 0 {
+		length = defaultSnippetLength
+	}
+	for i := range results {
+		text := results[i].Content
+		results[i].Snippets = snippets(text, idx.matches(text, words), length, opts.SnippetCount, opts.MergeSnippets)
+	}
+}
+
+// snippets returns up to count fragments of text of about length bytes,
+// each around one of matches, cut at word boundaries. Fragments with more
+// distinct words matched are chosen first, then more matches, then earlier
+// ones, and never overlap; they're returned in the order of text. With
+// merge, the fragments of matches close enough to overlap or touch are
+// joined into one, which may be longer than length.
+func snippets(text string, matches []Match, length, count int, merge bool) []Snippet {
+	var spans [][2]int
+	for _, m := range matches {
+		start, end := window(text, m, length)
+		if n := len(spans); merge && n > 0 && strings.TrimSpace(text[spans[n-1][1]:max(start, spans[n-1][1])]) == "" {
+			spans[n-1][1] = max(spans[n-1][1], end)
+			continue
+		}
+		spans = append(spans, [2]int{start, end})
+	}
+
+	type candidate struct {
+		Snippet
+		words int
+	}
+	candidates := make([]candidate, len(spans))
+	for i, span := range spans {
+		c := candidate{Snippet: Snippet{Text: text[span[0]:span[1]], Start: span[0], End: span[1]}}
+		seen := make(map[string]bool)
+		for _, m := range matches {
+			if m.Start >= span[0] && m.End <= span[1] {
+				c.Matches = append(c.Matches, Match{Start: m.Start - span[0], End: m.End - span[0], Word: m.Word})
+				seen[m.Word] = true
+			}
+		}
+		c.words = len(seen)
+		candidates[i] = c
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].words != candidates[j].words {
+			return candidates[i].words > candidates[j].words
+		}
+		return len(candidates[i].Matches) > len(candidates[j].Matches)
+	})
+
+	var chosen []Snippet
+	for _, c := range candidates {
+		if len(chosen) == count {
+			break
+		}
+		overlaps := false
+		for _, s := range chosen {
+			if c.Start < s.End && s.Start < c.End {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			chosen = append(chosen, c.Snippet)
+		}
+	}
+	sort.Slice(chosen, func(i, j int) bool { return chosen[i].Start < chosen[j].Start })
+	return chosen
+}
+
+// window returns the bounds of a fragment of text of at most length bytes
+// centered on m, or of m alone if it's longer, cut at word boundaries.
+func window(text string, m Match, length int) (int, int) {
+	start, end := m.Start, m.End
+	if pad := length - (end - start); pad > 0 {
+		start = max(0, start-pad/2)
+		end = min(len(text), start+length)
+		start = max(0, end-length)
+	}
+	// don't cut words in two, nor runes
+	if start > 0 && !unicode.IsSpace(rune(text[start-1])) {
+		if i := strings.IndexFunc(text[start:m.Start], unicode.IsSpace); i >= 0 {
+			start += i
+		} else {
+			start = m.Start
+		}
+	}
+	for start < m.Start && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	if end < len(text) && !unicode.IsSpace(rune(text[end])) {
+		if i := strings.LastIndexFunc(text[m.End:end], unicode.IsSpace); i >= 0 {
+			end = m.End + i
+		} else {
+			end = m.End
+		}
+	}
+	for end > m.End && end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	for start < m.Start && unicode.IsSpace(rune(text[start])) {
+		start++
+	}
+	for end > m.End && unicode.IsSpace(rune(text[end-1])) {
+		end--
+	}
+	return start, end
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSnippets(t *testing.T) {
+	filler := strings.Repeat("and so on ", 20)
+	content := "The pond " + filler + "froze in winter, the pond " + filler + "thawed in spring."
+	index := mustIndex(t, memLoader(
+		Document{Name: "walden.md", Content: content},
+		Document{Name: "city.md", Content: "the city streets"},
+	), DocOpts{})
+	search := func(opts SearchOpts) []Snippet {
+		t.Helper()
+		opts.Limit = 1
+		results, err := index.Search(context.Background(), []string{"pond", "winter"}, opts)
+		if err != nil || len(results) != 1 {
+			t.Fatalf("expected walden.md, got %+v (%v)", results, err)
+		}
+		return results[0].Snippets
+	}
+
+	// the snippet matching both words is chosen first, but they're returned in order
+	snippets := search(SearchOpts{SnippetCount: 2, SnippetLength: 40})
+	if len(snippets) != 2 {
+		t.Fatalf("expected 2 snippets, got %+v", snippets)
+	}
+	if !strings.Contains(snippets[1].Text, "winter") || snippets[0].Start > snippets[1].Start {
+		t.Errorf("unexpected snippets %+v", snippets)
+	}
+	for _, s := range snippets {
+		if len(s.Text) > 40 || s.Text != content[s.Start:s.End] || strings.HasPrefix(s.Text, " ") {
+			t.Errorf("unexpected snippet %+v", s)
+		}
+		for _, m := range s.Matches {
+			if m.Word != strings.ToLower(s.Text[m.Start:m.End]) {
+				t.Errorf("match %+v is %q in %q", m, s.Text[m.Start:m.End], s.Text)
+			}
+		}
+	}
+	if one := search(SearchOpts{SnippetCount: 1, SnippetLength: 40}); len(one) != 1 || len(one[0].Matches) != 2 {
+		t.Errorf("expected the snippet with both words, got %+v", one)
+	}
+
+	// the snippets of "winter" and the second "pond" overlap: apart, only
+	// one is kept; merged, they're one
+	apart := search(SearchOpts{SnippetCount: 3, SnippetLength: 16})
+	if len(apart) != 2 || len(apart[1].Matches) != 1 {
+		t.Errorf("expected 2 snippets of one match, got %+v", apart)
+	}
+	merged := search(SearchOpts{SnippetCount: 3, SnippetLength: 16, MergeSnippets: true})
+	if len(merged) != 2 || merged[1].Text != "in winter, the pond and" {
+		t.Errorf("expected a merged snippet, got %+v", merged)
+	}
+	if search(SearchOpts{}) != nil {
+		t.Error("expected no snippets by default")
+	}
+}
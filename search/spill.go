@@ -0,0 +1,254 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// buildSpilled builds the term map like build, but whenever the partial term
+// map grows past memoryBudget bytes it's written to a sorted segment file in
+// spillDir and cleared. The segments are then merged term by term, pruning and (with
+// CompactPostings) compacting each term as it's merged, so peak memory is the
+// budget plus the finished index rather than the full unpruned term map.
+func (idx *Index) buildSpilled(ctx context.Context) error {
+	names := make([]string, 0, len(idx.docs))
+	for name := range idx.docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var segments []string
+	defer func() {
+		for _, path := range segments {
+			os.Remove(path)
+		}
+	}()
+
+	tmap := make(map[string]TermFreq)
+	size := int64(0)
+	var tok tokenizer
+	tokenizing := idx.startPhase(PhaseTokenize, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		doc := idx.docs[name]
+		size += int64(idx.indexDoc(&tok, tmap, &doc))
+		idx.docs[name] = doc
+		tokenizing.add(1)
+		if size >= idx.memoryBudget {
+			path, err := writeSegment(tmap, idx.spillDir)
+			if err != nil {
+				return err
+			}
+			segments = append(segments, path)
+			tmap = make(map[string]TermFreq)
+			size = 0
+		}
+	}
+	tokenizing.finish()
+	if len(segments) == 0 {
+		// everything fit in the budget
+		idx.tmap = tmap
+		idx.prune()
+		return nil
+	}
+	if len(tmap) > 0 {
+		path, err := writeSegment(tmap, idx.spillDir)
+		if err != nil {
+			return err
+		}
+		segments = append(segments, path)
+	}
+	tmap = nil
+
+	if err := idx.mergeSegments(segments); err != nil {
+		return err
+	}
+	idx.filter = newBloom(idx.tmap)
+	idx.avgTokens = idx.meanTokens()
+	return nil
+}
+
+// A segment file is a sequence of terms in sorted order, each written as
+//
+//	uvarint len(term), term, uvarint postings,
+//	postings * (uvarint len(name), name, uvarint count)
+func writeSegment(tmap map[string]TermFreq, dir string) (string, error) {
+	f, err := os.CreateTemp(dir, "infrared-segment-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create segment: %w", err)
+	}
+	defer f.Close()
+
+	terms := make([]string, 0, len(tmap))
+	for term := range tmap {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	w := bufio.NewWriter(f)
+	var buf []byte
+	for _, term := range terms {
+		tfMap := tmap[term].TfMap
+		buf = binary.AppendUvarint(buf[:0], uint64(len(term)))
+		buf = append(buf, term...)
+		buf = binary.AppendUvarint(buf, uint64(len(tfMap)))
+		for name, count := range tfMap {
+			buf = binary.AppendUvarint(buf, uint64(len(name)))
+			buf = append(buf, name...)
+			buf = binary.AppendUvarint(buf, uint64(count))
+		}
+		if _, err := w.Write(buf); err != nil {
+			return f.Name(), fmt.Errorf("failed to write segment: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return f.Name(), fmt.Errorf("failed to write segment: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// segmentReader reads the terms of a segment file in order.
+type segmentReader struct {
+	r      *bufio.Reader
+	f      *os.File
+	term   string
+	counts map[string]float64
+	done   bool
+}
+
+func openSegment(path string) (*segmentReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment: %w", err)
+	}
+	s := &segmentReader{r: bufio.NewReader(f), f: f}
+	if err := s.next(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// next reads the next term and its postings, or sets done at the end of the segment.
+func (s *segmentReader) next() error {
+	n, err := binary.ReadUvarint(s.r)
+	if errors.Is(err, io.EOF) {
+		s.done = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read segment: %w", err)
+	}
+	term, err := s.readString(n)
+	if err != nil {
+		return err
+	}
+	postings, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return fmt.Errorf("failed to read segment: %w", err)
+	}
+	s.term, s.counts = term, make(map[string]float64, postings)
+	for i := uint64(0); i < postings; i++ {
+		n, err := binary.ReadUvarint(s.r)
+		if err != nil {
+			return fmt.Errorf("failed to read segment: %w", err)
+		}
+		name, err := s.readString(n)
+		if err != nil {
+			return err
+		}
+		count, err := binary.ReadUvarint(s.r)
+		if err != nil {
+			return fmt.Errorf("failed to read segment: %w", err)
+		}
+		s.counts[name] = float64(count)
+	}
+	return nil
+}
+
+func (s *segmentReader) readString(n uint64) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(s.r, b); err != nil {
+		return "", fmt.Errorf("failed to read segment: %w", err)
+	}
+	return string(b), nil
+}
+
+// mergeSegments merges sorted segment files into the term map. A document
+// is only ever in one segment, so merging a term concatenates its postings.
+func (idx *Index) mergeSegments(paths []string) error {
+	var readers []*segmentReader
+	defer func() {
+		for _, s := range readers {
+			s.f.Close()
+		}
+	}()
+	for _, path := range paths {
+		s, err := openSegment(path)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, s)
+	}
+
+	idx.tmap = make(map[string]TermFreq)
+	var table *docTable
+	var ids map[string]uint32
+	if idx.compact {
+		table, ids = idx.newDocTable()
+	}
+	// document names are shared with the stored documents rather than read per posting
+	names := make(interner, len(idx.docs))
+	for name := range idx.docs {
+		names[name] = name
+	}
+
+	// terms are weighed as they're merged, so there's no separate idf phase
+	merging := idx.startPhase(PhasePostings, 0)
+	defer merging.finish()
+	for {
+		term, found := "", false
+		for _, s := range readers {
+			if !s.done && (!found || s.term < term) {
+				term, found = s.term, true
+			}
+		}
+		if !found {
+			break
+		}
+
+		tfreq := TermFreq{TfMap: make(map[string]float64)}
+		for _, s := range readers {
+			if s.done || s.term != term {
+				continue
+			}
+			for name, count := range s.counts {
+				tfreq.TfMap[names.intern(name)] = count
+			}
+			if err := s.next(); err != nil {
+				return err
+			}
+		}
+
+		merging.add(1)
+		tfreq, keep := idx.weigh(term, tfreq)
+		if !keep {
+			continue
+		}
+		if table != nil {
+			tfreq.postings = table.encode(tfreq.TfMap, ids)
+			tfreq.TfMap = nil
+		}
+		idx.tmap[term] = tfreq
+	}
+	idx.docTable = table
+	return nil
+}
@@ -0,0 +1,39 @@
+package search
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func TestBuildSpilled(t *testing.T) {
+	opts := DocOpts{Load: LoadOpts{Path: "../example/docs", Content: true}}
+	want := mustIndex(t, DefaultLoader, opts)
+
+	for _, compact := range []bool{false, true} {
+		dir := t.TempDir()
+		opts := opts
+		opts.MemoryBudget = 64 << 10 // spills after every document
+		opts.SpillDir = dir
+		opts.CompactPostings = compact
+		got := mustIndex(t, DefaultLoader, opts)
+
+		if got.TermCount() != want.TermCount() {
+			t.Fatalf("compact=%v: got %d terms, want %d", compact, got.TermCount(), want.TermCount())
+		}
+		for term, tfreq := range want.tmap {
+			postings := got.postings(got.tmap[term])
+			if got.tmap[term].Idf != tfreq.Idf || len(postings) != len(tfreq.TfMap) {
+				t.Fatalf("compact=%v: term %q differs", compact, term)
+			}
+			for name, tf := range tfreq.TfMap {
+				if math.Abs(postings[name]-tf) > 1e-12 {
+					t.Fatalf("compact=%v: tf of %q in %s: got %g, want %g", compact, term, name, postings[name], tf)
+				}
+			}
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("expected segment files to be removed, found %d", len(entries))
+		}
+	}
+}
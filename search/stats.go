@@ -0,0 +1,75 @@
+package search
+
+import "time"
+
+// Stats is a snapshot of an index's corpus statistics.
+type Stats struct {
+	Documents    int     `json:"documents"`
+	Terms        int     `json:"terms"` // unique terms, including field terms
+	TotalWords   int     `json:"total_words"`
+	AvgDocLength float64 `json:"avg_doc_length"` // in words
+	// DocLengths are percentiles of the document lengths, to spot outliers
+	DocLengths DocLengths `json:"doc_lengths"`
+	// BuildTime is how long loading and indexing the documents took; zero
+	// for an index that was read rather than built
+	BuildTime time.Duration `json:"build_time_ns"`
+	// MemoryBytes is a rough estimate of the memory held by the term map,
+	// the stored documents and any word positions
+	MemoryBytes int64 `json:"memory_bytes"`
+	// NGrams counts the terms of each n-gram length, by number of words
+	NGrams     map[int]int `json:"ngrams"`
+	FieldTerms int         `json:"field_terms"` // terms of entity fields, like person:thoreau
+}
+
+// approximate memory used by a stored document, besides its text
+const docOverhead = 160
+
+// Stats returns the statistics of the index.
+func (idx *Index) Stats() Stats {
+	stats := Stats{
+		Documents:  idx.DocCount(),
+		Terms:      idx.TermCount(),
+		TotalWords: idx.TotalWords(),
+		DocLengths: idx.docLengths(),
+		BuildTime:  idx.buildTime,
+		NGrams:     make(map[int]int),
+	}
+	if stats.Documents > 0 {
+		stats.AvgDocLength = float64(stats.TotalWords) / float64(stats.Documents)
+	}
+
+	for term, tfreq := range idx.tmap {
+		if isFieldTerm(term) {
+			stats.FieldTerms++
+		} else {
+			n := 1
+			for i := 0; i < len(term); i++ {
+				if term[i] == ' ' {
+					n++
+				}
+			}
+			stats.NGrams[n]++
+		}
+		stats.MemoryBytes += int64(termOverhead + len(term))
+		if tfreq.postings != nil {
+			if idx.mapping == nil { // else they're in the mapped file
+				stats.MemoryBytes += int64(len(tfreq.postings))
+			}
+		} else {
+			stats.MemoryBytes += int64(postingOverhead * len(tfreq.TfMap))
+		}
+	}
+	for _, doc := range idx.docs {
+		stats.MemoryBytes += int64(docOverhead + len(doc.Name) + len(doc.Date) + len(doc.Preview) + len(doc.Content))
+	}
+	if idx.docTable != nil {
+		stats.MemoryBytes += int64(len(idx.docTable.names) * (16 + 4))
+	}
+	for word, docs := range idx.positions {
+		stats.MemoryBytes += int64(termOverhead + len(word))
+		for _, pos := range docs {
+			stats.MemoryBytes += int64(postingOverhead + len(pos))
+		}
+	}
+	return stats
+}
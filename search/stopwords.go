@@ -0,0 +1,86 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// gap stands in for a stop word removed from the text (see
+// DocOpts.StopWords). Normalized content never contains '_', so it can't be
+// a word.
+const gap = "_"
+
+// stopWordSet returns the set of words, normalized as documents are, or nil
+// if there are none.
+func (idx *Index) stopWordSet(words []string) map[string]bool {
+	if len(words) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		for _, word := range strings.Fields(idx.normalizer(w)) {
+			set[word] = true
+		}
+	}
+	return set
+}
+
+// wordSet returns the set of saved stop words, or nil if there are none.
+func wordSet(words []string) map[string]bool {
+	if len(words) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// stopWordList returns the index's stop words in sorted order, for saving.
+func (idx *Index) stopWordList() []string {
+	if idx.stopWords == nil {
+		return nil
+	}
+	words := make([]string, 0, len(idx.stopWords))
+	for w := range idx.stopWords {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// gapStopWords replaces the stop words among words with gaps, in place.
+func (idx Index) gapStopWords(words []string) []string {
+	for i, w := range words {
+		if idx.stopWords[w] {
+			words[i] = gap
+		}
+	}
+	return words
+}
+
+// isGapped reports whether term starts or ends with a gap. Such n-grams
+// match wherever their other words do, so they're neither indexed nor
+// searched.
+func isGapped(term []byte) bool {
+	n := len(term)
+	return (n > 0 && term[0] == '_' && (n == 1 || term[1] == ' ')) ||
+		(n > 1 && term[n-1] == '_' && term[n-2] == ' ')
+}
+
+// ngramTerms returns the n-gram terms of words as they're indexed, with
+// stop words gapped.
+func (idx Index) ngramTerms(words []string) []string {
+	if idx.stopWords == nil {
+		return idx.ngrams.terms(words)
+	}
+	gapped := idx.gapStopWords(append([]string(nil), words...))
+	var terms []string
+	for _, term := range idx.ngrams.terms(gapped) {
+		if !isGapped([]byte(term)) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestStopWordGaps(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "a.md", Content: "the use of language"},
+		Document{Name: "b.md", Content: "we use language daily"},
+		Document{Name: "c.md", Content: "cats and dogs"},
+	), DocOpts{StopWords: []string{"The", "of", "in", "and"}})
+
+	for _, term := range []string{"the", "of", "of language", "the use"} {
+		if _, ok := index.tmap[term]; ok {
+			t.Errorf("expected %q not to be indexed", term)
+		}
+	}
+	if _, ok := index.tmap["use _ language"]; !ok {
+		t.Error("expected the phrase to keep a gap for the stop word")
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"use of language", "a.md"},
+		{"use in language", "a.md"},
+		{"use language", "b.md"},
+	} {
+		results, err := index.Search(context.Background(), []string{tc.query}, SearchOpts{Limit: 1})
+		if err != nil || len(results) != 1 || results[0].Name != tc.want {
+			t.Errorf("%q: expected %s first, got %+v %v", tc.query, tc.want, results, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := index.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadIndex(context.Background(), &buf, nil, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.stopWords["of"] || len(loaded.stopWords) != 4 {
+		t.Errorf("expected the stop words to be saved, got %v", loaded.stopWords)
+	}
+
+	data, err := index.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = UnmarshalProto(data, DocOpts{}); err != nil || len(loaded.stopWords) != 4 {
+		t.Errorf("expected the stop words in the protobuf, got %v %v", loaded.stopWords, err)
+	}
+}
@@ -1,193 +1,542 @@
 package search
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 	"unicode"
+
+	"github.com/Eratosthenes/infrared/search/zstd"
 )
 
-// Loader is a function that returns documents given some options.
-type Loader func(opts DocOpts) ([]Document, error)
+// Loader is a function that returns documents given some options. It should
+// stop and return ctx's error once ctx is done.
+type Loader func(ctx context.Context, opts LoadOpts) ([]Document, error)
 
-// DefaultLoader loads documents from the filesystem using the provided options.
-func DefaultLoader(opts DocOpts) ([]Document, error) {
-	// load documents from the LoadPath directory
+// DefaultLoader loads documents from the filesystem using the provided
+// options, stopping early if ctx is done.
+func DefaultLoader(ctx context.Context, opts LoadOpts) ([]Document, error) {
+	// load documents from the opts.Path directory
 	// create new docs for each file in the directory using NewDoc
-	files, err := os.ReadDir(opts.LoadPath)
+	fsys, dir := opts.docFS()
+	return loadDir(ctx, fsys, dir, ".", opts)
+}
+
+// loadDir loads the documents in the sub directory of root, and in its
+// subdirectories if opts.Recursive is set. Documents are named by their
+// path beneath root.
+func loadDir(ctx context.Context, fsys fs.FS, root, sub string, opts LoadOpts) ([]Document, error) {
+	files, err := fs.ReadDir(fsys, path.Join(root, sub))
 	if err != nil {
-		return []Document{}, err
+		// the directory asked for can't be skipped, only its subdirectories
+		if sub == "." {
+			return []Document{}, &DocLoadError{Path: opts.Path, Err: err}
+		}
+		return nil, opts.unreadable(path.Join(opts.Path, sub), err)
 	}
 
+	// NewDoc reads the files of sub from the filesystem already opened
+	subOpts := opts
+	subOpts.FS, subOpts.Path = fsys, path.Join(root, sub)
 	var docs []Document
 	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return []Document{}, err
+		}
 		info, err := file.Info()
 		if err != nil {
-			return []Document{}, err
+			if err := opts.unreadable(path.Join(opts.Path, sub, file.Name()), err); err != nil {
+				return []Document{}, err
+			}
+			continue
 		}
 		if info.IsDir() {
+			if !opts.Recursive {
+				if opts.Skip != nil {
+					opts.Skip(path.Join(opts.Path, sub, file.Name()), "directory")
+				}
+				continue
+			}
+			more, err := loadDir(ctx, fsys, root, path.Join(sub, file.Name()), opts)
+			if err != nil {
+				return []Document{}, err
+			}
+			docs = append(docs, more...)
 			continue
 		}
-		doc, err := NewDoc(file, opts)
+		doc, err := NewDoc(file, subOpts)
 		if err != nil {
-			return []Document{}, err
+			if err := opts.unreadable(path.Join(opts.Path, sub, file.Name()), err); err != nil {
+				return []Document{}, err
+			}
+			continue
 		}
+		doc.Name, doc.Dir = path.Join(sub, doc.Name), sub
 		docs = append(docs, doc)
 	}
 	return docs, nil
 }
 
+// unreadable handles a file or directory at path that couldn't be read as
+// opts.Unreadable says: it returns the error as a DocLoadError, or nil after
+// reporting the file skipped, or nil alone.
+func (opts LoadOpts) unreadable(path string, err error) error {
+	switch opts.Unreadable {
+	case SkipUnreadable:
+		if opts.Skip != nil {
+			opts.Skip(path, "unreadable: "+err.Error())
+		}
+	case IgnoreUnreadable:
+	default:
+		return &DocLoadError{Path: path, Err: err}
+	}
+	return nil
+}
+
 // Normalizer converts a raw document string into a cleaned version before tokenization (e.g. lowercase, strip punctuation, etc.).
 type Normalizer func(text string) string
 
 // DefaultNormalizer lowercases and strips punctuation.
 func DefaultNormalizer(s string) string {
-	s = strings.ToLower(s)
-	s = strings.Map(func(r rune) rune {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+	// a single pass, so only one copy of the text is allocated
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		if unicode.IsSpace(r) {
 			return r
 		}
 		return -1
 	}, s)
-	return s
 }
 
-// NewIndex creates a new search index from the documents loaded using the provided loader function.
-func NewIndex(loader Loader, docOpts DocOpts) *Index {
-	idx := &Index{
-		normalizer: DefaultNormalizer,
-		compressed: docOpts.Compressed,
+// NewIndex creates a new search index from the documents loaded using the
+// provided loader function. It returns an error if the options are invalid or
+// the documents can't be loaded, and ctx's error if ctx is done first.
+func NewIndex(ctx context.Context, loader Loader, docOpts DocOpts) (*Index, error) {
+	idx := &Index{}
+	if err := idx.buildFrom(ctx, loader, docOpts); err != nil {
+		return nil, err
 	}
-	idx.populate(loader, docOpts)
-	idx.build()
-	return idx
+	return idx, nil
 }
 
-// populate loads documents into the index using the provided loader function
-func (idx *Index) populate(loader Loader, docOpts DocOpts) {
-	docs, err := loader(docOpts)
+// buildFrom configures idx, loads its documents with loader and builds it.
+func (idx *Index) buildFrom(ctx context.Context, loader Loader, docOpts DocOpts) error {
+	start := time.Now()
+	if err := idx.configure(docOpts); err != nil {
+		return err
+	}
+	if err := idx.populate(ctx, loader, docOpts); err != nil {
+		return err
+	}
+	if err := idx.build(ctx); err != nil {
+		return err
+	}
+	idx.buildTime = time.Since(start)
+	if idx.report != nil {
+		idx.report.finish(idx)
+	}
+	return nil
+}
+
+// configure sets the index options that are not persisted with the index,
+// that an IndexBuilder or Engine hasn't already set.
+func (idx *Index) configure(docOpts DocOpts) error {
+	if idx.fieldAnalyzers == nil {
+		idx.fieldAnalyzers = docOpts.FieldAnalyzers
+	}
+	if err := checkFieldAnalyzers(idx.fieldAnalyzers); err != nil {
+		return err
+	}
+	if idx.normalizer == nil {
+		idx.normalizer = DefaultNormalizer
+	}
+	if idx.ngrams.max == 0 {
+		idx.ngrams = defaultNGrams
+	}
+	if docOpts.FoldDiacritics {
+		idx.normalizer = diacriticNormalizer(idx.normalizer)
+		idx.foldDiacritics = true
+	}
+	if docOpts.FoldPlurals {
+		idx.normalizer = foldingNormalizer(idx.normalizer)
+		idx.foldPlurals = true
+	}
+	if idx.stopWords == nil {
+		idx.stopWords = idx.stopWordSet(docOpts.StopWords)
+	}
+	if idx.expander == nil {
+		idx.expander = newExpander(docOpts.Expansions, idx.normalizer, idx.ngrams)
+	}
+	idx.entities = docOpts.Entities
+	idx.fields = make(map[string]bool)
+	idx.storage = docOpts.Storage
+	idx.load = docOpts.Load
+	idx.compact = docOpts.CompactPostings
+	if idx.workers == 0 {
+		idx.workers = docOpts.Workers
+	}
+	idx.memoryBudget = docOpts.MemoryBudget
+	idx.spillDir = docOpts.SpillDir
+	idx.progress = docOpts.Progress
+	idx.stopwordRatio = docOpts.StopwordRatio
+	idx.stopwordWeight = docOpts.StopwordWeight
+	idx.sentenceNGrams = docOpts.SentenceNGrams
+	idx.limits = docOpts.Limits
+	idx.outliers = docOpts.Outliers
+	idx.filters = newFilterCache(docOpts.FilterCache)
+	idx.transforms = docOpts.Transform
+	idx.withholdText = docOpts.WithholdText
+	idx.audit = docOpts.Audit
+	if docOpts.Positions && idx.positions == nil {
+		idx.positions = make(positions)
+	}
+	if docOpts.Report {
+		idx.report = &BuildReport{}
+		idx.progress = idx.report.recordPhases(docOpts.Progress)
+	}
+	return nil
+}
+
+// populate loads documents into the index using the provided loader function.
+// A nil loader leaves the index without stored documents.
+func (idx *Index) populate(ctx context.Context, loader Loader, docOpts DocOpts) error {
+	idx.docs = make(map[string]Document)
+	if loader == nil {
+		return nil
+	}
+	if logger := docOpts.Logger; logger != nil {
+		next := docOpts.Load.Skip
+		docOpts.Load.Skip = func(path, reason string) {
+			logger.Debug("skipped file", "path", path, "reason", reason)
+			if next != nil {
+				next(path, reason)
+			}
+		}
+	}
+	if idx.report != nil {
+		docOpts.Load.Skip = idx.report.recordSkips(docOpts.Load.Skip)
+	}
+	loading := idx.startPhase(PhaseLoad, 0)
+	docs, err := loader(ctx, docOpts.Load)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	// set idx.docs to a map with key as doc.Name and value as doc
-	idx.docs = make(map[string]Document)
 	for _, doc := range docs {
+		if err := idx.transform(&doc); err != nil {
+			return err
+		}
+		idx.extractEntities(&doc)
 		idx.docs[doc.Name] = doc
+		loading.add(1)
 	}
+	idx.indexDirs()
+	loading.finish()
+	return nil
 }
 
-type indexLoader func(loader Loader, docOpts DocOpts) *Index
+// indexStoredDocs registers the entity fields and directories of documents
+// read with the index rather than loaded.
+func (idx *Index) indexStoredDocs() {
+	for _, doc := range idx.docs {
+		for kind := range doc.Entities {
+			idx.fields[kind] = true
+		}
+	}
+	idx.indexDirs()
+}
 
-func jsonLoader(loader Loader, docOpts DocOpts) *Index {
-	file, err := os.Open(docOpts.IndexPath)
-	if err != nil {
-		log.Fatalf("failed to open index file: %v", err)
+// finishLoad prepares a decoded index for searching. Postings decoded
+// compact, as those of FormatMapped are, stay compact.
+func (idx *Index) finishLoad() {
+	if idx.compact || idx.docTable != nil {
+		idx.compactPostings()
+	} else {
+		idx.internPostings()
 	}
-	defer file.Close()
+	idx.filter = newBloom(idx.tmap)
+	idx.avgTokens = idx.meanTokens()
+	idx.indexPositions()
+}
 
-	data, err := io.ReadAll(file)
+// LoadIndex loads the index saved at opts.Storage.Path and populates its
+// documents with loader, or from opts.Storage.DocsPath if loader is nil.
+func LoadIndex(ctx context.Context, loader Loader, opts DocOpts) (*Index, error) {
+	file, err := openIndexFile(opts.Storage.Path)
 	if err != nil {
-		log.Fatalf("failed to read index file: %v", err)
+		return nil, fmt.Errorf("failed to open index file: %w", err)
 	}
+	defer file.Close()
 
-	var idx Index
-	if err := json.Unmarshal(data, &idx); err != nil {
-		log.Fatalf("failed to unmarshal index: %v", err)
+	if loader == nil && opts.Storage.DocsPath != "" {
+		loader = DocumentLoader(opts.Storage)
 	}
-
-	idx.populate(loader, docOpts)
-	return &idx
+	if opts.Storage.Format == FormatMapped {
+		return openMapped(ctx, file, loader, opts)
+	}
+	return ReadIndex(ctx, file, loader, opts)
 }
 
-// gzipLoader loads the index from a gzipped file.
-func gzipLoader(loader Loader, docOpts DocOpts) *Index {
-	file, err := os.Open(docOpts.IndexPath)
+// ReadIndex reads an index saved in opts.Storage.Format from r, gzipped or
+// not. An index carries its own documents, so it's searchable without the
+// files it was built from; loader is only used to populate the documents of
+// an index saved without them (see StorageOpts.DocsPath), and may be nil,
+// in which case results only carry document names. Unlike LoadIndex it
+// doesn't touch the OS filesystem, so it also works in a browser under
+// js/wasm.
+func ReadIndex(ctx context.Context, r io.Reader, loader Loader, opts DocOpts) (*Index, error) {
+	src, err := opts.Storage.decompress(r)
 	if err != nil {
-		log.Fatalf("failed to open index file: %v", err)
+		return nil, err
 	}
-	defer file.Close()
+	defer src.Close()
 
-	// Wrap with gzip reader
-	gz, err := gzip.NewReader(file)
-	if err != nil {
-		log.Fatalf("failed to create gzip reader: %v", err)
+	if opts.Storage.Format == FormatProto {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index: %w", err)
+		}
+		return unmarshalProto(ctx, data, loader, opts)
 	}
-	defer gz.Close()
 
-	data, err := io.ReadAll(gz)
-	if err != nil {
-		log.Fatalf("failed to read gzipped data: %v", err)
+	var idx *Index
+	var docs []Document
+	switch opts.Storage.Format {
+	case FormatGob:
+		saved, err := decodeGob(src)
+		if err != nil {
+			return nil, err
+		}
+		if idx, err = saved.index(); err != nil {
+			return nil, err
+		}
+		docs = saved.documents()
+	case FormatMapped:
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index: %w", err)
+		}
+		if idx, docs, err = decodeMapped(data); err != nil {
+			return nil, err
+		}
+	default:
+		var saved jsonIndex
+		if err := json.NewDecoder(src).Decode(&saved); err != nil {
+			return nil, fmt.Errorf("%w: failed to unmarshal index: %w", ErrCorruptIndex, err)
+		}
+		if err := saved.check(saved.TMap != nil); err != nil {
+			return nil, err
+		}
+		idx = &Index{tmap: saved.TMap, fieldAnalyzers: saved.FieldAnalyzers}
+		idx.stopWords = wordSet(saved.StopWords)
+		idx.pruned = wordSet(saved.Pruned)
+		docs = saved.Docs
+	}
+	if err := idx.finishRead(ctx, docs, loader, opts); err != nil {
+		return nil, err
 	}
+	return idx, nil
+}
 
-	var idx Index
-	if err := json.Unmarshal(data, &idx); err != nil {
-		log.Fatalf("failed to unmarshal index: %v", err)
+// finishRead configures a decoded index, sets its documents to the saved
+// docs, or those loader loads if there are none, and prepares it for
+// searching.
+func (idx *Index) finishRead(ctx context.Context, docs []Document, loader Loader, opts DocOpts) error {
+	if err := idx.configure(opts); err != nil {
+		return err
 	}
+	if len(docs) > 0 {
+		idx.docs = make(map[string]Document, len(docs))
+		for _, doc := range docs {
+			idx.docs[doc.Name] = doc
+		}
+		idx.indexStoredDocs()
+	} else if err := idx.populate(ctx, loader, opts); err != nil {
+		return err
+	}
+	idx.finishLoad()
+	return nil
+}
+
+// indexMagic and jsonFormatVersion head every JSON index and documents
+// file, so a reader can tell an index from other JSON, and a version it
+// knows from a newer one; gob files start with indexMagic too. The version
+// goes up whenever a change to the format would make older readers misread
+// it.
+const (
+	indexMagic        = "infrared-index"
+	jsonFormatVersion = 1
+)
 
-	idx.populate(loader, docOpts)
-	return &idx
+// jsonHeader heads the saved forms of FormatJSON.
+type jsonHeader struct {
+	Magic   string `json:"magic"`
+	Version int    `json:"format_version"`
 }
 
-func LoadIndex(loader Loader, opts DocOpts) *Index {
-	var il indexLoader
-	if opts.Compressed {
-		il = gzipLoader
-	} else {
-		il = jsonLoader
-	}
-	return il(loader, opts)
+func newJSONHeader() jsonHeader {
+	return jsonHeader{Magic: indexMagic, Version: jsonFormatVersion}
 }
 
-// Save saves the index to a file.
-func (idx *Index) Save(path string) error {
-	var is indexSaver
-	if idx.compressed {
-		is = gzipSaver
-	} else {
-		is = jsonSaver
+// check returns an error if the header isn't that of an index this package
+// reads. Files saved before there was a header are migrated, being read as
+// version 1, if they look like what they should be: readers fall back on
+// Length for their documents' missing TokenCounts, and on the loader for
+// missing documents.
+func (h *jsonHeader) check(looksRight bool) error {
+	if h.Magic == "" && h.Version == 0 && looksRight {
+		h.Magic, h.Version = indexMagic, 1
+	}
+	if h.Magic != indexMagic {
+		return fmt.Errorf("%w: not an infrared index", ErrCorruptIndex)
 	}
-	return is(idx, path)
+	return checkVersion("JSON", h.Version, jsonFormatVersion)
 }
 
-type indexSaver func(idx *Index, path string) error
+// checkVersion returns ErrUnsupportedFormat, with the versions involved,
+// if version isn't the current version of format.
+func checkVersion(format string, version, current int) error {
+	switch {
+	case version > current:
+		return fmt.Errorf("%w: %s version %d is newer than version %d, the latest this package reads; upgrade it", ErrUnsupportedFormat, format, version, current)
+	case version != current:
+		return fmt.Errorf("%w: %s version %d is incompatible with version %d; rebuild the index", ErrUnsupportedFormat, format, version, current)
+	}
+	return nil
+}
 
-// jsonSaver saves the index to a JSON file.
-func jsonSaver(idx *Index, path string) error {
-	// Marshal the Index object into JSON
-	jsonData, err := json.Marshal(idx)
-	if err != nil {
-		return err
+// decompress returns a reader of r, decompressing it if it's gzipped,
+// compressed with the codec of the options, or zstd-compressed.
+func (opts StorageOpts) decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to create gzip reader: %w", ErrCorruptIndex, err)
+		}
+		return gz, nil
 	}
+	if c := opts.Codec; c != nil && len(c.Magic) > 0 {
+		if magic, err := br.Peek(len(c.Magic)); err == nil && bytes.Equal(magic, c.Magic) {
+			zr, err := c.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to create %s reader: %w", ErrCorruptIndex, c.Name, err)
+			}
+			return zr, nil
+		}
+	}
+	if magic, err := br.Peek(len(zstd.Magic)); err == nil && bytes.Equal(magic, zstd.Magic) {
+		return zstd.NewReader(br), nil
+	}
+	return io.NopCloser(br), nil
+}
 
-	// Write the JSON data to a file
-	err = os.WriteFile(path, jsonData, 0644)
-	if err != nil {
+// Save saves the index to a file, in the format and compression given by the
+// StorageOpts it was built or loaded with. The output is canonical: terms,
+// postings and documents are written in sorted order, so equal indexes save
+// to identical bytes however they were built, and can be cached by content.
+// If the StorageOpts set DocsPath, the stored documents are saved there
+// rather than with the postings. An index built with DocOpts.Report also
+// saves its BuildReport, as "index.report.json" for "index.json.gz". Each
+// file is replaced atomically, so an index can be saved over the file it
+// was mapped from, or one a server is reading.
+func (idx *Index) Save(path string) error {
+	if err := writeFile(path, idx.Write); err != nil {
 		return err
 	}
-
+	if idx.storage.DocsPath != "" {
+		if err := writeFile(idx.storage.DocsPath, idx.WriteDocuments); err != nil {
+			return err
+		}
+	}
+	if idx.report != nil {
+		return writeFile(reportPath(path), idx.WriteBuildReport)
+	}
 	return nil
 }
 
-// gzipSaver saves the index to a gzipped JSON file.
-func gzipSaver(idx *Index, path string) error {
-	file, err := os.Create(path)
+// writeFile writes a file with write, atomically: to a temporary file in
+// the same directory, synced, then renamed over path. A reader of the old
+// file, as a FormatMapped index mapping it, keeps reading the old file, and
+// a crash leaves either the old file or the new one, never part of one.
+func writeFile(path string, write func(io.Writer) error) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	tmp := file.Name()
+	err = write(file)
+	if err == nil {
+		err = file.Chmod(mode)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
 
-	// Create a gzip writer for compression
-	gz := gzip.NewWriter(file)
-	defer gz.Close()
+// Write writes the index to w, as Save does. If the StorageOpts set
+// DocsPath, the stored documents are left out; see WriteDocuments.
+func (idx *Index) Write(w io.Writer) error {
+	return idx.storage.compress(w, idx.encode)
+}
 
-	enc := json.NewEncoder(gz)
-	if err := enc.Encode(idx); err != nil {
+// compress calls encode with w, compressed if the options say so.
+func (opts StorageOpts) compress(w io.Writer, encode func(io.Writer) error) error {
+	var zw io.WriteCloser
+	switch {
+	case opts.Codec != nil:
+		var err error
+		if zw, err = opts.Codec.NewWriter(w); err != nil {
+			return fmt.Errorf("failed to create %s writer: %w", opts.Codec.Name, err)
+		}
+	case opts.Compressed:
+		zw = newParallelGzip(w, opts.CompressionWorkers)
+	default:
+		return encode(w)
+	}
+	if err := encode(zw); err != nil {
+		zw.Close()
 		return err
 	}
+	return zw.Close()
+}
 
-	return nil
+func (idx *Index) encode(w io.Writer) error {
+	switch idx.storage.Format {
+	case FormatProto:
+		_, err := w.Write(idx.marshalProto(idx.storage.DocsPath == ""))
+		return err
+	case FormatGob:
+		return idx.encodeGob(w, idx.storage.DocsPath == "")
+	case FormatMapped:
+		return idx.encodeMapped(w, true, idx.storage.DocsPath == "")
+	}
+	return idx.encodeJSON(w)
 }
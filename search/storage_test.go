@@ -0,0 +1,432 @@
+package search
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Eratosthenes/infrared/search/zstd"
+)
+
+// mustIndex builds an index as NewIndex does, failing the test on error.
+func mustIndex(t testing.TB, loader Loader, opts DocOpts) *Index {
+	t.Helper()
+	idx, err := NewIndex(context.Background(), loader, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+// mustLoad loads an index as LoadIndex does, failing the test on error.
+func mustLoad(t testing.TB, loader Loader, opts DocOpts) *Index {
+	t.Helper()
+	idx, err := LoadIndex(context.Background(), loader, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestFSLoaderAndReadIndex(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/pond.txt":  {Data: []byte("the pond in winter")},
+		"docs/city.txt":  {Data: []byte("the city in summer")},
+		"docs/sub/x.txt": {Data: []byte("ignored, in a subdirectory")},
+	}
+	opts := DocOpts{Load: LoadOpts{FS: fsys, Path: "docs", Content: true}, Storage: StorageOpts{Compressed: true}}
+	index := mustIndex(t, DefaultLoader, opts)
+	if index.DocCount() != 2 {
+		t.Fatalf("expected 2 documents, got %d", index.DocCount())
+	}
+
+	path := filepath.Join(t.TempDir(), "index.json.gz")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the index carries its documents, so it needs neither loader nor files
+	loaded, err := ReadIndex(context.Background(), bytes.NewReader(data), nil, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := loaded.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "pond.txt" {
+		t.Fatalf("expected pond.txt, got %+v", results)
+	}
+	if results[0].Content != "the pond in winter" || results[0].Length != 4 || results[0].Date == "" {
+		t.Errorf("expected the saved document, got %+v", results[0].Document)
+	}
+
+	if _, err := ReadIndex(context.Background(), bytes.NewReader([]byte("not an index")), nil, DocOpts{}); err == nil {
+		t.Error("expected an error for a corrupt index")
+	}
+}
+
+func TestStorageFormats(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+	)
+	for _, storage := range []StorageOpts{
+		{Format: FormatJSON},
+		{Format: FormatJSON, Compressed: true},
+		{Format: FormatProto},
+		{Format: FormatProto, Compressed: true},
+		{Format: FormatGob},
+		{Format: FormatGob, Compressed: true},
+		{Format: FormatMapped},
+		{Format: FormatMapped, Compressed: true},
+	} {
+		storage.Path = filepath.Join(t.TempDir(), "index")
+		opts := DocOpts{Storage: storage}
+		if err := mustIndex(t, docs, opts).Save(storage.Path); err != nil {
+			t.Fatal(err)
+		}
+		// a protobuf index carries its documents; a JSON one needs the loader
+		loaded := mustLoad(t, docs, opts)
+		results, err := loaded.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Name != "pond.md" || results[0].Length != 4 {
+			t.Errorf("%+v: unexpected results %+v", storage, results)
+		}
+	}
+}
+
+func TestDeterministicSave(t *testing.T) {
+	load := LoadOpts{Path: "../example/docs", Content: true}
+	write := func(idx *Index) []byte {
+		var buf bytes.Buffer
+		if err := idx.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	want := write(mustIndex(t, DefaultLoader, DocOpts{Load: load}))
+	builders := map[string]*IndexBuilder{
+		"parallel": NewIndexBuilder().Source(DefaultLoader, load).Workers(4),
+		"compact":  NewIndexBuilder().Source(DefaultLoader, load).CompactPostings(),
+		"spilled":  NewIndexBuilder().Source(DefaultLoader, load).MemoryBudget(64<<10, t.TempDir()),
+	}
+	for name, b := range builders {
+		idx, err := b.Build(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(write(idx), want) {
+			t.Errorf("%s build saved differently", name)
+		}
+	}
+
+	reloaded, err := ReadIndex(context.Background(), bytes.NewReader(want), nil, DocOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(write(reloaded), want) {
+		t.Error("a reloaded index saved differently")
+	}
+}
+
+func TestLoaderStaysBeneathRoot(t *testing.T) {
+	root := t.TempDir()
+	docs := filepath.Join(root, "docs")
+	if err := os.Mkdir(docs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		filepath.Join(docs, "pond.txt"): "the pond in winter",
+		filepath.Join(root, "secret"):   "outside the corpus",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := DefaultLoader(context.Background(), LoadOpts{Root: root, Path: "docs", Content: true})
+	if err != nil || len(loaded) != 1 || loaded[0].Content != "the pond in winter" {
+		t.Fatalf("expected pond.txt, got %+v (%v)", loaded, err)
+	}
+	if _, err := DefaultLoader(context.Background(), LoadOpts{Root: docs, Path: "..", Content: true}); err == nil {
+		t.Error("expected an error for a path above the root")
+	}
+
+	if err := os.Symlink(filepath.Join(root, "secret"), filepath.Join(docs, "escape.txt")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	if _, err := DefaultLoader(context.Background(), LoadOpts{Path: docs, Content: true}); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected a permission error for a symlink out of the root, got %v", err)
+	}
+}
+
+func TestSplitStorage(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+	)
+	for _, format := range []Format{FormatJSON, FormatProto, FormatGob, FormatMapped} {
+		dir := t.TempDir()
+		storage := StorageOpts{
+			Path:       filepath.Join(dir, "postings"),
+			DocsPath:   filepath.Join(dir, "docs"),
+			Format:     format,
+			Compressed: true,
+		}
+		if err := mustIndex(t, docs, DocOpts{Storage: storage}).Save(storage.Path); err != nil {
+			t.Fatal(err)
+		}
+
+		// ranking only: the postings file carries no documents
+		ranking := mustLoad(t, nil, DocOpts{Storage: StorageOpts{Path: storage.Path, Format: format}})
+		results, err := ranking.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Name != "pond.md" || results[0].Content != "" {
+			t.Errorf("%v: expected pond.md without content, got %+v", format, results)
+		}
+
+		// both files
+		full := mustLoad(t, nil, DocOpts{Storage: storage})
+		results, err = full.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Content != "the pond in winter" || results[0].Length != 4 {
+			t.Errorf("%v: expected pond.md with its content, got %+v", format, results)
+		}
+
+		// documents only
+		loaded, err := LoadDocuments(storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded) != 2 || loaded[0].Name != "city.md" {
+			t.Errorf("%v: unexpected documents %+v", format, loaded)
+		}
+	}
+}
+
+func TestContent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/pond.txt":        {Data: []byte("The Pond in Winter.")},
+		"docs/essays/city.txt": {Data: []byte("The City.")},
+	}
+	index := mustIndex(t, DefaultLoader, DocOpts{Load: LoadOpts{FS: fsys, Path: "docs", Recursive: true}})
+	for name, want := range map[string]string{"pond.txt": "The Pond in Winter.", "essays/city.txt": "The City."} {
+		r, err := index.Content(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+	if _, err := index.Content("missing.txt"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound, got %v", err)
+	}
+
+	// an index read with its documents serves their stored content
+	stored := mustIndex(t, memLoader(Document{Name: "a.md", Content: "stored text"}), DocOpts{})
+	r, err := stored.Content("a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "stored text" {
+		t.Errorf("got %q", data)
+	}
+}
+
+func TestLoggerSkips(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/pond.txt":  {Data: []byte("the pond in winter")},
+		"docs/sub/x.txt": {Data: []byte("in a subdirectory")},
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	mustIndex(t, DefaultLoader, DocOpts{Load: LoadOpts{FS: fsys, Path: "docs", Content: true}, Logger: logger})
+	if !strings.Contains(buf.String(), "skipped file") || !strings.Contains(buf.String(), "reason=directory") {
+		t.Errorf("expected the skipped directory to be logged, got %q", buf.String())
+	}
+}
+
+// unreadableFS is a filesystem whose bad file can be listed but not read.
+type unreadableFS struct {
+	fstest.MapFS
+	bad string
+}
+
+func (fsys unreadableFS) Open(name string) (fs.File, error) {
+	if name == fsys.bad {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.MapFS.Open(name)
+}
+
+func (fsys unreadableFS) ReadFile(name string) ([]byte, error) {
+	if name == fsys.bad {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.MapFS.ReadFile(name)
+}
+
+func TestUnreadableFiles(t *testing.T) {
+	fsys := unreadableFS{fstest.MapFS{
+		"docs/pond.txt":   {Data: []byte("the pond in winter")},
+		"docs/locked.txt": {Data: []byte("can't be read")},
+	}, "docs/locked.txt"}
+	load := LoadOpts{FS: fsys, Path: "docs", Content: true}
+
+	var loadErr *DocLoadError
+	if _, err := DefaultLoader(context.Background(), load); !errors.As(err, &loadErr) || loadErr.Path != "docs/locked.txt" {
+		t.Errorf("expected a DocLoadError for locked.txt, got %v", err)
+	}
+
+	var skipped []string
+	load.Unreadable = SkipUnreadable
+	load.Skip = func(path, reason string) { skipped = append(skipped, path) }
+	idx := mustIndex(t, DefaultLoader, DocOpts{Load: load, Report: true})
+	if idx.DocCount() != 1 {
+		t.Errorf("expected pond.txt alone, got %d documents", idx.DocCount())
+	}
+	report := idx.BuildReport()
+	if len(skipped) != 1 || len(report.Skipped) != 1 || !strings.HasPrefix(report.Skipped[0].Reason, "unreadable: ") {
+		t.Errorf("expected locked.txt to be reported, got %q and %+v", skipped, report.Skipped)
+	}
+
+	skipped = nil
+	load.Unreadable = IgnoreUnreadable
+	docs, err := DefaultLoader(context.Background(), load)
+	if err != nil || len(docs) != 1 || len(skipped) != 0 {
+		t.Errorf("expected locked.txt to be ignored, got %d documents, %q skipped (%v)", len(docs), skipped, err)
+	}
+}
+
+// flateCodec is a Codec of DEFLATE streams, headed by a magic of its own.
+var flateCodec = &Codec{
+	Name:  "flate",
+	Magic: []byte("FLT1"),
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		if _, err := w.Write([]byte("FLT1")); err != nil {
+			return nil, err
+		}
+		return flate.NewWriter(w, flate.BestSpeed)
+	},
+	NewReader: func(r io.Reader) (io.ReadCloser, error) {
+		if _, err := io.ReadFull(r, make([]byte, 4)); err != nil {
+			return nil, err
+		}
+		return flate.NewReader(r), nil
+	},
+}
+
+func TestCodec(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+	)
+	dir := t.TempDir()
+	storage := StorageOpts{
+		Path:     filepath.Join(dir, "index"),
+		DocsPath: filepath.Join(dir, "docs"),
+		Format:   FormatProto,
+		Codec:    flateCodec,
+	}
+	if err := mustIndex(t, docs, DocOpts{Storage: storage}).Save(storage.Path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(storage.Path)
+	if err != nil || !bytes.HasPrefix(data, []byte("FLT1")) {
+		t.Fatalf("expected a flate index, got %.8q (%v)", data, err)
+	}
+
+	loaded := mustLoad(t, nil, DocOpts{Storage: storage})
+	results, err := loaded.Search(context.Background(), []string{"winter"}, SearchOpts{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Content != "the pond in winter" {
+		t.Errorf("expected pond.md with its content, got %+v", results)
+	}
+
+	// zstd indexes load without the codec
+	storage.Codec = Zstd
+	if err := mustIndex(t, docs, DocOpts{Storage: storage}).Save(storage.Path); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = os.ReadFile(storage.Path); err != nil || !bytes.HasPrefix(data, zstd.Magic) {
+		t.Fatalf("expected a zstd index, got %.8q (%v)", data, err)
+	}
+	storage.Codec = nil
+	loaded = mustLoad(t, nil, DocOpts{Storage: storage})
+	if results, _ := loaded.Search(context.Background(), []string{"summer"}, SearchOpts{Limit: 1}); len(results) != 1 || results[0].Content != "the city in summer" {
+		t.Errorf("expected city.md from the zstd index, got %+v", results)
+	}
+
+	corrupt := append(bytes.Clone(zstd.Magic), []byte("not a zstd frame")...)
+	if _, err := ReadIndex(context.Background(), bytes.NewReader(corrupt), nil, DocOpts{}); !errors.Is(err, ErrCorruptIndex) || !errors.Is(err, zstd.ErrCorrupt) {
+		t.Errorf("expected ErrCorruptIndex for a corrupt zstd index, got %v", err)
+	}
+}
+
+func TestStreamingJSON(t *testing.T) {
+	opts := DocOpts{
+		Load:           LoadOpts{Path: "../example/docs", Content: true},
+		Entities:       Gazetteer{"Walden": "place", "<Concord>": "place"},
+		FieldAnalyzers: map[string]string{"place": "keyword"},
+		StopWords:      []string{"the", "of"},
+	}
+	for _, storage := range []StorageOpts{{}, {DocsPath: "docs"}} {
+		for _, compact := range []bool{false, true} {
+			opts.Storage, opts.CompactPostings = storage, compact
+			idx := mustIndex(t, DefaultLoader, opts)
+
+			// the streamed encoding is the jsonIndex, marshaled whole
+			saved := jsonIndex{
+				jsonHeader:     newJSONHeader(),
+				TMap:           make(map[string]TermFreq),
+				FieldAnalyzers: idx.fieldAnalyzers,
+				StopWords:      idx.stopWordList(),
+				Pruned:         idx.prunedList(),
+			}
+			for term, tfreq := range idx.tmap {
+				saved.TMap[term] = TermFreq{Idf: tfreq.Idf, TfMap: idx.postings(tfreq)}
+			}
+			if storage.DocsPath == "" {
+				saved.Docs = idx.sortedDocs()
+			}
+			want, err := json.Marshal(saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := idx.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), append(want, '\n')) {
+				t.Errorf("docs path %q, compact %v: streamed index differs from the marshaled one", storage.DocsPath, compact)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Summarizer returns a short, query-specific summary of a document. It is
+// called lazily, only for the results a search actually returns.
+type Summarizer func(doc *Document, terms []string) string
+
+// defaultSummarySentences is the number of sentences picked by the default summarizer.
+const defaultSummarySentences = 2
+
+// SentenceSummarizer returns an extractive summarizer that picks the n
+// sentences of a document with the highest TF-IDF weight for the query terms
+// (and their n-grams), and joins them in document order. Documents without a
+// matching sentence keep their existing preview.
+func (idx *Index) SentenceSummarizer(n int) Summarizer {
+	return func(doc *Document, terms []string) string {
+		words := idx.Analyze(strings.Join(terms, " "))
+		weights := make(map[string]float64)
+		for _, term := range append(idx.ngramTerms(words), idx.expander.expand(words)...) {
+			weights[term] = math.Log(idx.idf(term))
+		}
+
+		type scored struct {
+			pos   int
+			score float64
+		}
+		sentences := SplitSentences(doc.Content, DefaultLanguage)
+		var picks []scored
+		for i, sentence := range sentences {
+			tokens := strings.Fields(idx.normalizer(sentence))
+			if len(tokens) == 0 {
+				continue
+			}
+			score := 0.0
+			for _, term := range idx.ngramTerms(tokens) {
+				score += weights[term]
+			}
+			if score > 0 {
+				picks = append(picks, scored{pos: i, score: score / math.Sqrt(float64(len(tokens)))})
+			}
+		}
+		if len(picks) == 0 {
+			return doc.Preview
+		}
+
+		sort.SliceStable(picks, func(i, j int) bool { return picks[i].score > picks[j].score })
+		if len(picks) > n {
+			picks = picks[:n]
+		}
+		sort.Slice(picks, func(i, j int) bool { return picks[i].pos < picks[j].pos })
+		parts := make([]string, len(picks))
+		for i, p := range picks {
+			parts[i] = sentences[p.pos]
+		}
+		return strings.Join(parts, " … ")
+	}
+}
+
+// summarize replaces the preview of each result with a query-specific summary.
+func (opts SearchOpts) summarize(idx *Index, terms []string, results []SearchResult) {
+	summarizer := opts.Summarizer
+	if summarizer == nil {
+		summarizer = idx.SentenceSummarizer(defaultSummarySentences)
+	}
+	for i := range results {
+		// copy the document so the summary never leaks into shared state
+		doc := *results[i].Document
+		doc.Preview = summarizer(&doc, terms)
+		results[i].Document = &doc
+	}
+}
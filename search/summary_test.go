@@ -0,0 +1,57 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	text := "The law is clear. Is it just?\n\nA new paragraph without a stop\nthat wraps. \"Quoted!\" he said."
+	want := []string{
+		"The law is clear.",
+		"Is it just?",
+		"A new paragraph without a stop that wraps.",
+		"\"Quoted!\"",
+		"he said.",
+	}
+	if got := SplitSentences(text, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	text = "Dr. Thoreau met J. S. Mill at St. Paul's, e.g. on Sunday. They talked."
+	want = []string{"Dr. Thoreau met J. S. Mill at St. Paul's, e.g. on Sunday.", "They talked."}
+	if got := SplitSentences(text, "en"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	text = "Hr. Kant schrieb z.B. dies. Dann ging er."
+	want = []string{"Hr. Kant schrieb z.B. dies.", "Dann ging er."}
+	if got := SplitSentences(text, "de"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSummarizedPreview(t *testing.T) {
+	index := mustIndex(t, memLoader(
+		Document{Name: "a.txt", Preview: "Chapter one...", Content: "Chapter one. The weather was fine. The moral law binds us all. Then we ate lunch."},
+		Document{Name: "b.txt", Preview: "Other...", Content: "Nothing to see here."},
+	), DocOpts{})
+
+	results, err := index.Search(context.Background(), strings.Fields("moral law"), SearchOpts{Limit: 1, Summarize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Preview != "The moral law binds us all." {
+		t.Fatalf("expected the matching sentence as preview, got %+v", results)
+	}
+	if index.docs["a.txt"].Preview != "Chapter one..." {
+		t.Error("summarizing must not modify the indexed document")
+	}
+
+	custom := func(doc *Document, terms []string) string { return doc.Name + ":" + strings.Join(terms, "+") }
+	results, _ = index.Search(context.Background(), strings.Fields("moral law"), SearchOpts{Limit: 1, Summarizer: custom})
+	if results[0].Preview != "a.txt:moral+law" {
+		t.Errorf("expected custom summary, got %q", results[0].Preview)
+	}
+}
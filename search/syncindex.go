@@ -0,0 +1,75 @@
+package search
+
+import (
+	"context"
+	"sync"
+)
+
+// SyncIndex guards an index with a read-write lock, so that any number of
+// goroutines can search it while others change it in place with
+// AddDocument, RemoveDocument and UpdateDocument. It's the other side of
+// IndexManager's tradeoff: a change costs the postings of its document
+// rather than a copy of the index, and searches see it as soon as it's
+// made, but it holds up the searches started while it's applied.
+//
+// The index mustn't be used other than through the SyncIndex once it's
+// wrapped. Methods of Index that SyncIndex doesn't have are reached with
+// View, or Modify for those that change the index in place.
+type SyncIndex struct {
+	mu  sync.RWMutex
+	idx *Index
+}
+
+// NewSyncIndex returns a SyncIndex guarding idx.
+func NewSyncIndex(idx *Index) *SyncIndex {
+	return &SyncIndex{idx: idx}
+}
+
+// Search searches the index, between changes.
+func (s *SyncIndex) Search(ctx context.Context, terms []string, opts SearchOpts) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.idx.Search(ctx, terms, opts)
+}
+
+// Document returns the stored document named name, as Index.Document does.
+func (s *SyncIndex) Document(name string) (Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.idx.Document(name)
+}
+
+// AddDocument adds doc to the index, as Index.AddDocument does, once the
+// searches under way have finished.
+func (s *SyncIndex) AddDocument(doc Document) error {
+	return s.Modify(func(idx *Index) error { return idx.AddDocument(doc) })
+}
+
+// RemoveDocument removes the named document from the index, as
+// Index.RemoveDocument does.
+func (s *SyncIndex) RemoveDocument(name string) error {
+	return s.Modify(func(idx *Index) error { return idx.RemoveDocument(name) })
+}
+
+// UpdateDocument replaces a document of the index with doc, as
+// Index.UpdateDocument does.
+func (s *SyncIndex) UpdateDocument(doc Document) error {
+	return s.Modify(func(idx *Index) error { return idx.UpdateDocument(doc) })
+}
+
+// View calls fn with the index, alongside searches but between changes, as
+// to Save or Stats it. fn mustn't change the index, nor keep it after it
+// returns.
+func (s *SyncIndex) View(fn func(*Index) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.idx)
+}
+
+// Modify calls fn with the index while nothing else uses it, so that fn
+// can change it in place. fn mustn't keep the index after it returns.
+func (s *SyncIndex) Modify(fn func(*Index) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.idx)
+}
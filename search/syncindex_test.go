@@ -0,0 +1,58 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSyncIndex(t *testing.T) {
+	idx := mustIndex(t, memLoader(
+		Document{Name: "pond.md", Content: "the pond in winter"},
+		Document{Name: "city.md", Content: "the city in summer"},
+	), DocOpts{CompactPostings: true, FilterCache: 4})
+	s := NewSyncIndex(idx)
+
+	// searches run alongside changes; go test -race checks they don't race
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := s.Search(context.Background(), []string{"winter", "tag:ice"}, SearchOpts{Limit: 3}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		doc := Document{Name: fmt.Sprintf("pond%d.md", i), Content: "another pond in winter"}
+		if err := s.AddDocument(doc); err != nil {
+			t.Fatal(err)
+		}
+		doc.Content = "another pond in spring"
+		if err := s.UpdateDocument(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RemoveDocument("city.md"); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if doc, _ := s.Document("pond7.md"); doc.Content != "another pond in spring" {
+		t.Errorf("expected pond7.md to be updated, got %+v", doc)
+	}
+	if _, ok := s.Document("city.md"); ok {
+		t.Error("expected city.md to be removed")
+	}
+	s.View(func(idx *Index) error {
+		if idx.DocCount() != 21 {
+			t.Errorf("expected 21 documents, got %d", idx.DocCount())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Abbreviations holds, by language code, the abbreviations that end in a
+// period without ending a sentence, lowercase and without their final
+// period. Add a language, or words to one, before splitting text with it.
+var Abbreviations = map[string]map[string]bool{
+	"en": wordSet([]string{
+		"mr", "mrs", "ms", "dr", "prof", "st", "jr", "sr", "rev", "gen", "col", "capt", "lt", "sgt",
+		"vs", "e.g", "i.e", "cf", "viz", "al", "approx", "vol", "pp", "ch", "fig",
+		"inc", "ltd", "co", "corp", "jan", "feb", "mar", "apr", "jun", "jul", "aug", "sep", "sept",
+		"oct", "nov", "dec", "mt", "ft", "u.s", "u.k",
+	}),
+	"de": wordSet([]string{
+		"hr", "fr", "dr", "prof", "nr", "bzw", "ca", "vgl", "usw", "z.b", "d.h", "u.a", "bd",
+		"evtl", "ggf", "inkl", "jh", "str",
+	}),
+	"fr": wordSet([]string{
+		"mm", "mme", "mlle", "dr", "pr", "st", "ste", "cf", "av", "apr", "env", "vol",
+		"éd",
+	}),
+	"es": wordSet([]string{
+		"sr", "sra", "srta", "dr", "dra", "dña", "pág", "núm", "ud", "uds", "vol", "cap",
+		"p.ej", "av",
+	}),
+}
+
+// DefaultLanguage is the language whose Abbreviations SplitSentences uses
+// when it isn't given one, and the one the index splits documents with
+// for SentenceNGrams and summaries.
+const DefaultLanguage = "en"
+
+// SplitSentences splits text into trimmed sentences at terminal punctuation
+// followed by whitespace, and at blank lines (paragraph breaks). A period
+// doesn't end a sentence after one of the Abbreviations of lang, or after
+// a single letter, as in the initials of "J. S. Mill". These are the rules
+// summaries and SentenceNGrams segment documents by.
+func SplitSentences(text, lang string) []string {
+	if lang == "" {
+		lang = DefaultLanguage
+	}
+	abbreviations := Abbreviations[lang]
+	var sentences []string
+	add := func(s string) {
+		if s = strings.Join(strings.Fields(s), " "); s != "" {
+			sentences = append(sentences, s)
+		}
+	}
+
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '.' && isAbbreviation(runes[start:i], abbreviations):
+		case r == '.' || r == '!' || r == '?':
+			// include closing quotes and brackets in the sentence
+			end := i + 1
+			for end < len(runes) && strings.ContainsRune(`"')]”’`, runes[end]) {
+				end++
+			}
+			if end == len(runes) || unicode.IsSpace(runes[end]) {
+				add(string(runes[start:end]))
+				start = end
+				i = end - 1
+			}
+		case r == '\n' && i+1 < len(runes) && isBlankLine(runes[i+1:]):
+			add(string(runes[start:i]))
+			start = i + 1
+		}
+	}
+	add(string(runes[start:]))
+	return sentences
+}
+
+// isAbbreviation reports whether the last word of runes, which precede a
+// period, is a single letter or one of abbreviations.
+func isAbbreviation(runes []rune, abbreviations map[string]bool) bool {
+	start := len(runes)
+	for start > 0 && !unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	word := strings.TrimLeft(string(runes[start:]), `"'([“‘`)
+	if utf8.RuneCountInString(word) == 1 {
+		return unicode.IsLetter([]rune(word)[0])
+	}
+	return abbreviations[strings.ToLower(word)]
+}
+
+// isBlankLine reports whether runes start with an empty (or whitespace-only) line.
+func isBlankLine(runes []rune) bool {
+	for _, r := range runes {
+		if r == '\n' {
+			return true
+		}
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
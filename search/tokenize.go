@@ -0,0 +1,102 @@
+package search
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenizer turns normalized text into index terms. Its buffers are reused
+// from one document to the next, so tokenizing a corpus allocates only when
+// a document has more words than any before it.
+type tokenizer struct {
+	words  []string
+	bounds []int // end of each sentence in words, see sentences
+	buf    []byte
+}
+
+// split returns the whitespace-separated words of text, as strings.Fields
+// does. The words slice text and are valid until the next call.
+func (t *tokenizer) split(text string) []string {
+	t.words = appendWords(t.words[:0], text)
+	return t.words
+}
+
+// sentences returns the words of text, normalized a sentence at a time, and
+// the index in them at which each sentence ends. They're valid until the
+// next call.
+func (t *tokenizer) sentences(text string, normalize Normalizer) ([]string, []int) {
+	t.words, t.bounds = t.words[:0], t.bounds[:0]
+	for _, sentence := range SplitSentences(text, DefaultLanguage) {
+		t.words = appendWords(t.words, normalize(sentence))
+		if n := len(t.words); len(t.bounds) == 0 || t.bounds[len(t.bounds)-1] < n {
+			t.bounds = append(t.bounds, n)
+		}
+	}
+	return t.words, t.bounds
+}
+
+// appendWords appends the whitespace-separated words of text to words.
+func appendWords(words []string, text string) []string {
+	start := -1
+	for i := 0; i < len(text); {
+		r, size := rune(text[i]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(text[i:])
+		}
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				words = append(words, text[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	if start >= 0 {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// ngrams calls emit with every term that r.terms(words) returns, shortest
+// n-grams first. The term is only valid for the duration of the call.
+// If bounds is non-nil, holding the end of each sentence in words, n-grams
+// don't span sentences.
+func (t *tokenizer) ngrams(words []string, bounds []int, r ngramRange, emit func(term []byte)) {
+	for n := r.min; n <= r.max; n++ {
+		if len(words) < n {
+			// as in ngrams, too few words for an n-gram counts the words again
+			for _, w := range words {
+				t.buf = append(t.buf[:0], w...)
+				emit(t.buf)
+			}
+			continue
+		}
+		if bounds == nil {
+			t.emitNGrams(words, n, emit)
+			continue
+		}
+		start := 0
+		for _, end := range bounds {
+			t.emitNGrams(words[start:end], n, emit)
+			start = end
+		}
+	}
+}
+
+// emitNGrams calls emit with each n-gram of words, if there are n or more.
+func (t *tokenizer) emitNGrams(words []string, n int, emit func(term []byte)) {
+	for i := 0; i+n <= len(words); i++ {
+		t.buf = appendNGram(t.buf[:0], words[i:i+n])
+		emit(t.buf)
+	}
+}
+
+// terms calls emit with each of terms, copied through the scratch buffer.
+func (t *tokenizer) terms(emit func(term []byte), terms ...string) {
+	for _, term := range terms {
+		t.buf = append(t.buf[:0], term...)
+		emit(t.buf)
+	}
+}
@@ -0,0 +1,81 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizerMatchesNGramTerms(t *testing.T) {
+	var tok tokenizer
+	for _, text := range []string{"", "one", "one two", "one two three", " the  pond\tin\nwinter ", "naïve café au lait"} {
+		var got []string
+		tok.ngrams(tok.split(text), nil, defaultNGrams, func(term []byte) { got = append(got, string(term)) })
+		want := defaultNGrams.terms(strings.Fields(text))
+		if len(got)+len(want) > 0 && !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %q, want %q", text, got, want)
+		}
+	}
+}
+
+func benchmarkText(b *testing.B) []string {
+	paths, err := filepath.Glob("../example/docs/*")
+	if err != nil || len(paths) == 0 {
+		b.Fatalf("no example docs: %v", err)
+	}
+	var texts []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		texts = append(texts, DefaultNormalizer(string(data)))
+	}
+	return texts
+}
+
+// BenchmarkTokenizeFields is the allocating path: strings.Fields and ngramRange.terms.
+func BenchmarkTokenizeFields(b *testing.B) {
+	texts := benchmarkText(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, text := range texts {
+			n := 0
+			for _, term := range defaultNGrams.terms(strings.Fields(text)) {
+				n += len(term)
+			}
+		}
+	}
+}
+
+// BenchmarkTokenize is the path build uses, which reuses the tokenizer's buffers.
+func BenchmarkTokenize(b *testing.B) {
+	texts := benchmarkText(b)
+	var tok tokenizer
+	n := 0
+	emit := func(term []byte) { n += len(term) }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, text := range texts {
+			tok.ngrams(tok.split(text), nil, defaultNGrams, emit)
+		}
+	}
+}
+
+func TestTokenizerSentenceNGrams(t *testing.T) {
+	var tok tokenizer
+	words, bounds := tok.sentences("Obey the law. Human rights!\n\nA new paragraph", DefaultNormalizer)
+	var got []string
+	tok.ngrams(words, bounds, ngramRange{1, 2}, func(term []byte) { got = append(got, string(term)) })
+	want := []string{
+		"obey", "the", "law", "human", "rights", "a", "new", "paragraph",
+		"obey the", "the law", "human rights", "a new", "new paragraph",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Transform changes a document after it's loaded and before it's indexed,
+// such as stripping markup the Parser left, redacting personal data or
+// adding computed tags, so corpus-specific cleanup needn't fork a Loader.
+// Entities a transform sets, normalized as field values are, are indexed in
+// place of those of DocOpts.Entities. An error stops the build, or the
+// addition of the document. Set them with DocOpts.Transform, applied in
+// order.
+type Transform func(doc *Document) error
+
+// transform applies the transforms of the index to doc.
+func (idx *Index) transform(doc *Document) error {
+	for _, t := range idx.transforms {
+		if err := t(doc); err != nil {
+			return fmt.Errorf("failed to transform %s: %w", doc.Name, err)
+		}
+	}
+	return nil
+}
+
+// fencedCode matches Markdown fenced code blocks, fences included.
+var fencedCode = regexp.MustCompile("(?ms)^ {0,3}```.*?^ {0,3}```[ \t]*$|^ {0,3}~~~.*?^ {0,3}~~~[ \t]*$")
+
+// StripCodeBlocks removes the fenced code blocks of Markdown documents, so
+// that code doesn't crowd the prose out of searches.
+func StripCodeBlocks(doc *Document) error {
+	doc.Content = fencedCode.ReplaceAllString(doc.Content, "")
+	return nil
+}
+
+// emailAddress matches most email addresses.
+var emailAddress = regexp.MustCompile(`[\w.%+-]+@[\w-]+(?:\.[\w-]+)*\.[A-Za-z]{2,}`)
+
+// RedactEmails replaces the email addresses of documents' content and
+// preview with [email], so they're neither searchable nor shown.
+func RedactEmails(doc *Document) error {
+	doc.Content = emailAddress.ReplaceAllString(doc.Content, "[email]")
+	doc.Preview = emailAddress.ReplaceAllString(doc.Preview, "[email]")
+	return nil
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	docs := memLoader(
+		Document{Name: "notes/pond.md", Content: "The pond in winter.\n\n```go\nfunc frozen() {}\n```\n\nWrite to henry@walden.org"},
+		Document{Name: "notes/city.md", Content: "the city streets"},
+		Document{Name: "notes/town.md", Content: "the town hall"},
+	)
+	tag := func(doc *Document) error {
+		if strings.Contains(doc.Content, "winter") {
+			doc.Entities = map[string][]string{"tag": {"seasonal"}}
+		}
+		return nil
+	}
+	idx := mustIndex(t, docs, DocOpts{Transform: []Transform{StripCodeBlocks, RedactEmails, tag}})
+
+	pond := idx.docs["notes/pond.md"]
+	if strings.Contains(pond.Content, "frozen") || strings.Contains(pond.Content, "henry@") || !strings.Contains(pond.Content, "[email]") {
+		t.Errorf("expected the code and email to be gone, got %q", pond.Content)
+	}
+	if _, ok := idx.tmap["frozen"]; ok {
+		t.Error("expected the code block not to be indexed")
+	}
+	results, err := idx.Search(context.Background(), []string{"tag:seasonal"}, SearchOpts{})
+	if err != nil || len(results) != 1 || results[0].Name != "notes/pond.md" {
+		t.Errorf("expected the tagged document, got %+v (%v)", results, err)
+	}
+
+	added, err := idx.AddDocuments([]Document{{Name: "notes/snow.md", Content: "snow in winter", Length: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.docs["notes/snow.md"].Entities["tag"] == nil {
+		t.Error("expected added documents to be transformed")
+	}
+
+	failing := func(doc *Document) error { return errors.New("no") }
+	if _, err := NewIndex(context.Background(), docs, DocOpts{Transform: []Transform{failing}}); err == nil {
+		t.Error("expected the transform's error")
+	}
+}
@@ -0,0 +1,121 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// bitWriter writes a bitstream forwards, each value's bits above the last
+// one's, as the FSE and Huffman streams and table descriptions are written.
+type bitWriter struct {
+	out   []byte
+	value uint64 // bits not yet in out, from the lowest
+	n     uint   // number of bits in value, under 32 between calls
+}
+
+// addBits writes the low n bits of v, for n up to 32.
+func (w *bitWriter) addBits(v uint64, n uint) {
+	w.value |= (v & (1<<n - 1)) << w.n
+	w.n += n
+	if w.n >= 32 {
+		w.out = append(w.out, byte(w.value), byte(w.value>>8), byte(w.value>>16), byte(w.value>>24))
+		w.value >>= 32
+		w.n -= 32
+	}
+}
+
+// flush writes the bits left, padded with zeros to a whole byte.
+func (w *bitWriter) flush() []byte {
+	for ; w.n > 0; w.n -= min(w.n, 8) {
+		w.out = append(w.out, byte(w.value))
+		w.value >>= 8
+	}
+	return w.out
+}
+
+// close ends a stream to be read backwards with a bit set above its last,
+// and writes what's left.
+func (w *bitWriter) close() []byte {
+	w.addBits(1, 1)
+	return w.flush()
+}
+
+// bitReader reads a bitstream backwards, from the last value written to
+// the first. The highest set bit of the stream's last byte marks its end.
+type bitReader struct {
+	in       []byte
+	off      int    // in[:off] isn't yet in value
+	value    uint64 // bits to read, the next at the top of the lowest n
+	n        uint   // number of bits in value
+	overread uint   // bits read from before the start of the stream, as zeros
+}
+
+func (r *bitReader) init(in []byte) error {
+	if len(in) == 0 || in[len(in)-1] == 0 {
+		return corrupt("bitstream without an end mark")
+	}
+	*r = bitReader{in: in, off: len(in)}
+	r.fill()
+	r.n -= uint(bits.LeadingZeros8(in[len(in)-1])) + 1
+	return nil
+}
+
+// fill loads as many bytes into value as fit.
+func (r *bitReader) fill() {
+	if k := (64 - r.n) / 8; k > 0 && r.off >= 8 {
+		x := binary.LittleEndian.Uint64(r.in[r.off-8:])
+		r.value = r.value<<(8*k) | x>>(64-8*k)
+		r.off -= int(k)
+		r.n += 8 * k
+		return
+	}
+	for r.n <= 56 && r.off > 0 {
+		r.off--
+		r.value = r.value<<8 | uint64(r.in[r.off])
+		r.n += 8
+	}
+}
+
+// readBits reads n bits, for n up to 56, as zeros past the start.
+func (r *bitReader) readBits(n uint) uint64 {
+	if r.n < n {
+		r.refill(n)
+	}
+	r.n -= n
+	return r.value >> r.n & (1<<n - 1)
+}
+
+// refill loads at least n bits into value, counting those past the start.
+func (r *bitReader) refill(n uint) {
+	r.fill()
+	if r.n < n {
+		r.overread += n - r.n
+		r.value <<= n - r.n
+		r.n = n
+	}
+}
+
+// peek returns the next n bits without reading them.
+func (r *bitReader) peek(n uint) uint64 {
+	if r.n < n {
+		r.fill()
+		if r.n < n {
+			return r.value << (n - r.n) & (1<<n - 1)
+		}
+	}
+	return r.value >> (r.n - n) & (1<<n - 1)
+}
+
+// skip reads n bits that were peeked at.
+func (r *bitReader) skip(n uint) {
+	if n > r.n {
+		r.overread += n - r.n
+		n = r.n
+	}
+	r.n -= n
+}
+
+// finished reports whether the stream was read exactly to its start.
+func (r *bitReader) finished() bool {
+	return r.n == 0 && r.off == 0 && r.overread == 0
+}
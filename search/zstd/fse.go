@@ -0,0 +1,333 @@
+package zstd
+
+import (
+	"math"
+	"math/bits"
+)
+
+// FSE (finite state entropy) coding, a form of asymmetric numeral systems,
+// codes the sequences' literals lengths, match lengths and offsets, and
+// the weights of Huffman tables. A distribution of symbols, normalized to
+// sum to 1<<log, is spread over a table of as many states; a decoder in a
+// state emits its symbol and reads bits to find its next state.
+
+// fseEntry is the decoding of a state: its symbol, and the next state, base
+// plus the value of the nbBits bits read.
+type fseEntry struct {
+	symbol uint8
+	nbBits uint8
+	base   uint16
+}
+
+type fseTable struct {
+	log     uint8
+	entries []fseEntry
+}
+
+// spread returns the symbol of each state of the distribution norm, in
+// which -1 stands for a probability under 1, or false if norm doesn't
+// spread evenly.
+func spread(norm []int16, log uint8) ([]uint8, bool) {
+	size := 1 << log
+	symbols := make([]uint8, size)
+	high := size - 1
+	for s, n := range norm {
+		if n == -1 {
+			symbols[high] = uint8(s)
+			high--
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s, n := range norm {
+		for i := 0; i < int(n); i++ {
+			symbols[pos] = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	return symbols, pos == 0
+}
+
+// build builds the decoding table of the distribution norm.
+func (t *fseTable) build(norm []int16, log uint8) error {
+	symbols, ok := spread(norm, log)
+	if !ok {
+		return corrupt("FSE distribution doesn't spread")
+	}
+	size := uint16(1) << log
+	next := make([]uint16, len(norm))
+	for s, n := range norm {
+		next[s] = uint16(max(n, 1))
+	}
+	t.log = log
+	t.entries = make([]fseEntry, size)
+	for u, s := range symbols {
+		x := next[s]
+		next[s]++
+		nb := log + 1 - uint8(bits.Len16(x))
+		t.entries[u] = fseEntry{symbol: s, nbBits: nb, base: x<<nb - size}
+	}
+	return nil
+}
+
+// mustTable returns the decoding table of a predefined distribution.
+func mustTable(norm []int16, log uint8) *fseTable {
+	t := new(fseTable)
+	if err := t.build(norm, log); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// rleTable returns the table of a single symbol, which takes no bits.
+func rleTable(symbol uint8) *fseTable {
+	return &fseTable{entries: []fseEntry{{symbol: symbol}}}
+}
+
+// readNCount reads a distribution's description from the start of in, of
+// symbols up to maxSymbol at an accuracy log up to maxLog, and returns it
+// and its length in bytes.
+func readNCount(in []byte, maxSymbol int, maxLog uint8) ([]int16, uint8, int, error) {
+	pos := 0 // in bits
+	peek := func(n int) int32 {
+		var v uint32
+		for i := 0; i < n; i++ {
+			if b := (pos + i) >> 3; b < len(in) && in[b]>>((pos+i)&7)&1 != 0 {
+				v |= 1 << i
+			}
+		}
+		return int32(v)
+	}
+
+	log := uint8(peek(4)) + 5
+	pos += 4
+	if log > maxLog {
+		return nil, 0, 0, corrupt("FSE accuracy too high")
+	}
+	remaining := int32(1)<<log + 1
+	threshold := int32(1) << log
+	nbBits := int(log) + 1
+	var norm []int16
+	prev0 := false
+	for remaining > 1 {
+		if prev0 {
+			// 2 bits at a time, 3 meaning there are more
+			for repeat := int32(3); repeat == 3 && len(norm) <= maxSymbol; {
+				repeat = peek(2)
+				pos += 2
+				for i := int32(0); i < repeat; i++ {
+					norm = append(norm, 0)
+				}
+			}
+		}
+		if len(norm) > maxSymbol {
+			return nil, 0, 0, corrupt("FSE distribution of too many symbols")
+		}
+		max := 2*threshold - 1 - remaining
+		var count int32
+		if low := peek(nbBits-1) & (threshold - 1); low < max {
+			count = low
+			pos += nbBits - 1
+		} else {
+			count = peek(nbBits) & (2*threshold - 1)
+			if count >= threshold {
+				count -= max
+			}
+			pos += nbBits
+		}
+		count-- // -1 is a probability under 1
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		if remaining < 1 {
+			return nil, 0, 0, corrupt("invalid FSE distribution")
+		}
+		norm = append(norm, int16(count))
+		prev0 = count == 0
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	n := (pos + 7) >> 3
+	if remaining != 1 || n > len(in) {
+		return nil, 0, 0, corrupt("invalid FSE distribution")
+	}
+	return norm, log, n, nil
+}
+
+// appendNCount appends the description of the distribution norm, whose
+// last symbol's count isn't 0.
+func appendNCount(out []byte, norm []int16, log uint8) []byte {
+	w := bitWriter{out: out}
+	w.addBits(uint64(log-5), 4)
+	remaining := int32(1)<<log + 1
+	threshold := int32(1) << log
+	nbBits := uint(log) + 1
+	prev0 := false
+	for s := 0; s < len(norm) && remaining > 1; {
+		if prev0 {
+			start := s
+			for norm[s] == 0 {
+				s++
+			}
+			for ; s >= start+24; start += 24 {
+				w.addBits(0xffff, 16)
+			}
+			for ; s >= start+3; start += 3 {
+				w.addBits(3, 2)
+			}
+			w.addBits(uint64(s-start), 2)
+		}
+		count := int32(norm[s])
+		s++
+		max := 2*threshold - 1 - remaining
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		count++
+		if count >= threshold {
+			count += max
+		}
+		if count < max {
+			w.addBits(uint64(count), nbBits-1)
+		} else {
+			w.addBits(uint64(count), nbBits)
+		}
+		prev0 = count == 1
+		for remaining < threshold && threshold > 1 {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	return w.flush()
+}
+
+// optimalLog returns the accuracy log for coding n symbols of values up to
+// maxSymbol, at most maxLog.
+func optimalLog(n, maxSymbol int, maxLog uint8) uint8 {
+	log := int(maxLog)
+	if fromSize := bits.Len(uint(n-1)) - 3; fromSize < log {
+		log = fromSize
+	}
+	if minLog := min(bits.Len(uint(n)), bits.Len(uint(maxSymbol))+1); minLog > log {
+		log = minLog
+	}
+	return uint8(min(max(log, 5), int(maxLog)))
+}
+
+// normalize scales counts, of total, to a distribution summing to 1<<log
+// in which every symbol counted has at least 1.
+func normalize(counts []uint32, total int, log uint8) []int16 {
+	norm := make([]int16, len(counts))
+	size := 1 << log
+	sum, largest := 0, 0
+	for s, c := range counts {
+		if c == 0 {
+			continue
+		}
+		n := max(int((uint64(c)<<log+uint64(total)/2)/uint64(total)), 1)
+		norm[s] = int16(n)
+		sum += n
+		if c > counts[largest] {
+			largest = s
+		}
+	}
+	// the rounding is made up by the largest symbol, or if it hasn't enough
+	// to take, by the largest in turn
+	diff := size - sum
+	for int(norm[largest])+diff <= 0 {
+		diff += int(norm[largest]) - 1
+		norm[largest] = 1
+		for s, n := range norm {
+			if n > norm[largest] {
+				largest = s
+			}
+		}
+	}
+	norm[largest] += int16(diff)
+	return norm
+}
+
+// cost returns an estimate of the bits taken to code counts with the
+// distribution norm, or +Inf if it can't code them.
+func cost(counts []uint32, norm []int16, log uint8) float64 {
+	total := 0.0
+	for s, c := range counts {
+		switch {
+		case c == 0:
+		case s >= len(norm) || norm[s] == 0:
+			return math.Inf(1)
+		default:
+			total += float64(c) * (float64(log) - math.Log2(float64(max(norm[s], 1))))
+		}
+	}
+	return total
+}
+
+// fseEncoder codes symbols with a distribution, in reverse: it moves from
+// the state a decoder is to end up in to the one emitting a symbol, and
+// writes the bits the decoder reads to get from that one to this.
+type fseEncoder struct {
+	log     uint8
+	states  []uint16 // of each symbol in turn, in the order they're numbered
+	symbols []fseSymbol
+}
+
+type fseSymbol struct {
+	first     uint32 // index of the symbol's first state in states
+	count     uint32
+	nbBits    uint8  // most bits read moving from a state of the symbol
+	threshold uint32 // next states from here on, plus the table size, take nbBits
+}
+
+// build builds the encoder of the distribution norm.
+func (e *fseEncoder) build(norm []int16, log uint8) {
+	symbols, _ := spread(norm, log)
+	e.log = log
+	e.states = make([]uint16, 1<<log)
+	e.symbols = make([]fseSymbol, len(norm))
+	first := uint32(0)
+	for s, n := range norm {
+		if n == 0 {
+			continue
+		}
+		count := uint32(max(n, 1))
+		nb := log + 1 - uint8(bits.Len32(count))
+		e.symbols[s] = fseSymbol{first: first, nbBits: nb, threshold: count << nb}
+		first += count
+	}
+	for u, s := range symbols {
+		sym := &e.symbols[s]
+		e.states[sym.first+sym.count] = uint16(u)
+		sym.count++
+	}
+}
+
+// initial returns the first state of symbol s, for the last symbol coded.
+// It takes the most bits to move from, at least 1 unless s is the only
+// symbol.
+func (e *fseEncoder) initial(s uint8) uint16 {
+	return e.states[e.symbols[s].first]
+}
+
+// encode returns the state emitting s that moves to state, and writes the
+// bits the move reads.
+func (e *fseEncoder) encode(w *bitWriter, state uint16, s uint8) uint16 {
+	sym := &e.symbols[s]
+	v := uint32(state) + 1<<e.log
+	nb := uint(sym.nbBits)
+	if v < sym.threshold {
+		nb--
+	}
+	w.addBits(uint64(v), nb)
+	return e.states[sym.first+v>>nb-sym.count]
+}
@@ -0,0 +1,396 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sort"
+)
+
+// Huffman coding of literals. A table is described by the weight of each
+// byte value, the number of bits of its code being maxBits+1-weight, or
+// none for a weight of 0. The last value's weight is left out: it's what
+// completes the tree.
+
+const (
+	huffMaxBits    = 11
+	huffMaxWeights = 255
+	huffWeightsLog = 6 // the most accuracy of the FSE coding of weights
+)
+
+type huffEntry struct {
+	symbol uint8
+	nbBits uint8
+}
+
+type huffTable struct {
+	log     uint8 // maxBits, the longest code
+	entries []huffEntry
+}
+
+// readHuffman reads a Huffman table's description from the start of in,
+// and returns its length in bytes.
+func readHuffman(in []byte) (*huffTable, int, error) {
+	if len(in) == 0 {
+		return nil, 0, corrupt("missing Huffman table")
+	}
+	var weights [huffMaxWeights + 1]uint8
+	var nw, n int
+	if header := int(in[0]); header >= 128 {
+		nw = header - 127
+		n = 1 + (nw+1)/2
+		if n > len(in) {
+			return nil, 0, corrupt("truncated Huffman table")
+		}
+		for i := 0; i < nw; i++ {
+			b := in[1+i/2]
+			if i%2 == 0 {
+				b >>= 4
+			}
+			weights[i] = b & 15
+		}
+	} else {
+		n = 1 + header
+		if n > len(in) {
+			return nil, 0, corrupt("truncated Huffman table")
+		}
+		var err error
+		if nw, err = readWeights(in[1:n], &weights); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var rank [huffMaxBits + 2]uint32 // the number of values of each weight
+	total := uint32(0)
+	for _, w := range weights[:nw] {
+		if w > huffMaxBits {
+			return nil, 0, corrupt("Huffman weight too large")
+		}
+		rank[w]++
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, corrupt("empty Huffman table")
+	}
+	maxBits := uint8(bits.Len32(total))
+	left := uint32(1)<<maxBits - total
+	if maxBits > huffMaxBits || left&(left-1) != 0 {
+		return nil, 0, corrupt("incomplete Huffman table")
+	}
+	last := uint8(bits.Len32(left))
+	weights[nw] = last
+	rank[last]++
+	nw++
+
+	// the values of each weight take a run of the table, the lowest first
+	start := uint32(0)
+	for w := 1; w <= int(maxBits); w++ {
+		start, rank[w] = start+rank[w]<<(w-1), start
+	}
+	t := &huffTable{log: maxBits, entries: make([]huffEntry, 1<<maxBits)}
+	for s, w := range weights[:nw] {
+		if w == 0 {
+			continue
+		}
+		entry := huffEntry{symbol: uint8(s), nbBits: maxBits + 1 - w}
+		length := uint32(1) << (w - 1)
+		for i := rank[w]; i < rank[w]+length; i++ {
+			t.entries[i] = entry
+		}
+		rank[w] += length
+	}
+	return t, n, nil
+}
+
+// readWeights decodes the FSE-coded weights in into weights, and returns
+// how many there are. They're coded with two states taking turns, the
+// first emitting the first weight, which share one bitstream; the weights
+// end when the stream does.
+func readWeights(in []byte, weights *[huffMaxWeights + 1]uint8) (int, error) {
+	norm, log, n, err := readNCount(in, huffMaxBits, huffWeightsLog)
+	if err != nil {
+		return 0, err
+	}
+	var t fseTable
+	if err := t.build(norm, log); err != nil {
+		return 0, err
+	}
+	var br bitReader
+	if err := br.init(in[n:]); err != nil {
+		return 0, err
+	}
+	states := [2]uint16{uint16(br.readBits(uint(log))), uint16(br.readBits(uint(log)))}
+	if br.overread > 0 {
+		return 0, corrupt("truncated Huffman weights")
+	}
+	nw := 0
+	for i := 0; ; i ^= 1 {
+		if nw+2 > huffMaxWeights {
+			return 0, corrupt("too many Huffman weights")
+		}
+		e := t.entries[states[i]]
+		weights[nw] = e.symbol
+		nw++
+		states[i] = e.base + uint16(br.readBits(uint(e.nbBits)))
+		if br.overread > 0 {
+			weights[nw] = t.entries[states[i^1]].symbol
+			return nw + 1, nil
+		}
+	}
+}
+
+// decode decodes a stream coded with the table into out, which it fills.
+func (t *huffTable) decode(out, in []byte) error {
+	var br bitReader
+	if err := br.init(in); err != nil {
+		return err
+	}
+	log := uint(t.log)
+	for i := range out {
+		e := t.entries[br.peek(log)]
+		out[i] = e.symbol
+		br.skip(uint(e.nbBits))
+	}
+	if !br.finished() {
+		return corrupt("Huffman stream of the wrong length")
+	}
+	return nil
+}
+
+// decodeLiterals decodes literals coded in one stream or four into out.
+func (t *huffTable) decodeLiterals(out, in []byte, streams int) error {
+	if streams == 1 {
+		return t.decode(out, in)
+	}
+	if len(in) < 6 {
+		return corrupt("truncated jump table")
+	}
+	sizes := [4]int{
+		int(binary.LittleEndian.Uint16(in)),
+		int(binary.LittleEndian.Uint16(in[2:])),
+		int(binary.LittleEndian.Uint16(in[4:])),
+	}
+	in = in[6:]
+	sizes[3] = len(in) - sizes[0] - sizes[1] - sizes[2]
+	segment := (len(out) + 3) / 4
+	if sizes[3] < 0 || 3*segment > len(out) {
+		return corrupt("invalid jump table")
+	}
+	for i, size := range sizes {
+		end := min((i+1)*segment, len(out))
+		if i == 3 {
+			end = len(out)
+		}
+		if err := t.decode(out[i*segment:end], in[:size]); err != nil {
+			return err
+		}
+		in = in[size:]
+	}
+	return nil
+}
+
+// huffEncoder is a Huffman table for coding literals.
+type huffEncoder struct {
+	maxBits uint8
+	nbBits  [256]uint8
+	codes   [256]uint16
+	last    int // the highest value coded
+}
+
+// build builds a table for the values counted, of which there must be at
+// least two, with codes of at most huffMaxBits.
+func (h *huffEncoder) build(counts *[256]uint32) {
+	type node struct {
+		count       uint64
+		left, right int
+	}
+	var nodes []node
+	for s, c := range counts {
+		if c > 0 {
+			nodes = append(nodes, node{count: uint64(c), left: -1, right: s})
+			h.last = s
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].count < nodes[j].count })
+
+	// two queues: the leaves in order of count, then the internal nodes,
+	// which are made in order of count
+	leaves := len(nodes)
+	nextLeaf, nextNode := 0, leaves
+	pick := func() int {
+		if nextLeaf < leaves && (nextNode == len(nodes) || nodes[nextLeaf].count <= nodes[nextNode].count) {
+			nextLeaf++
+			return nextLeaf - 1
+		}
+		nextNode++
+		return nextNode - 1
+	}
+	for len(nodes) < 2*leaves-1 {
+		a, b := pick(), pick()
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, left: a, right: b})
+	}
+	depth := make([]uint8, len(nodes))
+	h.nbBits = [256]uint8{}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if n := nodes[i]; n.left >= 0 {
+			depth[n.left], depth[n.right] = depth[i]+1, depth[i]+1
+		} else {
+			h.nbBits[n.right] = depth[i]
+		}
+	}
+	h.limit()
+
+	h.maxBits = 0
+	for _, nb := range h.nbBits {
+		h.maxBits = max(h.maxBits, nb)
+	}
+	// codes are numbered as a decoder's table is filled
+	var rank [huffMaxBits + 2]uint32
+	for _, nb := range h.nbBits {
+		if nb > 0 {
+			rank[h.maxBits+1-nb]++
+		}
+	}
+	start := uint32(0)
+	for w := 1; w <= int(h.maxBits); w++ {
+		start, rank[w] = start+rank[w]<<(w-1), start
+	}
+	for s, nb := range h.nbBits {
+		if nb > 0 {
+			w := h.maxBits + 1 - nb
+			h.codes[s] = uint16(rank[w] >> (w - 1))
+			rank[w] += 1 << (w - 1)
+		}
+	}
+}
+
+// limit shortens codes longer than huffMaxBits, lengthening others to
+// make room, so that the codes still fill the tree exactly.
+func (h *huffEncoder) limit() {
+	const full = 1 << huffMaxBits
+	kraft := 0 // the tree's fill, in units of the longest code
+	for s, nb := range h.nbBits {
+		if nb > huffMaxBits {
+			h.nbBits[s] = huffMaxBits
+		}
+		if nb > 0 {
+			kraft += full >> h.nbBits[s]
+		}
+	}
+	// lengthen the longest codes that are still short enough, which costs least
+	for kraft > full {
+		best := -1
+		for s, nb := range h.nbBits {
+			if nb > 0 && nb < huffMaxBits && (best < 0 || nb > h.nbBits[best]) {
+				best = s
+			}
+		}
+		kraft -= full >> (h.nbBits[best] + 1)
+		h.nbBits[best]++
+	}
+	// then fill what's left by shortening the longest codes
+	for kraft < full {
+		best := -1
+		for s, nb := range h.nbBits {
+			if nb > 1 && full>>nb <= full-kraft && (best < 0 || nb > h.nbBits[best]) {
+				best = s
+			}
+		}
+		kraft += full >> h.nbBits[best]
+		h.nbBits[best]--
+	}
+}
+
+// appendTable appends the description of the table, or returns false if
+// it can't be described.
+func (h *huffEncoder) appendTable(out []byte) ([]byte, bool) {
+	var weights [256]uint8
+	for s, nb := range h.nbBits[:h.last] {
+		if nb > 0 {
+			weights[s] = h.maxBits + 1 - nb
+		}
+	}
+	nw := h.last
+	if coded, ok := appendWeights(out, weights[:nw]); ok && (nw > 128 || len(coded)-len(out) < 1+(nw+1)/2) {
+		return coded, true
+	}
+	if nw > 128 {
+		return out, false
+	}
+	out = append(out, byte(127+nw))
+	for i := 0; i < nw; i += 2 {
+		out = append(out, weights[i]<<4|weights[i+1])
+	}
+	return out, true
+}
+
+// appendWeights appends weights coded with FSE, as readWeights decodes
+// them, or returns false if they can't be.
+func appendWeights(out []byte, weights []uint8) ([]byte, bool) {
+	var counts [huffMaxBits + 1]uint32
+	maxWeight := 0
+	for _, w := range weights {
+		counts[w]++
+		maxWeight = max(maxWeight, int(w))
+	}
+	if len(weights) < 2 || int(counts[weights[0]]) == len(weights) {
+		return out, false // a single symbol's states read no bits, so can't end the stream
+	}
+	log := optimalLog(len(weights), maxWeight, huffWeightsLog)
+	norm := normalize(counts[:maxWeight+1], len(weights), log)
+	var e fseEncoder
+	e.build(norm, log)
+
+	start := len(out)
+	out = appendNCount(append(out, 0), norm, log)
+	w := bitWriter{out: out}
+	// the state of the last weight decoded moves on to nothing, and that
+	// of the one before to past the start of the stream, which ends it
+	n := len(weights)
+	var states [2]uint16
+	states[(n-1)&1] = e.initial(weights[n-1])
+	states[(n-2)&1] = e.initial(weights[n-2])
+	for i := n - 3; i >= 0; i-- {
+		states[i&1] = e.encode(&w, states[i&1], weights[i])
+	}
+	w.addBits(uint64(states[1]), uint(log))
+	w.addBits(uint64(states[0]), uint(log))
+	out = w.close()
+	if size := len(out) - start - 1; size < 128 {
+		out[start] = byte(size)
+		return out, true
+	}
+	return out[:start], false
+}
+
+// encode appends src coded in one stream.
+func (h *huffEncoder) encode(out, src []byte) []byte {
+	w := bitWriter{out: out}
+	for i := len(src) - 1; i >= 0; i-- {
+		s := src[i]
+		w.addBits(uint64(h.codes[s]), uint(h.nbBits[s]))
+	}
+	return w.close()
+}
+
+// encodeLiterals appends src coded in four streams after a jump table,
+// which is false if a stream is too long for it.
+func (h *huffEncoder) encodeLiterals(out, src []byte) ([]byte, bool) {
+	start := len(out)
+	out = append(out, make([]byte, 6)...)
+	segment := (len(src) + 3) / 4
+	for i := 0; i < 4; i++ {
+		begin := len(out)
+		out = h.encode(out, src[min(i*segment, len(src)):min((i+1)*segment, len(src))])
+		if i == 3 {
+			break
+		}
+		size := len(out) - begin
+		if size > 0xffff {
+			return out[:start], false
+		}
+		binary.LittleEndian.PutUint16(out[start+2*i:], uint16(size))
+	}
+	return out, true
+}
@@ -0,0 +1,507 @@
+package zstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Predefined decoding tables of the sequences' codes.
+var (
+	llPredefined = mustTable(llDefault, llDefaultLog)
+	mlPredefined = mustTable(mlDefault, mlDefaultLog)
+	ofPredefined = mustTable(ofDefault, ofDefaultLog)
+)
+
+// Reader decompresses a zstd stream of one or more frames.
+type Reader struct {
+	r   *bufio.Reader
+	err error // to return once what's decoded has been read
+
+	out  []byte // decoded data, the window of matches before what's unread
+	read int    // out[:read] has been read
+
+	// the state of the frame being decoded
+	inFrame  bool
+	frames   int
+	window   int
+	size     int64 // of the frame's content, or -1 if not given
+	written  int64
+	checksum bool
+	hash     xxh64
+	reps     reps
+	huff     *huffTable
+	tables   [3]*fseTable // literals lengths, offsets and match lengths
+
+	block    []byte
+	literals []byte
+}
+
+// NewReader returns a Reader decompressing r.
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{r: br}
+}
+
+// Read reads decompressed data.
+func (z *Reader) Read(p []byte) (int, error) {
+	for z.read == len(z.out) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n := copy(p, z.out[z.read:])
+	z.read += n
+	return n, nil
+}
+
+// Close releases the Reader's buffers. It doesn't close the underlying
+// reader.
+func (z *Reader) Close() error {
+	z.out, z.block, z.literals = nil, nil, nil
+	if z.err == nil {
+		z.err = errors.New("zstd: reader closed")
+	}
+	return nil
+}
+
+// next decodes a frame header or a block.
+func (z *Reader) next() error {
+	// everything has been read, so only the window need be kept
+	if len(z.out) >= 2*z.window+maxBlockSize {
+		keep := copy(z.out, z.out[len(z.out)-z.window:])
+		z.out = z.out[:keep]
+		z.read = keep
+	}
+	if !z.inFrame {
+		return z.frameHeader()
+	}
+	return z.nextBlock()
+}
+
+// unexpected returns the error of a stream ending early.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (z *Reader) frameHeader() error {
+	var magic [4]byte
+	if _, err := io.ReadFull(z.r, magic[:]); err != nil {
+		if err == io.EOF && z.frames > 0 {
+			return io.EOF
+		}
+		return unexpected(err)
+	}
+	switch m := binary.LittleEndian.Uint32(magic[:]); {
+	case m&skippableMask == skippableMagic:
+		if _, err := io.ReadFull(z.r, magic[:]); err != nil {
+			return unexpected(err)
+		}
+		n := int64(binary.LittleEndian.Uint32(magic[:]))
+		if _, err := io.CopyN(io.Discard, z.r, n); err != nil {
+			return unexpected(err)
+		}
+		z.frames++
+		return nil
+	case m != frameMagic:
+		return corrupt("unknown frame")
+	}
+
+	fhd, err := z.r.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	single := fhd&0x20 != 0
+	if fhd&0x08 != 0 {
+		return corrupt("reserved frame header bit set")
+	}
+	n := [4]int{0, 1, 2, 4}[fhd&3] + [4]int{0, 2, 4, 8}[fhd>>6]
+	if !single {
+		n++
+	} else if fhd>>6 == 0 {
+		n++
+	}
+	var header [14]byte
+	h := header[:n]
+	if _, err := io.ReadFull(z.r, h); err != nil {
+		return unexpected(err)
+	}
+	var window int64
+	if !single {
+		exp, mantissa := h[0]>>3, h[0]&7
+		base := int64(1) << (10 + exp)
+		window = base + base/8*int64(mantissa)
+		h = h[1:]
+	}
+	if dictSize := [4]int{0, 1, 2, 4}[fhd&3]; dictSize > 0 {
+		var id uint32
+		for i, b := range h[:dictSize] {
+			id |= uint32(b) << (8 * i)
+		}
+		if id != 0 {
+			return fmt.Errorf("zstd: frame needs dictionary %d, and dictionaries aren't supported", id)
+		}
+		h = h[dictSize:]
+	}
+	z.size = -1
+	switch len(h) {
+	case 1:
+		z.size = int64(h[0])
+	case 2:
+		z.size = int64(binary.LittleEndian.Uint16(h)) + 256
+	case 4:
+		z.size = int64(binary.LittleEndian.Uint32(h))
+	case 8:
+		z.size = int64(binary.LittleEndian.Uint64(h))
+		if z.size < 0 {
+			return corrupt("content size too large")
+		}
+	}
+	if single {
+		window = min(z.size, maxWindowSize+1)
+	}
+	if window > maxWindowSize {
+		return fmt.Errorf("zstd: window of %d bytes is over the maximum of %d", window, maxWindowSize)
+	}
+
+	z.inFrame = true
+	z.frames++
+	z.window = int(window)
+	z.written = 0
+	z.checksum = fhd&0x04 != 0
+	z.hash.reset()
+	z.reps = initialReps
+	z.huff = nil
+	z.tables = [3]*fseTable{}
+	return nil
+}
+
+// blockMax returns the most bytes a block of the frame may have.
+func (z *Reader) blockMax() int {
+	return min(z.window, maxBlockSize)
+}
+
+func (z *Reader) nextBlock() error {
+	var header [3]byte
+	if _, err := io.ReadFull(z.r, header[:]); err != nil {
+		return unexpected(err)
+	}
+	h := uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16
+	last := h&1 != 0
+	size := int(h >> 3)
+	if size > z.blockMax() {
+		return corrupt("block too large")
+	}
+	start := len(z.out)
+	switch (h >> 1) & 3 {
+	case blockRaw:
+		z.out = append(z.out, make([]byte, size)...)
+		if _, err := io.ReadFull(z.r, z.out[start:]); err != nil {
+			return unexpected(err)
+		}
+	case blockRLE:
+		b, err := z.r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		for i := 0; i < size; i++ {
+			z.out = append(z.out, b)
+		}
+	case blockCompressed:
+		if cap(z.block) < size {
+			z.block = make([]byte, size)
+		}
+		z.block = z.block[:size]
+		if _, err := io.ReadFull(z.r, z.block); err != nil {
+			return unexpected(err)
+		}
+		if err := z.decompressBlock(z.block, start); err != nil {
+			return err
+		}
+		if len(z.out)-start > z.blockMax() {
+			return corrupt("block decompresses too large")
+		}
+	default:
+		return corrupt("reserved block type")
+	}
+	z.written += int64(len(z.out) - start)
+	if z.checksum {
+		z.hash.write(z.out[start:])
+	}
+	if last {
+		return z.endFrame()
+	}
+	return nil
+}
+
+func (z *Reader) endFrame() error {
+	z.inFrame = false
+	if z.size >= 0 && z.written != z.size {
+		return corrupt("frame of the wrong size")
+	}
+	if !z.checksum {
+		return nil
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(z.r, sum[:]); err != nil {
+		return unexpected(err)
+	}
+	if binary.LittleEndian.Uint32(sum[:]) != uint32(z.hash.sum()) {
+		return corrupt("checksum mismatch")
+	}
+	return nil
+}
+
+// decompressBlock decodes a compressed block, appending it to out from
+// start.
+func (z *Reader) decompressBlock(in []byte, start int) error {
+	n, err := z.decodeLiterals(in)
+	if err != nil {
+		return err
+	}
+	in = in[n:]
+	if len(in) == 0 {
+		return corrupt("missing sequences section")
+	}
+	nbSeq := int(in[0])
+	switch {
+	case nbSeq == 0:
+		z.out = append(z.out, z.literals...)
+		return nil
+	case nbSeq < 128:
+		in = in[1:]
+	case nbSeq < 255:
+		if len(in) < 2 {
+			return corrupt("truncated sequences header")
+		}
+		nbSeq = (nbSeq-128)<<8 | int(in[1])
+		in = in[2:]
+	default:
+		if len(in) < 3 {
+			return corrupt("truncated sequences header")
+		}
+		nbSeq = int(binary.LittleEndian.Uint16(in[1:])) + 0x7f00
+		in = in[3:]
+	}
+	if len(in) == 0 {
+		return corrupt("truncated sequences header")
+	}
+	modes := in[0]
+	if modes&3 != 0 {
+		return corrupt("reserved sequences modes set")
+	}
+	in = in[1:]
+	for i, kind := range [3]struct {
+		predefined *fseTable
+		maxCode    int
+		maxLog     uint8
+	}{
+		{llPredefined, llMaxCode, llMaxLog},
+		{ofPredefined, ofMaxCode, ofMaxLog},
+		{mlPredefined, mlMaxCode, mlMaxLog},
+	} {
+		switch modes >> (6 - 2*i) & 3 {
+		case modePredefined:
+			z.tables[i] = kind.predefined
+		case modeRLE:
+			if len(in) == 0 || int(in[0]) > kind.maxCode {
+				return corrupt("invalid RLE code")
+			}
+			z.tables[i] = rleTable(in[0])
+			in = in[1:]
+		case modeCompressed:
+			norm, log, n, err := readNCount(in, kind.maxCode, kind.maxLog)
+			if err != nil {
+				return err
+			}
+			t := new(fseTable)
+			if err := t.build(norm, log); err != nil {
+				return err
+			}
+			z.tables[i] = t
+			in = in[n:]
+		case modeRepeat:
+			if z.tables[i] == nil {
+				return corrupt("repeated table without one before")
+			}
+		}
+	}
+	return z.execute(in, nbSeq, start)
+}
+
+// decodeLiterals decodes the literals section at the start of in into
+// literals, and returns its length.
+func (z *Reader) decodeLiterals(in []byte) (int, error) {
+	if len(in) == 0 {
+		return 0, corrupt("missing literals section")
+	}
+	typ, format := in[0]&3, in[0]>>2&3
+	if typ == 0 || typ == 1 { // raw or RLE
+		var size, n int
+		switch format {
+		case 0, 2:
+			size, n = int(in[0]>>3), 1
+		case 1:
+			if len(in) < 2 {
+				return 0, corrupt("truncated literals header")
+			}
+			size, n = int(in[0]>>4)|int(in[1])<<4, 2
+		case 3:
+			if len(in) < 3 {
+				return 0, corrupt("truncated literals header")
+			}
+			size, n = int(in[0]>>4)|int(in[1])<<4|int(in[2])<<12, 3
+		}
+		if size > z.blockMax() {
+			return 0, corrupt("too many literals")
+		}
+		if typ == 0 {
+			if n+size > len(in) {
+				return 0, corrupt("truncated literals")
+			}
+			z.literals = append(z.literals[:0], in[n:n+size]...)
+			return n + size, nil
+		}
+		if n >= len(in) {
+			return 0, corrupt("truncated literals")
+		}
+		z.literals = z.literals[:0]
+		for i := 0; i < size; i++ {
+			z.literals = append(z.literals, in[n])
+		}
+		return n + 1, nil
+	}
+
+	// compressed, with a Huffman table or with the last one
+	n := [4]int{3, 3, 4, 5}[format]
+	if len(in) < n {
+		return 0, corrupt("truncated literals header")
+	}
+	var h uint64
+	for i := n - 1; i >= 0; i-- {
+		h = h<<8 | uint64(in[i])
+	}
+	sizeBits := [4]uint{10, 10, 14, 18}[format]
+	size := int(h >> 4 & (1<<sizeBits - 1))
+	compressed := int(h >> (4 + sizeBits) & (1<<sizeBits - 1))
+	if size > z.blockMax() {
+		return 0, corrupt("too many literals")
+	}
+	if n+compressed > len(in) {
+		return 0, corrupt("truncated literals")
+	}
+	data := in[n : n+compressed]
+	if typ == 2 {
+		t, k, err := readHuffman(data)
+		if err != nil {
+			return 0, err
+		}
+		z.huff = t
+		data = data[k:]
+	} else if z.huff == nil {
+		return 0, corrupt("repeated Huffman table without one before")
+	}
+	if cap(z.literals) < size {
+		z.literals = make([]byte, size)
+	}
+	z.literals = z.literals[:size]
+	streams := 4
+	if format == 0 {
+		streams = 1
+	}
+	if err := z.huff.decodeLiterals(z.literals, data, streams); err != nil {
+		return 0, err
+	}
+	return n + compressed, nil
+}
+
+// execute decodes nbSeq sequences from the bitstream in, and appends the
+// literals and matches they stand for to out, whose block starts at start.
+func (z *Reader) execute(in []byte, nbSeq, start int) error {
+	var br bitReader
+	if err := br.init(in); err != nil {
+		return err
+	}
+	ll, of, ml := z.tables[0], z.tables[1], z.tables[2]
+	llState := br.readBits(uint(ll.log))
+	ofState := br.readBits(uint(of.log))
+	mlState := br.readBits(uint(ml.log))
+	literals := z.literals
+	z.out = slices.Grow(z.out, z.blockMax()+16)
+	for i := 0; i < nbSeq; i++ {
+		llEntry, ofEntry, mlEntry := ll.entries[llState], of.entries[ofState], ml.entries[mlState]
+		ofCode := ofEntry.symbol
+		ov := uint32(1)<<ofCode + uint32(br.readBits(uint(ofCode)))
+		matchLen := mlBase[mlEntry.symbol] + uint32(br.readBits(uint(mlBits[mlEntry.symbol])))
+		litLen := llBase[llEntry.symbol] + uint32(br.readBits(uint(llBits[llEntry.symbol])))
+		if i < nbSeq-1 {
+			llState = uint64(llEntry.base) + br.readBits(uint(llEntry.nbBits))
+			mlState = uint64(mlEntry.base) + br.readBits(uint(mlEntry.nbBits))
+			ofState = uint64(ofEntry.base) + br.readBits(uint(ofEntry.nbBits))
+		}
+		if br.overread > 0 {
+			return corrupt("truncated sequences")
+		}
+
+		if int(litLen) > len(literals) {
+			return corrupt("sequence of more literals than there are")
+		}
+		z.out = appendShort(z.out, literals, int(litLen))
+		literals = literals[litLen:]
+		offset := int(z.reps.offset(ov, litLen))
+		// matches refer only to the frame's own data
+		frame := z.written + int64(len(z.out)-start)
+		if offset == 0 || int64(offset) > frame || offset > z.window {
+			return corrupt("match offset out of range")
+		}
+		if int(matchLen) > z.blockMax() {
+			return corrupt("match too long")
+		}
+		if o := len(z.out); offset >= 8 && cap(z.out)-o >= int(matchLen)+8 {
+			// 8 bytes at a time, each from before the last
+			z.out = z.out[:o+int(matchLen)]
+			for j := 0; j < int(matchLen); j += 8 {
+				copy8(z.out[o+j:o+j+8], z.out[o+j-offset:])
+			}
+			continue
+		}
+		// a match overlapping itself repeats what's copied so far
+		for from, left := len(z.out)-offset, int(matchLen); left > 0; {
+			k := min(left, len(z.out)-from)
+			z.out = append(z.out, z.out[from:from+k]...)
+			left -= k
+		}
+	}
+	if !br.finished() {
+		return corrupt("sequences of the wrong length")
+	}
+	z.out = append(z.out, literals...)
+	return nil
+}
+
+// appendShort appends the first n bytes of src to dst, copying 16 when
+// there are as many, which is quicker than copying what's needed.
+func appendShort(dst, src []byte, n int) []byte {
+	o := len(dst)
+	if n > 16 || len(src) < 16 || cap(dst)-o < 16 {
+		return append(dst, src[:n]...)
+	}
+	dst = dst[:o+16]
+	copy8(dst[o:], src)
+	copy8(dst[o+8:], src[8:])
+	return dst[:o+n]
+}
+
+func copy8(dst, src []byte) {
+	binary.LittleEndian.PutUint64(dst, binary.LittleEndian.Uint64(src))
+}
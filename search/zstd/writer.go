@@ -0,0 +1,485 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+const (
+	windowLog  = 21
+	windowSize = 1 << windowLog
+
+	longHashLog  = 17 // of 8 bytes
+	shortHashLog = 16 // of 5 bytes
+)
+
+// sequence is a run of literals then a match, whose offset is the value
+// coded: 1 to 3 for a repeat offset, else the distance plus 3.
+type sequence struct {
+	litLen, matchLen, offset uint32
+}
+
+// Writer compresses to a zstd stream of a single frame.
+type Writer struct {
+	w   io.Writer
+	err error
+
+	started bool // whether the frame header was written
+	hist    []byte
+	pos     int     // hist[:pos] was written, and hist[pos:] is the block to come
+	long    []int32 // positions in hist by the hash of the 8 bytes there
+	short   []int32 // by that of the 5 bytes there
+	reps    reps
+	hash    xxh64
+
+	seqs     []sequence
+	literals []byte
+	codes    [3][]uint8 // of the sequences' literals lengths, offsets and match lengths
+	out      []byte
+	scratch  []byte
+}
+
+// NewWriter returns a Writer compressing to w.
+func NewWriter(w io.Writer) *Writer {
+	z := &Writer{
+		w:     w,
+		long:  make([]int32, 1<<longHashLog),
+		short: make([]int32, 1<<shortHashLog),
+		reps:  initialReps,
+	}
+	for i := range z.long {
+		z.long[i] = -1
+	}
+	for i := range z.short {
+		z.short[i] = -1
+	}
+	z.hash.reset()
+	return z
+}
+
+// Write compresses p, writing each block once it's full.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), z.pos+maxBlockSize-len(z.hist))
+		z.hist = append(z.hist, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(z.hist)-z.pos == maxBlockSize {
+			if z.err = z.writeBlock(false); z.err != nil {
+				return written, z.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes what's left and ends the frame. It doesn't close the
+// underlying writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		if z.err == errWriterClosed {
+			return nil
+		}
+		return z.err
+	}
+	if z.err = z.writeBlock(true); z.err != nil {
+		return z.err
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], uint32(z.hash.sum()))
+	if _, z.err = z.w.Write(sum[:]); z.err != nil {
+		return z.err
+	}
+	z.err = errWriterClosed
+	return nil
+}
+
+var errWriterClosed = errors.New("zstd: writer closed")
+
+// writeBlock writes hist[pos:] as a block, and the frame header first.
+func (z *Writer) writeBlock(last bool) error {
+	out := z.out[:0]
+	if !z.started {
+		// a checksum, and no content size, which isn't known
+		out = append(out, Magic...)
+		out = append(out, 0x04, (windowLog-10)<<3)
+		z.started = true
+	}
+	block := z.hist[z.pos:]
+	z.hash.write(block)
+
+	start := len(out)
+	out = append(out, 0, 0, 0)
+	typ, size := blockRaw, len(block)
+	if rle(block) {
+		typ = blockRLE
+		out = append(out, block[0])
+	} else if len(block) >= 32 {
+		saved := z.reps
+		z.findSequences()
+		out = z.appendLiterals(out)
+		out = z.appendSequences(out)
+		if compressed := len(out) - start - 3; compressed < len(block) {
+			typ, size = blockCompressed, compressed
+		} else {
+			// a raw block leaves the decoder's repeat offsets as they were
+			z.reps = saved
+			out = out[:start+3]
+		}
+	}
+	if typ == blockRaw {
+		out = append(out, block...)
+	}
+	h := uint32(size)<<3 | uint32(typ)<<1
+	if last {
+		h |= 1
+	}
+	out[start], out[start+1], out[start+2] = byte(h), byte(h>>8), byte(h>>16)
+	z.out = out
+	if _, err := z.w.Write(out); err != nil {
+		return err
+	}
+
+	z.pos = len(z.hist)
+	if z.pos >= 2*windowSize {
+		z.rebase(z.pos - windowSize)
+	}
+	return nil
+}
+
+// rle reports whether block is a run of one byte.
+func rle(block []byte) bool {
+	if len(block) < 2 {
+		return false
+	}
+	for _, b := range block[1:] {
+		if b != block[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// rebase drops the first shift bytes of the history, which are past the
+// window.
+func (z *Writer) rebase(shift int) {
+	z.hist = z.hist[:copy(z.hist, z.hist[shift:])]
+	z.pos -= shift
+	for _, table := range [][]int32{z.long, z.short} {
+		for i, p := range table {
+			table[i] = max(p-int32(shift), -1)
+		}
+	}
+}
+
+func load32(b []byte, i int) uint32 { return binary.LittleEndian.Uint32(b[i:]) }
+func load64(b []byte, i int) uint64 { return binary.LittleEndian.Uint64(b[i:]) }
+
+func hashLong(v uint64) uint32 {
+	return uint32(v * 0xcf1bbcdcb7a56463 >> (64 - longHashLog))
+}
+
+func hashShort(v uint64) uint32 {
+	return uint32(v << 24 * 889523592379 >> (64 - shortHashLog))
+}
+
+// matchLen returns how many bytes from a match those from b, a after b,
+// up to end.
+func matchLen(h []byte, a, b, end int) int {
+	n := 0
+	for a+n+8 <= end {
+		if x := load64(h, a+n) ^ load64(h, b+n); x != 0 {
+			return n + bits.TrailingZeros64(x)/8
+		}
+		n += 8
+	}
+	for a+n < end && h[a+n] == h[b+n] {
+		n++
+	}
+	return n
+}
+
+// findSequences finds the matches of the block in the window, a repeat
+// of the last offset first, then one of 8 bytes, then one of 4, and sets
+// seqs and literals.
+func (z *Writer) findSequences() {
+	h, start, end := z.hist, z.pos, len(z.hist)
+	z.seqs, z.literals = z.seqs[:0], z.literals[:0]
+	in := func(cand, ip int) bool { return cand >= 0 && ip-cand <= windowSize }
+	anchor, ip := start, start
+	for limit := end - 8; ip < limit; {
+		v := load64(h, ip)
+		hl, hs := hashLong(v), hashShort(v)
+		candL, candS := int(z.long[hl]), int(z.short[hs])
+		z.long[hl], z.short[hs] = int32(ip), int32(ip)
+
+		var off, n int
+		if r := ip + 1 - int(z.reps[0]); r >= 0 && load32(h, r) == load32(h, ip+1) {
+			ip++
+			off = int(z.reps[0])
+			n = 4 + matchLen(h, ip+4, r+4, end)
+		} else if in(candL, ip) && load64(h, candL) == v {
+			off = ip - candL
+			n = 8 + matchLen(h, ip+8, candL+8, end)
+		} else if in(candS, ip) && load32(h, candS) == uint32(v) {
+			// a match of 8 bytes at the next position beats it
+			v1 := load64(h, ip+1)
+			h1 := hashLong(v1)
+			cand := int(z.long[h1])
+			z.long[h1] = int32(ip + 1)
+			if in(cand, ip+1) && load64(h, cand) == v1 {
+				ip++
+				off = ip - cand
+				n = 8 + matchLen(h, ip+8, cand+8, end)
+			} else {
+				off = ip - candS
+				n = 4 + matchLen(h, ip+4, candS+4, end)
+			}
+		} else {
+			// skip faster the longer there's been no match
+			ip += 1 + (ip-anchor)>>8
+			continue
+		}
+		for ip > anchor && ip > off && h[ip-1] == h[ip-off-1] {
+			ip--
+			n++
+		}
+
+		litLen := uint32(ip - anchor)
+		ov := z.reps.value(uint32(off), litLen)
+		z.reps.offset(ov, litLen)
+		z.literals = append(z.literals, h[anchor:ip]...)
+		z.seqs = append(z.seqs, sequence{litLen: litLen, matchLen: uint32(n), offset: ov})
+		ip += n
+		anchor = ip
+		if ip < limit {
+			// positions within the match find later ones
+			for _, p := range [...]int{ip - n + 2, ip - 2} {
+				v := load64(h, p)
+				z.long[hashLong(v)] = int32(p)
+				z.short[hashShort(v)] = int32(p)
+			}
+		}
+	}
+	z.literals = append(z.literals, h[anchor:end]...)
+}
+
+// value returns the offset value coding offset after literals of
+// length ll, as offset decodes it.
+func (r *reps) value(offset, ll uint32) uint32 {
+	if ll > 0 {
+		switch offset {
+		case r[0]:
+			return 1
+		case r[1]:
+			return 2
+		case r[2]:
+			return 3
+		}
+	} else {
+		switch offset {
+		case r[1]:
+			return 1
+		case r[2]:
+			return 2
+		case r[0] - 1:
+			return 3
+		}
+	}
+	return offset + 3
+}
+
+// appendLiterals appends the literals section of the block: the literals
+// raw, as a run of one byte or Huffman coded, whichever is smallest.
+func (z *Writer) appendLiterals(out []byte) []byte {
+	lits := z.literals
+	n := len(lits)
+	rawHeader := func(typ int) []byte {
+		switch {
+		case n < 32:
+			return append(out, byte(typ|n<<3))
+		case n < 4096:
+			return append(out, byte(typ|1<<2|n<<4), byte(n>>4))
+		default:
+			return append(out, byte(typ|3<<2|n<<4), byte(n>>4), byte(n>>12))
+		}
+	}
+	if rle(lits) {
+		return append(rawHeader(1), lits[0])
+	}
+	if n < 64 {
+		return append(rawHeader(0), lits...)
+	}
+
+	var counts [256]uint32
+	for _, b := range lits {
+		counts[b]++
+	}
+	var h huffEncoder
+	h.build(&counts)
+	coded, ok := h.appendTable(z.scratch[:0])
+	format := 0
+	if ok && n < 256 {
+		coded = h.encode(coded, lits)
+	} else if ok {
+		coded, ok = h.encodeLiterals(coded, lits)
+		format = 1
+	}
+	z.scratch = coded
+	size := max(n, len(coded))
+	switch {
+	case !ok:
+	case format == 0:
+		ok = size < 1024
+	case size < 1024:
+	case size < 16384:
+		format = 2
+	case size < 262144:
+		format = 3
+	default:
+		ok = false
+	}
+	headerSize := [4]int{3, 3, 4, 5}[format]
+	if !ok || headerSize+len(coded) >= n {
+		return append(rawHeader(0), lits...)
+	}
+	sizeBits := [4]uint{10, 10, 14, 18}[format]
+	header := uint64(2) | uint64(format)<<2 | uint64(n)<<4 | uint64(len(coded))<<(4+sizeBits)
+	for i := 0; i < headerSize; i++ {
+		out = append(out, byte(header>>(8*i)))
+	}
+	return append(out, coded...)
+}
+
+// Codes of literals lengths under 64 and match lengths under 131.
+var llCodes, mlCodes = func() (ll [64]uint8, ml [128]uint8) {
+	for c := range llBase {
+		for v := llBase[c]; v < 64 && v < llBase[c]+1<<llBits[c]; v++ {
+			ll[v] = uint8(c)
+		}
+	}
+	for c := range mlBase {
+		for v := mlBase[c] - 3; v < 128 && v < mlBase[c]-3+1<<mlBits[c]; v++ {
+			ml[v] = uint8(c)
+		}
+	}
+	return ll, ml
+}()
+
+func llCode(ll uint32) uint8 {
+	if ll < 64 {
+		return llCodes[ll]
+	}
+	return uint8(bits.Len32(ll)) + 18
+}
+
+func mlCode(ml uint32) uint8 {
+	if v := ml - 3; v < 128 {
+		return mlCodes[v]
+	}
+	return uint8(bits.Len32(ml-3)) + 35
+}
+
+func ofCode(ov uint32) uint8 {
+	return uint8(bits.Len32(ov)) - 1
+}
+
+// appendSequences appends the sequences section of the block.
+func (z *Writer) appendSequences(out []byte) []byte {
+	n := len(z.seqs)
+	switch {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7f00:
+		out = append(out, byte(n>>8|0x80), byte(n))
+	default:
+		out = append(out, 0xff, byte(n-0x7f00), byte((n-0x7f00)>>8))
+	}
+	if n == 0 {
+		return out
+	}
+
+	for i := range z.codes {
+		z.codes[i] = z.codes[i][:0]
+	}
+	for _, s := range z.seqs {
+		z.codes[0] = append(z.codes[0], llCode(s.litLen))
+		z.codes[1] = append(z.codes[1], ofCode(s.offset))
+		z.codes[2] = append(z.codes[2], mlCode(s.matchLen))
+	}
+	modes := len(out)
+	out = append(out, 0)
+	var encoders [3]fseEncoder
+	for i, kind := range [3]struct {
+		predefined []int16
+		log        uint8
+		maxLog     uint8
+	}{
+		{llDefault, llDefaultLog, llMaxLog},
+		{ofDefault, ofDefaultLog, ofMaxLog},
+		{mlDefault, mlDefaultLog, mlMaxLog},
+	} {
+		var mode byte
+		mode, out = z.chooseTable(out, &encoders[i], z.codes[i], kind.predefined, kind.log, kind.maxLog)
+		out[modes] |= mode << (6 - 2*i)
+	}
+
+	// written backwards, the last sequence first, as it's read from the end
+	ll, of, ml := &encoders[0], &encoders[1], &encoders[2]
+	llc, ofc, mlc := z.codes[0], z.codes[1], z.codes[2]
+	w := bitWriter{out: out}
+	extras := func(i int) {
+		s := z.seqs[i]
+		w.addBits(uint64(s.litLen-llBase[llc[i]]), uint(llBits[llc[i]]))
+		w.addBits(uint64(s.matchLen-mlBase[mlc[i]]), uint(mlBits[mlc[i]]))
+		w.addBits(uint64(s.offset), uint(ofc[i]))
+	}
+	last := n - 1
+	llState, ofState, mlState := ll.initial(llc[last]), of.initial(ofc[last]), ml.initial(mlc[last])
+	extras(last)
+	for i := last - 1; i >= 0; i-- {
+		ofState = of.encode(&w, ofState, ofc[i])
+		mlState = ml.encode(&w, mlState, mlc[i])
+		llState = ll.encode(&w, llState, llc[i])
+		extras(i)
+	}
+	w.addBits(uint64(mlState), uint(ml.log))
+	w.addBits(uint64(ofState), uint(of.log))
+	w.addBits(uint64(llState), uint(ll.log))
+	return w.close()
+}
+
+// chooseTable chooses how to code codes: as a run of one, with the
+// predefined distribution or with their own, described in out, whichever
+// is smallest. It builds the encoder and returns the mode.
+func (z *Writer) chooseTable(out []byte, e *fseEncoder, codes []uint8, predefined []int16, predefinedLog, maxLog uint8) (byte, []byte) {
+	var counts [mlMaxCode + 1]uint32
+	maxCode := 0
+	for _, c := range codes {
+		counts[c]++
+		maxCode = max(maxCode, int(c))
+	}
+	if int(counts[maxCode]) == len(codes) {
+		norm := make([]int16, maxCode+1)
+		norm[maxCode] = 1
+		e.build(norm, 0)
+		return modeRLE, append(out, byte(maxCode))
+	}
+
+	log := optimalLog(len(codes), maxCode, maxLog)
+	norm := normalize(counts[:maxCode+1], len(codes), log)
+	z.scratch = appendNCount(z.scratch[:0], norm, log)
+	own := cost(counts[:], norm, log) + float64(8*len(z.scratch))
+	if cost(counts[:], predefined, predefinedLog) <= own {
+		e.build(predefined, predefinedLog)
+		return modePredefined, out
+	}
+	e.build(norm, log)
+	return modeCompressed, append(out, z.scratch...)
+}
@@ -0,0 +1,101 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// xxh64 is the XXH64 hash, with seed 0, of which a frame's checksum is
+// the low 32 bits.
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int // bytes in buf
+}
+
+const (
+	prime64_1 = 11400714785074694791
+	prime64_2 = 14029467366897019727
+	prime64_3 = 1609587929392839161
+	prime64_4 = 9650029242287828579
+	prime64_5 = 2870177450012600261
+)
+
+func (d *xxh64) reset() {
+	*d = xxh64{}
+	// the sums wrap, as the constants' do in the algorithm
+	p1, p2 := uint64(prime64_1), uint64(prime64_2)
+	d.v = [4]uint64{p1 + p2, p2, 0, -p1}
+}
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * prime64_2
+	return bits.RotateLeft64(acc, 31) * prime64_1
+}
+
+func xxhMerge(acc, v uint64) uint64 {
+	acc ^= xxhRound(0, v)
+	return acc*prime64_1 + prime64_4
+}
+
+func (d *xxh64) stripe(p []byte) {
+	d.v[0] = xxhRound(d.v[0], binary.LittleEndian.Uint64(p))
+	d.v[1] = xxhRound(d.v[1], binary.LittleEndian.Uint64(p[8:]))
+	d.v[2] = xxhRound(d.v[2], binary.LittleEndian.Uint64(p[16:]))
+	d.v[3] = xxhRound(d.v[3], binary.LittleEndian.Uint64(p[24:]))
+}
+
+func (d *xxh64) write(p []byte) {
+	d.total += uint64(len(p))
+	if d.n > 0 {
+		k := copy(d.buf[d.n:], p)
+		d.n += k
+		p = p[k:]
+		if d.n < len(d.buf) {
+			return
+		}
+		d.stripe(d.buf[:])
+		d.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		d.stripe(p)
+	}
+	d.n = copy(d.buf[:], p)
+}
+
+func (d *xxh64) sum() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v[0], 1) + bits.RotateLeft64(d.v[1], 7) +
+			bits.RotateLeft64(d.v[2], 12) + bits.RotateLeft64(d.v[3], 18)
+		for _, v := range d.v {
+			h = xxhMerge(h, v)
+		}
+	} else {
+		h = prime64_5
+	}
+	h += d.total
+
+	p := d.buf[:d.n]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*prime64_1 + prime64_4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * prime64_1
+		h = bits.RotateLeft64(h, 23)*prime64_2 + prime64_3
+		p = p[4:]
+	}
+	for _, b := range p {
+		h ^= uint64(b) * prime64_5
+		h = bits.RotateLeft64(h, 11) * prime64_1
+	}
+
+	h ^= h >> 33
+	h *= prime64_2
+	h ^= h >> 29
+	h *= prime64_3
+	h ^= h >> 32
+	return h
+}
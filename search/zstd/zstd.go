@@ -0,0 +1,139 @@
+// Package zstd reads and writes Zstandard streams (RFC 8878) with the
+// standard library alone. It's how package search saves indexes with zstd;
+// set search.StorageOpts.Codec to search.Zstd.
+//
+// The Writer favors speed, much like the fast levels of the reference
+// implementation, and the Reader reads any stream that doesn't need a
+// dictionary, whatever wrote it.
+package zstd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCorrupt means a stream couldn't be decoded.
+var ErrCorrupt = errors.New("zstd: corrupt stream")
+
+// corrupt returns ErrCorrupt with what's wrong.
+func corrupt(what string) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt, what)
+}
+
+// Magic starts every zstd frame.
+var Magic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+const (
+	frameMagic     = 0xfd2fb528
+	skippableMagic = 0x184d2a50 // the low 4 bits may be anything
+	skippableMask  = 0xfffffff0
+
+	maxBlockSize = 128 << 10
+	// maxWindowSize bounds the memory a Reader keeps for matches to refer to
+	maxWindowSize = 1 << 30
+
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+)
+
+// Literals_Length, Match_Length and Offset codes: baselines and extra bits.
+var (
+	llBase = [36]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	llBits = [36]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	mlBase = [53]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	mlBits = [53]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+// The predefined distributions of the codes, and their accuracy logs.
+var (
+	llDefault = []int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	mlDefault = []int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	ofDefault = []int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+)
+
+const (
+	llDefaultLog = 6
+	mlDefaultLog = 6
+	ofDefaultLog = 5
+
+	llMaxLog = 9
+	mlMaxLog = 9
+	ofMaxLog = 8
+
+	llMaxCode = 35
+	mlMaxCode = 52
+	ofMaxCode = 31
+)
+
+// Symbol_Compression_Modes of the sequences' codes.
+const (
+	modePredefined = 0
+	modeRLE        = 1
+	modeCompressed = 2
+	modeRepeat     = 3
+)
+
+// reps are the repeat offsets, which sequences refer to with offset values
+// of 1 to 3.
+type reps [3]uint32
+
+// initialReps are the repeat offsets at the start of a frame.
+var initialReps = reps{1, 4, 8}
+
+// offset returns the offset of a sequence of offset value ov and literals
+// length ll, updating the repeat offsets. It's 0 for an invalid repeat.
+func (r *reps) offset(ov, ll uint32) uint32 {
+	if ov > 3 {
+		r[2], r[1], r[0] = r[1], r[0], ov-3
+		return r[0]
+	}
+	i := ov - 1
+	if ll == 0 {
+		i++
+	}
+	if i == 0 {
+		return r[0]
+	}
+	var off uint32
+	if i == 3 {
+		off = r[0] - 1
+	} else {
+		off = r[i]
+	}
+	if i != 1 {
+		r[2] = r[1]
+	}
+	r[1], r[0] = r[0], off
+	return off
+}
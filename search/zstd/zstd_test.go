@@ -0,0 +1,222 @@
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pond = "The pond in winter is a field of snow, and the pond in summer is a mirror of the sky. The pond in winter keeps its secrets under the ice; the pond in summer gives them up to anyone who looks. Walden is a pond, and every pond is a well of the woods around it, deep and clear and cold, as still in winter as the woods are, and as alive in summer."
+
+// pondFrame is pond compressed by the reference implementation at its
+// highest level, with Huffman coded literals and the content size.
+var pondFrame = []byte{
+	0x28, 0xb5, 0x2f, 0xfd, 0x64, 0x58, 0x00, 0x75, 0x05, 0x00, 0xa2, 0x8b,
+	0x1e, 0x15, 0x90, 0xab, 0x0d, 0x00, 0x6a, 0xa2, 0x30, 0xad, 0x9b, 0x87,
+	0xdf, 0xd2, 0xe4, 0x78, 0xc6, 0xe2, 0x45, 0x67, 0xec, 0x44, 0x0e, 0xc1,
+	0x1b, 0xbb, 0xf2, 0xd6, 0xb7, 0xee, 0x2c, 0xad, 0xf7, 0x52, 0xeb, 0x57,
+	0x2c, 0x3f, 0x32, 0x90, 0xcc, 0x08, 0x99, 0xd4, 0xf2, 0xa2, 0x4c, 0xe7,
+	0xee, 0x8e, 0xcb, 0xfb, 0xe8, 0x9b, 0xe3, 0xd1, 0x15, 0xe1, 0x60, 0x93,
+	0xcc, 0x73, 0x22, 0x8e, 0x8f, 0xf9, 0x60, 0x39, 0x93, 0x17, 0xc6, 0xca,
+	0xbe, 0xb1, 0x43, 0x78, 0x61, 0x7a, 0x84, 0x8c, 0x37, 0x5d, 0x8b, 0xaf,
+	0x37, 0x99, 0x77, 0xf9, 0x13, 0x07, 0x4f, 0xb2, 0x46, 0x5a, 0x53, 0xd5,
+	0x14, 0x45, 0x61, 0x36, 0x19, 0x61, 0x19, 0x70, 0x12, 0xd7, 0x46, 0x1a,
+	0xdd, 0xcd, 0x70, 0x79, 0xcd, 0xfa, 0x84, 0xe6, 0x18, 0xcd, 0x08, 0x73,
+	0xf1, 0x91, 0x21, 0x13, 0x00, 0x3e, 0xdb, 0x2c, 0xc7, 0xc0, 0x8e, 0x38,
+	0x2d, 0x69, 0xb6, 0x9b, 0x10, 0x70, 0xcb, 0xe8, 0x59, 0x2f, 0x23, 0x19,
+	0xe1, 0x51, 0x64, 0x75, 0xd9, 0x44, 0x10, 0x07, 0xc0, 0x30, 0xfd, 0xdc,
+	0xaa, 0x45, 0x4c, 0x49, 0x10, 0x5a, 0x16, 0x52, 0x17, 0x75, 0x0f, 0x20,
+	0x84, 0xce, 0x50, 0x65, 0x76, 0x29, 0x5b, 0x85,
+}
+
+func compress(t testing.TB, data []byte, chunk int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for p := data; len(p) > 0; p = p[min(chunk, len(p)):] {
+		if _, err := w.Write(p[:min(chunk, len(p))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 300<<10)
+	rng.Read(random)
+	// text of words from the pond, with repeats further back than the window
+	words := strings.Fields(pond)
+	var text []byte
+	for len(text) < 3*windowSize {
+		if len(text) > windowSize && rng.Intn(4) == 0 {
+			from := rng.Intn(len(text) - 1000)
+			text = append(text, text[from:from+1000]...)
+		}
+		text = append(text, words[rng.Intn(len(words))]...)
+		text = append(text, ' ')
+	}
+
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		ratio float64 // the most compressed size over size
+	}{
+		{"empty", nil, 0},
+		{"byte", []byte{'a'}, 0},
+		{"pond", []byte(pond), 0.8},
+		{"run", bytes.Repeat([]byte{'z'}, 3*maxBlockSize+5), 0.01},
+		{"random", random, 1.01},
+		{"text", text, 0.3},
+	} {
+		for _, chunk := range []int{1000, maxBlockSize + 1} {
+			compressed := compress(t, tc.data, chunk)
+			if tc.ratio > 0 && float64(len(compressed)) > tc.ratio*float64(len(tc.data)) {
+				t.Errorf("%s: compressed %d bytes to %d", tc.name, len(tc.data), len(compressed))
+			}
+			got, err := io.ReadAll(NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if !bytes.Equal(got, tc.data) {
+				t.Fatalf("%s: read back %d bytes that differ from the %d written", tc.name, len(got), len(tc.data))
+			}
+		}
+	}
+}
+
+func TestReadReference(t *testing.T) {
+	got, err := io.ReadAll(NewReader(bytes.NewReader(pondFrame)))
+	if err != nil || string(got) != pond {
+		t.Fatalf("expected the pond, got %q (%v)", got, err)
+	}
+
+	// frames follow one another, and skippable ones are skipped
+	var stream []byte
+	stream = append(stream, pondFrame...)
+	stream = append(stream, 0x5a, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 'x', 'y', 'z')
+	stream = append(stream, compress(t, []byte(pond), 100)...)
+	got, err = io.ReadAll(NewReader(bytes.NewReader(stream)))
+	if err != nil || string(got) != pond+pond {
+		t.Fatalf("expected the pond twice, got %q (%v)", got, err)
+	}
+}
+
+// The fixtures in testdata were written by the zstd 1.5.6 CLI, from the
+// example documents in ../../example/docs:
+//
+//	zstd -3 how_much_land.txt -o land.3.zst
+//	zstd -19 how_much_land.txt -o land.19.zst
+//	zstd -3 --no-check < how_much_land.txt > land.stream.zst
+//	cat *.txt | zstd --ultra -22 --long=27 > docs.long.zst
+//	head -c 300000 /dev/zero | zstd -3 > zeros.zst
+//	(zstd -3 -c how_much_land.txt; zstd -3 -c self_reliance.txt) > frames.zst
+func TestReadFixtures(t *testing.T) {
+	doc := func(names ...string) []byte {
+		var data []byte
+		for _, name := range names {
+			b, err := os.ReadFile(filepath.Join("../../example/docs", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, b...)
+		}
+		return data
+	}
+	land := doc("how_much_land.txt")
+	for _, tc := range []struct {
+		file string
+		want []byte
+	}{
+		{"land.3.zst", land},
+		{"land.19.zst", land},
+		{"land.stream.zst", land},
+		{"docs.long.zst", doc("civil_disobedience.txt", "how_much_land.txt", "politics_and_the_english_language.txt", "self_reliance.txt")},
+		{"zeros.zst", make([]byte, 300000)},
+		{"frames.zst", doc("how_much_land.txt", "self_reliance.txt")},
+	} {
+		in, err := os.ReadFile(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(NewReader(bytes.NewReader(in)))
+		if err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+		} else if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: read %d bytes that differ from the %d expected", tc.file, len(got), len(tc.want))
+		}
+	}
+}
+
+func TestReadCorrupt(t *testing.T) {
+	flip := func(i int) []byte {
+		data := bytes.Clone(pondFrame)
+		data[(i+len(data))%len(data)] ^= 1
+		return data
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"magic", flip(0), ErrCorrupt},
+		{"checksum", flip(-1), ErrCorrupt},
+		{"literals", flip(40), ErrCorrupt},
+		{"sequences", flip(-10), ErrCorrupt},
+		{"truncated", pondFrame[:100], io.ErrUnexpectedEOF},
+		{"empty", nil, io.ErrUnexpectedEOF},
+	} {
+		if _, err := io.ReadAll(NewReader(bytes.NewReader(tc.data))); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestXXH64(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"abc", 0x44bc2cf5ad770999},
+	} {
+		var d xxh64
+		d.reset()
+		d.write([]byte(tc.in))
+		if got := d.sum(); got != tc.want {
+			t.Errorf("XXH64(%q) = %#x, want %#x", tc.in, got, tc.want)
+		}
+	}
+}
+
+// FuzzDecode checks that the Reader fails on what it can't decode rather
+// than panicking, and that what it decodes survives a round trip.
+func FuzzDecode(f *testing.F) {
+	f.Add(pondFrame)
+	f.Add(compress(f, []byte(pond), 100))
+	fixtures, _ := filepath.Glob("testdata/*.zst")
+	for _, file := range fixtures {
+		if data, err := os.ReadFile(file); err == nil && len(data) < 16<<10 {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// a few bytes can claim a huge output, so only some is read
+		got, err := io.ReadAll(io.LimitReader(NewReader(bytes.NewReader(data)), 1<<20))
+		if err != nil || len(got) == 1<<20 {
+			return
+		}
+		back, err := io.ReadAll(NewReader(bytes.NewReader(compress(t, got, 1000))))
+		if err != nil || !bytes.Equal(back, got) {
+			t.Fatalf("round trip of %d decoded bytes failed: %v", len(got), err)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package vectors
+
+import "fmt"
+
+// BatchEmbedder is implemented by embedders that can embed several texts in
+// one call (e.g. one HTTP request or one model invocation).
+type BatchEmbedder interface {
+	Embedder
+	EmbedBatch(texts []string) ([][]float32, error)
+}
+
+// EmbedAll embeds texts in batches of batchSize, using EmbedBatch when e
+// supports it and falling back to one Embed call per text otherwise.
+func EmbedAll(e Embedder, texts []string, batchSize int) ([][]float32, error) {
+	be, ok := e.(BatchEmbedder)
+	if !ok {
+		out := make([][]float32, len(texts))
+		for i, text := range texts {
+			vec, err := e.Embed(text)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = vec
+		}
+		return out, nil
+	}
+
+	if batchSize <= 0 {
+		batchSize = len(texts)
+	}
+	out := make([][]float32, 0, len(texts))
+	for i := 0; i < len(texts); i += batchSize {
+		batch := texts[i:min(i+batchSize, len(texts))]
+		vecs, err := be.EmbedBatch(batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(vecs) != len(batch) {
+			return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vecs), len(batch))
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
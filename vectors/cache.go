@@ -0,0 +1,86 @@
+package vectors
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// CachedEmbedder memoizes another embedder by the SHA-256 of the input text,
+// so unchanged documents aren't re-embedded when an index is rebuilt.
+type CachedEmbedder struct {
+	embedder Embedder
+	mu       sync.Mutex
+	cache    map[[sha256.Size]byte][]float32
+}
+
+// NewCachedEmbedder wraps e with a content-hash cache.
+func NewCachedEmbedder(e Embedder) *CachedEmbedder {
+	return &CachedEmbedder{
+		embedder: e,
+		cache:    make(map[[sha256.Size]byte][]float32),
+	}
+}
+
+// Len returns the number of cached vectors.
+func (c *CachedEmbedder) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.cache)
+}
+
+// Embed returns the cached vector for text, embedding it on a miss.
+func (c *CachedEmbedder) Embed(text string) ([]float32, error) {
+	key := sha256.Sum256([]byte(text))
+	c.mu.Lock()
+	vec, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return vec, nil
+	}
+
+	vec, err := c.embedder.Embed(text)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.cache[key] = vec
+	c.mu.Unlock()
+	return vec, nil
+}
+
+// EmbedBatch embeds only the texts that aren't cached, in a single batch if
+// the wrapped embedder supports batching.
+func (c *CachedEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	keys := make([][sha256.Size]byte, len(texts))
+	var missing []string
+	var missingIdx []int
+
+	c.mu.Lock()
+	for i, text := range texts {
+		keys[i] = sha256.Sum256([]byte(text))
+		if vec, ok := c.cache[keys[i]]; ok {
+			out[i] = vec
+		} else {
+			missing = append(missing, text)
+			missingIdx = append(missingIdx, i)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return out, nil
+	}
+	vecs, err := EmbedAll(c.embedder, missing, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	for j, i := range missingIdx {
+		out[i] = vecs[j]
+		c.cache[keys[i]] = vecs[j]
+	}
+	c.mu.Unlock()
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package vectors
+
+import "math"
+
+// Embedder converts text into a dense vector. Implementations must return
+// vectors of the same dimension for every input.
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+}
+
+// EmbedderFunc adapts an ordinary function to the Embedder interface.
+type EmbedderFunc func(text string) ([]float32, error)
+
+// Embed calls f(text).
+func (f EmbedderFunc) Embed(text string) ([]float32, error) {
+	return f(text)
+}
+
+// Dot returns the dot product of a and b.
+func Dot(a, b []float32) float32 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	var sum float32
+	for i := 0; i < n; i++ {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 if either is a zero vector.
+func Cosine(a, b []float32) float32 {
+	na, nb := norm(a), norm(b)
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return Dot(a, b) / (na * nb)
+}
+
+// Normalize returns a copy of v scaled to unit length.
+func Normalize(v []float32) []float32 {
+	out := make([]float32, len(v))
+	n := norm(v)
+	if n == 0 {
+		return out
+	}
+	for i, x := range v {
+		out[i] = x / n
+	}
+	return out
+}
+
+func norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(Dot(v, v))))
+}
@@ -0,0 +1,383 @@
+package vectors
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// HNSW is a hierarchical navigable small world graph for approximate
+// nearest-neighbor search over unit vectors. Similarity is the dot product of
+// the normalized vectors, i.e. cosine similarity.
+type HNSW struct {
+	M              int // max links per node on upper layers (2*M on layer 0)
+	EfConstruction int // candidate list size while inserting
+	EfSearch       int // candidate list size while searching
+
+	nodes    []node
+	ids      map[string]int
+	entry    int
+	maxLevel int
+	rng      *rand.Rand
+}
+
+type node struct {
+	ID     string    `json:"id"`
+	Vector []float32 `json:"vector"`
+	Links  [][]int   `json:"links"` // links[level] = neighbor node indexes
+}
+
+// Neighbor is a search hit with its cosine similarity to the query.
+type Neighbor struct {
+	ID    string
+	Score float32
+}
+
+// NewHNSW creates an empty graph. Zero values fall back to M=16, EfConstruction=200, EfSearch=50.
+// M=1 is raised to 2, since levels are drawn with a multiplier of 1/ln(M).
+func NewHNSW(m, efConstruction, efSearch int) *HNSW {
+	if m <= 0 {
+		m = 16
+	}
+	m = max(m, 2)
+	if efConstruction <= 0 {
+		efConstruction = 200
+	}
+	if efSearch <= 0 {
+		efSearch = 50
+	}
+	return &HNSW{
+		M:              m,
+		EfConstruction: efConstruction,
+		EfSearch:       efSearch,
+		ids:            make(map[string]int),
+		entry:          -1,
+		rng:            rand.New(rand.NewSource(1)),
+	}
+}
+
+// Len returns the number of vectors in the graph.
+func (h *HNSW) Len() int {
+	return len(h.nodes)
+}
+
+// Vector returns the stored (normalized) vector for id.
+func (h *HNSW) Vector(id string) ([]float32, bool) {
+	i, ok := h.ids[id]
+	if !ok {
+		return nil, false
+	}
+	return h.nodes[i].Vector, true
+}
+
+// Add inserts a vector under id. Adding an existing id returns an error.
+func (h *HNSW) Add(id string, vec []float32) error {
+	if _, ok := h.ids[id]; ok {
+		return fmt.Errorf("vector %q already exists", id)
+	}
+	if len(h.nodes) > 0 && len(vec) != len(h.nodes[0].Vector) {
+		return fmt.Errorf("vector %q has dimension %d, want %d", id, len(vec), len(h.nodes[0].Vector))
+	}
+
+	level := h.randomLevel()
+	n := node{ID: id, Vector: Normalize(vec), Links: make([][]int, level+1)}
+	cur := len(h.nodes)
+	h.nodes = append(h.nodes, n)
+	h.ids[id] = cur
+
+	if h.entry < 0 {
+		h.entry = cur
+		h.maxLevel = level
+		return nil
+	}
+
+	q := h.nodes[cur].Vector
+	ep := h.entry
+	for lc := h.maxLevel; lc > level; lc-- {
+		ep = h.greedy(q, ep, lc)
+	}
+	eps := []int{ep}
+	for lc := min(level, h.maxLevel); lc >= 0; lc-- {
+		found := h.searchLayer(q, eps, h.EfConstruction, lc)
+		neighbors := closest(found, h.maxLinks(lc))
+		h.nodes[cur].Links[lc] = neighbors
+		for _, nb := range neighbors {
+			h.link(nb, cur, lc)
+		}
+		eps = make([]int, len(found))
+		for i, c := range found {
+			eps[i] = c.node
+		}
+	}
+
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entry = cur
+	}
+	return nil
+}
+
+// Search returns up to k nearest neighbors of vec, most similar first.
+func (h *HNSW) Search(vec []float32, k int) []Neighbor {
+	if h.entry < 0 || k <= 0 {
+		return nil
+	}
+	q := Normalize(vec)
+	ep := h.entry
+	for lc := h.maxLevel; lc > 0; lc-- {
+		ep = h.greedy(q, ep, lc)
+	}
+	found := h.searchLayer(q, []int{ep}, max(h.EfSearch, k), 0)
+	if len(found) > k {
+		found = found[:k]
+	}
+	out := make([]Neighbor, len(found))
+	for i, c := range found {
+		out[i] = Neighbor{ID: h.nodes[c.node].ID, Score: c.sim}
+	}
+	return out
+}
+
+func (h *HNSW) randomLevel() int {
+	mult := 1 / math.Log(float64(h.M))
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * mult))
+}
+
+func (h *HNSW) maxLinks(level int) int {
+	if level == 0 {
+		return 2 * h.M
+	}
+	return h.M
+}
+
+// link adds a directed edge from -> to at level, pruning from's links to the closest maxLinks.
+func (h *HNSW) link(from, to, level int) {
+	links := append(h.nodes[from].Links[level], to)
+	if len(links) > h.maxLinks(level) {
+		v := h.nodes[from].Vector
+		cands := make([]candidate, len(links))
+		for i, l := range links {
+			cands[i] = candidate{node: l, sim: Dot(v, h.nodes[l].Vector)}
+		}
+		sort.Slice(cands, func(i, j int) bool { return cands[i].sim > cands[j].sim })
+		links = closest(cands, h.maxLinks(level))
+	}
+	h.nodes[from].Links[level] = links
+}
+
+// greedy walks level from ep towards q, returning the closest node found.
+func (h *HNSW) greedy(q []float32, ep, level int) int {
+	best := Dot(q, h.nodes[ep].Vector)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range h.nodes[ep].Links[level] {
+			if s := Dot(q, h.nodes[nb].Vector); s > best {
+				best, ep, changed = s, nb, true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer returns up to ef nodes closest to q on level, most similar first.
+func (h *HNSW) searchLayer(q []float32, eps []int, ef, level int) []candidate {
+	visited := make(map[int]bool, ef*4)
+	cands := &maxHeap{}
+	found := &minHeap{}
+	for _, ep := range eps {
+		visited[ep] = true
+		c := candidate{node: ep, sim: Dot(q, h.nodes[ep].Vector)}
+		heap.Push(cands, c)
+		heap.Push(found, c)
+	}
+	for found.Len() > ef {
+		heap.Pop(found)
+	}
+
+	for cands.Len() > 0 {
+		c := heap.Pop(cands).(candidate)
+		if found.Len() >= ef && c.sim < (*found)[0].sim {
+			break
+		}
+		for _, nb := range h.nodes[c.node].Links[level] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			s := Dot(q, h.nodes[nb].Vector)
+			if found.Len() < ef || s > (*found)[0].sim {
+				heap.Push(cands, candidate{node: nb, sim: s})
+				heap.Push(found, candidate{node: nb, sim: s})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+
+	out := []candidate(*found)
+	sort.Slice(out, func(i, j int) bool { return out[i].sim > out[j].sim })
+	return out
+}
+
+// closest returns the node indexes of the first n candidates (already sorted by similarity).
+func closest(cands []candidate, n int) []int {
+	if len(cands) > n {
+		cands = cands[:n]
+	}
+	out := make([]int, len(cands))
+	for i, c := range cands {
+		out[i] = c.node
+	}
+	return out
+}
+
+type hnswFile struct {
+	M              int    `json:"m"`
+	EfConstruction int    `json:"ef_construction"`
+	EfSearch       int    `json:"ef_search"`
+	Entry          int    `json:"entry"`
+	MaxLevel       int    `json:"max_level"`
+	Nodes          []node `json:"nodes"`
+}
+
+// Save writes the graph to a JSON file. It's written to a temporary file,
+// synced and renamed into place, so a crash leaves the old graph or the new
+// one, never half of one.
+func (h *HNSW) Save(path string) error {
+	data, err := json.Marshal(hnswFile{
+		M:              h.M,
+		EfConstruction: h.EfConstruction,
+		EfSearch:       h.EfSearch,
+		Entry:          h.entry,
+		MaxLevel:       h.maxLevel,
+		Nodes:          h.nodes,
+	})
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(0o644)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// LoadHNSW reads a graph previously written by Save. A graph whose entry
+// point or links refer to nodes or levels it doesn't have is an error.
+func LoadHNSW(path string) (*HNSW, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f hnswFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hnsw graph: %w", err)
+	}
+	if err := f.check(); err != nil {
+		return nil, fmt.Errorf("invalid hnsw graph: %w", err)
+	}
+	h := NewHNSW(f.M, f.EfConstruction, f.EfSearch)
+	h.nodes = f.Nodes
+	h.entry = f.Entry
+	h.maxLevel = f.MaxLevel
+	for i, n := range h.nodes {
+		h.ids[n.ID] = i
+	}
+	if len(h.nodes) == 0 {
+		h.entry = -1
+	}
+	return h, nil
+}
+
+// check returns an error if searching the graph would index out of range:
+// the entry point must be a node on the top level, and each link a node on
+// the level it's on.
+func (f *hnswFile) check() error {
+	if len(f.Nodes) == 0 {
+		return nil
+	}
+	if f.Entry < 0 || f.Entry >= len(f.Nodes) {
+		return fmt.Errorf("entry point %d of %d nodes", f.Entry, len(f.Nodes))
+	}
+	if f.MaxLevel < 0 || len(f.Nodes[f.Entry].Links) <= f.MaxLevel {
+		return fmt.Errorf("entry point %d isn't on the top level %d", f.Entry, f.MaxLevel)
+	}
+	dim := len(f.Nodes[0].Vector)
+	seen := make(map[string]bool, len(f.Nodes))
+	for i, n := range f.Nodes {
+		if seen[n.ID] {
+			return fmt.Errorf("vector %q is in the graph twice", n.ID)
+		}
+		seen[n.ID] = true
+		if len(n.Vector) != dim {
+			return fmt.Errorf("vector %q has dimension %d, want %d", n.ID, len(n.Vector), dim)
+		}
+		if len(n.Links) == 0 || len(n.Links) > f.MaxLevel+1 {
+			return fmt.Errorf("node %d has %d levels of at most %d", i, len(n.Links), f.MaxLevel+1)
+		}
+		for level, links := range n.Links {
+			for _, l := range links {
+				if l < 0 || l >= len(f.Nodes) || len(f.Nodes[l].Links) <= level {
+					return fmt.Errorf("node %d links to node %d, which isn't on level %d", i, l, level)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type candidate struct {
+	node int
+	sim  float32
+}
+
+// maxHeap pops the most similar candidate first.
+type maxHeap []candidate
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i].sim > h[j].sim }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// minHeap pops the least similar candidate first.
+type minHeap []candidate
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].sim < h[j].sim }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,178 @@
+package vectors
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// concepts maps words onto a few dimensions so that synonyms share a
+// direction even though they share no characters.
+var concepts = map[string]int{
+	"car": 0, "automobile": 0, "vehicle": 0,
+	"land": 1, "soil": 1, "acres": 1,
+	"law": 2, "statute": 2, "government": 2,
+}
+
+var conceptEmbedder = EmbedderFunc(func(text string) ([]float32, error) {
+	vec := make([]float32, 4)
+	for _, w := range strings.Fields(strings.ToLower(text)) {
+		if d, ok := concepts[w]; ok {
+			vec[d]++
+		} else {
+			vec[3] += 0.1
+		}
+	}
+	return vec, nil
+})
+
+func TestSemanticSearchWithoutKeywordOverlap(t *testing.T) {
+	vi := NewIndex(conceptEmbedder, Opts{})
+	docs := map[string]string{
+		"cars.txt":  "the car is a vehicle",
+		"farm.txt":  "acres of soil",
+		"civil.txt": "the government and the statute",
+	}
+	for name, text := range docs {
+		if err := vi.AddDocument(name, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := vi.Search("automobile", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "cars.txt" {
+		t.Fatalf("expected cars.txt, got %+v", results)
+	}
+
+	path := "test_vectors.json"
+	defer os.Remove(path)
+	if err := vi.Save(path); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	loaded, err := LoadIndex(path, conceptEmbedder, Opts{})
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	results, _ = loaded.Search("law", 1)
+	if len(results) != 1 || results[0].Name != "civil.txt" {
+		t.Fatalf("expected civil.txt after reload, got %+v", results)
+	}
+}
+
+func TestPassagesReportBestPassageOnce(t *testing.T) {
+	vi := NewIndex(conceptEmbedder, Opts{PassageWords: 2})
+	if err := vi.AddDocument("mixed.txt", "car vehicle soil acres law statute"); err != nil {
+		t.Fatal(err)
+	}
+	if vi.Len() != 3 {
+		t.Fatalf("expected 3 passages, got %d", vi.Len())
+	}
+	results, _ := vi.Search("land", 5)
+	if len(results) != 1 || results[0].Passage != 1 {
+		t.Fatalf("expected mixed.txt passage 1, got %+v", results)
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	random := func() []float32 {
+		v := make([]float32, 16)
+		for i := range v {
+			v[i] = rng.Float32()*2 - 1
+		}
+		return v
+	}
+
+	h := NewHNSW(8, 100, 64)
+	var ids []string
+	for i := 0; i < 500; i++ {
+		id := fmt.Sprintf("v%d", i)
+		ids = append(ids, id)
+		if err := h.Add(id, random()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, total := 0, 0
+	for q := 0; q < 20; q++ {
+		query := Normalize(random())
+		exact := append([]string(nil), ids...)
+		sort.Slice(exact, func(i, j int) bool {
+			vi, _ := h.Vector(exact[i])
+			vj, _ := h.Vector(exact[j])
+			return Dot(query, vi) > Dot(query, vj)
+		})
+		want := make(map[string]bool)
+		for _, id := range exact[:10] {
+			want[id] = true
+		}
+		for _, nb := range h.Search(query, 10) {
+			if want[nb.ID] {
+				hits++
+			}
+		}
+		total += 10
+	}
+	if recall := float64(hits) / float64(total); recall < 0.9 {
+		t.Errorf("recall@10 too low: %.2f", recall)
+	}
+}
+
+func TestHNSWOneLink(t *testing.T) {
+	h := NewHNSW(1, 10, 10)
+	if h.M != 2 {
+		t.Errorf("expected M=1 to be raised to 2, got %d", h.M)
+	}
+	for i := 0; i < 50; i++ {
+		if err := h.Add(fmt.Sprintf("v%d", i), []float32{float32(i), 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := h.Search([]float32{1, 0}, 1); len(got) != 1 {
+		t.Errorf("expected a neighbor, got %+v", got)
+	}
+}
+
+func TestLoadHNSWInvalid(t *testing.T) {
+	dir := t.TempDir()
+	h := NewHNSW(4, 10, 10)
+	for i := 0; i < 20; i++ {
+		if err := h.Add(fmt.Sprintf("v%d", i), []float32{float32(i), 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "graph.json")
+	if err := h.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := filepath.Glob(path + ".tmp*"); len(entries) > 0 {
+		t.Errorf("expected no temporary files to be left, got %v", entries)
+	}
+	if _, err := LoadHNSW(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, graph := range map[string]string{
+		"entry":    `{"m":4,"entry":5,"max_level":0,"nodes":[{"id":"a","vector":[1,0],"links":[[]]}]}`,
+		"level":    `{"m":4,"entry":0,"max_level":3,"nodes":[{"id":"a","vector":[1,0],"links":[[]]}]}`,
+		"link":     `{"m":4,"entry":0,"max_level":0,"nodes":[{"id":"a","vector":[1,0],"links":[[7]]}]}`,
+		"negative": `{"m":4,"entry":0,"max_level":0,"nodes":[{"id":"a","vector":[1,0],"links":[[-1]]}]}`,
+		"upper": `{"m":4,"entry":0,"max_level":1,"nodes":[` +
+			`{"id":"a","vector":[1,0],"links":[[1],[1]]},{"id":"b","vector":[0,1],"links":[[0]]}]}`,
+	} {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(graph), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadHNSW(path); err == nil {
+			t.Errorf("%s: expected an error loading an invalid graph", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package vectors
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Opts configures a vector Index.
+type Opts struct {
+	PassageWords   int // split documents into passages of this many words; 0 embeds whole documents
+	M              int
+	EfConstruction int
+	EfSearch       int
+}
+
+// Index stores one vector per document (or per passage) in an HNSW graph so
+// documents can be found by meaning rather than by shared keywords.
+type Index struct {
+	embedder Embedder
+	opts     Opts
+	graph    *HNSW
+}
+
+// Result is a document matched by a vector search. Passage is the index of the
+// best-matching passage within the document (always 0 when passages are disabled).
+type Result struct {
+	Name    string
+	Passage int
+	Score   float32
+}
+
+// NewIndex creates an empty vector index that embeds text with e.
+func NewIndex(e Embedder, opts Opts) *Index {
+	return &Index{
+		embedder: e,
+		opts:     opts,
+		graph:    NewHNSW(opts.M, opts.EfConstruction, opts.EfSearch),
+	}
+}
+
+// Len returns the number of stored vectors (documents or passages).
+func (vi *Index) Len() int {
+	return vi.graph.Len()
+}
+
+// AddDocument embeds text and stores its vectors under the document name.
+func (vi *Index) AddDocument(name, text string) error {
+	for i, passage := range passages(text, vi.opts.PassageWords) {
+		vec, err := vi.embedder.Embed(passage)
+		if err != nil {
+			return fmt.Errorf("failed to embed %q: %w", name, err)
+		}
+		if err := vi.graph.Add(passageID(name, i), vec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddDocuments embeds many documents at once, batching calls when the
+// embedder supports it. Documents are added in name order so that builds are reproducible.
+func (vi *Index) AddDocuments(docs map[string]string, batchSize int) error {
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ids, texts []string
+	for _, name := range names {
+		for i, passage := range passages(docs[name], vi.opts.PassageWords) {
+			ids = append(ids, passageID(name, i))
+			texts = append(texts, passage)
+		}
+	}
+	vecs, err := EmbedAll(vi.embedder, texts, batchSize)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		if err := vi.graph.Add(id, vecs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search embeds the query and returns up to k documents ordered by similarity.
+// When passages are enabled each document is reported once, scored by its best passage.
+func (vi *Index) Search(query string, k int) ([]Result, error) {
+	vec, err := vi.embedder.Embed(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return vi.SearchVector(vec, k), nil
+}
+
+// SearchVector is like Search but takes an already embedded query.
+func (vi *Index) SearchVector(vec []float32, k int) []Result {
+	// over-fetch so that several passages of one document don't crowd out others
+	fetch := k
+	if vi.opts.PassageWords > 0 {
+		fetch = k * 4
+	}
+
+	var results []Result
+	seen := make(map[string]bool)
+	for _, nb := range vi.graph.Search(vec, fetch) {
+		name, passage := splitPassageID(nb.ID)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		results = append(results, Result{Name: name, Passage: passage, Score: nb.Score})
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// Save writes the vectors and graph to path.
+func (vi *Index) Save(path string) error {
+	return vi.graph.Save(path)
+}
+
+// LoadIndex reads an index written by Save. The embedder must be the one the
+// index was built with, otherwise query vectors won't be comparable.
+func LoadIndex(path string, e Embedder, opts Opts) (*Index, error) {
+	graph, err := LoadHNSW(path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.EfSearch > 0 {
+		graph.EfSearch = opts.EfSearch
+	}
+	return &Index{embedder: e, opts: opts, graph: graph}, nil
+}
+
+// passages splits text into chunks of n words, or returns the whole text if n <= 0.
+func passages(text string, n int) []string {
+	if n <= 0 {
+		return []string{text}
+	}
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var out []string
+	for i := 0; i < len(words); i += n {
+		end := min(i+n, len(words))
+		out = append(out, strings.Join(words[i:end], " "))
+	}
+	return out
+}
+
+func passageID(name string, i int) string {
+	return name + "#" + strconv.Itoa(i)
+}
+
+func splitPassageID(id string) (string, int) {
+	i := strings.LastIndexByte(id, '#')
+	if i < 0 {
+		return id, 0
+	}
+	n, err := strconv.Atoi(id[i+1:])
+	if err != nil {
+		return id, 0
+	}
+	return id[:i], n
+}
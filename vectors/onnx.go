@@ -0,0 +1,206 @@
+package vectors
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Session runs a local sentence-transformer model (e.g. all-MiniLM-L6-v2
+// exported to ONNX) and returns its last hidden state, shaped
+// [batch][tokens][dim]. Keeping the runtime behind this interface lets the
+// package stay free of cgo; an adapter over an ONNX Runtime binding only has to
+// feed input_ids and attention_mask and return the output tensor.
+type Session interface {
+	Run(inputIDs, attentionMask [][]int64) ([][][]float32, error)
+}
+
+// ONNXEmbedder embeds text locally by tokenizing it with a WordPiece
+// vocabulary, running the model session, and mean-pooling the token vectors.
+type ONNXEmbedder struct {
+	Session   Session
+	Vocab     *WordPiece
+	MaxTokens int // truncate inputs to this many tokens including [CLS]/[SEP], default 256
+}
+
+// Embed embeds a single text.
+func (o *ONNXEmbedder) Embed(text string) ([]float32, error) {
+	vecs, err := o.EmbedBatch([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// EmbedBatch runs the model once for all texts, padding them to the longest input.
+func (o *ONNXEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	maxTokens := o.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 256
+	}
+
+	ids := make([][]int64, len(texts))
+	longest := 0
+	for i, text := range texts {
+		ids[i] = o.Vocab.Encode(text, maxTokens)
+		longest = max(longest, len(ids[i]))
+	}
+	mask := make([][]int64, len(texts))
+	for i := range ids {
+		mask[i] = make([]int64, longest)
+		for j := range ids[i] {
+			mask[i][j] = 1
+		}
+		for len(ids[i]) < longest {
+			ids[i] = append(ids[i], o.Vocab.pad)
+		}
+	}
+
+	hidden, err := o.Session.Run(ids, mask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run embedding model: %w", err)
+	}
+	if len(hidden) != len(texts) {
+		return nil, fmt.Errorf("model returned %d outputs for %d inputs", len(hidden), len(texts))
+	}
+
+	out := make([][]float32, len(texts))
+	for i, tokens := range hidden {
+		out[i] = meanPool(tokens, mask[i])
+	}
+	return out, nil
+}
+
+// meanPool averages the token vectors whose mask is set.
+func meanPool(tokens [][]float32, mask []int64) []float32 {
+	if len(tokens) == 0 {
+		return nil
+	}
+	sum := make([]float32, len(tokens[0]))
+	var n float32
+	for t, vec := range tokens {
+		if t < len(mask) && mask[t] == 0 {
+			continue
+		}
+		for d, x := range vec {
+			sum[d] += x
+		}
+		n++
+	}
+	if n > 0 {
+		for d := range sum {
+			sum[d] /= n
+		}
+	}
+	return sum
+}
+
+// WordPiece is the BERT-style subword tokenizer used by most sentence-transformer models.
+type WordPiece struct {
+	vocab              map[string]int64
+	cls, sep, pad, unk int64
+}
+
+// NewWordPiece builds a tokenizer from an ordered token list (the token's position is its id).
+func NewWordPiece(tokens []string) (*WordPiece, error) {
+	wp := &WordPiece{vocab: make(map[string]int64, len(tokens))}
+	for i, tok := range tokens {
+		wp.vocab[tok] = int64(i)
+	}
+	for _, special := range []struct {
+		tok string
+		id  *int64
+	}{{"[CLS]", &wp.cls}, {"[SEP]", &wp.sep}, {"[PAD]", &wp.pad}, {"[UNK]", &wp.unk}} {
+		id, ok := wp.vocab[special.tok]
+		if !ok {
+			return nil, fmt.Errorf("vocabulary is missing %s", special.tok)
+		}
+		*special.id = id
+	}
+	return wp, nil
+}
+
+// LoadWordPiece reads a vocab.txt file with one token per line.
+func LoadWordPiece(path string) (*WordPiece, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		tokens = append(tokens, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWordPiece(tokens)
+}
+
+// Encode returns the token ids for text wrapped in [CLS] ... [SEP], truncated to maxTokens.
+func (wp *WordPiece) Encode(text string, maxTokens int) []int64 {
+	ids := []int64{wp.cls}
+	for _, word := range basicTokens(text) {
+		ids = append(ids, wp.subwords(word)...)
+		if len(ids) >= maxTokens-1 {
+			ids = ids[:maxTokens-1]
+			break
+		}
+	}
+	return append(ids, wp.sep)
+}
+
+// subwords splits word greedily into the longest vocabulary pieces, continuation pieces prefixed with "##".
+func (wp *WordPiece) subwords(word string) []int64 {
+	runes := []rune(word)
+	var ids []int64
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		found := int64(-1)
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if id, ok := wp.vocab[piece]; ok {
+				found = id
+				break
+			}
+		}
+		if found < 0 {
+			return []int64{wp.unk}
+		}
+		ids = append(ids, found)
+		start = end
+	}
+	return ids
+}
+
+// basicTokens lowercases text and splits it on whitespace and punctuation, keeping punctuation as tokens.
+func basicTokens(text string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,111 @@
+package vectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint. Many hosted
+// and self-hosted servers (OpenAI, Azure, Ollama, vLLM, LM Studio) accept this format.
+type OpenAIEmbedder struct {
+	BaseURL    string // e.g. "https://api.openai.com/v1"
+	APIKey     string // sent as a bearer token if non-empty
+	Model      string
+	Dimensions int // optional, for models that support shortened embeddings
+	BatchSize  int // texts per request, default 64
+	Client     *http.Client
+}
+
+type openAIRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed embeds a single text.
+func (o *OpenAIEmbedder) Embed(text string) ([]float32, error) {
+	vecs, err := o.EmbedBatch([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// EmbedBatch embeds texts, splitting them into requests of at most BatchSize inputs.
+func (o *OpenAIEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	size := o.batchSize()
+	out := make([][]float32, 0, len(texts))
+	for i := 0; i < len(texts); i += size {
+		vecs, err := o.request(texts[i:min(i+size, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+// batchSize returns the most texts sent in one request.
+func (o *OpenAIEmbedder) batchSize() int {
+	if o.BatchSize <= 0 {
+		return 64
+	}
+	return o.BatchSize
+}
+
+func (o *OpenAIEmbedder) request(texts []string) ([][]float32, error) {
+	body, err := json.Marshal(openAIRequest{Model: o.Model, Input: texts, Dimensions: o.Dimensions})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(o.BaseURL, "/")+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embedding request failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var r openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
+	}
+	if len(r.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding response has %d vectors for %d inputs", len(r.Data), len(texts))
+	}
+	vecs := make([][]float32, len(texts))
+	for _, d := range r.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("embedding response has out of range index %d", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
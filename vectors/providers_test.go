@@ -0,0 +1,108 @@
+package vectors
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestOpenAIEmbedderBatchesRequests(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp openAIResponse
+		// answer in reverse order to check that results are placed by index
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{i, []float32{float32(len(req.Input[i]))}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	e := &OpenAIEmbedder{BaseURL: srv.URL + "/v1/", APIKey: "secret", Model: "test", BatchSize: 2}
+	vecs, err := EmbedAll(e, []string{"a", "bb", "ccc"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	want := [][]float32{{1}, {2}, {3}}
+	if !reflect.DeepEqual(vecs, want) {
+		t.Errorf("got %v, want %v", vecs, want)
+	}
+
+	e.APIKey = "wrong"
+	if _, err := e.Embed("a"); err == nil {
+		t.Error("expected an error for a rejected request")
+	}
+}
+
+func TestCachedEmbedderSkipsKnownContent(t *testing.T) {
+	calls := 0
+	inner := EmbedderFunc(func(text string) ([]float32, error) {
+		calls++
+		return []float32{float32(len(text))}, nil
+	})
+	c := NewCachedEmbedder(inner)
+
+	if _, err := c.EmbedBatch([]string{"one", "two", "one"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Embed("two"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || c.Len() != 2 {
+		t.Errorf("expected 3 calls and 2 cached vectors, got %d and %d", calls, c.Len())
+	}
+}
+
+type fakeSession struct{}
+
+// Run returns each token id as a one-dimensional vector.
+func (fakeSession) Run(ids, mask [][]int64) ([][][]float32, error) {
+	out := make([][][]float32, len(ids))
+	for i, row := range ids {
+		for _, id := range row {
+			out[i] = append(out[i], []float32{float32(id)})
+		}
+	}
+	return out, nil
+}
+
+func TestONNXEmbedderTokenizesAndPools(t *testing.T) {
+	wp, err := NewWordPiece([]string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "moral", "law", "##s", "!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := wp.Encode("Moral laws!", 16), []int64{2, 4, 5, 6, 7, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode: got %v, want %v", got, want)
+	}
+	if got, want := wp.Encode("moral xyz", 16), []int64{2, 4, 1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode unknown: got %v, want %v", got, want)
+	}
+
+	e := &ONNXEmbedder{Session: fakeSession{}, Vocab: wp}
+	vecs, err := e.EmbedBatch([]string{"law", "moral law"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// padding must not contribute to the mean: (2+5+3)/3 and (2+4+5+3)/4
+	if vecs[0][0] != 10.0/3 || vecs[1][0] != 3.5 {
+		t.Errorf("unexpected pooled vectors %v", vecs)
+	}
+}
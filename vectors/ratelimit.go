@@ -0,0 +1,107 @@
+package vectors
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitedEmbedder spaces out calls to another embedder using a token
+// bucket, so bulk indexing stays under a provider's requests-per-second quota.
+// A batch counts as one request per request the wrapped embedder makes for
+// it: an OpenAIEmbedder's batches are split into requests of its BatchSize,
+// each waiting for its own token, and other embedders' batches count once.
+type RateLimitedEmbedder struct {
+	embedder Embedder
+	interval time.Duration
+	burst    int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// batchSizer is implemented by batch embedders that split batches into
+// requests of at most batchSize texts.
+type batchSizer interface {
+	batchSize() int
+}
+
+// NewRateLimitedEmbedder allows perSecond calls per second to e, with bursts
+// of up to burst calls. A perSecond of 0 or less doesn't limit calls.
+func NewRateLimitedEmbedder(e Embedder, perSecond float64, burst int) *RateLimitedEmbedder {
+	if burst < 1 {
+		burst = 1
+	}
+	var interval time.Duration
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return &RateLimitedEmbedder{
+		embedder: e,
+		interval: interval,
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Embed waits for a token and then calls the wrapped embedder.
+func (r *RateLimitedEmbedder) Embed(text string) ([]float32, error) {
+	r.wait()
+	return r.embedder.Embed(text)
+}
+
+// EmbedBatch waits for a token for each request the batch takes, and embeds
+// the texts of each once it has.
+func (r *RateLimitedEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	if _, ok := r.embedder.(BatchEmbedder); !ok {
+		out := make([][]float32, len(texts))
+		for i, text := range texts {
+			vec, err := r.Embed(text)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = vec
+		}
+		return out, nil
+	}
+	size := len(texts)
+	if bs, ok := r.embedder.(batchSizer); ok {
+		size = bs.batchSize()
+	}
+	out := make([][]float32, 0, len(texts))
+	for i := 0; i < len(texts); i += size {
+		r.wait()
+		vecs, err := EmbedAll(r.embedder, texts[i:min(i+size, len(texts))], 0)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+// wait blocks until a token is available and takes it, or returns at once
+// if calls aren't limited.
+func (r *RateLimitedEmbedder) wait() {
+	if r.interval <= 0 {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	r.tokens += float64(now.Sub(r.last)) / float64(r.interval)
+	if r.tokens > float64(r.burst) {
+		r.tokens = float64(r.burst)
+	}
+	r.last = now
+	r.tokens--
+	var delay time.Duration
+	if r.tokens < 0 {
+		delay = time.Duration(-r.tokens * float64(r.interval))
+	}
+	r.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
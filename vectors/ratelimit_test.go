@@ -0,0 +1,60 @@
+package vectors
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedEmbedderChargesEachRequest(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp openAIResponse
+		for i := range req.Input {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{i, []float32{1}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	// a token an hour, so none comes back during the test
+	r := NewRateLimitedEmbedder(&OpenAIEmbedder{BaseURL: srv.URL, BatchSize: 2}, 1.0/3600, 3)
+	vecs, err := r.EmbedBatch([]string{"a", "b", "c", "d", "e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs) != 5 || requests != 3 {
+		t.Fatalf("expected 5 vectors from 3 requests, got %d from %d", len(vecs), requests)
+	}
+	if math.Abs(r.tokens) > 0.01 {
+		t.Errorf("expected a token taken per request, %v of 3 left", r.tokens)
+	}
+}
+
+func TestRateLimitedEmbedderUnlimited(t *testing.T) {
+	inner := EmbedderFunc(func(text string) ([]float32, error) { return []float32{1}, nil })
+	for _, perSecond := range []float64{0, -1} {
+		r := NewRateLimitedEmbedder(inner, perSecond, 1)
+		start := time.Now()
+		for i := 0; i < 100; i++ {
+			if _, err := r.Embed("a"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("perSecond %v: expected no waiting, took %v", perSecond, elapsed)
+		}
+	}
+}